@@ -0,0 +1,100 @@
+package cli
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/go-playground/validator/v10"
+
+	"github.com/chucky-1/finance/internal/config"
+	"github.com/chucky-1/finance/internal/consumer"
+	"github.com/chucky-1/finance/internal/messenger"
+	"github.com/chucky-1/finance/internal/producer"
+)
+
+var chatHelp = `Чат с ботом в терминале. Бот работает в режиме одного бота с локальными Postgres и Mongo.
+Кнопки можно нажимать их номерами. Что бы получать отчёты, подпишитесь командой /subscribe daily или /subscribe monthly.
+Отчёты, подписки и симулированные часы хранятся только в памяти чата, отчёты получают только пользователи, вошедшие в чате.
+Их дневные расходы после отчёта удаляются, как и в сервисе.
+
+Команды симулированных часов:
+  :time          показать время
+  :skip <время>  перевести часы, например :skip 2h30m
+  :midnight      перевести часы на сутки, полночь наступит во всех часовых поясах
+  :month         перевести часы на начало следующего месяца во всех часовых поясах
+  :help          эта справка
+  :quit          выйти`
+
+// chat runs the whole pipeline of the bot in the terminal, so flows can be tried without telegram.
+// Reports are triggered by a simulated clock instead of the real one, they are kept in memory with the schedule
+// and subscriptions, and only users who sign in in the chat get them
+func chat(ctx context.Context, cfg *config.Config) error {
+	services, closeConnections, err := connectWith(ctx, cfg, cfg.MigrateOnStart, newMemoryReports)
+	if err != nil {
+		return err
+	}
+	defer closeConnections()
+
+	terminal := messenger.NewTerminal(os.Stdout)
+	hub := consumer.NewHub(terminal, terminal.Messages(), validator.New(), services.auth, services.recorder, services.reporter,
+		services.subscription, services.apiToken, services.session, services.settings, services.ledger, "", "", true, cfg.AccountMode == config.TelegramAccountMode)
+	go hub.Consume(ctx)
+	reporterProducer := producer.NewReporter(terminal, terminal, nil, nil, services.reporter, services.outbox, services.subscription)
+
+	clock := time.Now().UTC()
+	reporterProducer.Tick(ctx, clock)
+	fmt.Println(chatHelp)
+
+	scanner := bufio.NewScanner(os.Stdin)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+		if !strings.HasPrefix(line, ":") {
+			terminal.Write(line)
+			continue
+		}
+
+		command, arg, _ := strings.Cut(line, " ")
+		switch command {
+		case ":time":
+			fmt.Printf("сейчас %s UTC\n", clock.Format(time.DateTime))
+			continue
+		case ":skip":
+			duration, err := time.ParseDuration(arg)
+			if err != nil || duration <= 0 {
+				fmt.Println("укажите положительную длительность, например :skip 2h30m")
+				continue
+			}
+			clock = clock.Add(duration)
+		case ":midnight":
+			clock = clock.Add(24 * time.Hour)
+		case ":month":
+			clock = nextMonthEverywhere(clock)
+		case ":help":
+			fmt.Println(chatHelp)
+			continue
+		case ":quit":
+			return nil
+		default:
+			fmt.Println("неизвестная команда, :help покажет справку")
+			continue
+		}
+		fmt.Printf("часы переведены на %s UTC\n", clock.Format(time.DateTime))
+		reporterProducer.Tick(ctx, clock)
+	}
+	if err = scanner.Err(); err != nil {
+		return fmt.Errorf("chat couldn't read terminal: %v", err)
+	}
+	return nil
+}
+
+// nextMonthEverywhere returns the time when the next month has started in every timezone from -12 to +14
+func nextMonthEverywhere(timeUTC time.Time) time.Time {
+	return time.Date(timeUTC.Year(), timeUTC.Month()+1, 1, 12, 0, 0, 0, time.UTC)
+}
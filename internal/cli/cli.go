@@ -0,0 +1,86 @@
+package cli
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/caarlos0/env/v8"
+	"github.com/sirupsen/logrus"
+
+	"github.com/chucky-1/finance/internal/config"
+	"github.com/chucky-1/finance/internal/logging"
+)
+
+const usage = `Usage: finance [command] [arguments]
+
+Commands:
+  serve                               run the bots and the http server, it's the default command
+  chat                                talk to the bot in the terminal with a simulated clock
+  migrate [--status]                  apply pending migrations of postgres and mongo, they're embedded in the binary
+  user list                           list users
+  user show <username>                show the user with subscriptions, api tokens and sessions
+  user delete <username>              delete the user with all expenses
+  user reset-password <username>      set a new random password and print it
+  user unlock <username>              unlock the account locked after failed logins
+  report send --user <username> --period <2006-01-02|2006-01>
+                                      put the report of the ended day or month into the outbox
+  export [--user <username>] [--output <file>]
+                                      write entries as json lines with entries of ledgers the users own,
+                                      all users by default
+  import [--input <file>]             add entries written by export to existing users and ledgers,
+                                      the same file imported twice doubles them
+
+The configuration is read from the environment like the service does.
+`
+
+// Run executes the command from the arguments without the name of the program
+func Run(args []string) error {
+	command := "serve"
+	if len(args) > 0 {
+		command, args = args[0], args[1:]
+	}
+	if command == "help" || command == "-h" || command == "--help" {
+		fmt.Print(usage)
+		return nil
+	}
+
+	cfg := config.Config{}
+	if err := env.Parse(&cfg); err != nil {
+		return fmt.Errorf("couldn't parse config: %v", err)
+	}
+	logrus.SetLevel(logrus.Level(cfg.LogLevel))
+	logrus.SetFormatter(logging.NewRedactor(&logrus.TextFormatter{}))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	switch command {
+	case "serve":
+		return serve(ctx, &cfg)
+	case "chat":
+		return chat(ctx, &cfg)
+	case "migrate":
+		return migrate(ctx, &cfg, args)
+	case "user":
+		return user(ctx, &cfg, args)
+	case "report":
+		return report(ctx, &cfg, args)
+	case "export":
+		return export(ctx, &cfg, args)
+	case "import":
+		return importEntries(ctx, &cfg, args)
+	}
+	fmt.Fprint(os.Stderr, usage)
+	return fmt.Errorf("unknown command %q", command)
+}
+
+// newFlagSet returns flags of the command which print the usage of all commands on errors
+func newFlagSet(name string) *flag.FlagSet {
+	flags := flag.NewFlagSet(name, flag.ContinueOnError)
+	flags.Usage = func() {
+		fmt.Fprint(flags.Output(), usage)
+	}
+	return flags
+}
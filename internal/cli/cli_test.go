@@ -0,0 +1,204 @@
+package cli
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/chucky-1/finance/internal/model"
+	"github.com/chucky-1/finance/internal/repository"
+	"github.com/chucky-1/finance/internal/service"
+)
+
+func TestRun_UnknownCommand(t *testing.T) {
+	require.EqualError(t, Run([]string{"unknown"}), `unknown command "unknown"`)
+	require.NoError(t, Run([]string{"help"}))
+}
+
+func TestParsePeriod(t *testing.T) {
+	testTable := []struct {
+		name      string
+		periodKey string
+		// timezone is Europe/Minsk by default
+		timezone   string
+		monthStart int
+		period     string
+		key        string
+		from       time.Time
+		to         time.Time
+	}{
+		{
+			name:      "Day",
+			periodKey: "2023-06-28",
+			period:    service.DailyReport,
+			key:       "2023-06-28",
+			from:      time.Date(2023, 6, 27, 21, 0, 0, 0, time.UTC),
+			to:        time.Date(2023, 6, 28, 21, 0, 0, 0, time.UTC),
+		},
+		{
+			name:      "Month",
+			periodKey: "2023-12",
+			period:    service.MonthlyReport,
+			key:       "2023-12",
+			from:      time.Date(2023, 11, 30, 21, 0, 0, 0, time.UTC),
+			to:        time.Date(2023, 12, 31, 21, 0, 0, 0, time.UTC),
+		},
+		{
+			name:      "Month with the daylight saving time change",
+			periodKey: "2023-03",
+			timezone:  "Europe/Warsaw",
+			period:    service.MonthlyReport,
+			key:       "2023-03",
+			from:      time.Date(2023, 2, 28, 23, 0, 0, 0, time.UTC),
+			to:        time.Date(2023, 3, 31, 22, 0, 0, 0, time.UTC),
+		},
+		{
+			name:       "Financial month",
+			periodKey:  "2023-12",
+			monthStart: 10,
+			period:     service.MonthlyReport,
+			key:        "2023-12-10",
+			from:       time.Date(2023, 12, 9, 21, 0, 0, 0, time.UTC),
+			to:         time.Date(2024, 1, 9, 21, 0, 0, 0, time.UTC),
+		},
+		{
+			name:       "Day when months begin on another day",
+			periodKey:  "2023-12-10",
+			monthStart: 10,
+			period:     service.DailyReport,
+			key:        "2023-12-10",
+			from:       time.Date(2023, 12, 9, 21, 0, 0, 0, time.UTC),
+			to:         time.Date(2023, 12, 10, 21, 0, 0, 0, time.UTC),
+		},
+	}
+
+	minsk, err := service.LoadLocation("Europe/Minsk")
+	require.NoError(t, err)
+	for _, testCase := range testTable {
+		t.Run(testCase.name, func(t *testing.T) {
+			timezone := minsk
+			if testCase.timezone != "" {
+				timezone, err = service.LoadLocation(testCase.timezone)
+				require.NoError(t, err)
+			}
+			period, key, from, to, err := parsePeriod(testCase.periodKey, timezone, testCase.monthStart)
+			require.NoError(t, err)
+			require.Equal(t, testCase.period, period)
+			require.Equal(t, testCase.key, key)
+			require.Equal(t, testCase.from, from)
+			require.Equal(t, testCase.to, to)
+		})
+	}
+
+	_, _, _, _, err = parsePeriod("28.06.2023", minsk, 0)
+	require.Error(t, err)
+}
+
+func TestCheckEnded(t *testing.T) {
+	minsk, err := service.LoadLocation("Europe/Minsk")
+	require.NoError(t, err)
+	// 2023-06-28 23:30 in Minsk
+	now := time.Date(2023, 6, 28, 20, 30, 0, 0, time.UTC)
+
+	period, key, _, to, err := parsePeriod("2023-06-27", minsk, 0)
+	require.NoError(t, err)
+	require.NoError(t, checkEnded(period, key, to, now))
+
+	period, key, _, to, err = parsePeriod("2023-06-28", minsk, 0)
+	require.NoError(t, err)
+	require.EqualError(t, checkEnded(period, key, to, now), "day 2023-06-28 hasn't ended yet, its report is sent by the schedule")
+
+	period, key, _, to, err = parsePeriod("2023-05", minsk, 0)
+	require.NoError(t, err)
+	require.NoError(t, checkEnded(period, key, to, now))
+
+	// the financial month from June 10 ends on July 10
+	period, key, _, to, err = parsePeriod("2023-06", minsk, 10)
+	require.NoError(t, err)
+	require.EqualError(t, checkEnded(period, key, to, now), "month 2023-06-10 hasn't ended yet, its report is sent by the schedule")
+	period, key, _, to, err = parsePeriod("2023-05", minsk, 10)
+	require.NoError(t, err)
+	require.NoError(t, checkEnded(period, key, to, now))
+}
+
+func TestParseEntryLine(t *testing.T) {
+	entry, ledgerID, err := parseEntryLine([]byte(`{"user":"dima","date":"2023-06-28T23:30:00+03:00","category":"Кофе","amount":3.5}`))
+	require.NoError(t, err)
+	require.Zero(t, ledgerID)
+	require.Equal(t, &model.Entry{
+		Kind:     expenses,
+		User:     "dima",
+		Date:     time.Date(2023, 6, 28, 20, 30, 0, 0, time.UTC),
+		Category: &model.Category{Name: "Кофе", Amount: 3.5},
+	}, entry)
+
+	entry, ledgerID, err = parseEntryLine([]byte(`{"ledger":3,"member":"anna","date":"2023-06-28T20:30:00Z","category":"Еда","amount":12}`))
+	require.NoError(t, err)
+	require.Equal(t, int64(3), ledgerID)
+	require.Equal(t, &model.Entry{
+		Kind:     expenses,
+		Member:   "anna",
+		Date:     time.Date(2023, 6, 28, 20, 30, 0, 0, time.UTC),
+		Category: &model.Category{Name: "Еда", Amount: 12},
+	}, entry)
+
+	for _, line := range []string{
+		`{"user":"dima","amount":3.5}`,
+		`Кофе 3.5`,
+		`{"ledger":3,"date":"2023-06-28T20:30:00Z","category":"Еда","amount":12}`,
+		`{"user":"dima","ledger":3,"member":"anna","date":"2023-06-28T20:30:00Z","category":"Еда","amount":12}`,
+	} {
+		_, _, err = parseEntryLine([]byte(line))
+		require.Errorf(t, err, line)
+	}
+}
+
+func TestFormatTimezone(t *testing.T) {
+	summer, winter := time.Date(2023, 7, 1, 0, 0, 0, 0, time.UTC), time.Date(2023, 1, 1, 0, 0, 0, 0, time.UTC)
+	require.Equal(t, "Europe/Minsk (GMT+3)", formatTimezone("Europe/Minsk", winter))
+	require.Equal(t, "America/St_Johns (GMT-2:30)", formatTimezone("America/St_Johns", summer))
+	require.Equal(t, "America/St_Johns (GMT-3:30)", formatTimezone("America/St_Johns", winter))
+	require.Equal(t, "UTC (GMT+0)", formatTimezone("UTC", summer))
+	require.Equal(t, "GMT+3 (unknown)", formatTimezone("GMT+3", summer))
+}
+
+func TestMemoryOutbox(t *testing.T) {
+	ctx := context.Background()
+	now := time.Date(2023, 6, 29, 5, 0, 0, 0, time.UTC)
+	outbox := service.NewOutbox(newMemoryOutbox(), 1)
+
+	require.NoError(t, outbox.Enqueue(ctx, "dima", service.DailyReport, "2023-06-28", "report", now))
+	require.Equal(t, repository.ReportAlreadyIssuedErr, outbox.Enqueue(ctx, "dima", service.DailyReport, "2023-06-28", "report", now))
+	require.NoError(t, outbox.Enqueue(ctx, "dima", service.DailyReport, "2023-06-29", "report", now.Add(time.Hour)))
+
+	due, err := outbox.Due(ctx, now)
+	require.NoError(t, err)
+	require.Len(t, due, 1)
+	require.Equal(t, "2023-06-28", due[0].PeriodKey)
+
+	// one attempt is allowed, so the report is dead after the failure
+	require.NoError(t, outbox.Failed(ctx, due[0], errors.New("chat is closed"), now))
+	dead, err := outbox.DeadLetters(ctx)
+	require.NoError(t, err)
+	require.Len(t, dead, 1)
+	require.Equal(t, now, *dead[0].LastAttemptAt)
+	require.NoError(t, outbox.Replay(ctx, dead[0].ID))
+	require.Equal(t, repository.ReportNotFoundErr, outbox.Replay(ctx, dead[0].ID))
+
+	due, err = outbox.Due(ctx, time.Now().UTC())
+	require.NoError(t, err)
+	require.Len(t, due, 2)
+	require.NoError(t, outbox.Delivered(ctx, due[0], now))
+	due, err = outbox.Due(ctx, time.Now().UTC())
+	require.NoError(t, err)
+	require.Len(t, due, 1)
+
+	require.NoError(t, outbox.Skipped(ctx, due[0], errors.New("user didn't subscribe on reports")))
+	require.Equal(t, repository.ReportNotFoundErr, outbox.Skipped(ctx, due[0], errors.New("user didn't subscribe on reports")))
+	due, err = outbox.Due(ctx, time.Now().UTC())
+	require.NoError(t, err)
+	require.Empty(t, due)
+}
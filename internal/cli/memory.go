@@ -0,0 +1,230 @@
+package cli
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/chucky-1/finance/internal/model"
+	"github.com/chucky-1/finance/internal/repository"
+)
+
+// memoryScheduler keeps last ticks of the simulated clock, so they never get into the scheduler of the running service
+type memoryScheduler struct {
+	mu    sync.Mutex
+	ticks map[string]time.Time
+}
+
+func newMemoryScheduler() *memoryScheduler {
+	return &memoryScheduler{
+		ticks: make(map[string]time.Time),
+	}
+}
+
+func (s *memoryScheduler) GetLastTick(_ context.Context, name string) (time.Time, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.ticks[name], nil
+}
+
+func (s *memoryScheduler) SetLastTick(_ context.Context, name string, tick time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.ticks[name] = tick
+	return nil
+}
+
+// memoryOutbox is the outbox and the issued reports of the terminal chat, reports of simulated periods stay in it
+type memoryOutbox struct {
+	mu      sync.Mutex
+	reports []*model.Report
+	// key: username/period/key of the report
+	issued map[string]bool
+}
+
+func newMemoryOutbox() *memoryOutbox {
+	return &memoryOutbox{
+		issued: make(map[string]bool),
+	}
+}
+
+func (o *memoryOutbox) Add(_ context.Context, report *model.Report) error {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	key := report.Username + "/" + report.Period + "/" + report.PeriodKey
+	if o.issued[key] {
+		return repository.ReportAlreadyIssuedErr
+	}
+	o.issued[key] = true
+	report.ID = int64(len(o.reports) + 1)
+	report.Status = model.ReportPending
+	report.CreatedAt = time.Now().UTC()
+	stored := *report
+	o.reports = append(o.reports, &stored)
+	return nil
+}
+
+func (o *memoryOutbox) IsIssued(_ context.Context, username, period, periodKey string) (bool, error) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	return o.issued[username+"/"+period+"/"+periodKey], nil
+}
+
+func (o *memoryOutbox) GetDue(_ context.Context, now time.Time, limit int) ([]*model.Report, error) {
+	reports := o.find(func(report *model.Report) bool {
+		return report.Status == model.ReportPending && !report.NextAttemptAt.After(now)
+	}, limit)
+	sort.SliceStable(reports, func(i, j int) bool {
+		return reports[i].NextAttemptAt.Before(reports[j].NextAttemptAt)
+	})
+	return reports, nil
+}
+
+func (o *memoryOutbox) GetDead(_ context.Context, limit int) ([]*model.Report, error) {
+	return o.find(func(report *model.Report) bool {
+		return report.Status == model.ReportDead
+	}, limit), nil
+}
+
+func (o *memoryOutbox) MarkDelivered(_ context.Context, id int64, deliveredAt time.Time) error {
+	return o.update(id, func(report *model.Report) {
+		report.Status = model.ReportDelivered
+		report.Attempts++
+		report.LastError = ""
+		report.LastAttemptAt = &deliveredAt
+		report.DeliveredAt = &deliveredAt
+	})
+}
+
+func (o *memoryOutbox) MarkFailed(_ context.Context, id int64, lastError string, attemptAt, nextAttemptAt time.Time, dead bool) error {
+	return o.update(id, func(report *model.Report) {
+		report.Status = model.ReportPending
+		if dead {
+			report.Status = model.ReportDead
+		}
+		report.Attempts++
+		report.LastError = lastError
+		report.LastAttemptAt = &attemptAt
+		report.NextAttemptAt = nextAttemptAt
+	})
+}
+
+func (o *memoryOutbox) MarkSkipped(_ context.Context, id int64, reason string) error {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	if id < 1 || id > int64(len(o.reports)) || o.reports[id-1].Status != model.ReportPending {
+		return repository.ReportNotFoundErr
+	}
+	report := o.reports[id-1]
+	report.Status = model.ReportSkipped
+	report.LastError = reason
+	return nil
+}
+
+func (o *memoryOutbox) Replay(_ context.Context, id int64, now time.Time) error {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	if id < 1 || id > int64(len(o.reports)) || o.reports[id-1].Status != model.ReportDead {
+		return repository.ReportNotFoundErr
+	}
+	report := o.reports[id-1]
+	report.Status = model.ReportPending
+	report.Attempts = 0
+	report.NextAttemptAt = now
+	return nil
+}
+
+// find returns copies of the reports, so the producer doesn't change the outbox by them
+func (o *memoryOutbox) find(match func(report *model.Report) bool, limit int) []*model.Report {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	reports := make([]*model.Report, 0)
+	for _, report := range o.reports {
+		if len(reports) == limit {
+			break
+		}
+		if match(report) {
+			found := *report
+			reports = append(reports, &found)
+		}
+	}
+	return reports
+}
+
+func (o *memoryOutbox) update(id int64, change func(report *model.Report)) error {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	if id < 1 || id > int64(len(o.reports)) {
+		return repository.ReportNotFoundErr
+	}
+	change(o.reports[id-1])
+	return nil
+}
+
+// memorySubscriptions binds reports to the terminal chat, real subscriptions of users keep their telegram chats
+type memorySubscriptions struct {
+	mu sync.Mutex
+	// key: username/period
+	subscriptions map[string]*model.Subscription
+	// key: nonce
+	tokens map[string]*memoryToken
+}
+
+type memoryToken struct {
+	username  string
+	period    string
+	expiresAt time.Time
+	used      bool
+}
+
+func newMemorySubscriptions() *memorySubscriptions {
+	return &memorySubscriptions{
+		subscriptions: make(map[string]*model.Subscription),
+		tokens:        make(map[string]*memoryToken),
+	}
+}
+
+func (s *memorySubscriptions) Set(_ context.Context, subscription *model.Subscription) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	stored := *subscription
+	s.subscriptions[subscription.Username+"/"+subscription.Period] = &stored
+	return nil
+}
+
+func (s *memorySubscriptions) Get(_ context.Context, username, period string) (*model.Subscription, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	subscription, ok := s.subscriptions[username+"/"+period]
+	if !ok {
+		return nil, nil
+	}
+	found := *subscription
+	return &found, nil
+}
+
+func (s *memorySubscriptions) Delete(_ context.Context, username, period string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.subscriptions, username+"/"+period)
+	return nil
+}
+
+func (s *memorySubscriptions) Add(_ context.Context, nonce, username, period string, expiresAt time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.tokens[nonce] = &memoryToken{username: username, period: period, expiresAt: expiresAt}
+	return nil
+}
+
+func (s *memorySubscriptions) Use(_ context.Context, nonce, period string, now time.Time) (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	token, ok := s.tokens[nonce]
+	if !ok || token.used || token.period != period || !token.expiresAt.After(now) {
+		return "", nil
+	}
+	token.used = true
+	return token.username, nil
+}
@@ -0,0 +1,72 @@
+package cli
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	"github.com/jackc/pgx/v4/pgxpool"
+	"github.com/sirupsen/logrus"
+	"go.mongodb.org/mongo-driver/mongo"
+
+	"github.com/chucky-1/finance/internal/config"
+	"github.com/chucky-1/finance/internal/migration"
+	"github.com/chucky-1/finance/migrations"
+)
+
+// migrate applies pending migrations of postgres and mongo or shows their status
+func migrate(ctx context.Context, cfg *config.Config, args []string) error {
+	flags := newFlagSet("migrate")
+	status := flags.Bool("status", false, "show applied and pending migrations without applying them")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	conn, client, closeConnections, err := openDatabases(ctx, cfg)
+	if err != nil {
+		return err
+	}
+	defer closeConnections()
+
+	if !*status {
+		return applyMigrations(ctx, conn, client)
+	}
+	postgresStatus, err := migration.NewPostgres(conn, migrations.Postgres).Status(ctx)
+	if err != nil {
+		return err
+	}
+	mongoStatus, err := migration.NewMongo(client, migrations.Mongo).Status(ctx)
+	if err != nil {
+		return err
+	}
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "DATABASE\tVERSION\tDESCRIPTION\tAPPLIED")
+	printStatus(w, "postgres", postgresStatus)
+	printStatus(w, "mongo", mongoStatus)
+	return w.Flush()
+}
+
+func applyMigrations(ctx context.Context, conn *pgxpool.Pool, client *mongo.Client) error {
+	applied, err := migration.NewPostgres(conn, migrations.Postgres).Migrate(ctx)
+	if err != nil {
+		return fmt.Errorf("couldn't migrate postgres: %v", err)
+	}
+	appliedMongo, err := migration.NewMongo(client, migrations.Mongo).Migrate(ctx)
+	if err != nil {
+		return fmt.Errorf("couldn't migrate mongo: %v", err)
+	}
+	logrus.Infof("applied %d postgres and %d mongo migrations", len(applied), len(appliedMongo))
+	return nil
+}
+
+func printStatus(w *tabwriter.Writer, database string, statuses []*migration.Status) {
+	for _, status := range statuses {
+		applied := "pending"
+		if status.AppliedAt != nil {
+			applied = status.AppliedAt.UTC().Format(time.DateTime)
+		}
+		fmt.Fprintf(w, "%s\t%d\t%s\t%s\n", database, status.Version, status.Description, applied)
+	}
+}
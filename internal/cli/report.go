@@ -0,0 +1,102 @@
+package cli
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/chucky-1/finance/internal/config"
+	"github.com/chucky-1/finance/internal/i18n"
+	"github.com/chucky-1/finance/internal/producer"
+	"github.com/chucky-1/finance/internal/repository"
+	"github.com/chucky-1/finance/internal/service"
+)
+
+const dayLayout = "2006-01-02"
+
+// report sends the report of the user for the ended day or month.
+// It's put into the outbox, so the running service delivers it like scheduled reports
+func report(ctx context.Context, cfg *config.Config, args []string) error {
+	if len(args) == 0 || args[0] != "send" {
+		return errors.New("report needs the subcommand send")
+	}
+	flags := newFlagSet("report send")
+	username := flags.String("user", "", "username")
+	periodKey := flags.String("period", "", "the day like 2023-06-28 or the month like 2023-06, "+
+		"it begins on the month start day of the user")
+	if err := flags.Parse(args[1:]); err != nil {
+		return err
+	}
+	if *username == "" || *periodKey == "" {
+		return errors.New("report send needs --user and --period")
+	}
+
+	services, closeConnections, err := connect(ctx, cfg, false)
+	if err != nil {
+		return err
+	}
+	defer closeConnections()
+
+	u, err := services.users.Get(ctx, *username)
+	if err != nil {
+		return err
+	}
+	if u == nil {
+		return service.UserNotFoundErr
+	}
+	timezone, err := service.LoadLocation(u.Timezone)
+	if err != nil {
+		return err
+	}
+	period, key, from, to, err := parsePeriod(*periodKey, timezone, u.MonthStart)
+	if err != nil {
+		return err
+	}
+	if err = checkEnded(period, key, to, time.Now().UTC()); err != nil {
+		return err
+	}
+	if _, ok, err := services.subscription.ChatID(ctx, u.Username, period); err != nil {
+		return err
+	} else if !ok {
+		return fmt.Errorf("%s isn't subscribed on %s reports, there is no chat to deliver to", u.Username, period)
+	}
+
+	categories, err := services.reporter.Report(ctx, u.Username, from, to)
+	if err != nil {
+		return err
+	}
+	err = services.outbox.Enqueue(ctx, u.Username, period, key, producer.ReportText(key, period, u.MonthStart, i18n.Language(u.Language), categories),
+		time.Now().UTC())
+	if err == repository.ReportAlreadyIssuedErr {
+		return fmt.Errorf("%s report %s of %s has already been issued, replay it via the admin api if it isn't delivered",
+			period, key, u.Username)
+	}
+	if err != nil {
+		return err
+	}
+	fmt.Printf("%s report %s of %s is in the outbox\n", period, key, u.Username)
+	return nil
+}
+
+// parsePeriod returns the period of the report by its key, the key which scheduled reports of the period have
+// and the range of the period in UTC, the month is the financial month which begins on the month start day
+func parsePeriod(periodKey string, timezone *time.Location, monthStart int) (string, string, time.Time, time.Time, error) {
+	if day, err := time.ParseInLocation(dayLayout, periodKey, timezone); err == nil {
+		return service.DailyReport, periodKey, day.UTC(), day.AddDate(0, 0, 1).UTC(), nil
+	}
+	if from, to, err := service.MonthRange(periodKey, timezone, monthStart); err == nil {
+		return service.MonthlyReport, service.MonthKey(from, timezone, monthStart), from, to, nil
+	}
+	return "", "", time.Time{}, time.Time{}, fmt.Errorf("period must be a day like 2023-06-28 or a month like 2023-06, not %q",
+		periodKey)
+}
+
+// checkEnded returns an error if the period hasn't ended by now. The report would be issued instead of the scheduled one,
+// so expenses added after it would never be reported
+func checkEnded(period, key string, to, now time.Time) error {
+	if to.After(now) {
+		return fmt.Errorf("%s %s hasn't ended yet, its report is sent by the schedule", period, key)
+	}
+	return nil
+}
@@ -0,0 +1,138 @@
+package cli
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/go-playground/validator/v10"
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"github.com/sirupsen/logrus"
+
+	"github.com/chucky-1/finance/internal/config"
+	"github.com/chucky-1/finance/internal/consumer"
+	"github.com/chucky-1/finance/internal/handler"
+	"github.com/chucky-1/finance/internal/messenger"
+	"github.com/chucky-1/finance/internal/producer"
+)
+
+// serve runs the bots and the http server until SIGTERM or interrupt
+func serve(ctx context.Context, cfg *config.Config) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	if cfg.TGUpdatesMode == config.WebhookUpdatesMode && (cfg.TGWebhookURL == "" || cfg.TGWebhookSecret == "") {
+		return errors.New("TG_WEBHOOK_URL and TG_WEBHOOK_SECRET are required in the webhook mode")
+	}
+	singleBot := cfg.TGMode == config.SingleBotMode
+	if !singleBot && cfg.SubscriptionSecret == "" {
+		return errors.New("SUBSCRIPTION_SECRET is required when reports are delivered by reporter bots")
+	}
+
+	services, closeConnections, err := connect(ctx, cfg, cfg.MigrateOnStart)
+	if err != nil {
+		return err
+	}
+	defer closeConnections()
+
+	mux := http.NewServeMux()
+
+	mainBot, err := tgbotapi.NewBotAPI(cfg.TGMainBotToken)
+	if err != nil {
+		return err
+	}
+	//bot.Debug = true
+	mainMessenger := messenger.NewTelegram(mainBot)
+	mainUpdates, err := updatesChannel(mainBot, cfg.TGMainTimeout, cfg, mux)
+	if err != nil {
+		return err
+	}
+	mainMessages := mainMessenger.Listen(ctx, mainUpdates)
+
+	hub := consumer.NewHub(mainMessenger, mainMessages, validator.New(), services.auth, services.recorder, services.reporter,
+		services.subscription, services.apiToken, services.session, services.settings, services.ledger, cfg.TGNameDailyReporterBot,
+		cfg.TGNameMonthlyReporterBot, singleBot, cfg.AccountMode == config.TelegramAccountMode)
+	go hub.Consume(ctx)
+
+	// in the single bot mode the main bot delivers reports and there are no subscription messages
+	var dailyReporter, monthlyReporter messenger.Sender = mainMessenger, mainMessenger
+	var dailyMessages, monthlyMessages <-chan *messenger.Message
+	if !singleBot {
+		dailyReporterBot, err := tgbotapi.NewBotAPI(cfg.TGDailyReporterBotToken)
+		if err != nil {
+			return err
+		}
+		dailyMessenger := messenger.NewTelegram(dailyReporterBot)
+		dailyUpdates, err := updatesChannel(dailyReporterBot, cfg.TGDailyTimeout, cfg, mux)
+		if err != nil {
+			return err
+		}
+		dailyReporter = dailyMessenger
+		dailyMessages = dailyMessenger.Listen(ctx, dailyUpdates)
+
+		monthlyReporterBot, err := tgbotapi.NewBotAPI(cfg.TGMonthlyReporterBotToken)
+		if err != nil {
+			return err
+		}
+		monthlyMessenger := messenger.NewTelegram(monthlyReporterBot)
+		monthlyUpdates, err := updatesChannel(monthlyReporterBot, cfg.TGMonthlyTimeout, cfg, mux)
+		if err != nil {
+			return err
+		}
+		monthlyReporter = monthlyMessenger
+		monthlyMessages = monthlyMessenger.Listen(ctx, monthlyUpdates)
+	}
+
+	reporterProducer := producer.NewReporter(dailyReporter, monthlyReporter, dailyMessages, monthlyMessages,
+		services.reporter, services.outbox, services.subscription)
+	go reporterProducer.Produce(ctx)
+
+	// http server to check health
+	mux.HandleFunc("/", func(writer http.ResponseWriter, request *http.Request) {
+		if _, err := io.WriteString(writer, ""); err != nil {
+			logrus.Errorf("couldn't write response: %v", err)
+		}
+	})
+	handler.NewAdmin(services.outbox, cfg.AdminToken).Register(mux)
+	handler.NewAPI(services.apiToken, services.recorder, services.reporter).Register(mux)
+	go func() {
+		if err := http.ListenAndServe(":8080", mux); err != nil {
+			logrus.Fatalf("couldn't listen and serve: %v", err)
+		}
+	}()
+
+	logrus.Infof("app has started")
+
+	quit := make(chan os.Signal, 1)
+	signal.Notify(quit, syscall.SIGTERM, os.Interrupt)
+	<-quit
+	cancel()
+	<-time.After(2 * time.Second)
+	return nil
+}
+
+// updatesChannel returns updates of the bot received via webhook on the http server or via long polling
+func updatesChannel(bot *tgbotapi.BotAPI, timeout int, cfg *config.Config, mux *http.ServeMux) (tgbotapi.UpdatesChannel, error) {
+	if cfg.TGUpdatesMode == config.WebhookUpdatesMode {
+		webhook := handler.NewTelegram(bot, cfg.TGWebhookSecret)
+		webhook.Register(mux)
+		if err := webhook.SetWebhook(cfg.TGWebhookURL); err != nil {
+			return nil, err
+		}
+		return webhook.Updates(), nil
+	}
+
+	// telegram doesn't give updates via long polling while a webhook is set
+	if _, err := bot.Request(tgbotapi.DeleteWebhookConfig{}); err != nil {
+		return nil, fmt.Errorf("couldn't delete webhook for %s: %v", bot.Self.UserName, err)
+	}
+	u := tgbotapi.NewUpdate(0)
+	u.Timeout = timeout
+	return bot.GetUpdatesChan(u), nil
+}
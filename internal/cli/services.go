@@ -0,0 +1,170 @@
+package cli
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/jackc/pgx/v4/pgxpool"
+	"github.com/sirupsen/logrus"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+
+	"github.com/chucky-1/finance/internal/config"
+	"github.com/chucky-1/finance/internal/i18n"
+	"github.com/chucky-1/finance/internal/repository"
+	"github.com/chucky-1/finance/internal/service"
+)
+
+type services struct {
+	users        *repository.Postgres
+	auth         *service.Auth
+	recorder     *service.Recorder
+	reporter     *service.Reporter
+	outbox       *service.Outbox
+	subscription *service.Subscription
+	apiToken     *service.APIToken
+	session      *service.Session
+	settings     *service.Settings
+	ledger       *service.Ledger
+}
+
+// reportRepositories keep the schedule, the outbox and the subscriptions of reports
+type reportRepositories struct {
+	scheduler     repository.Scheduler
+	outbox        repository.Outbox
+	issued        repository.Issued
+	subscriptions repository.Subscription
+	tokens        repository.SubscriptionToken
+	// scheduleUsers plans reports of all users on start, otherwise only users who sign in are planned
+	scheduleUsers bool
+}
+
+func newPostgresReports(conn *pgxpool.Pool) *reportRepositories {
+	reportRepository := repository.NewReportPostgres(conn)
+	return &reportRepositories{
+		scheduler:     repository.NewSchedulerPostgres(conn),
+		outbox:        reportRepository,
+		issued:        reportRepository,
+		subscriptions: repository.NewSubscriptionPostgres(conn),
+		tokens:        repository.NewSubscriptionTokenPostgres(conn),
+		scheduleUsers: true,
+	}
+}
+
+// newMemoryReports keeps reports of the simulated clock in memory, so the terminal chat doesn't change
+// the schedule, the outbox and subscriptions of the running service
+func newMemoryReports(*pgxpool.Pool) *reportRepositories {
+	subscriptions := newMemorySubscriptions()
+	outbox := newMemoryOutbox()
+	return &reportRepositories{
+		scheduler:     newMemoryScheduler(),
+		outbox:        outbox,
+		issued:        outbox,
+		subscriptions: subscriptions,
+		tokens:        subscriptions,
+	}
+}
+
+// connect returns services on top of the databases and a function which closes the connections.
+// Pending migrations are applied first when migrate is true
+func connect(ctx context.Context, cfg *config.Config, migrate bool) (*services, func(), error) {
+	return connectWith(ctx, cfg, migrate, newPostgresReports)
+}
+
+// connectWith is connect with the repositories of reports made by the function
+func connectWith(ctx context.Context, cfg *config.Config, migrate bool, reports func(conn *pgxpool.Pool) *reportRepositories) (*services,
+	func(), error) {
+	conn, client, closeConnections, err := openDatabases(ctx, cfg)
+	if err != nil {
+		return nil, nil, err
+	}
+	if migrate {
+		if err = applyMigrations(ctx, conn, client); err != nil {
+			closeConnections()
+			return nil, nil, err
+		}
+	}
+	s, err := newServices(ctx, cfg, conn, client, reports(conn))
+	if err != nil {
+		closeConnections()
+		return nil, nil, err
+	}
+	return s, closeConnections, nil
+}
+
+// openDatabases returns connections to postgres and mongo and a function which closes them
+func openDatabases(ctx context.Context, cfg *config.Config) (*pgxpool.Pool, *mongo.Client, func(), error) {
+	conn, err := pgxpool.Connect(ctx, cfg.PostgresEndpoint)
+	if err != nil {
+		return nil, nil, nil, fmt.Errorf("couldn't connect to database: %v", err)
+	}
+	if err = conn.Ping(ctx); err != nil {
+		conn.Close()
+		return nil, nil, nil, fmt.Errorf("couldn't ping database: %v", err)
+	}
+
+	client, err := mongo.Connect(ctx, options.Client().ApplyURI(cfg.MongoURI))
+	if err != nil {
+		conn.Close()
+		return nil, nil, nil, fmt.Errorf("couldn't connect to mongo: %v", err)
+	}
+	closeConnections := func() {
+		conn.Close()
+		if err := client.Disconnect(context.TODO()); err != nil {
+			logrus.Errorf("couldn't disconnect to mongo: %v", err)
+		}
+	}
+	if err = client.Ping(ctx, nil); err != nil {
+		closeConnections()
+		return nil, nil, nil, fmt.Errorf("failed ping to mongo: %v", err)
+	}
+	return conn, client, closeConnections, nil
+}
+
+func newServices(ctx context.Context, cfg *config.Config, conn *pgxpool.Pool, client *mongo.Client, reports *reportRepositories) (*services,
+	error) {
+	postgresRepository := repository.NewPostgres(conn)
+	apiTokenRepository := repository.NewAPITokenPostgres(conn)
+	loginAttemptRepository := repository.NewLoginAttemptPostgres(conn)
+	sessionRepository := repository.NewSessionPostgres(conn)
+	ledgerRepository := repository.NewLedgerPostgres(conn)
+	mongoRepository := repository.NewMongo(client)
+
+	s := &services{
+		users:    postgresRepository,
+		auth:     service.NewAuth(postgresRepository, loginAttemptRepository, cfg.AuthSalt),
+		recorder: service.NewRecorder(mongoRepository, mongoRepository),
+		reporter: service.NewReporter(mongoRepository, mongoRepository, reports.scheduler, reports.issued,
+			mongoRepository),
+		outbox:       service.NewOutbox(reports.outbox, cfg.OutboxMaxAttempts),
+		subscription: service.NewSubscription(reports.subscriptions, reports.tokens, cfg.SubscriptionSecret),
+		apiToken:     service.NewAPIToken(apiTokenRepository, postgresRepository),
+		session:      service.NewSession(sessionRepository, cfg.SessionIdleTimeout),
+		ledger:       service.NewLedger(ledgerRepository, mongoRepository),
+	}
+	s.settings = service.NewSettings(postgresRepository, s.reporter, s.recorder)
+
+	// users' timezones are needed before the reporter starts to catch up the reports missed during downtime
+	users, err := postgresRepository.GetAll(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("couldn't get users: %v", err)
+	}
+	for _, user := range users {
+		// the language is known even if reports can't be scheduled, consumers answer in it
+		s.reporter.SetLanguage(user.Username, i18n.Language(user.Language))
+		// the month start and the report time are kept for users who aren't scheduled until they sign in
+		s.reporter.SetMonthStart(user.Username, user.MonthStart, time.Now().UTC())
+		s.reporter.SetReportTime(user.Username, user.ReportTime)
+		if !reports.scheduleUsers {
+			continue
+		}
+		timezone, err := service.LoadLocation(user.Timezone)
+		if err != nil {
+			logrus.Errorf("reports of %s aren't scheduled: %v", user.Username, err)
+			continue
+		}
+		s.reporter.AddTimezone(timezone, user.Username)
+	}
+	return s, nil
+}
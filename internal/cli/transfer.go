@@ -0,0 +1,217 @@
+package cli
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	"github.com/chucky-1/finance/internal/config"
+	"github.com/chucky-1/finance/internal/model"
+	"github.com/chucky-1/finance/internal/service"
+)
+
+const expenses = "expenses"
+
+// entryLine is an entry in the file of export and import, one json object per line.
+// Entries of ledgers have the ledger and the member who made them instead of the user
+type entryLine struct {
+	Kind     string    `json:"kind"`
+	User     string    `json:"user,omitempty"`
+	Ledger   int64     `json:"ledger,omitempty"`
+	Member   string    `json:"member,omitempty"`
+	Date     time.Time `json:"date"`
+	Category string    `json:"category"`
+	Amount   float64   `json:"amount"`
+}
+
+// export writes entries of the user or of all users with entries of ledgers they own,
+// so every ledger is written once with its owner
+func export(ctx context.Context, cfg *config.Config, args []string) error {
+	flags := newFlagSet("export")
+	username := flags.String("user", "", "username, all users by default")
+	output := flags.String("output", "", "file, stdout by default")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	services, closeConnections, err := connect(ctx, cfg, false)
+	if err != nil {
+		return err
+	}
+	defer closeConnections()
+
+	usernames := []string{*username}
+	if *username == "" {
+		users, err := services.users.GetAll(ctx)
+		if err != nil {
+			return err
+		}
+		usernames = make([]string, len(users))
+		for i, u := range users {
+			usernames[i] = u.Username
+		}
+	}
+
+	var w io.Writer = os.Stdout
+	if *output != "" {
+		file, err := os.Create(*output)
+		if err != nil {
+			return err
+		}
+		defer file.Close()
+		w = file
+	}
+	buffered := bufio.NewWriter(w)
+	encoder := json.NewEncoder(buffered)
+
+	var count, ledgerCount int
+	for _, name := range usernames {
+		n, err := exportEntries(ctx, services, encoder, name, 0)
+		if err != nil {
+			return err
+		}
+		count += n
+
+		memberships, err := services.ledger.List(ctx, name)
+		if err != nil {
+			return err
+		}
+		for _, membership := range memberships {
+			if membership.Role != model.OwnerRole {
+				continue
+			}
+			if n, err = exportEntries(ctx, services, encoder, model.LedgerKey(membership.Ledger.ID), membership.Ledger.ID); err != nil {
+				return err
+			}
+			ledgerCount += n
+		}
+	}
+	if err = buffered.Flush(); err != nil {
+		return err
+	}
+	fmt.Fprintf(os.Stderr, "exported %d entries and %d entries of ledgers\n", count, ledgerCount)
+	return nil
+}
+
+// exportEntries writes entries kept under the key, they're entries of the ledger if its id isn't 0
+func exportEntries(ctx context.Context, services *services, encoder *json.Encoder, key string, ledgerID int64) (int, error) {
+	entries, err := services.recorder.Entries(ctx, expenses, key, time.Time{}, time.Date(9999, 1, 1, 0, 0, 0, 0, time.UTC))
+	if err != nil {
+		return 0, err
+	}
+	for _, entry := range entries {
+		line := entryLine{
+			Kind:     entry.Kind,
+			User:     entry.User,
+			Date:     entry.Date,
+			Category: entry.Category.Name,
+			Amount:   entry.Category.Amount,
+		}
+		if ledgerID != 0 {
+			line.User, line.Ledger, line.Member = "", ledgerID, entry.Member
+		}
+		if err = encoder.Encode(line); err != nil {
+			return 0, err
+		}
+	}
+	return len(entries), nil
+}
+
+// importEntries adds entries to existing users, the aggregated periods are updated as if the entries were added in the bot.
+// Entries of ledgers are added to existing ledgers
+func importEntries(ctx context.Context, cfg *config.Config, args []string) error {
+	flags := newFlagSet("import")
+	input := flags.String("input", "", "file, stdin by default")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	var r io.Reader = os.Stdin
+	if *input != "" {
+		file, err := os.Open(*input)
+		if err != nil {
+			return err
+		}
+		defer file.Close()
+		r = file
+	}
+
+	services, closeConnections, err := connect(ctx, cfg, false)
+	if err != nil {
+		return err
+	}
+	defer closeConnections()
+
+	users, err := services.users.GetAll(ctx)
+	if err != nil {
+		return err
+	}
+	timezones := make(map[string]*time.Location, len(users))
+	monthStarts := make(map[string]int, len(users))
+	for _, u := range users {
+		if timezones[u.Username], err = service.LoadLocation(u.Timezone); err != nil {
+			return fmt.Errorf("user %s: %v", u.Username, err)
+		}
+		monthStarts[u.Username] = u.MonthStart
+	}
+
+	scanner := bufio.NewScanner(r)
+	var count int
+	for line := 1; scanner.Scan(); line++ {
+		entry, ledgerID, err := parseEntryLine(scanner.Bytes())
+		if err != nil {
+			return fmt.Errorf("line %d: %v", line, err)
+		}
+		if ledgerID != 0 {
+			if err = services.ledger.Restore(ctx, ledgerID, entry); err != nil {
+				return fmt.Errorf("line %d: ledger %d: %v, %d entries are imported", line, ledgerID, err, count)
+			}
+			count++
+			continue
+		}
+		timezone, ok := timezones[entry.User]
+		if !ok {
+			return fmt.Errorf("line %d: user %s doesn't exist, %d entries are imported", line, entry.User, count)
+		}
+		if err = services.recorder.Add(ctx, entry, timezone, monthStarts[entry.User]); err != nil {
+			return fmt.Errorf("line %d: %v, %d entries are imported", line, err, count)
+		}
+		count++
+	}
+	if err = scanner.Err(); err != nil {
+		return fmt.Errorf("couldn't read entries: %v, %d entries are imported", err, count)
+	}
+	fmt.Printf("imported %d entries\n", count)
+	return nil
+}
+
+// parseEntryLine returns the entry with the id of its ledger, the id is 0 for entries of users
+func parseEntryLine(data []byte) (*model.Entry, int64, error) {
+	var line entryLine
+	if err := json.Unmarshal(data, &line); err != nil {
+		return nil, 0, fmt.Errorf("entry must be json: %v", err)
+	}
+	if line.Kind == "" {
+		line.Kind = expenses
+	}
+	if line.Category == "" || line.Date.IsZero() {
+		return nil, 0, fmt.Errorf("entry needs date and category")
+	}
+	if (line.User == "") == (line.Ledger == 0) {
+		return nil, 0, fmt.Errorf("entry needs either user or ledger")
+	}
+	if line.Ledger != 0 && line.Member == "" {
+		return nil, 0, fmt.Errorf("entry of the ledger needs member")
+	}
+	return &model.Entry{
+		Kind:     line.Kind,
+		User:     line.User,
+		Member:   line.Member,
+		Date:     line.Date.UTC(),
+		Category: &model.Category{Name: line.Category, Amount: line.Amount},
+	}, line.Ledger, nil
+}
@@ -0,0 +1,191 @@
+package cli
+
+import (
+	"context"
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"math/big"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	"github.com/chucky-1/finance/internal/config"
+	"github.com/chucky-1/finance/internal/model"
+	"github.com/chucky-1/finance/internal/service"
+)
+
+const (
+	generatedPasswordLength   = 12
+	generatedPasswordAlphabet = "abcdefghijkmnopqrstuvwxyzABCDEFGHJKLMNPQRSTUVWXYZ23456789"
+)
+
+// user manages accounts: list, show, delete and reset-password
+func user(ctx context.Context, cfg *config.Config, args []string) error {
+	if len(args) == 0 {
+		return errors.New("user needs a subcommand: list, show, delete, reset-password or unlock")
+	}
+	subcommand, args := args[0], args[1:]
+	if subcommand != "list" && len(args) != 1 {
+		return fmt.Errorf("user %s needs a username", subcommand)
+	}
+
+	services, closeConnections, err := connect(ctx, cfg, false)
+	if err != nil {
+		return err
+	}
+	defer closeConnections()
+
+	switch subcommand {
+	case "list":
+		return listUsers(ctx, services)
+	case "show":
+		return showUser(ctx, services, args[0])
+	case "delete":
+		return deleteUser(ctx, services, args[0])
+	case "reset-password":
+		return resetPassword(ctx, services, args[0])
+	case "unlock":
+		if err = services.auth.Unlock(ctx, args[0]); err != nil {
+			return err
+		}
+		fmt.Printf("failed logins of %s are forgotten, the user can log in\n", args[0])
+		return nil
+	}
+	return fmt.Errorf("unknown subcommand user %s", subcommand)
+}
+
+func listUsers(ctx context.Context, services *services) error {
+	users, err := services.users.GetAll(ctx)
+	if err != nil {
+		return err
+	}
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "USERNAME\tCOUNTRY\tTIMEZONE")
+	for _, u := range users {
+		fmt.Fprintf(w, "%s\t%s\t%s\n", u.Username, u.Country, formatTimezone(u.Timezone, time.Now()))
+	}
+	return w.Flush()
+}
+
+func showUser(ctx context.Context, services *services, username string) error {
+	u, err := services.users.Get(ctx, username)
+	if err != nil {
+		return err
+	}
+	if u == nil {
+		return service.UserNotFoundErr
+	}
+	fmt.Printf("username: %s\ncountry:  %s\ntimezone: %s\nchat:     %d\n", u.Username, u.Country, formatTimezone(u.Timezone, time.Now()), u.ChatID)
+	if u.TGUserID != 0 {
+		fmt.Printf("telegram: %d\n", u.TGUserID)
+	}
+
+	for _, period := range []string{service.DailyReport, service.MonthlyReport} {
+		chatID, ok, err := services.subscription.ChatID(ctx, username, period)
+		if err != nil {
+			return err
+		}
+		if ok {
+			fmt.Printf("%s reports: chat %d\n", period, chatID)
+		} else {
+			fmt.Printf("%s reports: not subscribed\n", period)
+		}
+	}
+
+	tokens, err := services.apiToken.List(ctx, username)
+	if err != nil {
+		return err
+	}
+	fmt.Println("api tokens:")
+	for _, token := range tokens {
+		fmt.Printf("  %s\n", formatAPIToken(token))
+	}
+
+	sessions, err := services.session.List(ctx, username)
+	if err != nil {
+		return err
+	}
+	fmt.Println("sessions:")
+	for _, session := range sessions {
+		fmt.Printf("  chat %d, logged in %s, last seen %s\n", session.ChatID,
+			session.CreatedAt.UTC().Format(time.DateTime), session.LastSeenAt.UTC().Format(time.DateTime))
+	}
+	return nil
+}
+
+func deleteUser(ctx context.Context, services *services, username string) error {
+	// ledgers of the user are deleted with the user by foreign keys, so they're listed before
+	memberships, err := services.ledger.List(ctx, username)
+	if err != nil {
+		return err
+	}
+	if err = services.auth.Delete(ctx, username); err != nil {
+		return err
+	}
+	if err = services.reporter.DeleteUserData(ctx, username); err != nil {
+		return fmt.Errorf("user %s is deleted, but expenses aren't: %v", username, err)
+	}
+	for _, membership := range memberships {
+		if membership.Role != model.OwnerRole {
+			continue
+		}
+		if err = services.reporter.DeleteUserData(ctx, model.LedgerKey(membership.Ledger.ID)); err != nil {
+			return fmt.Errorf("user %s is deleted, but expenses of ledger %d aren't: %v", username, membership.Ledger.ID, err)
+		}
+	}
+	fmt.Printf("user %s is deleted, the running service logs out chats of the user by their next messages "+
+		"and stops scheduling reports of the user by the next report\n", username)
+	return nil
+}
+
+func resetPassword(ctx context.Context, services *services, username string) error {
+	password, err := generatePassword()
+	if err != nil {
+		return err
+	}
+	if err = services.auth.ResetPassword(ctx, username, password); err != nil {
+		return err
+	}
+	fmt.Printf("new password of %s: %s\n", username, password)
+	return nil
+}
+
+func generatePassword() (string, error) {
+	password := make([]byte, generatedPasswordLength)
+	for i := range password {
+		n, err := rand.Int(rand.Reader, big.NewInt(int64(len(generatedPasswordAlphabet))))
+		if err != nil {
+			return "", fmt.Errorf("couldn't generate password: %v", err)
+		}
+		password[i] = generatedPasswordAlphabet[n.Int64()]
+	}
+	return string(password), nil
+}
+
+// formatTimezone returns the timezone with its offset at the time like Europe/Minsk (GMT+3) or America/St_Johns (GMT-2:30)
+func formatTimezone(name string, now time.Time) string {
+	timezone, err := service.LoadLocation(name)
+	if err != nil {
+		return name + " (unknown)"
+	}
+	_, seconds := now.In(timezone).Zone()
+	offset := time.Duration(seconds) * time.Second
+	sign := "+"
+	if offset < 0 {
+		sign, offset = "-", -offset
+	}
+	hours, minutes := int(offset.Hours()), int(offset.Minutes())%60
+	if minutes == 0 {
+		return fmt.Sprintf("%s (GMT%s%d)", name, sign, hours)
+	}
+	return fmt.Sprintf("%s (GMT%s%d:%02d)", name, sign, hours, minutes)
+}
+
+func formatAPIToken(token *model.APIToken) string {
+	lastUsed := "never used"
+	if token.LastUsedAt != nil {
+		lastUsed = "last used " + token.LastUsedAt.UTC().Format(time.DateTime)
+	}
+	return fmt.Sprintf("%s (%s), created %s, %s", token.Name, token.Scope, token.CreatedAt.UTC().Format(time.DateTime), lastUsed)
+}
@@ -1,20 +1,53 @@
 package config
 
+import "time"
+
+const (
+	// SingleBotMode is when the main bot records expenses and delivers reports
+	SingleBotMode = "single"
+	// MultiBotMode is when reports are delivered by separate daily and monthly reporter bots
+	MultiBotMode = "multi"
+)
+
+const (
+	// PollingUpdatesMode is when bots receive updates via long polling, it's convenient for local development
+	PollingUpdatesMode = "polling"
+	// WebhookUpdatesMode is when telegram sends updates to the http server of the service
+	WebhookUpdatesMode = "webhook"
+)
+
+const (
+	// PasswordAccountMode is when users register and log in with a username and a password
+	PasswordAccountMode = "password"
+	// TelegramAccountMode is when accounts are linked to telegram users and /start creates or resumes them
+	TelegramAccountMode = "telegram"
+)
+
 type Config struct {
-	LogLevel                  int    `env:"LOG_LEVEL"`
-	TGMainBotToken            string `env:"TG_MAIN_BOT_TOKEN"`
-	TGMainTimeout             int    `env:"TG_MAIN_TIMEOUT"`
-	TGNameDailyReporterBot    string `env:"TG_NAME_DAILY_REPORTER_BOT"`
-	TGDailyReporterBotToken   string `env:"TG_DAILY_REPORTER_BOT_TOKEN"`
-	TGDailyTimeout            int    `env:"TG_DAILY_TIMEOUT"`
-	TGNameMonthlyReporterBot  string `env:"TG_NAME_MONTHLY_REPORTER_BOT"`
-	TGMonthlyReporterBotToken string `env:"TG_MONTHLY_REPORTER_BOT_TOKEN"`
-	TGMonthlyTimeout          int    `env:"TG_MONTHLY_TIMEOUT"`
-	PostgresDB                string `env:"POSTGRES_DB"`
-	PostgresUser              string `env:"POSTGRES_USER"`
-	PostgresPassword          string `env:"POSTGRES_PASSWORD"`
-	PostgresPort              string `env:"POSTGRES_PORT"`
-	PostgresEndpoint          string `env:"POSTGRES_ENDPOINT"`
-	MongoURI                  string `env:"MONGODB_URI"`
-	AuthSalt                  string `env:"AUTHORIZATION_SALT"` // 10 characters is the maximum length
+	LogLevel                  int           `env:"LOG_LEVEL"`
+	TGMode                    string        `env:"TG_MODE" envDefault:"multi"`           // single or multi
+	TGUpdatesMode             string        `env:"TG_UPDATES_MODE" envDefault:"polling"` // polling or webhook
+	TGWebhookURL              string        `env:"TG_WEBHOOK_URL"`                       // public base url of the service, e.g. https://finance.example.com
+	TGWebhookSecret           string        `env:"TG_WEBHOOK_SECRET"`                    // paths and secret tokens of webhooks are derived from it
+	TGMainBotToken            string        `env:"TG_MAIN_BOT_TOKEN"`
+	TGMainTimeout             int           `env:"TG_MAIN_TIMEOUT"`
+	TGNameDailyReporterBot    string        `env:"TG_NAME_DAILY_REPORTER_BOT"`
+	TGDailyReporterBotToken   string        `env:"TG_DAILY_REPORTER_BOT_TOKEN"`
+	TGDailyTimeout            int           `env:"TG_DAILY_TIMEOUT"`
+	TGNameMonthlyReporterBot  string        `env:"TG_NAME_MONTHLY_REPORTER_BOT"`
+	TGMonthlyReporterBotToken string        `env:"TG_MONTHLY_REPORTER_BOT_TOKEN"`
+	TGMonthlyTimeout          int           `env:"TG_MONTHLY_TIMEOUT"`
+	PostgresDB                string        `env:"POSTGRES_DB"`
+	PostgresUser              string        `env:"POSTGRES_USER"`
+	PostgresPassword          string        `env:"POSTGRES_PASSWORD"`
+	PostgresPort              string        `env:"POSTGRES_PORT"`
+	PostgresEndpoint          string        `env:"POSTGRES_ENDPOINT"`
+	MongoURI                  string        `env:"MONGODB_URI"`
+	AuthSalt                  string        `env:"AUTHORIZATION_SALT"` // only verifies passwords hashed by the old SHA-1 scheme
+	OutboxMaxAttempts         int           `env:"OUTBOX_MAX_ATTEMPTS" envDefault:"10"`
+	SubscriptionSecret        string        `env:"SUBSCRIPTION_SECRET"`                    // signs tokens of deep links to reporter bots
+	AdminToken                string        `env:"ADMIN_TOKEN"`                            // admin endpoints are disabled when it's empty
+	AccountMode               string        `env:"ACCOUNT_MODE" envDefault:"password"`     // password or telegram
+	MigrateOnStart            bool          `env:"MIGRATE_ON_START" envDefault:"true"`     // serve and chat apply pending migrations
+	SessionIdleTimeout        time.Duration `env:"SESSION_IDLE_TIMEOUT" envDefault:"720h"` // chats are logged out after it without messages
 }
@@ -2,16 +2,18 @@ package consumer
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"github.com/chucky-1/finance/internal/i18n"
+	"github.com/chucky-1/finance/internal/messenger"
 	"github.com/chucky-1/finance/internal/model"
 	"github.com/chucky-1/finance/internal/repository"
 	"github.com/chucky-1/finance/internal/service"
-	"strconv"
+	"math"
 	"strings"
 	"time"
 
 	"github.com/go-playground/validator/v10"
-	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
 	"github.com/sirupsen/logrus"
 )
 
@@ -26,61 +28,107 @@ const (
 	passwordMaxLength = 15
 )
 
-var explainingSubscriptionMessage = "Если вы хотите получать отчёты, отправьте команду \"start\" следующим ботам\n\n" +
+var explainingSubscriptionMessage = "Если вы хотите получать отчёты, перейдите по ссылкам и нажмите \"Start\"\n\n" +
 	"Для получения ежедневных отчётов\n" +
 	"%s\n" +
 	"Для получения ежемесячных отчётов\n" +
 	"%s\n\n" +
+	"Ссылки одноразовые и действуют сутки. Новую ссылку можно получить командой /subscribe daily или /subscribe monthly\n\n" +
 	"Эти боты не смогут с вами коммуницировать, они предназначены ТОЛЬКО для отчётов. Вся коммуникация с приложением осуществляется через этот чат\n"
 
+var explainingSingleBotSubscriptionMessage = "Если вы хотите получать отчёты в этот чат, отправьте команды\n\n" +
+	"Для получения ежедневных отчётов\n" +
+	"/subscribe daily\n" +
+	"Для получения ежемесячных отчётов\n" +
+	"/subscribe monthly\n\n" +
+	"Отписаться можно командой /unsubscribe, например\n" +
+	"/unsubscribe daily\n"
+
 var explainingCommunicationMessage = "Для того что бы записать расходы, вы должны отправить сообщение в формате\n\n" +
 	"Кофе 3.5\n\n" +
 	"Вы должны отправить мне только 2 слова, точнее одно слово и одну цифру, через пробел, иначе я не смогу обработать сообщение и буду ругаться :)\n" +
 	"Приятного пользования :)"
 
+var accountLockedOwnerMessage = "Кто-то несколько раз ввёл неверный пароль от вашего аккаунта, поэтому вход заблокирован на %s. " +
+	"Если это были не вы, смените пароль командой /settings. Если вы, обратитесь к администратору, что бы разблокировать аккаунт раньше"
+
 var chooseCountryMessage = "Выберете свою страну и часовой пояс. " +
 	"Это нужно для того, что бы мы понимали когда у вас наступают следующие сутки и могли разделять расходы по дням. " +
-	"Вы сможете изменить эту настройку в будущем.\n\n" +
-	"Пока мы работаем в бета версии, страну можно выбрать только из списка предложенных."
+	"Вы сможете изменить эту настройку командой /settings.\n\n" +
+	"Выберите страну из списка, напишите свой город или отправьте геопозицию."
+
+// country is offered on the keyboard when the user chooses the country
+type country struct {
+	// name is on the button, the country of the user is the part before the comma
+	name string
+	// timezone is the IANA name of the timezone
+	timezone string
+}
+
+var countries = []country{
+	{name: "Belarus", timezone: "Europe/Minsk"},
+	{name: "Russia, Moscow", timezone: "Europe/Moscow"},
+	{name: "Poland", timezone: "Europe/Warsaw"},
+	{name: "Ukraine", timezone: "Europe/Kyiv"},
+	{name: "Georgia", timezone: "Asia/Tbilisi"},
+	{name: "Sri Lanka", timezone: "Asia/Colombo"},
+	{name: "USA, California", timezone: "America/Los_Angeles"},
+}
 
 type finishData struct {
-	username   string
-	chatID     int64
-	tgUsername string
+	username string
+	timezone *time.Location
+	chatID   int64
+	session  *model.Session
 }
 
 type Auth struct {
-	bot                      *tgbotapi.BotAPI
-	updatesChan              chan tgbotapi.Update
+	sender                   messenger.Sender
+	messages                 chan *messenger.Message
 	validator                *validator.Validate
 	auth                     service.Authorization
 	reporter                 *service.Reporter
+	subscriptions            *service.Subscription
+	sessions                 *service.Session
 	finish                   chan<- *finishData
 	tgNameDailyReporterBot   string
 	tgNameMonthlyReporterBot string
+	singleBot                bool
+	telegramAccounts         bool
 
 	waitRegisterMessageWithUsername int
-	waitRegisterMessageWithCountry  int
 	waitRegisterMessageWithPassword int
 	waitLoginMessageWithUsername    int
 	waitLoginMessageWithPassword    int
 	username                        string
 	country                         string
-	timezone                        time.Duration
+	timezone                        *time.Location
 	password                        string
+	// picker asks for the timezone by /start or /register which is kept in pickerAction
+	picker       timezonePicker
+	pickerAction string
+	// language is the language of the telegram client until the user is authorized, then the language of the account
+	language i18n.Language
 }
 
-func NewAuth(bot *tgbotapi.BotAPI, updatesChan chan tgbotapi.Update, validator *validator.Validate, auth service.Authorization,
-	reporter *service.Reporter, finish chan<- *finishData, TGNameDailyReporterBot, TGNameMonthlyReporterBot string) *Auth {
+func NewAuth(sender messenger.Sender, messages chan *messenger.Message, validator *validator.Validate, auth service.Authorization,
+	reporter *service.Reporter, subscriptions *service.Subscription, sessions *service.Session, finish chan<- *finishData,
+	TGNameDailyReporterBot, TGNameMonthlyReporterBot string,
+	singleBot, telegramAccounts bool) *Auth {
 	return &Auth{
-		bot:                      bot,
-		updatesChan:              updatesChan,
+		sender:                   sender,
+		messages:                 messages,
 		validator:                validator,
 		auth:                     auth,
 		reporter:                 reporter,
+		subscriptions:            subscriptions,
+		sessions:                 sessions,
 		finish:                   finish,
 		tgNameDailyReporterBot:   TGNameDailyReporterBot,
 		tgNameMonthlyReporterBot: TGNameMonthlyReporterBot,
+		singleBot:                singleBot,
+		telegramAccounts:         telegramAccounts,
+		picker:                   timezonePicker{sender: sender},
 	}
 }
 
@@ -93,9 +141,33 @@ func (a *Auth) Consume(ctx context.Context) {
 			logrus.Debugf("auth consumer for user %s stopped: %v", a.username, ctx.Err())
 			return
 
-		case update := <-a.updatesChan:
-			if !update.Message.IsCommand() && update.Message.MessageID == a.waitRegisterMessageWithUsername {
-				success, err := a.handleUsername(register, update.Message)
+		case message := <-a.messages:
+			a.language = i18n.Detect(message.Language)
+			a.picker.language = a.language
+			if a.pickerAction == start && a.picker.waits(message) {
+				chosen, err := a.handleCountry(message)
+				if err != nil {
+					logrus.Errorf("start error: %v", err)
+					continue
+				}
+				if !chosen {
+					continue
+				}
+
+				user, err := a.registerTelegram(ctx, message)
+				if err != nil {
+					logrus.Errorf("start error: %v", err)
+					continue
+				}
+				if err = a.startFinance(ctx, message, user, "Спасибо, %s! Вы успешно зарегистрировались", true); err != nil {
+					logrus.Errorf("start error: %v", err)
+					continue
+				}
+				return
+			}
+
+			if !message.IsCommand() && message.ID == a.waitRegisterMessageWithUsername {
+				success, err := a.handleUsername(register, message)
 				if err != nil {
 					logrus.Errorf("register error: %v", err)
 					continue
@@ -104,28 +176,32 @@ func (a *Auth) Consume(ctx context.Context) {
 					continue
 				}
 
-				if err = a.requestForCountry(update.Message); err != nil {
+				if err = a.requestForCountry(register, message, a.language.T(chooseCountryMessage)); err != nil {
 					logrus.Errorf("register error: %v", err)
 					continue
 				}
 			}
 
-			if !update.Message.IsCommand() && update.Message.MessageID == a.waitRegisterMessageWithCountry {
-				if err := a.handleCountry(update.Message); err != nil {
+			if a.pickerAction == register && a.picker.waits(message) {
+				chosen, err := a.handleCountry(message)
+				if err != nil {
 					logrus.Errorf("register error: %v", err)
 					continue
 				}
+				if !chosen {
+					continue
+				}
 
-				if err := a.requestForPassword(register, update.Message,
-					fmt.Sprintf("Введите пароль. Максимум %d символов", passwordMaxLength)); err != nil {
+				if err := a.requestForPassword(register, message,
+					a.language.Plural("Введите пароль. Максимум %d символов", passwordMaxLength, passwordMaxLength)); err != nil {
 					logrus.Errorf("register error: %v", err)
 					continue
 				}
 				continue
 			}
 
-			if !update.Message.IsCommand() && update.Message.MessageID == a.waitRegisterMessageWithPassword {
-				success, err := a.handlePassword(register, update.Message)
+			if !message.IsCommand() && message.ID == a.waitRegisterMessageWithPassword {
+				success, err := a.handlePassword(register, message)
 				if err != nil {
 					logrus.Errorf("register error: %v", err)
 					continue
@@ -139,7 +215,9 @@ func (a *Auth) Consume(ctx context.Context) {
 					Username: a.username,
 					Password: a.password,
 					Country:  a.country,
-					Timezone: a.timezone,
+					Timezone: a.timezone.String(),
+					ChatID:   message.ChatID,
+					Language: string(a.language),
 				})
 				if err != nil && err != repository.DuplicateUserErr {
 					logrus.Errorf("register error: %v", err)
@@ -147,8 +225,8 @@ func (a *Auth) Consume(ctx context.Context) {
 					continue
 				} else if err == repository.DuplicateUserErr {
 					logrus.Debugf("user %s already exist", a.username)
-					if err = a.requestForUsername(register, update.Message,
-						fmt.Sprintf("Имя пользователя: %s уже существует. Попробуйте ещё раз! Введите ваше имя пользователя", a.username)); err != nil {
+					if err = a.requestForUsername(register, message,
+						a.language.T("Имя пользователя: %s уже существует. Попробуйте ещё раз! Введите ваше имя пользователя", a.username)); err != nil {
 						logrus.Errorf("register error: %v", err)
 						cancel()
 						continue
@@ -158,33 +236,40 @@ func (a *Auth) Consume(ctx context.Context) {
 				}
 				cancel()
 
+				session, err := a.startSession(ctx, message, a.username)
+				if err != nil {
+					logrus.Errorf("register error: %v", err)
+					continue
+				}
 				a.reporter.AddTimezone(a.timezone, a.username)
+				a.reporter.SetLanguage(a.username, a.language)
 
-				if err = a.sendMessage(update.Message, fmt.Sprintf("Спасибо, %s! Вы успешно зарегистрировались", a.username)); err != nil {
+				if err = a.sendMessage(message, a.language.T("Спасибо, %s! Вы успешно зарегистрировались", a.username)); err != nil {
 					logrus.Errorf("register error: %v", err)
 					continue
 				}
 
-				if err = a.sendMessage(update.Message, fmt.Sprintf(explainingSubscriptionMessage, a.tgNameDailyReporterBot, a.tgNameMonthlyReporterBot)); err != nil {
+				if err = a.sendSubscriptionMessage(ctx, message); err != nil {
 					logrus.Errorf("register error: coldn't send explanation subscribe message: %v", err)
 				}
 
-				if err = a.sendMessage(update.Message, explainingCommunicationMessage); err != nil {
+				if err = a.sendMessage(message, a.language.T(explainingCommunicationMessage)); err != nil {
 					logrus.Errorf("register error: coldn't send explanation comminicate message: %v", err)
 				}
 
 				logrus.Debugf("user %s successful registered", a.username)
 				logrus.Debugf("auth consumer for user %s stopped", a.username)
 				a.finish <- &finishData{
-					username:   a.username,
-					chatID:     update.Message.Chat.ID,
-					tgUsername: update.SentFrom().UserName,
+					username: a.username,
+					timezone: a.timezone,
+					chatID:   message.ChatID,
+					session:  session,
 				}
 				return
 			}
 
-			if !update.Message.IsCommand() && update.Message.MessageID == a.waitLoginMessageWithUsername {
-				success, err := a.handleUsername(login, update.Message)
+			if !message.IsCommand() && message.ID == a.waitLoginMessageWithUsername {
+				success, err := a.handleUsername(login, message)
 				if err != nil {
 					logrus.Errorf("login error: %v", err)
 					continue
@@ -193,15 +278,15 @@ func (a *Auth) Consume(ctx context.Context) {
 					continue
 				}
 
-				if err := a.requestForPassword(login, update.Message, "Введите пароль"); err != nil {
+				if err := a.requestForPassword(login, message, a.language.T("Введите пароль")); err != nil {
 					logrus.Errorf("login error: %v", err)
 					continue
 				}
 				continue
 			}
 
-			if !update.Message.IsCommand() && update.Message.MessageID == a.waitLoginMessageWithPassword {
-				success, err := a.handlePassword(login, update.Message)
+			if !message.IsCommand() && message.ID == a.waitLoginMessageWithPassword {
+				success, err := a.handlePassword(login, message)
 				if err != nil {
 					logrus.Errorf("login error: %v", err)
 					continue
@@ -211,14 +296,23 @@ func (a *Auth) Consume(ctx context.Context) {
 				}
 
 				newCtx, cancel := context.WithTimeout(ctx, 10*time.Second)
-				user, err := a.auth.Login(newCtx, a.username, a.password)
+				user, err := a.auth.Login(newCtx, a.username, a.password, message.ChatID)
+				var blockedErr *service.LoginBlockedError
+				if errors.As(err, &blockedErr) {
+					cancel()
+					if err = a.handleBlockedLogin(message, blockedErr); err != nil {
+						logrus.Errorf("login error: %v", err)
+					}
+					continue
+				}
 				if err != nil && err != service.UserNotFoundErr && err != service.WrongPasswordErr {
 					logrus.Errorf("login error: %v", err)
 					cancel()
 					continue
 				} else if err == service.UserNotFoundErr {
 					logrus.Debugf("user %s already exists", a.username)
-					if err = a.requestForUsername(login, update.Message, "Пользователь с таким именем не найден. Попробуйте ещё раз! Введите имя пользователя"); err != nil {
+					if err = a.requestForUsername(login, message,
+						a.language.T("Пользователь с таким именем не найден. Попробуйте ещё раз! Введите имя пользователя")); err != nil {
 						logrus.Errorf("login error: %v", err)
 						cancel()
 						continue
@@ -226,8 +320,9 @@ func (a *Auth) Consume(ctx context.Context) {
 					cancel()
 					continue
 				} else if err == service.WrongPasswordErr {
-					logrus.Debugf("user %s entered the wrong password %s", a.username, a.password)
-					if err = a.requestForUsername(login, update.Message, "Вы ввели неверное имя пользователя или пароль. Попробуйте ещё раз! Введите ваше имя пользователя"); err != nil {
+					logrus.Debugf("user %s entered the wrong password", a.username)
+					if err = a.requestForUsername(login, message,
+						a.language.T("Вы ввели неверное имя пользователя или пароль. Попробуйте ещё раз! Введите ваше имя пользователя")); err != nil {
 						logrus.Errorf("login error: %v", err)
 						cancel()
 						continue
@@ -237,44 +332,87 @@ func (a *Auth) Consume(ctx context.Context) {
 				}
 				cancel()
 
-				a.reporter.AddTimezone(user.Timezone, user.Username)
+				timezone, err := service.LoadLocation(user.Timezone)
+				if err != nil {
+					logrus.Errorf("login error: %v", err)
+					continue
+				}
+				session, err := a.startSession(ctx, message, a.username)
+				if err != nil {
+					logrus.Errorf("login error: %v", err)
+					continue
+				}
+				a.reporter.AddTimezone(timezone, user.Username)
+				a.language = i18n.Language(user.Language)
+				a.reporter.SetLanguage(user.Username, a.language)
 
-				if err = a.sendMessage(update.Message, fmt.Sprintf("%s, вы авторизованы!", a.username)); err != nil {
+				if err = a.sendMessage(message, a.language.T("%s, вы авторизованы!", a.username)); err != nil {
 					logrus.Errorf("login error: %v", err)
 					continue
 				}
 
-				if err = a.sendMessage(update.Message, fmt.Sprintf(explainingSubscriptionMessage, a.tgNameDailyReporterBot, a.tgNameMonthlyReporterBot)); err != nil {
+				if a.telegramAccounts {
+					if err = a.linkTelegram(ctx, message); err != nil {
+						logrus.Errorf("login error: %v", err)
+					}
+				}
+
+				if err = a.sendSubscriptionMessage(ctx, message); err != nil {
 					logrus.Errorf("login error: coldn't send explanation subscribe message: %v", err)
 				}
 
-				if err = a.sendMessage(update.Message, explainingCommunicationMessage); err != nil {
+				if err = a.sendMessage(message, a.language.T(explainingCommunicationMessage)); err != nil {
 					logrus.Errorf("login error: coldn't send explanation communicate message: %v", err)
 				}
 
 				logrus.Debugf("user %s is authorized", a.username)
 				logrus.Debugf("auth consumer for user %s stopped", a.username)
 				a.finish <- &finishData{
-					username:   a.username,
-					chatID:     update.Message.Chat.ID,
-					tgUsername: update.SentFrom().UserName,
+					username: a.username,
+					timezone: timezone,
+					chatID:   message.ChatID,
+					session:  session,
 				}
 				return
 			}
 
-			if update.Message.IsCommand() {
-				switch update.Message.Command() {
+			if message.IsCommand() {
+				switch message.Command() {
+				case start:
+					if !a.telegramAccounts {
+						continue
+					}
+					newCtx, cancel := context.WithTimeout(ctx, 10*time.Second)
+					user, err := a.auth.LoginTelegram(newCtx, message.UserID, message.ChatID)
+					cancel()
+					if err != nil && err != service.UserNotFoundErr {
+						logrus.Errorf("start error: %v", err)
+						continue
+					} else if err == service.UserNotFoundErr {
+						logrus.Debugf("no account is linked to telegram user %d", message.UserID)
+						text := a.language.T(welcomeIntro(a.singleBot)) + a.language.T(welcomeTelegramAccount) + "\n\n" +
+							a.language.T(chooseCountryMessage)
+						if err = a.requestForCountry(start, message, text); err != nil {
+							logrus.Errorf("start error: %v", err)
+						}
+						continue
+					}
+					if err = a.startFinance(ctx, message, user, "С возвращением, %s!", false); err != nil {
+						logrus.Errorf("start error: %v", err)
+						continue
+					}
+					return
 				case register:
 					logrus.Debug("register command started executing")
-					if err := a.requestForUsername(register, update.Message,
-						fmt.Sprintf("Введите имя пользователя. Минимум %d, максимум %d символов", usernameMinLength, usernameMaxLength)); err != nil {
+					if err := a.requestForUsername(register, message, a.language.Plural("Введите имя пользователя. Минимум %d, максимум %d символов",
+						usernameMaxLength, usernameMinLength, usernameMaxLength)); err != nil {
 						logrus.Errorf("register error: %v", err)
 						continue
 					}
 					continue
 				case login:
 					logrus.Debug("login command started executing")
-					if err := a.requestForUsername(login, update.Message, "Введите имя пользователя"); err != nil {
+					if err := a.requestForUsername(login, message, a.language.T("Введите имя пользователя")); err != nil {
 						logrus.Errorf("login error: %v", err)
 						continue
 					}
@@ -285,135 +423,284 @@ func (a *Auth) Consume(ctx context.Context) {
 	}
 }
 
-func (a *Auth) handleUsername(action string, message *tgbotapi.Message) (bool, error) {
+func (a *Auth) handleUsername(action string, message *messenger.Message) (bool, error) {
 	a.username = message.Text
 	if !a.validate(a.username, fmt.Sprintf("min=%d,max=%d", usernameMinLength, usernameMaxLength)) {
-		err := a.requestForUsername(action, message, "Вы ввели некорректное имя пользователя. Попробуйте ещё раз!")
+		err := a.requestForUsername(action, message, a.language.T("Вы ввели некорректное имя пользователя. Попробуйте ещё раз!"))
 		if err != nil {
 			return false, err
 		}
 		logrus.Debugf("%s, user entered the wrong username: %s", action, a.username)
 		return false, nil
 	}
+	// old accounts may have other characters, so they're checked only on register
+	if action == register && !service.ValidUsername(a.username) {
+		err := a.requestForUsername(action, message,
+			a.language.T("Имя пользователя может содержать только латинские буквы, цифры и _. Попробуйте ещё раз!"))
+		if err != nil {
+			return false, err
+		}
+		logrus.Debugf("%s, user entered the username with wrong characters: %s", action, a.username)
+		return false, nil
+	}
 	logrus.Debugf("%s, user entered username: %s", action, a.username)
 	return true, nil
 }
 
-func (a *Auth) handlePassword(action string, message *tgbotapi.Message) (bool, error) {
+// handlePassword deletes the message with the password from the chat, the password is never logged
+func (a *Auth) handlePassword(action string, message *messenger.Message) (bool, error) {
 	a.password = message.Text
+	deleteMessage(a.sender, message)
 	if !a.validate(a.password, fmt.Sprintf("max=%d", passwordMaxLength)) {
-		err := a.requestForPassword(action, message, fmt.Sprintf("%s, вы ввели некорректный пароль. Попробуйте ещё раз!", a.username))
+		err := a.requestForPassword(action, message, a.language.T("%s, вы ввели некорректный пароль. Попробуйте ещё раз!", a.username))
 		if err != nil {
 			return false, err
 		}
-		logrus.Debugf("%s, user %s entered the wrong password: %s", action, a.username, a.password)
+		logrus.Debugf("%s, user %s entered invalid password", action, a.username)
 		return false, nil
 	}
-	logrus.Debugf("%s, user %s entered password: %s", action, a.username, a.password)
+	logrus.Debugf("%s, user %s entered password", action, a.username)
 	return true, nil
 }
 
-func (a *Auth) handleCountry(message *tgbotapi.Message) error {
-	a.country = strings.Split(strings.Trim(strings.Split(message.Text, "(")[0], " "), ",")[0]
-	_, after, _ := strings.Cut(message.Text, "GMT")
-	timezoneString := strings.Trim(after, ")")
-	timezone, err := strconv.ParseFloat(timezoneString, 32)
-	if err != nil {
-		return fmt.Errorf("handle country couldn't parse int: %v", err)
+// deleteMessage deletes the message if the messenger supports it, the flow goes on if it fails
+func deleteMessage(sender messenger.Sender, message *messenger.Message) {
+	deleter, ok := sender.(messenger.Deleter)
+	if !ok {
+		return
+	}
+	if err := deleter.Delete(message.ChatID, message.ID); err != nil {
+		logrus.Errorf("consumer couldn't delete message %d in chat %d: %v", message.ID, message.ChatID, err)
 	}
-	hour := int(timezone)
-	minute := int((timezone - float64(int(timezone))) * 100)
-	a.timezone = time.Duration(hour)*time.Hour + time.Duration(minute)*time.Minute
+}
+
+// handleBlockedLogin asks to try later and warns the owner in their chat and language when the account has just been locked
+func (a *Auth) handleBlockedLogin(message *messenger.Message, blockedErr *service.LoginBlockedError) error {
+	until := time.Until(blockedErr.Until)
+	logrus.Infof("login of %s in chat %d is blocked: %v", a.username, message.ChatID, blockedErr)
+
+	if blockedErr.OwnerChatID != 0 && blockedErr.OwnerChatID != message.ChatID {
+		owner := a.reporter.Language(a.username)
+		_, err := a.sender.Send(&messenger.OutgoingMessage{
+			ChatID: blockedErr.OwnerChatID,
+			Text:   owner.T(accountLockedOwnerMessage, formatWait(owner, until)),
+		})
+		if err != nil {
+			logrus.Errorf("login error: couldn't notify the owner of %s: %v", a.username, err)
+		}
+	}
+
+	wait := formatWait(a.language, until)
+	text := a.language.T("Слишком много неудачных попыток входа. Попробуйте ещё раз через %s. Введите имя пользователя", wait)
+	if blockedErr.Locked {
+		text = a.language.T("Аккаунт временно заблокирован из-за неудачных попыток входа. Попробуйте ещё раз через %s. "+
+			"Введите имя пользователя", wait)
+	}
+	return a.requestForUsername(login, message, text)
+}
+
+// formatWait returns the duration rounded up to seconds or minutes, e.g. "40 сек." or "5 мин."
+func formatWait(language i18n.Language, wait time.Duration) string {
+	if wait < time.Minute {
+		return language.T("%d сек.", int(math.Ceil(wait.Seconds())))
+	}
+	return language.T("%d мин.", int(math.Ceil(wait.Minutes())))
+}
+
+// handleCountry returns true when the user has chosen the timezone, until then the picker asks further questions
+func (a *Auth) handleCountry(message *messenger.Message) (bool, error) {
+	country, timezone, err := a.picker.handle(message)
+	if err != nil || timezone == nil {
+		return false, err
+	}
+	a.country, a.timezone = country, timezone
 	logrus.Debugf("%s chose country: %s and timezone: %v", a.username, a.country, a.timezone)
-	return nil
+	return true, nil
 }
 
-func (a *Auth) requestForUsername(action string, message *tgbotapi.Message, text string) error {
-	msg := tgbotapi.NewMessage(message.Chat.ID, text)
-	msg.ReplyToMessageID = message.MessageID
+// parseCountry returns the country and the timezone of the button, e.g. USA and America/Los_Angeles for "USA, California (GMT-7)".
+// The offset on the button is ignored, it may have changed since the keyboard was sent
+func parseCountry(text string) (string, *time.Location, error) {
+	name := strings.TrimSpace(strings.Split(text, "(")[0])
+	for _, c := range countries {
+		if c.name != name {
+			continue
+		}
+		timezone, err := service.LoadLocation(c.timezone)
+		if err != nil {
+			return "", nil, err
+		}
+		return strings.Split(name, ",")[0], timezone, nil
+	}
+	return "", nil, fmt.Errorf("handle country couldn't find country %q", name)
+}
+
+// countryButtons returns the countries with their current offsets, e.g. Poland (GMT+2)
+func countryButtons(now time.Time) []string {
+	buttons := make([]string, 0, len(countries))
+	for _, c := range countries {
+		timezone, err := service.LoadLocation(c.timezone)
+		if err != nil {
+			logrus.Errorf("consumer couldn't offer %s: %v", c.name, err)
+			continue
+		}
+		buttons = append(buttons, fmt.Sprintf("%s (%s)", c.name, gmt(timezone, now)))
+	}
+	return buttons
+}
+
+func (a *Auth) requestForUsername(action string, message *messenger.Message, text string) error {
+	msg := messenger.NewMessage(message, text)
 
 	switch action {
 	case register:
-		a.waitRegisterMessageWithUsername = msg.ReplyToMessageID + 2
+		a.waitRegisterMessageWithUsername = msg.ReplyToID + 2
 	case login:
-		a.waitLoginMessageWithUsername = msg.ReplyToMessageID + 2
+		a.waitLoginMessageWithUsername = msg.ReplyToID + 2
 	}
 
-	_, err := a.bot.Send(msg)
+	_, err := a.sender.Send(msg)
 	if err != nil {
-		return fmt.Errorf("requestForUsername, telegram bot couldn't send message: %v", err)
+		return fmt.Errorf("requestForUsername, couldn't send message: %v", err)
 	}
 	return nil
 }
 
-func (a *Auth) requestForPassword(action string, message *tgbotapi.Message, text string) error {
-	msg := tgbotapi.NewMessage(message.Chat.ID, text)
-	msg.ReplyToMessageID = message.MessageID
-	msg.ReplyMarkup = tgbotapi.NewRemoveKeyboard(true)
+func (a *Auth) requestForPassword(action string, message *messenger.Message, text string) error {
+	msg := messenger.NewMessage(message, text)
+	msg.RemoveKeyboard = true
 
 	switch action {
 	case register:
-		a.waitRegisterMessageWithPassword = msg.ReplyToMessageID + 2
+		a.waitRegisterMessageWithPassword = msg.ReplyToID + 2
 	case login:
-		a.waitLoginMessageWithPassword = msg.ReplyToMessageID + 2
+		a.waitLoginMessageWithPassword = msg.ReplyToID + 2
 	}
 
-	_, err := a.bot.Send(msg)
+	_, err := a.sender.Send(msg)
 	if err != nil {
-		return fmt.Errorf("requestForPassword, telegram bot couldn't send message: %v", err)
+		return fmt.Errorf("requestForPassword, couldn't send message: %v", err)
 	}
 	return nil
 }
 
-func (a *Auth) requestForCountry(message *tgbotapi.Message) error {
-	msg := tgbotapi.NewMessage(message.Chat.ID, chooseCountryMessage)
-	msg.ReplyToMessageID = message.MessageID
-
-	a.waitRegisterMessageWithCountry = msg.ReplyToMessageID + 2
-
-	keyboard := tgbotapi.NewReplyKeyboard(
-		tgbotapi.NewKeyboardButtonRow(
-			tgbotapi.NewKeyboardButton("Belarus (GMT+3)"),
-		),
-		tgbotapi.NewKeyboardButtonRow(
-			tgbotapi.NewKeyboardButton("Russia, Moscow (GMT+3)"),
-		),
-		tgbotapi.NewKeyboardButtonRow(
-			tgbotapi.NewKeyboardButton("Poland (GMT+2)"),
-		),
-		tgbotapi.NewKeyboardButtonRow(
-			tgbotapi.NewKeyboardButton("Ukraine (GMT+3)"),
-		),
-		tgbotapi.NewKeyboardButtonRow(
-			tgbotapi.NewKeyboardButton("Georgia (GMT+4)"),
-		),
-		tgbotapi.NewKeyboardButtonRow(
-			tgbotapi.NewKeyboardButton("Sri Lanka (GMT+5.30)"),
-		),
-		tgbotapi.NewKeyboardButtonRow(
-			tgbotapi.NewKeyboardButton("USA, California (GMT-7)"),
-		),
-	)
-	msg.ReplyMarkup = keyboard
-
-	_, err := a.bot.Send(msg)
+func (a *Auth) requestForCountry(action string, message *messenger.Message, text string) error {
+	a.pickerAction = action
+	return a.picker.request(message, text)
+}
+
+// registerTelegram creates the account of the telegram user, the account is resumed if it was created meanwhile in another chat
+func (a *Auth) registerTelegram(ctx context.Context, message *messenger.Message) (*model.User, error) {
+	newCtx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+	user := &model.User{
+		Username: message.Username,
+		Country:  a.country,
+		Timezone: a.timezone.String(),
+		ChatID:   message.ChatID,
+		TGUserID: message.UserID,
+		Language: string(a.language),
+	}
+	err := a.auth.RegisterTelegram(newCtx, user)
+	if err == service.TelegramLinkedErr {
+		return a.auth.LoginTelegram(newCtx, message.UserID, message.ChatID)
+	}
+	if err != nil {
+		return nil, err
+	}
+	logrus.Debugf("user %s successful registered by telegram user %d", user.Username, user.TGUserID)
+	return user, nil
+}
+
+// linkTelegram links the account which logged in by the password to the telegram user, so the next time /start is enough
+func (a *Auth) linkTelegram(ctx context.Context, message *messenger.Message) error {
+	newCtx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+	err := a.auth.LinkTelegram(newCtx, a.username, message.UserID)
+	if err == service.TelegramLinkedErr {
+		return a.sendMessage(message, a.language.T("Аккаунт не привязан к вашему Telegram, потому что к нему уже привязан другой аккаунт. "+
+			"Что бы войти в него, нажмите /start"))
+	}
 	if err != nil {
-		return fmt.Errorf("sendMessage, telegram bot couldn't send message: %v", err)
+		return err
 	}
-	return nil
+	return a.sendMessage(message, a.language.T("Аккаунт привязан к вашему Telegram, теперь для входа достаточно нажать /start"))
 }
 
-func (a *Auth) sendMessage(message *tgbotapi.Message, text string) error {
-	msg := tgbotapi.NewMessage(message.Chat.ID, text)
-	msg.ReplyToMessageID = message.MessageID
+// startSession logs the chat in, the session is restored after restarts until the user logs out
+func (a *Auth) startSession(ctx context.Context, message *messenger.Message, username string) (*model.Session, error) {
+	newCtx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+	session, err := a.sessions.Start(newCtx, username, message.ChatID)
+	if err != nil {
+		return nil, fmt.Errorf("couldn't start session of %s: %v", username, err)
+	}
+	return session, nil
+}
+
+// startFinance greets the user authorized by telegram in the language of the account and passes the chat to the finance consumer.
+// The greeting is a message with the username
+func (a *Auth) startFinance(ctx context.Context, message *messenger.Message, user *model.User, greeting string, explain bool) error {
+	timezone, err := service.LoadLocation(user.Timezone)
+	if err != nil {
+		return err
+	}
+	session, err := a.startSession(ctx, message, user.Username)
+	if err != nil {
+		return err
+	}
+	a.username = user.Username
+	a.reporter.AddTimezone(timezone, user.Username)
+	a.language = i18n.Language(user.Language)
+	a.reporter.SetLanguage(user.Username, a.language)
+
+	if err := a.sendMessage(message, a.language.T(greeting, user.Username)); err != nil {
+		logrus.Errorf("start error: %v", err)
+	}
+	if explain {
+		if err := a.sendSubscriptionMessage(ctx, message); err != nil {
+			logrus.Errorf("start error: coldn't send explanation subscribe message: %v", err)
+		}
+		if err := a.sendMessage(message, a.language.T(explainingCommunicationMessage)); err != nil {
+			logrus.Errorf("start error: coldn't send explanation communicate message: %v", err)
+		}
+	}
+
+	logrus.Debugf("user %s is authorized by telegram user %d", user.Username, message.UserID)
+	a.finish <- &finishData{
+		username: user.Username,
+		timezone: timezone,
+		chatID:   message.ChatID,
+		session:  session,
+	}
+	return nil
+}
 
-	_, err := a.bot.Send(msg)
+func (a *Auth) sendMessage(message *messenger.Message, text string) error {
+	_, err := a.sender.Send(messenger.NewMessage(message, text))
 	if err != nil {
-		return fmt.Errorf("sendMessage, telegram bot couldn't send message: %v", err)
+		return fmt.Errorf("sendMessage, couldn't send message: %v", err)
 	}
 	return nil
 }
 
+func (a *Auth) sendSubscriptionMessage(ctx context.Context, message *messenger.Message) error {
+	if a.singleBot {
+		return a.sendMessage(message, a.language.T(explainingSingleBotSubscriptionMessage))
+	}
+	newCtx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+	dailyLink, err := subscriptionLink(newCtx, a.subscriptions, a.username, service.DailyReport, a.tgNameDailyReporterBot)
+	if err != nil {
+		return err
+	}
+	monthlyLink, err := subscriptionLink(newCtx, a.subscriptions, a.username, service.MonthlyReport, a.tgNameMonthlyReporterBot)
+	if err != nil {
+		return err
+	}
+	return a.sendMessage(message, a.language.T(explainingSubscriptionMessage, dailyLink, monthlyLink))
+}
+
 func (a *Auth) validate(value string, tags string) bool {
 	err := a.validator.Var(value, tags)
 	if err != nil {
@@ -3,28 +3,80 @@ package consumer
 import (
 	"context"
 	"fmt"
+	"github.com/chucky-1/finance/internal/i18n"
+	"github.com/chucky-1/finance/internal/messenger"
 	"github.com/chucky-1/finance/internal/model"
 	"github.com/chucky-1/finance/internal/service"
-	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
 	"github.com/sirupsen/logrus"
 	"strconv"
 	"strings"
 	"time"
 )
 
+const (
+	subscribe   = "subscribe"
+	unsubscribe = "unsubscribe"
+)
+
 type Finance struct {
-	bot         *tgbotapi.BotAPI
-	username    string
-	updatesChan chan tgbotapi.Update
-	recorder    *service.Recorder
+	sender        messenger.Sender
+	username      string
+	timezone      *time.Location
+	session       *model.Session
+	messages      chan *messenger.Message
+	auth          service.Authorization
+	recorder      *service.Recorder
+	subscriptions *service.Subscription
+	tokens        *service.APIToken
+	sessions      *service.Session
+	settings      *service.Settings
+	ledgers       *service.Ledger
+	// ended receives chats whose sessions ended, the hub stops their finance consumers
+	ended chan<- int64
+	// names of the reporter bots, they aren't used in the single bot mode
+	tgNameDailyReporterBot   string
+	tgNameMonthlyReporterBot string
+	singleBot                bool
+
+	waitSettingsMessageWithChoice      int
+	waitSettingsMessageWithOldPassword int
+	waitSettingsMessageWithNewPassword int
+	waitSettingsMessageWithDailyTime   int
+	waitSettingsMessageWithMonthlyTime int
+	waitSettingsMessageWithMonthStart  int
+	waitSettingsMessageWithLanguage    int
+	oldPassword                        string
+	picker                             timezonePicker
+	// dailyReportTime is the chosen time of the daily report, it's saved with the monthly one
+	dailyReportTime time.Duration
+	// language is the language of the user, it's read from the settings on every message
+	language i18n.Language
+	// ledger is the shared ledger which receives expenses of this chat, they're personal if it's nil
+	ledger *model.Membership
 }
 
-func NewFinance(bot *tgbotapi.BotAPI, username string, updatesChan chan tgbotapi.Update, recorder *service.Recorder) *Finance {
+func NewFinance(sender messenger.Sender, username string, timezone *time.Location, session *model.Session, messages chan *messenger.Message,
+	auth service.Authorization, recorder *service.Recorder, subscriptions *service.Subscription, tokens *service.APIToken,
+	sessions *service.Session, settings *service.Settings, ledgers *service.Ledger, ended chan<- int64,
+	TGNameDailyReporterBot, TGNameMonthlyReporterBot string, singleBot bool) *Finance {
 	return &Finance{
-		bot:         bot,
-		username:    username,
-		updatesChan: updatesChan,
-		recorder:    recorder,
+		sender:                   sender,
+		username:                 username,
+		timezone:                 timezone,
+		session:                  session,
+		messages:                 messages,
+		auth:                     auth,
+		recorder:                 recorder,
+		subscriptions:            subscriptions,
+		tokens:                   tokens,
+		sessions:                 sessions,
+		settings:                 settings,
+		ledgers:                  ledgers,
+		ended:                    ended,
+		tgNameDailyReporterBot:   TGNameDailyReporterBot,
+		tgNameMonthlyReporterBot: TGNameMonthlyReporterBot,
+		singleBot:                singleBot,
+		picker:                   timezonePicker{sender: sender},
 	}
 }
 
@@ -35,12 +87,44 @@ func (f *Finance) Consume(ctx context.Context) {
 		case <-ctx.Done():
 			logrus.Debugf("finance consumer stopped: %v", ctx.Err())
 			return
-		case update := <-f.updatesChan:
+		case message := <-f.messages:
 			logrus.Debugf("received message in finance consumer from username: %s", f.username)
-			args := strings.Split(update.Message.Text, " ")
+			if f.expire(ctx, message) {
+				return
+			}
+			// the timezone may have been changed in another chat of the user
+			if timezone, ok := f.settings.Timezone(f.username); ok {
+				f.timezone = timezone
+			}
+			f.language = f.settings.Language(f.username)
+			f.picker.language = f.language
+			if handled, err := f.handleSettings(ctx, message); handled {
+				if err != nil {
+					logrus.Errorf("finance consumer settings error: %v", err)
+				}
+				continue
+			}
+			if message.IsCommand() && (message.Command() == logout || message.Command() == sessions) {
+				ended, err := f.handleSessions(ctx, message)
+				if err != nil {
+					logrus.Errorf("finance consumer sessions error: %v", err)
+				}
+				if ended {
+					return
+				}
+				continue
+			}
+			if message.IsCommand() {
+				if err := f.handleCommand(ctx, message); err != nil {
+					logrus.Errorf("finance consumer command error: %v", err)
+				}
+				continue
+			}
+			args := strings.Split(message.Text, " ")
 			if len(args) != 2 {
-				logrus.Debugf("finance consumer received invalid message: %s", update.Message.Text)
-				err := f.sendMessage(update.Message, fmt.Sprintf("%s, мы не можем обработать ваш запрос. Вы должны ввести только 2 параметра разделённых пробелом: статью расходов и сумму", f.username))
+				logrus.Debugf("finance consumer received invalid message: %s", message.Text)
+				err := f.sendMessage(message, f.language.T("%s, мы не можем обработать ваш запрос. "+
+					"Вы должны ввести только 2 параметра разделённых пробелом: статью расходов и сумму", f.username))
 				if err != nil {
 					logrus.Errorf("finance consumer send message error: %v", err)
 					continue
@@ -48,10 +132,11 @@ func (f *Finance) Consume(ctx context.Context) {
 				continue
 			}
 
-			sum, err := strconv.ParseFloat(args[1], 64)
+			// the decimal separator is a comma in many languages, e.g. 3,5
+			sum, err := strconv.ParseFloat(strings.Replace(args[1], ",", ".", 1), 64)
 			if err != nil {
 				logrus.Debugf("finance consumer couldn't parseFloat: %v", err)
-				err = f.sendMessage(update.Message, fmt.Sprintf("%s, второй параметр должен быть числом", f.username))
+				err = f.sendMessage(message, f.language.T("%s, второй параметр должен быть числом", f.username))
 				if err != nil {
 					logrus.Errorf("finance consumer send message error: %v", err)
 					continue
@@ -60,6 +145,13 @@ func (f *Finance) Consume(ctx context.Context) {
 			}
 
 			newCtx, cancel := context.WithTimeout(ctx, 10*time.Second)
+			if f.ledger != nil {
+				if err = f.addToLedger(newCtx, message, &model.Category{Name: args[0], Amount: sum}); err != nil {
+					logrus.Errorf("finance consumer ledger error: %v", err)
+				}
+				cancel()
+				continue
+			}
 			err = f.recorder.Add(newCtx, &model.Entry{
 				Kind: "expenses",
 				User: f.username,
@@ -68,7 +160,7 @@ func (f *Finance) Consume(ctx context.Context) {
 					Name:   args[0],
 					Amount: sum,
 				},
-			})
+			}, f.timezone, f.settings.MonthStart(f.username))
 			if err != nil {
 				logrus.Errorf("finance consumer couldn't Add: %v", err)
 				cancel()
@@ -76,7 +168,7 @@ func (f *Finance) Consume(ctx context.Context) {
 			}
 			cancel()
 
-			err = f.sendMessage(update.Message, fmt.Sprintf("Добавлены расходы\n%s: %.2f", args[0], sum))
+			err = f.sendMessage(message, f.language.T("Добавлены расходы\n%s: %s", args[0], f.language.Number(sum)))
 			if err != nil {
 				logrus.Errorf("finance consumer send message error: %v", err)
 				continue
@@ -87,13 +179,66 @@ func (f *Finance) Consume(ctx context.Context) {
 	}
 }
 
-func (f *Finance) sendMessage(message *tgbotapi.Message, text string) error {
-	msg := tgbotapi.NewMessage(message.Chat.ID, text)
-	msg.ReplyToMessageID = message.MessageID
+func (f *Finance) handleCommand(ctx context.Context, message *messenger.Message) error {
+	switch message.Command() {
+	case subscribe, unsubscribe:
+		period, ok := reportPeriod(message.CommandArguments())
+		if !ok {
+			return f.sendMessage(message, f.language.T("Укажите тип отчёта, например\n/%[1]s daily\n/%[1]s monthly", message.Command()))
+		}
+
+		newCtx, cancel := context.WithTimeout(ctx, 10*time.Second)
+		defer cancel()
+		if message.Command() == subscribe && !f.singleBot {
+			botName := f.tgNameDailyReporterBot
+			if period == service.MonthlyReport {
+				botName = f.tgNameMonthlyReporterBot
+			}
+			link, err := subscriptionLink(newCtx, f.subscriptions, f.username, period, botName)
+			if err != nil {
+				return err
+			}
+			return f.sendMessage(message, f.language.T("Перейдите по ссылке и нажмите \"Start\"\n%s", link))
+		}
+		if message.Command() == subscribe {
+			if err := f.subscriptions.Subscribe(newCtx, f.username, period, message.ChatID); err != nil {
+				return fmt.Errorf("couldn't subscribe: %v", err)
+			}
+			logrus.Debugf("%s subscribed to %s reports", f.username, period)
+			return f.sendMessage(message, f.language.T("Вы подписались на отчёты"))
+		}
+		if err := f.subscriptions.Unsubscribe(newCtx, f.username, period); err != nil {
+			return fmt.Errorf("couldn't unsubscribe: %v", err)
+		}
+		logrus.Debugf("%s unsubscribed from %s reports", f.username, period)
+		return f.sendMessage(message, f.language.T("Вы отписались от отчётов"))
+	case token:
+		return f.handleToken(ctx, message)
+	case ledger:
+		return f.handleLedger(ctx, message)
+	case register, login:
+		return f.sendMessage(message, f.language.T("Вы уже авторизованы! Что бы войти в другой аккаунт, сначала выйдите из этого командой /logout"))
+	default:
+		logrus.Debugf("finance consumer received unknown command: %s", message.Text)
+		return f.sendMessage(message, f.language.T("Неизвестная команда"))
+	}
+}
+
+// reportPeriod converts the argument of the subscribe command to the period of reports
+func reportPeriod(arg string) (string, bool) {
+	switch strings.TrimSpace(arg) {
+	case "daily":
+		return service.DailyReport, true
+	case "monthly":
+		return service.MonthlyReport, true
+	}
+	return "", false
+}
 
-	_, err := f.bot.Send(msg)
+func (f *Finance) sendMessage(message *messenger.Message, text string) error {
+	_, err := f.sender.Send(messenger.NewMessage(message, text))
 	if err != nil {
-		return fmt.Errorf("sendMessage, telegram bot couldn't send message: %v", err)
+		return fmt.Errorf("sendMessage, couldn't send message: %v", err)
 	}
 	return nil
 }
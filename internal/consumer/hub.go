@@ -2,165 +2,272 @@ package consumer
 
 import (
 	"context"
-	"fmt"
-	"github.com/chucky-1/finance/internal/producer"
+	"github.com/chucky-1/finance/internal/i18n"
+	"github.com/chucky-1/finance/internal/messenger"
 	"github.com/chucky-1/finance/internal/service"
 	"github.com/go-playground/validator/v10"
-	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
 	"github.com/sirupsen/logrus"
+	"time"
 )
 
 const (
 	start = "start"
 )
 
-var welcomeMessage = "Привет! Если вы хотите лучше контролировать свои расходы, я могу вам помочь! Каждый раз, когда вы тратите деньги, " +
+var welcomeMultiBotIntro = "Привет! Если вы хотите лучше контролировать свои расходы, я могу вам помочь! Каждый раз, когда вы тратите деньги, " +
 	"просто отправляйте мне сообщение со статьёй расходов и суммой.\n\n" +
 	"Я буду суммировать ваши расходы, а в конце дня, в 00:00 по вашему местному времени, отправлю отчёт за весь день.\n" +
 	"Так же, 1 числа каждого месяца я буду отправлять вам расходы за месяц.\n\n" +
 	"Что бы вы всегда имели быстрый доступ к нужным отчётам, я буду отправлять в отдельные каналы ежедневные и ежемесячные отчёты. " +
 	"А этот канал будет использоваться только для записи расходов.\n" +
-	"Соответственно, нужно будет подписаться ещё на 2 канала, но как это сделать я расскажу после регистрации.\n\n" +
-	"А сейчас, если вы готовы, нажмите\n" +
+	"Соответственно, нужно будет подписаться ещё на 2 канала, но как это сделать я расскажу после регистрации.\n\n"
+
+var welcomeSingleBotIntro = "Привет! Если вы хотите лучше контролировать свои расходы, я могу вам помочь! Каждый раз, когда вы тратите деньги, " +
+	"просто отправляйте мне сообщение со статьёй расходов и суммой.\n\n" +
+	"Я буду суммировать ваши расходы и, если вы захотите, в конце дня, в 00:00 по вашему местному времени, отправлю отчёт за весь день.\n" +
+	"Так же, 1 числа каждого месяца я могу отправлять вам расходы за месяц. Как подписаться на отчёты я расскажу после регистрации.\n\n"
+
+var welcomeCommands = "А сейчас, если вы готовы, нажмите\n" +
 	"/register\n" +
 	"Если у вас уже есть аккаунт, нажмите\n" +
 	"/login"
 
+// welcomeIntro returns the intro of the mode, the reports are in other bots or in the same chat
+func welcomeIntro(singleBot bool) string {
+	if singleBot {
+		return welcomeSingleBotIntro
+	}
+	return welcomeMultiBotIntro
+}
+
+// welcomeTelegramAccount follows the intro when accounts are linked to telegram users
+var welcomeTelegramAccount = "Аккаунт будет привязан к вашему Telegram, пароль не нужен. " +
+	"Если у вас уже есть аккаунт с паролем, нажмите /login, что бы привязать его"
+
+var registerInTelegramModeMessage = "Аккаунт создаётся командой /start, пароль не нужен. " +
+	"Если у вас уже есть аккаунт с паролем, нажмите /login, что бы привязать его к Telegram"
+
 type Hub struct {
-	bot                      *tgbotapi.BotAPI
-	updatesChan              tgbotapi.UpdatesChannel
-	validator                *validator.Validate
-	auth                     service.Authorization
-	recorder                 *service.Recorder
-	reporter                 *service.Reporter
-	authChannels             map[int64]chan tgbotapi.Update
-	financeChannels          map[int64]chan tgbotapi.Update
-	tgUsersCh                chan<- producer.TGUser
+	sender          messenger.Sender
+	messages        <-chan *messenger.Message
+	validator       *validator.Validate
+	auth            service.Authorization
+	recorder        *service.Recorder
+	reporter        *service.Reporter
+	subscriptions   *service.Subscription
+	tokens          *service.APIToken
+	sessions        *service.Session
+	settings        *service.Settings
+	ledgers         *service.Ledger
+	authChannels    map[int64]chan *messenger.Message
+	financeChannels map[int64]chan *messenger.Message
+	financeStops    map[int64]context.CancelFunc
+	// finish receives users authorized by auth consumers, ended receives chats whose sessions ended.
+	// The maps above are changed only by the hub goroutine
+	finish                   chan *finishData
+	ended                    chan int64
 	tgNameDailyReporterBot   string
 	tgNameMonthlyReporterBot string
+	// singleBot is true when this bot also delivers reports
+	singleBot bool
+	// telegramAccounts is true when accounts are linked to telegram users instead of passwords
+	telegramAccounts bool
 }
 
-func NewHub(bot *tgbotapi.BotAPI, updatesChan tgbotapi.UpdatesChannel, validator *validator.Validate,
-	auth service.Authorization, recorder *service.Recorder, reporter *service.Reporter, tgUsersCh chan producer.TGUser,
-	TGNameDailyReporterBot, TGNameMonthlyReporterBot string) *Hub {
+func NewHub(sender messenger.Sender, messages <-chan *messenger.Message, validator *validator.Validate,
+	auth service.Authorization, recorder *service.Recorder, reporter *service.Reporter, subscriptions *service.Subscription,
+	tokens *service.APIToken, sessions *service.Session, settings *service.Settings, ledgers *service.Ledger, TGNameDailyReporterBot, TGNameMonthlyReporterBot string, singleBot, telegramAccounts bool) *Hub {
 	return &Hub{
-		bot:                      bot,
-		updatesChan:              updatesChan,
+		sender:                   sender,
+		messages:                 messages,
 		validator:                validator,
 		auth:                     auth,
 		recorder:                 recorder,
 		reporter:                 reporter,
-		authChannels:             make(map[int64]chan tgbotapi.Update),
-		financeChannels:          make(map[int64]chan tgbotapi.Update),
-		tgUsersCh:                tgUsersCh,
+		subscriptions:            subscriptions,
+		tokens:                   tokens,
+		sessions:                 sessions,
+		settings:                 settings,
+		ledgers:                  ledgers,
+		authChannels:             make(map[int64]chan *messenger.Message),
+		financeChannels:          make(map[int64]chan *messenger.Message),
+		financeStops:             make(map[int64]context.CancelFunc),
+		finish:                   make(chan *finishData),
+		ended:                    make(chan int64),
 		tgNameDailyReporterBot:   TGNameDailyReporterBot,
 		tgNameMonthlyReporterBot: TGNameMonthlyReporterBot,
+		singleBot:                singleBot,
+		telegramAccounts:         telegramAccounts,
 	}
 }
 
 func (h *Hub) Consume(ctx context.Context) {
 	logrus.Info("hub consumer started")
+	h.restoreSessions(ctx)
 	for {
 		select {
 		case <-ctx.Done():
 			logrus.Infof("hub consumer stopped: %v", ctx.Err())
 			return
-		case update := <-h.updatesChan:
-			financeCh, ok := h.financeChannels[update.Message.Chat.ID]
-			if ok {
-				financeCh <- update
-				continue
+		case data := <-h.finish:
+			h.startFinanceConsumer(ctx, data)
+		case chatID := <-h.ended:
+			h.stopFinanceConsumer(chatID)
+		case message := <-h.messages:
+			h.handle(ctx, message)
+		}
+	}
+}
+
+func (h *Hub) handle(ctx context.Context, message *messenger.Message) {
+	financeCh, ok := h.financeChannels[message.ChatID]
+	if ok {
+		h.forward(ctx, financeCh, message)
+		return
+	}
+
+	if message.IsCommand() && h.telegramAccounts {
+		switch message.Command() {
+		case register:
+			text := i18n.Detect(message.Language).T(registerInTelegramModeMessage)
+			_, err := h.sender.Send(&messenger.OutgoingMessage{ChatID: message.ChatID, Text: text})
+			if err != nil {
+				logrus.Errorf("hub consumer couldn't send register message: %v", err)
 			}
+			return
+		case start:
+			// the auth consumer resumes the account of the telegram user or creates it
+			ch, ok := h.authChannels[message.ChatID]
+			if !ok {
+				ch = h.startAuthConsumer(ctx, message.ChatID)
+			}
+			h.forward(ctx, ch, message)
+			return
+		}
+	}
 
-			if update.Message.IsCommand() {
-				switch update.Message.Command() {
-				case register, login:
-					logrus.Debugf("received message in hub consumer to register or login from chat %d", update.Message.Chat.ID)
-					if h.authorized(update.Message.Chat.ID) {
-						logrus.Debugf("register/login error: user with chat %d already is authorized", update.Message.Chat.ID)
-						if err := h.sendMessage(update.Message, "Вы уже авторизованы!"); err != nil {
-							logrus.Errorf("register/login error: %v", err)
-							continue
-						}
-						continue
-					}
-
-					ch, ok := h.authChannels[update.Message.Chat.ID]
-					if !ok {
-						// first touch with the user
-						logrus.Debugf("first touch with the user with chat id %d", update.Message.Chat.ID)
-						newUpdatesChan, finishChan := h.startAuthConsumer(ctx, update.Message.Chat.ID)
-						newUpdatesChan <- update
-						go h.listenFinish(ctx, finishChan)
-						continue
-					}
-					ch <- update
-					continue
-				case start:
-					_, err := h.bot.Send(tgbotapi.NewMessage(update.Message.Chat.ID, welcomeMessage))
-					if err != nil {
-						logrus.Errorf("hub consumer couldn't send start message: %v", err)
-						continue
-					}
-					continue
-				default:
-					logrus.Debugf("unknown command: %s", update.Message.Text)
-					continue
-				}
+	if message.IsCommand() {
+		switch message.Command() {
+		case register, login:
+			logrus.Debugf("received message in hub consumer to register or login from chat %d", message.ChatID)
+			ch, ok := h.authChannels[message.ChatID]
+			if !ok {
+				// first touch with the user
+				logrus.Debugf("first touch with the user with chat id %d", message.ChatID)
+				ch = h.startAuthConsumer(ctx, message.ChatID)
+			}
+			h.forward(ctx, ch, message)
+			return
+		case start:
+			language := i18n.Detect(message.Language)
+			text := language.T(welcomeIntro(h.singleBot)) + language.T(welcomeCommands)
+			_, err := h.sender.Send(&messenger.OutgoingMessage{ChatID: message.ChatID, Text: text})
+			if err != nil {
+				logrus.Errorf("hub consumer couldn't send start message: %v", err)
+			}
+			return
+		case logout, sessions, settings:
+			text := i18n.Detect(message.Language).T("Вы не авторизованы")
+			_, err := h.sender.Send(&messenger.OutgoingMessage{ChatID: message.ChatID, Text: text})
+			if err != nil {
+				logrus.Errorf("hub consumer couldn't send message: %v", err)
 			}
+			return
+		default:
+			logrus.Debugf("unknown command %s from chat %d", message.Command(), message.ChatID)
+			return
+		}
+	}
+
+	authCh, ok := h.authChannels[message.ChatID]
+	if ok {
+		h.forward(ctx, authCh, message)
+		return
+	}
+	// the text isn't logged, it may be a password typed out of the flow
+	logrus.Debugf("hub consumer received message %d from chat %d without a consumer", message.ID, message.ChatID)
+}
 
-			authCh, ok := h.authChannels[update.Message.Chat.ID]
-			if ok {
-				authCh <- update
-				continue
+// forward passes the message to the consumer of the chat. The auth consumer may finish before it reads the message,
+// then the message goes to the finance consumer of the user
+func (h *Hub) forward(ctx context.Context, ch chan *messenger.Message, message *messenger.Message) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case ch <- message:
+			return
+		case data := <-h.finish:
+			h.startFinanceConsumer(ctx, data)
+			if data.chatID == message.ChatID {
+				ch = h.financeChannels[message.ChatID]
+			}
+		case chatID := <-h.ended:
+			h.stopFinanceConsumer(chatID)
+			if chatID == message.ChatID {
+				// the chat is logged out, so the message is handled like a message of a new chat
+				h.handle(ctx, message)
+				return
 			}
-			logrus.Debugf("recieved message: %s", update.Message.Text)
 		}
 	}
 }
 
-func (h *Hub) startAuthConsumer(ctx context.Context, chatID int64) (chan tgbotapi.Update, chan *finishData) {
-	finishChan := make(chan *finishData)
-	newUpdatesChan := make(chan tgbotapi.Update)
-	h.authChannels[chatID] = newUpdatesChan
-	authConsumer := NewAuth(h.bot, newUpdatesChan, h.validator, h.auth, h.reporter, finishChan, h.tgNameDailyReporterBot, h.tgNameMonthlyReporterBot)
+func (h *Hub) startAuthConsumer(ctx context.Context, chatID int64) chan *messenger.Message {
+	messages := make(chan *messenger.Message)
+	h.authChannels[chatID] = messages
+	authConsumer := NewAuth(h.sender, messages, h.validator, h.auth, h.reporter, h.subscriptions, h.sessions, h.finish,
+		h.tgNameDailyReporterBot, h.tgNameMonthlyReporterBot, h.singleBot, h.telegramAccounts)
 	go authConsumer.Consume(ctx)
-	return newUpdatesChan, finishChan
+	return messages
 }
 
-func (h *Hub) listenFinish(ctx context.Context, finishChan chan *finishData) {
-	select {
-	case <-ctx.Done():
-		return
-	case data := <-finishChan:
-		logrus.Debugf("hub received message in finish chat with chat id %d", data.chatID)
-		delete(h.authChannels, data.chatID)
-		financeChan := make(chan tgbotapi.Update)
-		h.financeChannels[data.chatID] = financeChan
-		go NewFinance(h.bot, data.username, financeChan, h.recorder).Consume(ctx)
-		h.tgUsersCh <- producer.TGUser{
-			TGUsername: data.tgUsername,
-			Username:   data.username,
-		}
-		logrus.Debugf("goroutine in hub for user %s stopped", data.username)
-	}
+func (h *Hub) startFinanceConsumer(ctx context.Context, data *finishData) {
+	logrus.Debugf("hub received message in finish chat with chat id %d", data.chatID)
+	delete(h.authChannels, data.chatID)
+	financeChan := make(chan *messenger.Message)
+	h.financeChannels[data.chatID] = financeChan
+	financeCtx, stop := context.WithCancel(ctx)
+	h.financeStops[data.chatID] = stop
+	go NewFinance(h.sender, data.username, data.timezone, data.session, financeChan, h.auth, h.recorder, h.subscriptions, h.tokens,
+		h.sessions, h.settings, h.ledgers, h.ended, h.tgNameDailyReporterBot, h.tgNameMonthlyReporterBot, h.singleBot).Consume(financeCtx)
 }
 
-func (h *Hub) authorized(chatID int64) bool {
-	_, ok := h.financeChannels[chatID]
+// stopFinanceConsumer is called when the session of the chat ended, the next messages of the chat need a new login
+func (h *Hub) stopFinanceConsumer(chatID int64) {
+	stop, ok := h.financeStops[chatID]
 	if !ok {
-		return false
+		return
 	}
-	return true
+	stop()
+	delete(h.financeStops, chatID)
+	delete(h.financeChannels, chatID)
+	logrus.Debugf("hub stopped finance consumer of chat %d", chatID)
 }
 
-func (h *Hub) sendMessage(message *tgbotapi.Message, text string) error {
-	msg := tgbotapi.NewMessage(message.Chat.ID, text)
-	msg.ReplyToMessageID = message.MessageID
-
-	_, err := h.bot.Send(msg)
+// restoreSessions starts finance consumers of chats which were logged in before the restart
+func (h *Hub) restoreSessions(ctx context.Context) {
+	newCtx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+	sessions, err := h.sessions.Restore(newCtx)
 	if err != nil {
-		return fmt.Errorf("sendMessage, telegram bot couldn't send message: %v", err)
+		logrus.Errorf("hub consumer couldn't restore sessions: %v", err)
+		return
+	}
+	restored := 0
+	for _, session := range sessions {
+		timezone, err := service.LoadLocation(session.Timezone)
+		if err != nil {
+			logrus.Errorf("hub consumer couldn't restore session of chat %d: %v", session.ChatID, err)
+			continue
+		}
+		h.startFinanceConsumer(ctx, &finishData{
+			username: session.Username,
+			timezone: timezone,
+			chatID:   session.ChatID,
+			session:  session,
+		})
+		restored++
 	}
-	return nil
+	logrus.Infof("hub consumer restored %d sessions", restored)
 }
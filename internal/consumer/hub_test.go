@@ -0,0 +1,1159 @@
+package consumer
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/go-playground/validator/v10"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/require"
+
+	"github.com/chucky-1/finance/internal/i18n"
+	"github.com/chucky-1/finance/internal/logging"
+	"github.com/chucky-1/finance/internal/messenger"
+	"github.com/chucky-1/finance/internal/model"
+	"github.com/chucky-1/finance/internal/repository"
+	"github.com/chucky-1/finance/internal/service"
+)
+
+const replyTimeout = time.Second
+
+type fakeAuth struct {
+	mu    sync.Mutex
+	users map[string]*model.User
+	// blocked is returned by Login instead of checking the password
+	blocked *service.LoginBlockedError
+}
+
+func (a *fakeAuth) Register(_ context.Context, user *model.User) error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.users[user.Username] = user
+	return nil
+}
+
+func (a *fakeAuth) Login(_ context.Context, username, password string, _ int64) (*model.User, error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if a.blocked != nil {
+		return nil, a.blocked
+	}
+	user, ok := a.users[username]
+	if !ok {
+		return nil, service.UserNotFoundErr
+	}
+	if user.Password != password {
+		return nil, service.WrongPasswordErr
+	}
+	return user, nil
+}
+
+func (a *fakeAuth) RegisterTelegram(_ context.Context, user *model.User) error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if user.Username == "" {
+		user.Username = "tg_" + strconv.FormatInt(user.TGUserID, 36)
+	}
+	a.users[user.Username] = user
+	return nil
+}
+
+func (a *fakeAuth) LoginTelegram(_ context.Context, tgUserID, _ int64) (*model.User, error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	for _, user := range a.users {
+		if user.TGUserID == tgUserID {
+			return user, nil
+		}
+	}
+	return nil, service.UserNotFoundErr
+}
+
+func (a *fakeAuth) LinkTelegram(_ context.Context, username string, tgUserID int64) error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	for _, user := range a.users {
+		if user.TGUserID == tgUserID && user.Username != username {
+			return service.TelegramLinkedErr
+		}
+	}
+	a.users[username].TGUserID = tgUserID
+	return nil
+}
+
+func (a *fakeAuth) ChangePassword(_ context.Context, username, oldPassword, newPassword string) error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	user, ok := a.users[username]
+	if !ok {
+		return service.UserNotFoundErr
+	}
+	if user.Password != "" && user.Password != oldPassword {
+		return service.WrongPasswordErr
+	}
+	user.Password = newPassword
+	return nil
+}
+
+// fakeUsers gives the settings access to the users of fakeAuth
+type fakeUsers struct {
+	auth *fakeAuth
+}
+
+func (u *fakeUsers) Create(context.Context, *model.User) error {
+	return nil
+}
+
+func (u *fakeUsers) Get(_ context.Context, username string) (*model.User, error) {
+	u.auth.mu.Lock()
+	defer u.auth.mu.Unlock()
+	user, ok := u.auth.users[username]
+	if !ok {
+		return nil, nil
+	}
+	copied := *user
+	return &copied, nil
+}
+
+func (u *fakeUsers) GetAll(context.Context) ([]*model.User, error) {
+	return nil, nil
+}
+
+func (u *fakeUsers) GetByTelegramID(context.Context, int64) (*model.User, error) {
+	return nil, nil
+}
+
+func (u *fakeUsers) SetTelegramID(context.Context, string, int64) error {
+	return nil
+}
+
+func (u *fakeUsers) UpdatePassword(context.Context, string, string) (bool, error) {
+	return false, nil
+}
+
+func (u *fakeUsers) UpdateTimezone(_ context.Context, username, country, timezone string) (bool, error) {
+	u.auth.mu.Lock()
+	defer u.auth.mu.Unlock()
+	user, ok := u.auth.users[username]
+	if !ok {
+		return false, nil
+	}
+	user.Country, user.Timezone = country, timezone
+	return true, nil
+}
+
+func (u *fakeUsers) UpdateReportTime(_ context.Context, username string, reportTime model.ReportTime) (bool, error) {
+	u.auth.mu.Lock()
+	defer u.auth.mu.Unlock()
+	user, ok := u.auth.users[username]
+	if !ok {
+		return false, nil
+	}
+	user.ReportTime = reportTime
+	return true, nil
+}
+
+func (u *fakeUsers) UpdateMonthStart(_ context.Context, username string, monthStart int) (bool, error) {
+	u.auth.mu.Lock()
+	defer u.auth.mu.Unlock()
+	user, ok := u.auth.users[username]
+	if !ok {
+		return false, nil
+	}
+	user.MonthStart = monthStart
+	return true, nil
+}
+
+func (u *fakeUsers) UpdateLanguage(_ context.Context, username, language string) (bool, error) {
+	u.auth.mu.Lock()
+	defer u.auth.mu.Unlock()
+	user, ok := u.auth.users[username]
+	if !ok {
+		return false, nil
+	}
+	user.Language = language
+	return true, nil
+}
+
+func (u *fakeUsers) SetChat(context.Context, string, int64) error {
+	return nil
+}
+
+func (u *fakeUsers) Delete(context.Context, string) (bool, error) {
+	return false, nil
+}
+
+// fakeRecorder keeps entries and ignores aggregated periods
+type fakeRecorder struct {
+	mu      sync.Mutex
+	entries []*model.Entry
+}
+
+func (r *fakeRecorder) Add(context.Context, *model.Entry, string) error {
+	return nil
+}
+
+func (r *fakeRecorder) AddEntry(_ context.Context, entry *model.Entry) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	entry.ID = fmt.Sprint(len(r.entries) + 1)
+	r.entries = append(r.entries, entry)
+	return nil
+}
+
+func (r *fakeRecorder) GetEntry(context.Context, string, string, string) (*model.Entry, error) {
+	return nil, repository.EntryNotFoundErr
+}
+
+func (r *fakeRecorder) GetEntries(_ context.Context, _, user string, from, to time.Time) ([]*model.Entry, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	entries := make([]*model.Entry, 0)
+	for _, entry := range r.entries {
+		if entry.User == user && !entry.Date.Before(from) && entry.Date.Before(to) {
+			entries = append(entries, entry)
+		}
+	}
+	return entries, nil
+}
+
+func (r *fakeRecorder) UpdateEntry(context.Context, *model.Entry) error {
+	return repository.EntryNotFoundErr
+}
+
+func (r *fakeRecorder) DeleteEntry(context.Context, string, string, string) error {
+	return repository.EntryNotFoundErr
+}
+
+type fakeSubscriptions struct {
+	mu            sync.Mutex
+	subscriptions map[string]*model.Subscription
+}
+
+func (s *fakeSubscriptions) Set(_ context.Context, subscription *model.Subscription) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.subscriptions[subscription.Username+subscription.Period] = subscription
+	return nil
+}
+
+func (s *fakeSubscriptions) Get(_ context.Context, username, period string) (*model.Subscription, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.subscriptions[username+period], nil
+}
+
+func (s *fakeSubscriptions) Delete(_ context.Context, username, period string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.subscriptions, username+period)
+	return nil
+}
+
+type fakeTokens struct{}
+
+func (fakeTokens) Add(context.Context, string, string, string, time.Time) error {
+	return nil
+}
+
+func (fakeTokens) Use(context.Context, string, string, time.Time) (string, error) {
+	return "", nil
+}
+
+type fakeAPITokens struct {
+	mu     sync.Mutex
+	tokens []*model.APIToken
+}
+
+func (f *fakeAPITokens) Add(_ context.Context, token *model.APIToken, _ string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for _, t := range f.tokens {
+		if t.Name == token.Name {
+			return repository.DuplicateAPITokenErr
+		}
+	}
+	f.tokens = append(f.tokens, token)
+	return nil
+}
+
+func (f *fakeAPITokens) GetAll(context.Context, string) ([]*model.APIToken, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.tokens, nil
+}
+
+func (f *fakeAPITokens) Delete(_ context.Context, _, name string) (bool, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for i, t := range f.tokens {
+		if t.Name == name {
+			f.tokens = append(f.tokens[:i], f.tokens[i+1:]...)
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func (f *fakeAPITokens) Use(context.Context, string, time.Time) (*model.APIToken, error) {
+	return nil, nil
+}
+
+// fakeSessions keeps sessions by chats
+type fakeSessions struct {
+	mu       sync.Mutex
+	sessions map[int64]*model.Session
+}
+
+func (f *fakeSessions) Create(_ context.Context, session *model.Session) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	copied := *session
+	f.sessions[session.ChatID] = &copied
+	return nil
+}
+
+func (f *fakeSessions) GetAll(_ context.Context, username string) ([]*model.Session, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	sessions := make([]*model.Session, 0)
+	for _, session := range f.sessions {
+		if session.Username == username {
+			copied := *session
+			sessions = append(sessions, &copied)
+		}
+	}
+	sort.Slice(sessions, func(i, j int) bool { return sessions[i].ChatID < sessions[j].ChatID })
+	return sessions, nil
+}
+
+func (f *fakeSessions) GetActive(_ context.Context, since time.Time) ([]*model.Session, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	sessions := make([]*model.Session, 0)
+	for _, session := range f.sessions {
+		if !session.LastSeenAt.Before(since) {
+			copied := *session
+			sessions = append(sessions, &copied)
+		}
+	}
+	return sessions, nil
+}
+
+func (f *fakeSessions) Touch(_ context.Context, username string, chatID int64, now time.Time) (bool, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	session, ok := f.sessions[chatID]
+	if !ok || session.Username != username {
+		return false, nil
+	}
+	session.LastSeenAt = now
+	return true, nil
+}
+
+func (f *fakeSessions) Exists(_ context.Context, username string, chatID int64) (bool, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	session, ok := f.sessions[chatID]
+	return ok && session.Username == username, nil
+}
+
+func (f *fakeSessions) Delete(_ context.Context, username string, chatID int64) (bool, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	session, ok := f.sessions[chatID]
+	if !ok || session.Username != username {
+		return false, nil
+	}
+	delete(f.sessions, chatID)
+	return true, nil
+}
+
+func (f *fakeSessions) DeleteIdle(context.Context, time.Time) (int64, error) {
+	return 0, nil
+}
+
+// fakeLedgers keeps ledgers with roles of their members, invites are kept by hashes until they're used
+type fakeLedgers struct {
+	mu      sync.Mutex
+	ledgers []*model.Ledger
+	members map[int64]map[string]string
+	invites map[string]*model.Membership
+}
+
+func (f *fakeLedgers) Create(_ context.Context, ledger *model.Ledger) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.ledgers = append(f.ledgers, ledger)
+	ledger.ID = int64(len(f.ledgers))
+	f.members[ledger.ID] = map[string]string{ledger.Owner: model.OwnerRole}
+	return nil
+}
+
+func (f *fakeLedgers) GetAll(_ context.Context, username string) ([]*model.Membership, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	memberships := make([]*model.Membership, 0)
+	for _, ledger := range f.ledgers {
+		if role, ok := f.members[ledger.ID][username]; ok {
+			memberships = append(memberships, &model.Membership{Ledger: ledger, Role: role})
+		}
+	}
+	return memberships, nil
+}
+
+func (f *fakeLedgers) GetMembership(_ context.Context, ledgerID int64, username string) (*model.Membership, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	role, ok := f.members[ledgerID][username]
+	if !ok {
+		return nil, nil
+	}
+	return &model.Membership{Ledger: f.ledgers[ledgerID-1], Role: role}, nil
+}
+
+func (f *fakeLedgers) GetMembers(_ context.Context, ledgerID int64) ([]*model.LedgerMember, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	members := make([]*model.LedgerMember, 0)
+	for username, role := range f.members[ledgerID] {
+		members = append(members, &model.LedgerMember{LedgerID: ledgerID, Username: username, Role: role})
+	}
+	sort.Slice(members, func(i, j int) bool { return members[i].Username < members[j].Username })
+	return members, nil
+}
+
+func (f *fakeLedgers) DeleteMember(_ context.Context, ledgerID int64, username string) (bool, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	role, ok := f.members[ledgerID][username]
+	if !ok || role == model.OwnerRole {
+		return false, nil
+	}
+	delete(f.members[ledgerID], username)
+	return true, nil
+}
+
+func (f *fakeLedgers) AddInvite(_ context.Context, hash string, ledgerID int64, role string, _ time.Time) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.invites[hash] = &model.Membership{Ledger: f.ledgers[ledgerID-1], Role: role}
+	return nil
+}
+
+func (f *fakeLedgers) Join(_ context.Context, hash, username string, _ time.Time) (*model.Membership, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	invite, ok := f.invites[hash]
+	if !ok {
+		return nil, nil
+	}
+	if _, ok = f.members[invite.Ledger.ID][username]; ok {
+		return nil, repository.DuplicateLedgerMemberErr
+	}
+	delete(f.invites, hash)
+	f.members[invite.Ledger.ID][username] = invite.Role
+	return invite, nil
+}
+
+type testHub struct {
+	fake          *messenger.Fake
+	auth          *fakeAuth
+	recorder      *fakeRecorder
+	subscriptions *fakeSubscriptions
+	tokens        *fakeAPITokens
+	sessions      *fakeSessions
+	ledgers       *fakeLedgers
+	reporter      *service.Reporter
+}
+
+// sessionIdleTimeout of test hubs
+const sessionIdleTimeout = 24 * time.Hour
+
+// startHub starts the hub, the sessions are restored like after a restart
+func startHub(t *testing.T, singleBot, telegramAccounts bool, sessions ...*model.Session) *testHub {
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+
+	h := &testHub{
+		fake:          messenger.NewFake(),
+		auth:          &fakeAuth{users: make(map[string]*model.User)},
+		recorder:      &fakeRecorder{},
+		subscriptions: &fakeSubscriptions{subscriptions: make(map[string]*model.Subscription)},
+		tokens:        &fakeAPITokens{},
+		sessions:      &fakeSessions{sessions: make(map[int64]*model.Session)},
+		ledgers:       &fakeLedgers{members: make(map[int64]map[string]string), invites: make(map[string]*model.Membership)},
+		reporter:      service.NewReporter(nil, nil, nil, nil, nil),
+	}
+	for _, session := range sessions {
+		h.sessions.sessions[session.ChatID] = session
+	}
+	recorder := service.NewRecorder(h.recorder, h.recorder)
+	hub := NewHub(h.fake, h.fake.Messages(), validator.New(), h.auth, recorder,
+		h.reporter, service.NewSubscription(h.subscriptions, fakeTokens{}, "secret"), service.NewAPIToken(h.tokens, nil),
+		service.NewSession(h.sessions, sessionIdleTimeout), service.NewSettings(&fakeUsers{auth: h.auth}, h.reporter, recorder),
+		service.NewLedger(h.ledgers, h.recorder), "@daily_bot", "@monthly_bot", singleBot, telegramAccounts)
+	go hub.Consume(ctx)
+	return h
+}
+
+// say writes the text to the chat and returns the replies of the bot
+func (h *testHub) say(t *testing.T, chatID int64, text string, replies int) []*messenger.OutgoingMessage {
+	h.fake.Write(chatID, chatID, text)
+	messages := make([]*messenger.OutgoingMessage, replies)
+	for i := range messages {
+		messages[i] = h.fake.Read(replyTimeout)
+		require.NotNilf(t, messages[i], "reply %d to %q wasn't sent", i+1, text)
+		require.Equal(t, chatID, messages[i].ChatID)
+	}
+	return messages
+}
+
+// sayLocation shares the location in the chat and returns the reply of the bot
+func (h *testHub) sayLocation(t *testing.T, chatID int64, latitude, longitude float64) *messenger.OutgoingMessage {
+	h.fake.WriteLocation(chatID, chatID, latitude, longitude)
+	reply := h.fake.Read(replyTimeout)
+	require.NotNil(t, reply, "reply to the location wasn't sent")
+	return reply
+}
+
+func (h *testHub) register(t *testing.T, chatID int64, username, password string) {
+	h.say(t, chatID, "/register", 1)
+	h.say(t, chatID, username, 1)
+	h.say(t, chatID, "Belarus (GMT+3)", 1)
+	h.say(t, chatID, password, 3)
+}
+
+func TestHub_Register(t *testing.T) {
+	h := startHub(t, true, false)
+
+	replies := h.say(t, 1, "/start", 1)
+	require.Equal(t, welcomeSingleBotIntro+welcomeCommands, replies[0].Text)
+
+	replies = h.say(t, 1, "/register", 1)
+	require.Equal(t, fmt.Sprintf("Введите имя пользователя. Минимум %d, максимум %d символов", usernameMinLength, usernameMaxLength), replies[0].Text)
+
+	replies = h.say(t, 1, "dima", 1)
+	require.Equal(t, chooseCountryMessage, replies[0].Text)
+	require.NotNil(t, replies[0].Keyboard)
+	require.Contains(t, replies[0].Keyboard.Rows, []string{"Belarus (GMT+3)"})
+
+	replies = h.say(t, 1, "Belarus (GMT+3)", 1)
+	require.Equal(t, fmt.Sprintf("Введите пароль. Максимум %d символов", passwordMaxLength), replies[0].Text)
+	require.True(t, replies[0].RemoveKeyboard)
+
+	replies = h.say(t, 1, "secret", 3)
+	require.Equal(t, "Спасибо, dima! Вы успешно зарегистрировались", replies[0].Text)
+	require.Equal(t, explainingSingleBotSubscriptionMessage, replies[1].Text)
+	require.Equal(t, explainingCommunicationMessage, replies[2].Text)
+	require.Equal(t, &model.User{Username: "dima", Password: "secret", Country: "Belarus", Timezone: "Europe/Minsk", ChatID: 1, Language: "ru"},
+		h.auth.users["dima"])
+
+	replies = h.say(t, 1, "Кофе 3.5", 1)
+	require.Equal(t, "Добавлены расходы\nКофе: 3,50", replies[0].Text)
+	h.recorder.mu.Lock()
+	defer h.recorder.mu.Unlock()
+	require.NotEmpty(t, h.recorder.entries)
+	require.Equal(t, "dima", h.recorder.entries[0].User)
+	require.Equal(t, &model.Category{Name: "Кофе", Amount: 3.5}, h.recorder.entries[0].Category)
+}
+
+func TestHub_RegisterWithInvalidUsername(t *testing.T) {
+	h := startHub(t, true, false)
+
+	h.say(t, 1, "/register", 1)
+	replies := h.say(t, 1, "di", 1)
+	require.Equal(t, "Вы ввели некорректное имя пользователя. Попробуйте ещё раз!", replies[0].Text)
+
+	replies = h.say(t, 1, "ledger:1", 1)
+	require.Equal(t, "Имя пользователя может содержать только латинские буквы, цифры и _. Попробуйте ещё раз!", replies[0].Text)
+
+	replies = h.say(t, 1, "dima", 1)
+	require.Equal(t, chooseCountryMessage, replies[0].Text)
+}
+
+func TestHub_Login(t *testing.T) {
+	h := startHub(t, true, false)
+	h.auth.users["dima"] = &model.User{Username: "dima", Password: "secret", Timezone: "Europe/Minsk"}
+
+	h.say(t, 1, "/login", 1)
+	h.say(t, 1, "dima", 1)
+	replies := h.say(t, 1, "wrong", 1)
+	require.Equal(t, "Вы ввели неверное имя пользователя или пароль. Попробуйте ещё раз! Введите ваше имя пользователя", replies[0].Text)
+
+	h.say(t, 1, "dima", 1)
+	replies = h.say(t, 1, "secret", 3)
+	require.Equal(t, "dima, вы авторизованы!", replies[0].Text)
+
+	replies = h.say(t, 1, "/login", 1)
+	require.Equal(t, "Вы уже авторизованы! Что бы войти в другой аккаунт, сначала выйдите из этого командой /logout", replies[0].Text)
+}
+
+// syncBuffer is written by consumers and read by tests
+type syncBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *syncBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *syncBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.String()
+}
+
+func TestHub_PasswordsAreDeletedAndNotLogged(t *testing.T) {
+	var logs syncBuffer
+	level, out, formatter := logrus.GetLevel(), logrus.StandardLogger().Out, logrus.StandardLogger().Formatter
+	logrus.SetLevel(logrus.DebugLevel)
+	logrus.SetOutput(&logs)
+	logrus.SetFormatter(logging.NewRedactor(&logrus.TextFormatter{}))
+	t.Cleanup(func() {
+		logrus.SetLevel(level)
+		logrus.SetOutput(out)
+		logrus.SetFormatter(formatter)
+	})
+
+	h := startHub(t, true, false)
+	h.register(t, 1, "dima", "Qw3rty_pass")
+	require.Equal(t, []int{7}, h.fake.Deleted(1))
+
+	h.say(t, 2, "/login", 1)
+	h.say(t, 2, "dima", 1)
+	h.say(t, 2, "Wr0ng_pass", 1)
+	h.say(t, 2, "dima", 1)
+	h.say(t, 2, "Qw3rty_pass", 3)
+	require.Equal(t, []int{5, 9}, h.fake.Deleted(2))
+
+	// the password is typed in the chat without a flow, the hub handles it before the command
+	h.say(t, 3, "Str4y_pass", 0)
+	h.say(t, 3, "/login", 1)
+
+	require.Contains(t, logs.String(), "dima")
+	require.NotContains(t, logs.String(), "Qw3rty_pass")
+	require.NotContains(t, logs.String(), "Wr0ng_pass")
+	require.NotContains(t, logs.String(), "Str4y_pass")
+}
+
+func TestHub_LoginBlocked(t *testing.T) {
+	h := startHub(t, true, false)
+	h.auth.users["dima"] = &model.User{Username: "dima", Password: "secret", Timezone: "Europe/Minsk", ChatID: 1}
+	h.auth.blocked = &service.LoginBlockedError{Until: time.Now().Add(30 * time.Second)}
+
+	h.say(t, 2, "/login", 1)
+	h.say(t, 2, "dima", 1)
+	replies := h.say(t, 2, "wrong", 1)
+	require.Regexp(t, `^Слишком много неудачных попыток входа. Попробуйте ещё раз через \d+ сек.`, replies[0].Text)
+
+	h.auth.mu.Lock()
+	h.auth.blocked = &service.LoginBlockedError{Until: time.Now().Add(time.Hour), Locked: true, OwnerChatID: 1}
+	h.auth.mu.Unlock()
+	h.say(t, 2, "dima", 1)
+	h.fake.Write(2, 2, "wrong")
+	notification := h.fake.Read(replyTimeout)
+	require.NotNil(t, notification)
+	require.Equal(t, int64(1), notification.ChatID)
+	require.Equal(t, fmt.Sprintf(accountLockedOwnerMessage, "60 мин."), notification.Text)
+	reply := h.fake.Read(replyTimeout)
+	require.NotNil(t, reply)
+	require.Equal(t, int64(2), reply.ChatID)
+	require.Contains(t, reply.Text, "Аккаунт временно заблокирован")
+}
+
+func TestHub_TelegramAccount(t *testing.T) {
+	h := startHub(t, true, true)
+
+	replies := h.say(t, 1, "/register", 1)
+	require.Equal(t, registerInTelegramModeMessage, replies[0].Text)
+
+	replies = h.say(t, 1, "/start", 1)
+	require.Equal(t, welcomeSingleBotIntro+welcomeTelegramAccount+"\n\n"+chooseCountryMessage, replies[0].Text)
+	require.NotNil(t, replies[0].Keyboard)
+
+	replies = h.say(t, 1, "Poland (GMT+2)", 3)
+	require.Equal(t, "Спасибо, tg_1! Вы успешно зарегистрировались", replies[0].Text)
+	require.Equal(t, &model.User{Username: "tg_1", Country: "Poland", Timezone: "Europe/Warsaw", ChatID: 1, TGUserID: 1, Language: "ru"},
+		h.auth.users["tg_1"])
+
+	replies = h.say(t, 1, "Кофе 3.5", 1)
+	require.Equal(t, "Добавлены расходы\nКофе: 3,50", replies[0].Text)
+}
+
+func TestHub_RegisterWithCitySearch(t *testing.T) {
+	h := startHub(t, true, false)
+	h.say(t, 1, "/register", 1)
+	replies := h.say(t, 1, "dima", 1)
+	require.Equal(t, locationButton, replies[0].Keyboard.LocationButton)
+
+	replies = h.say(t, 1, "Атлантида", 1)
+	require.Equal(t, cityNotFoundMessage, replies[0].Text)
+	require.Contains(t, replies[0].Keyboard.Rows, []string{"Belarus (GMT+3)"})
+
+	replies = h.say(t, 1, "Гродно", 1)
+	require.Equal(t, "Grodno, Belarus, часовой пояс Europe/Minsk (GMT+3). Всё верно?", replies[0].Text)
+	require.Equal(t, messenger.NewKeyboard(confirmTimezoneButton, rejectTimezoneButton), replies[0].Keyboard)
+
+	replies = h.say(t, 1, rejectTimezoneButton, 1)
+	require.Equal(t, chooseTimezoneAgainMessage, replies[0].Text)
+
+	replies = h.say(t, 1, "Kathmandu", 1)
+	require.Equal(t, "Kathmandu, Nepal, часовой пояс Asia/Kathmandu (GMT+5.45). Всё верно?", replies[0].Text)
+	// the answer isn't on the buttons, the question is asked again
+	replies = h.say(t, 1, "Может быть", 1)
+	require.Equal(t, "Kathmandu, Nepal, часовой пояс Asia/Kathmandu (GMT+5.45). Всё верно?", replies[0].Text)
+
+	replies = h.say(t, 1, confirmTimezoneButton, 1)
+	require.Equal(t, fmt.Sprintf("Введите пароль. Максимум %d символов", passwordMaxLength), replies[0].Text)
+	h.say(t, 1, "secret", 3)
+	require.Equal(t, &model.User{Username: "dima", Password: "secret", Country: "Nepal", Timezone: "Asia/Kathmandu", ChatID: 1, Language: "ru"},
+		h.auth.users["dima"])
+}
+
+func TestHub_TelegramAccountWithLocation(t *testing.T) {
+	h := startHub(t, true, true)
+	replies := h.say(t, 1, "/start", 1)
+	require.Equal(t, locationButton, replies[0].Keyboard.LocationButton)
+
+	// the location is near Warsaw
+	reply := h.sayLocation(t, 1, 52.17, 20.81)
+	require.Contains(t, reply.Text, "Warsaw, Poland, часовой пояс Europe/Warsaw")
+
+	replies = h.say(t, 1, confirmTimezoneButton, 3)
+	require.Equal(t, "Спасибо, tg_1! Вы успешно зарегистрировались", replies[0].Text)
+	require.Equal(t, &model.User{Username: "tg_1", Country: "Poland", Timezone: "Europe/Warsaw", ChatID: 1, TGUserID: 1, Language: "ru"},
+		h.auth.users["tg_1"])
+}
+
+func TestHub_TelegramAccountIsResumed(t *testing.T) {
+	h := startHub(t, true, true)
+	h.auth.users["dima"] = &model.User{Username: "dima", Timezone: "Europe/Minsk", TGUserID: 1}
+
+	replies := h.say(t, 1, "/start", 1)
+	require.Equal(t, "С возвращением, dima!", replies[0].Text)
+
+	replies = h.say(t, 1, "Кофе 3.5", 1)
+	require.Equal(t, "Добавлены расходы\nКофе: 3,50", replies[0].Text)
+}
+
+func TestHub_LoginLinksTelegramAccount(t *testing.T) {
+	h := startHub(t, true, true)
+	h.auth.users["dima"] = &model.User{Username: "dima", Password: "secret", Timezone: "Europe/Minsk"}
+
+	h.say(t, 1, "/login", 1)
+	h.say(t, 1, "dima", 1)
+	replies := h.say(t, 1, "secret", 4)
+	require.Equal(t, "dima, вы авторизованы!", replies[0].Text)
+	require.Equal(t, "Аккаунт привязан к вашему Telegram, теперь для входа достаточно нажать /start", replies[1].Text)
+	require.Equal(t, int64(1), h.auth.users["dima"].TGUserID)
+}
+
+func TestHub_Subscribe(t *testing.T) {
+	h := startHub(t, true, false)
+	h.register(t, 1, "dima", "secret")
+
+	replies := h.say(t, 1, "/subscribe daily", 1)
+	require.Equal(t, "Вы подписались на отчёты", replies[0].Text)
+	require.Equal(t, &model.Subscription{Username: "dima", Period: service.DailyReport, ChatID: 1},
+		h.subscriptions.subscriptions["dima"+service.DailyReport])
+
+	replies = h.say(t, 1, "/unsubscribe daily", 1)
+	require.Equal(t, "Вы отписались от отчётов", replies[0].Text)
+	require.Empty(t, h.subscriptions.subscriptions)
+}
+
+func TestHub_SubscribeViaReporterBot(t *testing.T) {
+	h := startHub(t, false, false)
+	h.register(t, 1, "dima", "secret")
+
+	replies := h.say(t, 1, "/subscribe monthly", 1)
+	require.Regexp(t, `https://t\.me/monthly_bot\?start=\S{32}$`, replies[0].Text)
+}
+
+func TestHub_ChatsAreIndependent(t *testing.T) {
+	h := startHub(t, true, false)
+	h.register(t, 1, "dima", "secret")
+
+	h.say(t, 2, "/register", 1)
+	replies := h.say(t, 1, "Кофе 3.5", 1)
+	require.Equal(t, "Добавлены расходы\nКофе: 3,50", replies[0].Text)
+
+	replies = h.say(t, 2, "anna", 1)
+	require.Equal(t, chooseCountryMessage, replies[0].Text)
+}
+
+func TestHub_APITokens(t *testing.T) {
+	h := startHub(t, true, false)
+	h.register(t, 1, "dima", "secret")
+
+	replies := h.say(t, 1, "/token new script write", 1)
+	require.Regexp(t, `Токен script \(write\) создан:\n\nfin_\S+\n`, replies[0].Text)
+
+	replies = h.say(t, 1, "/token new script", 1)
+	require.Equal(t, "Токен script уже существует", replies[0].Text)
+
+	replies = h.say(t, 1, "/token new dashboard admin", 1)
+	require.Equal(t, tokenUsageMessage, replies[0].Text)
+
+	replies = h.say(t, 1, "/token list", 1)
+	require.Contains(t, replies[0].Text, "script (write), создан")
+	require.Contains(t, replies[0].Text, "не использовался")
+
+	replies = h.say(t, 1, "/token revoke script", 1)
+	require.Equal(t, "Токен script отозван", replies[0].Text)
+
+	replies = h.say(t, 1, "/token revoke script", 1)
+	require.Equal(t, "Токен script не найден", replies[0].Text)
+
+	replies = h.say(t, 1, "/token list", 1)
+	require.Equal(t, "У вас нет токенов", replies[0].Text)
+}
+
+func TestHub_SharedLedger(t *testing.T) {
+	h := startHub(t, true, false)
+	h.register(t, 1, "dima", "secret")
+	h.register(t, 2, "anna", "secret")
+	h.register(t, 3, "oleg", "secret")
+
+	replies := h.say(t, 1, "/ledger new Дом", 1)
+	require.True(t, strings.HasPrefix(replies[0].Text, "Бюджет \"Дом\" создан, его номер 1."))
+
+	// the owner invites, so the code is for one member only
+	replies = h.say(t, 2, "/ledger invite 1 editor", 1)
+	require.Equal(t, "Бюджет 1 не найден", replies[0].Text)
+	replies = h.say(t, 1, "/ledger invite 1 editor", 1)
+	code := regexp.MustCompile(`:\n\n(\S+)\n`).FindStringSubmatch(replies[0].Text)
+	require.Len(t, code, 2)
+	replies = h.say(t, 2, "/ledger join "+code[1], 1)
+	require.Equal(t, "Вы вступили в бюджет \"Дом\", его номер 1, ваша роль: редактор", replies[0].Text)
+	replies = h.say(t, 3, "/ledger join "+code[1], 1)
+	require.Equal(t, "Код приглашения неверный, уже использован или истёк", replies[0].Text)
+
+	replies = h.say(t, 1, "/ledger invite 1 viewer", 1)
+	code = regexp.MustCompile(`:\n\n(\S+)\n`).FindStringSubmatch(replies[0].Text)
+	h.say(t, 3, "/ledger join "+code[1], 1)
+	replies = h.say(t, 3, "/ledger use 1", 1)
+	require.Equal(t, "В бюджете \"Дом\" вы только смотрите отчёты и не можете записывать расходы", replies[0].Text)
+
+	h.say(t, 1, "/ledger use 1", 1)
+	h.say(t, 2, "/ledger use 1", 1)
+	replies = h.say(t, 1, "Еда 5", 1)
+	require.Equal(t, "Добавлены расходы в бюджет \"Дом\"\nЕда: 5,00", replies[0].Text)
+	h.say(t, 2, "Еда 10", 1)
+	h.say(t, 2, "Такси 7,5", 1)
+	replies = h.say(t, 2, "/ledger use personal", 1)
+	require.Equal(t, "Расходы снова записываются в ваш личный бюджет", replies[0].Text)
+	h.say(t, 2, "Кофе 3", 1)
+
+	replies = h.say(t, 3, "/ledger report 1", 1)
+	require.True(t, strings.HasPrefix(replies[0].Text, "Бюджет \"Дом\", расходы с 1 "))
+	require.True(t, strings.HasSuffix(replies[0].Text, "\nЕда - 15,00\nТакси - 7,50\nИтого - 22,50"))
+	replies = h.say(t, 3, "/ledger report 1 members", 1)
+	require.True(t, strings.HasSuffix(replies[0].Text, "\nИтого - 22,50\n\n"+
+		"anna\nЕда - 10,00\nТакси - 7,50\nИтого - 17,50\n\n"+
+		"dima\nЕда - 5,00\nИтого - 5,00"))
+
+	replies = h.say(t, 1, "/ledger members 1", 1)
+	require.Equal(t, "Участники бюджета 1:\n\nanna - редактор\ndima - владелец\noleg - наблюдатель", replies[0].Text)
+	replies = h.say(t, 1, "/ledger leave 1", 1)
+	require.Equal(t, "Владелец не может выйти из своего бюджета", replies[0].Text)
+	h.say(t, 2, "/ledger use 1", 1)
+	replies = h.say(t, 1, "/ledger remove 1 anna", 1)
+	require.Equal(t, "anna удалён из бюджета 1", replies[0].Text)
+	replies = h.say(t, 2, "Еда 1", 1)
+	require.Equal(t, "Вы больше не можете записывать расходы в бюджет \"Дом\". "+
+		"Расходы не добавлены, теперь они записываются в ваш личный бюджет", replies[0].Text)
+	replies = h.say(t, 2, "/ledger list", 1)
+	require.Equal(t, "У вас нет общих бюджетов. Создайте бюджет командой\n/ledger new <название>", replies[0].Text)
+
+	h.recorder.mu.Lock()
+	defer h.recorder.mu.Unlock()
+	require.Len(t, h.recorder.entries, 4)
+	require.Equal(t, model.LedgerKey(1), h.recorder.entries[0].User)
+	require.Equal(t, "dima", h.recorder.entries[0].Member)
+	require.Equal(t, "anna", h.recorder.entries[3].User)
+	require.Empty(t, h.recorder.entries[3].Member)
+}
+
+func TestHub_Logout(t *testing.T) {
+	h := startHub(t, true, false)
+	h.register(t, 1, "dima", "secret")
+	require.Contains(t, h.sessions.sessions, int64(1))
+
+	replies := h.say(t, 1, "/logout", 1)
+	require.Equal(t, loggedOutMessage, replies[0].Text)
+	require.Empty(t, h.sessions.sessions)
+
+	replies = h.say(t, 1, "/sessions", 1)
+	require.Equal(t, "Вы не авторизованы", replies[0].Text)
+
+	h.auth.users["anna"] = &model.User{Username: "anna", Password: "secret", Timezone: "Europe/Warsaw"}
+	h.say(t, 1, "/login", 1)
+	h.say(t, 1, "anna", 1)
+	replies = h.say(t, 1, "secret", 3)
+	require.Equal(t, "anna, вы авторизованы!", replies[0].Text)
+	require.Equal(t, "anna", h.sessions.sessions[1].Username)
+}
+
+func TestHub_SessionsOfSeveralChats(t *testing.T) {
+	h := startHub(t, true, false)
+	h.register(t, 1, "dima", "secret")
+	h.say(t, 2, "/login", 1)
+	h.say(t, 2, "dima", 1)
+	h.say(t, 2, "secret", 3)
+
+	replies := h.say(t, 2, "/sessions", 1)
+	require.Regexp(t, `^Ваши сеансы:\n\n1\. чат 1, вход .+\n2\. этот чат, вход `, replies[0].Text)
+
+	h.fake.Write(2, 2, "/sessions revoke 1")
+	notification := h.fake.Read(replyTimeout)
+	require.NotNil(t, notification)
+	require.Equal(t, int64(1), notification.ChatID)
+	require.Equal(t, sessionRevokedMessage, notification.Text)
+	reply := h.fake.Read(replyTimeout)
+	require.NotNil(t, reply)
+	require.Equal(t, "Сеанс 1 завершён", reply.Text)
+
+	replies = h.say(t, 1, "/sessions", 1)
+	require.Equal(t, "Вы не авторизованы", replies[0].Text)
+	replies = h.say(t, 2, "Кофе 3.5", 1)
+	require.Equal(t, "Добавлены расходы\nКофе: 3,50", replies[0].Text)
+}
+
+func TestHub_RestoresSessions(t *testing.T) {
+	now := time.Now().UTC()
+	h := startHub(t, true, false,
+		&model.Session{ChatID: 1, Username: "dima", CreatedAt: now.Add(-time.Hour), LastSeenAt: now.Add(-time.Hour), Timezone: "Europe/Minsk"},
+		&model.Session{ChatID: 2, Username: "anna", CreatedAt: now.Add(-48 * time.Hour), LastSeenAt: now.Add(-25 * time.Hour), Timezone: "Europe/Warsaw"},
+	)
+
+	replies := h.say(t, 1, "Кофе 3.5", 1)
+	require.Equal(t, "Добавлены расходы\nКофе: 3,50", replies[0].Text)
+	require.True(t, h.sessions.sessions[1].LastSeenAt.After(now.Add(-time.Minute)))
+
+	// the idle session isn't restored
+	h.fake.Write(2, 2, "Кофе 3.5")
+	require.Nil(t, h.fake.Read(100*time.Millisecond))
+}
+
+func TestHub_IdleSessionExpires(t *testing.T) {
+	// the session is restored and expires a moment later
+	lastSeen := time.Now().UTC().Add(-sessionIdleTimeout + 200*time.Millisecond)
+	h := startHub(t, true, false, &model.Session{ChatID: 1, Username: "dima", CreatedAt: lastSeen, LastSeenAt: lastSeen, Timezone: "Europe/Minsk"})
+	time.Sleep(300 * time.Millisecond)
+
+	replies := h.say(t, 1, "Кофе 3.5", 1)
+	require.Equal(t, sessionExpiredMessage, replies[0].Text)
+	require.Empty(t, h.sessions.sessions)
+	require.Empty(t, h.recorder.entries)
+}
+
+func TestHub_SessionDeletedByAnotherProcess(t *testing.T) {
+	h := startHub(t, true, false)
+	h.register(t, 1, "dima", "secret")
+
+	// the user is deleted by the command line while the service is running
+	h.sessions.mu.Lock()
+	delete(h.sessions.sessions, 1)
+	h.sessions.mu.Unlock()
+
+	replies := h.say(t, 1, "Кофе 3.5", 1)
+	require.Equal(t, sessionRevokedMessage, replies[0].Text)
+	require.Empty(t, h.recorder.entries)
+	replies = h.say(t, 1, "/sessions", 1)
+	require.Equal(t, "Вы не авторизованы", replies[0].Text)
+}
+
+func TestHub_SettingsChangeTimezone(t *testing.T) {
+	h := startHub(t, true, false)
+	h.register(t, 1, "dima", "secret")
+
+	replies := h.say(t, 1, "/settings", 1)
+	require.Equal(t, settingsMenuMessage, replies[0].Text)
+	require.Equal(t, messenger.NewKeyboard(settingsCountryButton, settingsReportTimeButton, settingsMonthStartButton, settingsLanguageButton,
+		settingsPasswordButton, settingsProfileButton), replies[0].Keyboard)
+
+	replies = h.say(t, 1, settingsCountryButton, 1)
+	require.Equal(t, settingsCountryMessage, replies[0].Text)
+	require.Contains(t, replies[0].Keyboard.Rows, []string{"Georgia (GMT+4)"})
+
+	replies = h.say(t, 1, "Georgia (GMT+4)", 1)
+	require.Equal(t, "Готово! Ваша страна: Georgia, часовой пояс: Asia/Tbilisi (GMT+4)", replies[0].Text)
+	require.True(t, replies[0].RemoveKeyboard)
+	require.Equal(t, "Georgia", h.auth.users["dima"].Country)
+	require.Equal(t, "Asia/Tbilisi", h.auth.users["dima"].Timezone)
+	timezone, ok := h.reporter.Timezone("dima")
+	require.True(t, ok)
+	require.Equal(t, "Asia/Tbilisi", timezone.String())
+
+	// the answer isn't taken for a country again
+	replies = h.say(t, 1, "Кофе 3.5", 1)
+	require.Equal(t, "Добавлены расходы\nКофе: 3,50", replies[0].Text)
+
+	h.say(t, 1, "/settings", 1)
+	replies = h.say(t, 1, settingsProfileButton, 1)
+	require.Equal(t, "Имя пользователя: dima\nСтрана: Georgia\nЧасовой пояс: Asia/Tbilisi (GMT+4)\n"+
+		"Отчёт за день: в 00:00\nНачало месяца: 1-го числа\nОтчёт за месяц: 1-го числа в 00:00\nЯзык: Русский\nTelegram: не привязан\nПароль: задан", replies[0].Text)
+}
+
+func TestHub_SettingsChooseCityOfCountry(t *testing.T) {
+	h := startHub(t, true, false)
+	h.register(t, 1, "dima", "secret")
+	h.say(t, 1, "/settings", 1)
+	h.say(t, 1, settingsCountryButton, 1)
+
+	replies := h.say(t, 1, "Беларусь", 1)
+	require.Equal(t, "Выберите свой город", replies[0].Text)
+	require.Equal(t, [][]string{{"Minsk, Belarus (GMT+3)"}, {"Brest, Belarus (GMT+3)"}, {"Grodno, Belarus (GMT+3)"}, {"Gomel, Belarus (GMT+3)"}},
+		replies[0].Keyboard.Rows)
+	require.Equal(t, locationButton, replies[0].Keyboard.LocationButton)
+
+	replies = h.say(t, 1, "Gomel, Belarus (GMT+3)", 1)
+	require.Equal(t, "Gomel, Belarus, часовой пояс Europe/Minsk (GMT+3). Всё верно?", replies[0].Text)
+	replies = h.say(t, 1, confirmTimezoneButton, 1)
+	require.Equal(t, "Готово! Ваша страна: Belarus, часовой пояс: Europe/Minsk (GMT+3)", replies[0].Text)
+	require.True(t, replies[0].RemoveKeyboard)
+
+	// the confirmation isn't taken twice
+	replies = h.say(t, 1, "Кофе 3.5", 1)
+	require.Equal(t, "Добавлены расходы\nКофе: 3,50", replies[0].Text)
+}
+
+func TestHub_SettingsChangeReportTime(t *testing.T) {
+	h := startHub(t, true, false)
+	h.register(t, 1, "dima", "secret")
+	h.say(t, 1, "/settings", 1)
+
+	replies := h.say(t, 1, settingsReportTimeButton, 1)
+	require.Equal(t, settingsDailyTimeMessage, replies[0].Text)
+	replies = h.say(t, 1, "25:00", 1)
+	require.Equal(t, "Не получилось разобрать время. "+settingsDailyTimeMessage, replies[0].Text)
+	replies = h.say(t, 1, "8:30", 1)
+	require.Equal(t, fmt.Sprintf(settingsMonthlyTimeMessage, service.MaxMonthlyReportDay), replies[0].Text)
+	replies = h.say(t, 1, "31 09:00", 1)
+	require.Equal(t, "Не получилось разобрать день и время. "+fmt.Sprintf(settingsMonthlyTimeMessage, service.MaxMonthlyReportDay), replies[0].Text)
+	replies = h.say(t, 1, "2 09:00", 1)
+	require.Equal(t, "Готово! Отчёт за день придёт в 08:30, отчёт за месяц — 2-го числа в 09:00", replies[0].Text)
+	require.True(t, replies[0].RemoveKeyboard)
+	require.Equal(t, model.ReportTime{Daily: 8*time.Hour + 30*time.Minute, Monthly: 33 * time.Hour}, h.auth.users["dima"].ReportTime)
+
+	// the answer isn't taken for the report time again
+	replies = h.say(t, 1, "Кофе 3.5", 1)
+	require.Equal(t, "Добавлены расходы\nКофе: 3,50", replies[0].Text)
+}
+
+func TestHub_SettingsChangeMonthStart(t *testing.T) {
+	h := startHub(t, true, false)
+	h.register(t, 1, "dima", "secret")
+	h.say(t, 1, "/settings", 1)
+
+	replies := h.say(t, 1, settingsMonthStartButton, 1)
+	require.Equal(t, fmt.Sprintf(settingsMonthStartMessage, service.MaxMonthlyReportDay), replies[0].Text)
+	replies = h.say(t, 1, "31", 1)
+	require.Equal(t, "Не получилось разобрать число. "+fmt.Sprintf(settingsMonthStartMessage, service.MaxMonthlyReportDay), replies[0].Text)
+	replies = h.say(t, 1, "10", 1)
+	require.Equal(t, "Готово! Ваш месяц начинается 10-го числа", replies[0].Text)
+	require.True(t, replies[0].RemoveKeyboard)
+	require.Equal(t, 10, h.auth.users["dima"].MonthStart)
+	require.Equal(t, 10, h.reporter.MonthStart("dima"))
+
+	h.say(t, 1, "/settings", 1)
+	replies = h.say(t, 1, settingsProfileButton, 1)
+	require.Contains(t, replies[0].Text, "Начало месяца: 10-го числа\nОтчёт за месяц: на 1-й день месяца в 00:00")
+}
+
+func TestHub_RegisterInLanguageOfClient(t *testing.T) {
+	h := startHub(t, true, false)
+	h.fake.SetLanguage(1, "en-US")
+
+	replies := h.say(t, 1, "/start", 1)
+	require.Equal(t, i18n.English.T(welcomeSingleBotIntro)+i18n.English.T(welcomeCommands), replies[0].Text)
+	require.Contains(t, replies[0].Text, "Hi! If you want to keep your expenses under control")
+	replies = h.say(t, 1, "/register", 1)
+	require.Equal(t, "Enter a username. Minimum 3, maximum 15 characters", replies[0].Text)
+	h.say(t, 1, "dima", 1)
+	replies = h.say(t, 1, "Belarus (GMT+3)", 1)
+	require.Equal(t, "Enter a password. Maximum 15 characters", replies[0].Text)
+	replies = h.say(t, 1, "secret", 3)
+	require.Equal(t, "Thank you, dima! You have registered successfully", replies[0].Text)
+	require.Equal(t, "en", h.auth.users["dima"].Language)
+	require.Equal(t, i18n.English, h.reporter.Language("dima"))
+
+	replies = h.say(t, 1, "Coffee 1234,5", 1)
+	require.Equal(t, "Expenses added\nCoffee: 1,234.50", replies[0].Text)
+}
+
+func TestHub_SettingsChangeLanguage(t *testing.T) {
+	h := startHub(t, true, false)
+	h.register(t, 1, "dima", "secret")
+	h.say(t, 1, "/settings", 1)
+
+	replies := h.say(t, 1, settingsLanguageButton, 1)
+	require.Equal(t, settingsLanguageMessage, replies[0].Text)
+	require.Equal(t, messenger.NewKeyboard("Русский", "English", "Polski"), replies[0].Keyboard)
+	replies = h.say(t, 1, "Klingon", 1)
+	require.Equal(t, settingsLanguageMessage, replies[0].Text)
+	replies = h.say(t, 1, "Polski", 1)
+	require.Equal(t, "Gotowe! Język: Polski", replies[0].Text)
+	require.True(t, replies[0].RemoveKeyboard)
+	require.Equal(t, "pl", h.auth.users["dima"].Language)
+	require.Equal(t, i18n.Polish, h.reporter.Language("dima"))
+
+	replies = h.say(t, 1, "Kawa 3,5", 1)
+	require.Equal(t, "Dodano wydatki\nKawa: 3,50", replies[0].Text)
+
+	// the buttons are in the new language
+	replies = h.say(t, 1, "/settings", 1)
+	require.Equal(t, "Co chcesz zmienić?", replies[0].Text)
+	require.Contains(t, replies[0].Keyboard.Rows, []string{"Profil"})
+	replies = h.say(t, 1, "Profil", 1)
+	require.Contains(t, replies[0].Text, "Początek miesiąca: 1. dnia miesiąca\nRaport miesięczny: 1. dnia miesiąca o 00:00\nJęzyk: Polski")
+}
+
+func TestHub_SettingsChangePassword(t *testing.T) {
+	h := startHub(t, true, false)
+	h.register(t, 1, "dima", "secret")
+
+	h.say(t, 1, "/settings", 1)
+	replies := h.say(t, 1, settingsPasswordButton, 1)
+	require.Equal(t, "Введите текущий пароль", replies[0].Text)
+	h.say(t, 1, "wrong", 1)
+	replies = h.say(t, 1, "newSecret", 1)
+	require.Equal(t, "Вы ввели неверный текущий пароль. Попробуйте ещё раз! Введите текущий пароль", replies[0].Text)
+	require.Equal(t, "secret", h.auth.users["dima"].Password)
+
+	h.say(t, 1, "secret", 1)
+	replies = h.say(t, 1, "newSecret", 1)
+	require.Equal(t, "Пароль изменён", replies[0].Text)
+	require.Equal(t, "newSecret", h.auth.users["dima"].Password)
+	require.Equal(t, []int{7, 15, 17, 19, 21}, h.fake.Deleted(1))
+
+	replies = h.say(t, 2, "/settings", 1)
+	require.Equal(t, "Вы не авторизованы", replies[0].Text)
+}
+
+func TestHub_SettingsSetPasswordOfTelegramAccount(t *testing.T) {
+	h := startHub(t, true, true)
+	h.say(t, 1, "/start", 1)
+	h.say(t, 1, "Belarus (GMT+3)", 3)
+
+	h.say(t, 1, "/settings", 1)
+	replies := h.say(t, 1, settingsPasswordButton, 1)
+	require.Equal(t, fmt.Sprintf("Придумайте пароль, с ним можно войти в аккаунт по /login. Максимум %d символов", passwordMaxLength),
+		replies[0].Text)
+	replies = h.say(t, 1, "secret", 1)
+	require.Equal(t, "Пароль изменён", replies[0].Text)
+	require.Equal(t, "secret", h.auth.users["tg_1"].Password)
+}
@@ -0,0 +1,290 @@
+package consumer
+
+import (
+	"context"
+	"fmt"
+	"github.com/chucky-1/finance/internal/i18n"
+	"github.com/chucky-1/finance/internal/messenger"
+	"github.com/chucky-1/finance/internal/model"
+	"github.com/chucky-1/finance/internal/repository"
+	"github.com/chucky-1/finance/internal/service"
+	"github.com/sirupsen/logrus"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const ledger = "ledger"
+
+// personalLedger is the argument of /ledger use which returns expenses to the user's own budget
+const personalLedger = "personal"
+
+var ledgerUsageMessage = "Общий бюджет ведут несколько пользователей. Владелец приглашает участников: " +
+	"editor записывает расходы и смотрит отчёты, viewer только смотрит отчёты\n\n" +
+	"Создать бюджет\n" +
+	"/ledger new <название>\n" +
+	"Список бюджетов\n" +
+	"/ledger list\n" +
+	"Пригласить участника\n" +
+	"/ledger invite <номер> editor\n" +
+	"/ledger invite <номер> viewer\n" +
+	"Вступить в бюджет\n" +
+	"/ledger join <код>\n" +
+	"Записывать расходы в бюджет\n" +
+	"/ledger use <номер>\n" +
+	"Записывать личные расходы\n" +
+	"/ledger use personal\n" +
+	"Участники бюджета\n" +
+	"/ledger members <номер>\n" +
+	"Отчёт за текущий месяц\n" +
+	"/ledger report <номер>\n" +
+	"Отчёт с расходами каждого участника\n" +
+	"/ledger report <номер> members\n" +
+	"Выйти из бюджета\n" +
+	"/ledger leave <номер>\n" +
+	"Удалить участника\n" +
+	"/ledger remove <номер> <имя пользователя>"
+
+var ledgerInviteMessage = "Код приглашения в бюджет %d, роль %s:\n\n%s\n\n" +
+	"Передайте его участнику, код действует сутки и только один раз. Участник вступает командой\n/ledger join <код>"
+
+// handleLedger manages shared ledgers of the user, the active ledger of the chat receives expenses instead of the user
+func (f *Finance) handleLedger(ctx context.Context, message *messenger.Message) error {
+	args := strings.Fields(message.CommandArguments())
+	if len(args) == 0 {
+		return f.sendMessage(message, f.language.T(ledgerUsageMessage))
+	}
+	var ledgerID int64
+	personal := len(args) == 2 && args[0] == "use" && args[1] == personalLedger
+	if len(args) > 1 && args[0] != "new" && args[0] != "join" && !personal {
+		id, err := strconv.ParseInt(args[1], 10, 64)
+		if err != nil || id < 1 {
+			return f.sendMessage(message, f.language.T(ledgerUsageMessage))
+		}
+		ledgerID = id
+	}
+
+	newCtx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+	var err error
+	switch {
+	case args[0] == "new" && len(args) > 1:
+		err = f.createLedger(newCtx, message, strings.Join(args[1:], " "))
+	case args[0] == "list" && len(args) == 1:
+		memberships, listErr := f.ledgers.List(newCtx, f.username)
+		if listErr != nil {
+			return fmt.Errorf("couldn't get ledgers: %v", listErr)
+		}
+		return f.sendMessage(message, ledgersList(f.language, memberships, f.ledger))
+	case args[0] == "invite" && len(args) == 3:
+		code, inviteErr := f.ledgers.Invite(newCtx, ledgerID, f.username, args[2])
+		if inviteErr == service.InvalidLedgerRoleErr {
+			return f.sendMessage(message, f.language.T(ledgerUsageMessage))
+		}
+		if inviteErr == service.LedgerForbiddenErr {
+			return f.sendMessage(message, f.language.T("Приглашать участников может только владелец бюджета"))
+		}
+		if inviteErr == nil {
+			logrus.Debugf("%s invited a %s to ledger %d", f.username, args[2], ledgerID)
+			return f.sendMessage(message, f.language.T(ledgerInviteMessage, ledgerID, roleName(f.language, args[2]), code))
+		}
+		err = inviteErr
+	case args[0] == "join" && len(args) == 2:
+		err = f.joinLedger(newCtx, message, args[1])
+	case args[0] == "use" && len(args) == 2:
+		err = f.useLedger(newCtx, message, ledgerID)
+	case args[0] == "members" && len(args) == 2:
+		members, membersErr := f.ledgers.Members(newCtx, ledgerID, f.username)
+		if membersErr == nil {
+			return f.sendMessage(message, membersList(f.language, ledgerID, members))
+		}
+		err = membersErr
+	case args[0] == "report" && (len(args) == 2 || len(args) == 3 && args[2] == "members"):
+		err = f.ledgerReport(newCtx, message, ledgerID, len(args) == 3)
+	case args[0] == "leave" && len(args) == 2:
+		if err = f.ledgers.Remove(newCtx, ledgerID, f.username, f.username); err == service.LedgerForbiddenErr {
+			return f.sendMessage(message, f.language.T("Владелец не может выйти из своего бюджета"))
+		}
+		if err == nil {
+			f.forgetLedger(ledgerID)
+			logrus.Debugf("%s left ledger %d", f.username, ledgerID)
+			return f.sendMessage(message, f.language.T("Вы вышли из бюджета %d", ledgerID))
+		}
+	case args[0] == "remove" && len(args) == 3:
+		if err = f.ledgers.Remove(newCtx, ledgerID, f.username, args[2]); err == service.LedgerForbiddenErr {
+			return f.sendMessage(message, f.language.T("Удалять участников может только владелец бюджета, сам владелец не удаляется"))
+		}
+		if err == service.LedgerMemberNotFoundErr {
+			return f.sendMessage(message, f.language.T("%s не участник бюджета %d", args[2], ledgerID))
+		}
+		if err == nil {
+			logrus.Debugf("%s removed %s from ledger %d", f.username, args[2], ledgerID)
+			return f.sendMessage(message, f.language.T("%s удалён из бюджета %d", args[2], ledgerID))
+		}
+	default:
+		return f.sendMessage(message, f.language.T(ledgerUsageMessage))
+	}
+
+	if err == nil {
+		return nil
+	}
+	if err == service.LedgerNotFoundErr {
+		return f.sendMessage(message, f.language.T("Бюджет %d не найден", ledgerID))
+	}
+	return fmt.Errorf("couldn't handle ledger command %s: %v", args[0], err)
+}
+
+func (f *Finance) createLedger(ctx context.Context, message *messenger.Message, name string) error {
+	created, err := f.ledgers.Create(ctx, f.username, name)
+	if err == service.InvalidLedgerNameErr {
+		return f.sendMessage(message, f.language.Plural("Название бюджета слишком длинное. Максимум %d символов",
+			service.MaxLedgerNameLength, service.MaxLedgerNameLength))
+	}
+	if err != nil {
+		return err
+	}
+	logrus.Debugf("%s created ledger %d", f.username, created.ID)
+	return f.sendMessage(message, f.language.T("Бюджет \"%[1]s\" создан, его номер %[2]d. Пригласите участников командой\n"+
+		"/ledger invite %[2]d editor\nЧто бы записывать в него расходы, выберите его командой\n/ledger use %[2]d", created.Name, created.ID))
+}
+
+func (f *Finance) joinLedger(ctx context.Context, message *messenger.Message, code string) error {
+	membership, err := f.ledgers.Join(ctx, code, f.username)
+	if err == service.InvalidLedgerInviteErr {
+		return f.sendMessage(message, f.language.T("Код приглашения неверный, уже использован или истёк"))
+	}
+	if err == repository.DuplicateLedgerMemberErr {
+		return f.sendMessage(message, f.language.T("Вы уже участник этого бюджета"))
+	}
+	if err != nil {
+		return err
+	}
+	logrus.Debugf("%s joined ledger %d as %s", f.username, membership.Ledger.ID, membership.Role)
+	return f.sendMessage(message, f.language.T("Вы вступили в бюджет \"%s\", его номер %d, ваша роль: %s",
+		membership.Ledger.Name, membership.Ledger.ID, roleName(f.language, membership.Role)))
+}
+
+// useLedger makes the ledger active in this chat, so expenses are added to it. The personal ledger is the user itself
+func (f *Finance) useLedger(ctx context.Context, message *messenger.Message, ledgerID int64) error {
+	if ledgerID == 0 {
+		f.ledger = nil
+		return f.sendMessage(message, f.language.T("Расходы снова записываются в ваш личный бюджет"))
+	}
+	membership, err := f.ledgers.Membership(ctx, ledgerID, f.username)
+	if err != nil {
+		return err
+	}
+	if !membership.CanEdit() {
+		return f.sendMessage(message, f.language.T("В бюджете \"%s\" вы только смотрите отчёты и не можете записывать расходы",
+			membership.Ledger.Name))
+	}
+	f.ledger = membership
+	return f.sendMessage(message, f.language.T("Теперь расходы записываются в бюджет \"%s\". Вернуться к личным расходам:\n"+
+		"/ledger use personal", membership.Ledger.Name))
+}
+
+// addToLedger adds the expense to the active ledger. If the user isn't its editor anymore, the chat returns to the personal
+// budget and the expense isn't added, so the user decides where it goes
+func (f *Finance) addToLedger(ctx context.Context, message *messenger.Message, category *model.Category) error {
+	_, err := f.ledgers.Add(ctx, f.ledger.Ledger.ID, f.username, category, time.Now().UTC())
+	if err == service.LedgerNotFoundErr || err == service.LedgerForbiddenErr {
+		name := f.ledger.Ledger.Name
+		f.ledger = nil
+		return f.sendMessage(message, f.language.T("Вы больше не можете записывать расходы в бюджет \"%s\". "+
+			"Расходы не добавлены, теперь они записываются в ваш личный бюджет", name))
+	}
+	if err != nil {
+		return fmt.Errorf("couldn't add expense to ledger %d: %v", f.ledger.Ledger.ID, err)
+	}
+	logrus.Debugf("%s added expenses to ledger %d: %s: %.2f", f.username, f.ledger.Ledger.ID, category.Name, category.Amount)
+	return f.sendMessage(message, f.language.T("Добавлены расходы в бюджет \"%s\"\n%s: %s", f.ledger.Ledger.Name,
+		category.Name, f.language.Number(category.Amount)))
+}
+
+// forgetLedger returns the chat to the personal budget if the ledger is active in it
+func (f *Finance) forgetLedger(ledgerID int64) {
+	if f.ledger != nil && f.ledger.Ledger.ID == ledgerID {
+		f.ledger = nil
+	}
+}
+
+// ledgerReport sends expenses of the ledger in the current financial month of the user, optionally split by members
+func (f *Finance) ledgerReport(ctx context.Context, message *messenger.Message, ledgerID int64, byMembers bool) error {
+	monthStart := f.settings.MonthStart(f.username)
+	from := service.MonthStart(time.Now().UTC(), f.timezone, monthStart)
+	_, to, err := service.MonthRange(from.In(f.timezone).Format("2006-01"), f.timezone, monthStart)
+	if err != nil {
+		return err
+	}
+	report, err := f.ledgers.Report(ctx, ledgerID, f.username, from, to)
+	if err != nil {
+		return err
+	}
+	local := from.In(f.timezone)
+	text := f.language.T("Бюджет \"%s\", расходы с %d %s", report.Ledger.Name, local.Day(), f.language.MonthOfDate(local.Month())) +
+		"\n" + categoriesText(f.language, report.Categories)
+	if !byMembers {
+		return f.sendMessage(message, text)
+	}
+	members := make([]string, 0, len(report.Members))
+	for member := range report.Members {
+		members = append(members, member)
+	}
+	sort.Strings(members)
+	for _, member := range members {
+		text += "\n\n" + member + "\n" + categoriesText(f.language, report.Members[member])
+	}
+	return f.sendMessage(message, text)
+}
+
+// categoriesText returns the categories in alphabetical order with the total
+func categoriesText(language i18n.Language, categories map[string]float64) string {
+	names := make([]string, 0, len(categories))
+	for name := range categories {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var text string
+	var total float64
+	for _, name := range names {
+		text += fmt.Sprintf("%s - %s\n", name, language.Number(categories[name]))
+		total += categories[name]
+	}
+	return text + language.T("Итого - %s", language.Number(total))
+}
+
+func ledgersList(language i18n.Language, memberships []*model.Membership, active *model.Membership) string {
+	if len(memberships) == 0 {
+		return language.T("У вас нет общих бюджетов. Создайте бюджет командой\n/ledger new <название>")
+	}
+	list := language.T("Ваши бюджеты:\n")
+	for _, membership := range memberships {
+		list += language.T("\n%d. \"%s\", владелец %s, ваша роль: %s", membership.Ledger.ID, membership.Ledger.Name,
+			membership.Ledger.Owner, roleName(language, membership.Role))
+		if active != nil && active.Ledger.ID == membership.Ledger.ID {
+			list += language.T(", расходы записываются сюда")
+		}
+	}
+	return list
+}
+
+func membersList(language i18n.Language, ledgerID int64, members []*model.LedgerMember) string {
+	list := language.T("Участники бюджета %d:\n", ledgerID)
+	for _, member := range members {
+		list += fmt.Sprintf("\n%s - %s", member.Username, roleName(language, member.Role))
+	}
+	return list
+}
+
+func roleName(language i18n.Language, role string) string {
+	switch role {
+	case model.OwnerRole:
+		return language.T("владелец")
+	case model.EditorRole:
+		return language.T("редактор")
+	case model.ViewerRole:
+		return language.T("наблюдатель")
+	}
+	return role
+}
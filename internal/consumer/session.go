@@ -0,0 +1,146 @@
+package consumer
+
+import (
+	"context"
+	"fmt"
+	"github.com/chucky-1/finance/internal/i18n"
+	"github.com/chucky-1/finance/internal/messenger"
+	"github.com/chucky-1/finance/internal/model"
+	"github.com/sirupsen/logrus"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	logout   = "logout"
+	sessions = "sessions"
+)
+
+var sessionsUsageMessage = "Список сеансов\n" +
+	"/sessions\n" +
+	"Завершить сеанс\n" +
+	"/sessions revoke <номер>\n" +
+	"Выйти из аккаунта в этом чате\n" +
+	"/logout"
+
+var loggedOutMessage = "Вы вышли из аккаунта. Что бы войти снова, нажмите /start"
+
+var sessionExpiredMessage = "Сеанс завершён, потому что вы долго не пользовались ботом. Что бы войти снова, нажмите /start"
+
+var sessionRevokedMessage = "Сеанс в этом чате завершён с другого устройства. Что бы войти снова, нажмите /start"
+
+// handleSessions logs the chat out by /logout, lists sessions of the user by /sessions and ends them by /sessions revoke <number>.
+// It returns true if the session of this chat ended
+func (f *Finance) handleSessions(ctx context.Context, message *messenger.Message) (bool, error) {
+	if message.Command() == logout {
+		return true, f.logout(ctx, message, f.language.T(loggedOutMessage))
+	}
+
+	newCtx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+
+	args := strings.Fields(message.CommandArguments())
+	switch {
+	case len(args) == 0:
+		list, err := f.sessions.List(newCtx, f.username)
+		if err != nil {
+			return false, fmt.Errorf("couldn't get sessions: %v", err)
+		}
+		return false, f.sendMessage(message, sessionsList(f.language, list, message.ChatID, f.timezone))
+	case args[0] == "revoke" && len(args) == 2:
+		number, err := strconv.Atoi(args[1])
+		if err != nil {
+			return false, f.sendMessage(message, f.language.T(sessionsUsageMessage))
+		}
+		list, err := f.sessions.List(newCtx, f.username)
+		if err != nil {
+			return false, fmt.Errorf("couldn't get sessions: %v", err)
+		}
+		if number < 1 || number > len(list) {
+			return false, f.sendMessage(message, f.language.T("Сеанс %d не найден", number))
+		}
+		chatID := list[number-1].ChatID
+		if chatID == message.ChatID {
+			return true, f.logout(ctx, message, f.language.T(loggedOutMessage))
+		}
+
+		revoked, err := f.sessions.End(newCtx, f.username, chatID)
+		if err != nil {
+			return false, fmt.Errorf("couldn't revoke session: %v", err)
+		}
+		if revoked {
+			logrus.Debugf("%s revoked session of chat %d", f.username, chatID)
+			if _, err = f.sender.Send(&messenger.OutgoingMessage{ChatID: chatID, Text: f.language.T(sessionRevokedMessage)}); err != nil {
+				logrus.Errorf("finance consumer couldn't notify revoked chat %d: %v", chatID, err)
+			}
+			f.end(ctx, chatID)
+		}
+		return false, f.sendMessage(message, f.language.T("Сеанс %d завершён", number))
+	default:
+		return false, f.sendMessage(message, f.language.T(sessionsUsageMessage))
+	}
+}
+
+// expire logs the chat out if it was idle for too long or the session has ended in another process,
+// otherwise the activity is saved. It returns true if the session ended
+func (f *Finance) expire(ctx context.Context, message *messenger.Message) bool {
+	now := time.Now().UTC()
+	if f.sessions.Expired(f.session, now) {
+		logrus.Debugf("session of %s in chat %d expired", f.username, message.ChatID)
+		if err := f.logout(ctx, message, f.language.T(sessionExpiredMessage)); err != nil {
+			logrus.Errorf("finance consumer couldn't end expired session: %v", err)
+		}
+		return true
+	}
+	newCtx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+	active, err := f.sessions.Touch(newCtx, f.session, now)
+	if err != nil {
+		logrus.Errorf("finance consumer couldn't save activity of chat %d: %v", message.ChatID, err)
+		return false
+	}
+	if !active {
+		logrus.Debugf("session of %s in chat %d ended in another process", f.username, message.ChatID)
+		if err = f.logout(ctx, message, f.language.T(sessionRevokedMessage)); err != nil {
+			logrus.Errorf("finance consumer couldn't end session: %v", err)
+		}
+		return true
+	}
+	return false
+}
+
+// logout ends the session of this chat. The consumer stops even if the session couldn't be deleted,
+// then the session is restored after a restart
+func (f *Finance) logout(ctx context.Context, message *messenger.Message, text string) error {
+	defer f.end(ctx, message.ChatID)
+	newCtx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+	if _, err := f.sessions.End(newCtx, f.username, message.ChatID); err != nil {
+		return fmt.Errorf("couldn't end session: %v", err)
+	}
+	logrus.Debugf("%s logged out in chat %d", f.username, message.ChatID)
+	return f.sendMessage(message, text)
+}
+
+// end asks the hub to stop the finance consumer of the chat
+func (f *Finance) end(ctx context.Context, chatID int64) {
+	select {
+	case f.ended <- chatID:
+	case <-ctx.Done():
+	}
+}
+
+func sessionsList(language i18n.Language, list []*model.Session, chatID int64, timezone *time.Location) string {
+	const layout = "2006-01-02 15:04"
+	text := language.T("Ваши сеансы:\n")
+	for i, session := range list {
+		chat := language.T("чат %d", session.ChatID)
+		if session.ChatID == chatID {
+			chat = language.T("этот чат")
+		}
+		text += language.T("\n%d. %s, вход %s, активность %s", i+1, chat,
+			session.CreatedAt.In(timezone).Format(layout), session.LastSeenAt.In(timezone).Format(layout))
+	}
+	return text + language.T("\n\nЗавершить сеанс: /sessions revoke <номер>")
+}
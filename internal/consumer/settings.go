@@ -0,0 +1,438 @@
+package consumer
+
+import (
+	"context"
+	"fmt"
+	"github.com/chucky-1/finance/internal/i18n"
+	"github.com/chucky-1/finance/internal/messenger"
+	"github.com/chucky-1/finance/internal/model"
+	"github.com/chucky-1/finance/internal/service"
+	"github.com/sirupsen/logrus"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+const settings = "settings"
+
+// buttons of the settings menu
+const (
+	settingsCountryButton    = "Страна и часовой пояс"
+	settingsReportTimeButton = "Время отчётов"
+	settingsMonthStartButton = "Начало месяца"
+	settingsLanguageButton   = "Язык"
+	settingsPasswordButton   = "Пароль"
+	settingsProfileButton    = "Профиль"
+)
+
+// settingsMenuButtons are the buttons of the settings menu in their order
+var settingsMenuButtons = []string{settingsCountryButton, settingsReportTimeButton, settingsMonthStartButton, settingsLanguageButton,
+	settingsPasswordButton, settingsProfileButton}
+
+var settingsMenuMessage = "Что вы хотите изменить?"
+
+var settingsDailyTimeMessage = "Во сколько присылать отчёт за прошедший день? Напишите время, например 08:00. " +
+	"День закрывается в полночь, в 00:00 отчёт приходит сразу"
+
+// settingsMonthlyTimeMessage is formatted with service.MaxMonthlyReportDay
+var settingsMonthlyTimeMessage = "В какой день и во сколько присылать отчёт за прошедший месяц? " +
+	"Напишите число от 1 до %d и время, например 1 09:00"
+
+var settingsCountryMessage = "Выберите страну из списка, напишите свой город или отправьте геопозицию. " +
+	"Отчёты будут приходить по новому времени, начиная с ближайшего"
+
+// settingsMonthStartMessage is formatted with service.MaxMonthlyReportDay
+var settingsMonthStartMessage = "С какого числа начинается ваш месяц? Например, 10, если зарплата приходит 10-го. " +
+	"Напишите число от 1 до %d, отчёты за месяц будут по этим датам"
+
+var settingsLanguageMessage = "Выберите язык сообщений и отчётов"
+
+// handleSettings shows the settings menu by /settings and handles the answers to its questions.
+// It returns false if the message isn't a part of the settings dialog
+func (f *Finance) handleSettings(ctx context.Context, message *messenger.Message) (bool, error) {
+	if message.IsCommand() {
+		if message.Command() != settings {
+			return false, nil
+		}
+		return true, f.requestForSettings(message, f.language.T(settingsMenuMessage))
+	}
+	if f.picker.waits(message) {
+		return true, f.handleSettingsCountry(ctx, message)
+	}
+
+	switch message.ID {
+	case f.waitSettingsMessageWithChoice:
+		return true, f.handleSettingsChoice(ctx, message)
+	case f.waitSettingsMessageWithOldPassword:
+		f.oldPassword = message.Text
+		deleteMessage(f.sender, message)
+		return true, f.requestForNewPassword(message,
+			f.language.Plural("Введите новый пароль. Максимум %d символов", passwordMaxLength, passwordMaxLength))
+	case f.waitSettingsMessageWithNewPassword:
+		return true, f.handleSettingsPassword(ctx, message)
+	case f.waitSettingsMessageWithDailyTime:
+		dailyTime, err := parseClock(message.Text)
+		if err != nil {
+			return true, f.requestForDailyTime(message, f.language.T("Не получилось разобрать время. ")+f.language.T(settingsDailyTimeMessage))
+		}
+		f.dailyReportTime = dailyTime
+		return true, f.requestForMonthlyTime(message, f.language.T(settingsMonthlyTimeMessage, service.MaxMonthlyReportDay))
+	case f.waitSettingsMessageWithMonthlyTime:
+		return true, f.handleSettingsReportTime(ctx, message)
+	case f.waitSettingsMessageWithMonthStart:
+		return true, f.handleSettingsMonthStart(ctx, message)
+	case f.waitSettingsMessageWithLanguage:
+		return true, f.handleSettingsLanguage(ctx, message)
+	}
+	return false, nil
+}
+
+func (f *Finance) handleSettingsChoice(ctx context.Context, message *messenger.Message) error {
+	switch button(f.language, message.Text, settingsMenuButtons...) {
+	case settingsCountryButton:
+		return f.picker.request(message, f.language.T(settingsCountryMessage))
+	case settingsReportTimeButton:
+		return f.requestForDailyTime(message, f.language.T(settingsDailyTimeMessage))
+	case settingsMonthStartButton:
+		return f.requestForMonthStart(message, f.language.T(settingsMonthStartMessage, service.MaxMonthlyReportDay))
+	case settingsLanguageButton:
+		return f.requestForLanguage(message, f.language.T(settingsLanguageMessage))
+	case settingsPasswordButton:
+		newCtx, cancel := context.WithTimeout(ctx, 10*time.Second)
+		defer cancel()
+		user, err := f.settings.Profile(newCtx, f.username)
+		if err != nil {
+			return fmt.Errorf("couldn't get profile: %v", err)
+		}
+		if user.Password == "" {
+			// the account was created by telegram, the password is set for the first time
+			return f.requestForNewPassword(message, f.language.Plural("Придумайте пароль, с ним можно войти в аккаунт по /login. "+
+				"Максимум %d символов", passwordMaxLength, passwordMaxLength))
+		}
+		return f.requestForOldPassword(message, f.language.T("Введите текущий пароль"))
+	case settingsProfileButton:
+		newCtx, cancel := context.WithTimeout(ctx, 10*time.Second)
+		defer cancel()
+		user, err := f.settings.Profile(newCtx, f.username)
+		if err != nil {
+			return fmt.Errorf("couldn't get profile: %v", err)
+		}
+		msg := messenger.NewMessage(message, profile(f.language, user, time.Now()))
+		msg.RemoveKeyboard = true
+		if _, err = f.sender.Send(msg); err != nil {
+			return fmt.Errorf("couldn't send message: %v", err)
+		}
+		return nil
+	default:
+		return f.requestForSettings(message, f.language.T("Выберите пункт меню"))
+	}
+}
+
+func (f *Finance) handleSettingsCountry(ctx context.Context, message *messenger.Message) error {
+	country, timezone, err := f.picker.handle(message)
+	if err != nil || timezone == nil {
+		return err
+	}
+
+	newCtx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+	if err = f.settings.ChangeTimezone(newCtx, f.username, country, timezone); err != nil {
+		return fmt.Errorf("couldn't change timezone: %v", err)
+	}
+	f.timezone = timezone
+	logrus.Debugf("%s changed country to %s and timezone to %v", f.username, country, timezone)
+
+	msg := messenger.NewMessage(message, f.language.T("Готово! Ваша страна: %s, часовой пояс: %s", country, timezoneName(timezone.String(), time.Now())))
+	msg.RemoveKeyboard = true
+	if _, err = f.sender.Send(msg); err != nil {
+		return fmt.Errorf("couldn't send message: %v", err)
+	}
+	return nil
+}
+
+func (f *Finance) handleSettingsReportTime(ctx context.Context, message *messenger.Message) error {
+	monthlyTime, err := parseMonthlyTime(message.Text)
+	if err != nil {
+		return f.requestForMonthlyTime(message, f.language.T("Не получилось разобрать день и время. ")+
+			f.language.T(settingsMonthlyTimeMessage, service.MaxMonthlyReportDay))
+	}
+	reportTime := model.ReportTime{Daily: f.dailyReportTime, Monthly: monthlyTime}
+
+	newCtx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+	if err = f.settings.ChangeReportTime(newCtx, f.username, reportTime); err != nil {
+		return fmt.Errorf("couldn't change report time: %v", err)
+	}
+	f.waitSettingsMessageWithMonthlyTime = 0
+	logrus.Debugf("%s changed report time to %v", f.username, reportTime)
+
+	msg := messenger.NewMessage(message, f.language.T("Готово! Отчёт за день придёт %s, отчёт за месяц — %s",
+		dailyTimeName(f.language, reportTime.Daily), monthlyTimeName(f.language, reportTime.Monthly, f.settings.MonthStart(f.username))))
+	msg.RemoveKeyboard = true
+	if _, err = f.sender.Send(msg); err != nil {
+		return fmt.Errorf("couldn't send message: %v", err)
+	}
+	return nil
+}
+
+func (f *Finance) handleSettingsMonthStart(ctx context.Context, message *messenger.Message) error {
+	monthStart, err := strconv.Atoi(strings.TrimSpace(message.Text))
+	if err != nil || monthStart < 1 || monthStart > service.MaxMonthlyReportDay {
+		return f.requestForMonthStart(message, f.language.T("Не получилось разобрать число. ")+
+			f.language.T(settingsMonthStartMessage, service.MaxMonthlyReportDay))
+	}
+
+	newCtx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+	if err = f.settings.ChangeMonthStart(newCtx, f.username, monthStart); err != nil {
+		return fmt.Errorf("couldn't change month start: %v", err)
+	}
+	f.waitSettingsMessageWithMonthStart = 0
+	logrus.Debugf("%s changed month start to %d", f.username, monthStart)
+
+	msg := messenger.NewMessage(message, f.language.T("Готово! Ваш месяц начинается %s", monthStartName(f.language, monthStart)))
+	msg.RemoveKeyboard = true
+	if _, err = f.sender.Send(msg); err != nil {
+		return fmt.Errorf("couldn't send message: %v", err)
+	}
+	return nil
+}
+
+// handleSettingsLanguage changes the language by its name on the button, the answer is in the new language
+func (f *Finance) handleSettingsLanguage(ctx context.Context, message *messenger.Message) error {
+	language, ok := languageByName(message.Text)
+	if !ok {
+		return f.requestForLanguage(message, f.language.T(settingsLanguageMessage))
+	}
+
+	newCtx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+	if err := f.settings.ChangeLanguage(newCtx, f.username, language); err != nil {
+		return fmt.Errorf("couldn't change language: %v", err)
+	}
+	f.waitSettingsMessageWithLanguage = 0
+	f.language, f.picker.language = language, language
+	logrus.Debugf("%s changed language to %s", f.username, language)
+
+	msg := messenger.NewMessage(message, f.language.T("Готово! Язык: %s", language.Name()))
+	msg.RemoveKeyboard = true
+	if _, err := f.sender.Send(msg); err != nil {
+		return fmt.Errorf("couldn't send message: %v", err)
+	}
+	return nil
+}
+
+// handleSettingsPassword deletes the message with the new password and changes the password, the passwords are never logged
+func (f *Finance) handleSettingsPassword(ctx context.Context, message *messenger.Message) error {
+	password := message.Text
+	deleteMessage(f.sender, message)
+	if utf8.RuneCountInString(password) > passwordMaxLength {
+		return f.requestForNewPassword(message,
+			f.language.Plural("Пароль слишком длинный. Максимум %d символов. Попробуйте ещё раз!", passwordMaxLength, passwordMaxLength))
+	}
+
+	newCtx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+	err := f.auth.ChangePassword(newCtx, f.username, f.oldPassword, password)
+	f.oldPassword = ""
+	f.waitSettingsMessageWithNewPassword = 0
+	if err == service.WrongPasswordErr {
+		logrus.Debugf("%s entered the wrong password in settings", f.username)
+		return f.requestForOldPassword(message, f.language.T("Вы ввели неверный текущий пароль. Попробуйте ещё раз! Введите текущий пароль"))
+	}
+	if err != nil {
+		return fmt.Errorf("couldn't change password: %v", err)
+	}
+	logrus.Debugf("%s changed the password", f.username)
+	return f.sendMessage(message, f.language.T("Пароль изменён"))
+}
+
+func (f *Finance) requestForSettings(message *messenger.Message, text string) error {
+	msg := messenger.NewMessage(message, text)
+	buttons := make([]string, len(settingsMenuButtons))
+	for i, b := range settingsMenuButtons {
+		buttons[i] = f.language.T(b)
+	}
+	msg.Keyboard = messenger.NewKeyboard(buttons...)
+	f.waitSettingsMessageWithChoice = msg.ReplyToID + 2
+	if _, err := f.sender.Send(msg); err != nil {
+		return fmt.Errorf("requestForSettings, couldn't send message: %v", err)
+	}
+	return nil
+}
+
+func (f *Finance) requestForDailyTime(message *messenger.Message, text string) error {
+	msg := messenger.NewMessage(message, text)
+	msg.Keyboard = messenger.NewKeyboard("00:00", "08:00", "21:00")
+	f.waitSettingsMessageWithDailyTime = msg.ReplyToID + 2
+	if _, err := f.sender.Send(msg); err != nil {
+		return fmt.Errorf("requestForDailyTime, couldn't send message: %v", err)
+	}
+	return nil
+}
+
+func (f *Finance) requestForMonthlyTime(message *messenger.Message, text string) error {
+	msg := messenger.NewMessage(message, text)
+	msg.Keyboard = messenger.NewKeyboard("1 00:00", "1 09:00")
+	f.waitSettingsMessageWithDailyTime = 0
+	f.waitSettingsMessageWithMonthlyTime = msg.ReplyToID + 2
+	if _, err := f.sender.Send(msg); err != nil {
+		return fmt.Errorf("requestForMonthlyTime, couldn't send message: %v", err)
+	}
+	return nil
+}
+
+func (f *Finance) requestForMonthStart(message *messenger.Message, text string) error {
+	msg := messenger.NewMessage(message, text)
+	msg.Keyboard = messenger.NewKeyboard("1", "10", "25")
+	f.waitSettingsMessageWithMonthStart = msg.ReplyToID + 2
+	if _, err := f.sender.Send(msg); err != nil {
+		return fmt.Errorf("requestForMonthStart, couldn't send message: %v", err)
+	}
+	return nil
+}
+
+// requestForLanguage offers the languages by their names in themselves, so a user finds the language in any interface
+func (f *Finance) requestForLanguage(message *messenger.Message, text string) error {
+	msg := messenger.NewMessage(message, text)
+	names := make([]string, len(i18n.Languages))
+	for i, language := range i18n.Languages {
+		names[i] = language.Name()
+	}
+	msg.Keyboard = messenger.NewKeyboard(names...)
+	f.waitSettingsMessageWithLanguage = msg.ReplyToID + 2
+	if _, err := f.sender.Send(msg); err != nil {
+		return fmt.Errorf("requestForLanguage, couldn't send message: %v", err)
+	}
+	return nil
+}
+
+func (f *Finance) requestForOldPassword(message *messenger.Message, text string) error {
+	msg := messenger.NewMessage(message, text)
+	msg.RemoveKeyboard = true
+	f.waitSettingsMessageWithOldPassword = msg.ReplyToID + 2
+	if _, err := f.sender.Send(msg); err != nil {
+		return fmt.Errorf("requestForOldPassword, couldn't send message: %v", err)
+	}
+	return nil
+}
+
+func (f *Finance) requestForNewPassword(message *messenger.Message, text string) error {
+	msg := messenger.NewMessage(message, text)
+	msg.RemoveKeyboard = true
+	f.waitSettingsMessageWithNewPassword = msg.ReplyToID + 2
+	if _, err := f.sender.Send(msg); err != nil {
+		return fmt.Errorf("requestForNewPassword, couldn't send message: %v", err)
+	}
+	return nil
+}
+
+func profile(language i18n.Language, user *model.User, now time.Time) string {
+	telegram := language.T("не привязан")
+	if user.TGUserID != 0 {
+		telegram = language.T("привязан")
+	}
+	password := language.T("не задан")
+	if user.Password != "" {
+		password = language.T("задан")
+	}
+	return strings.Join([]string{
+		language.T("Имя пользователя: %s", user.Username),
+		language.T("Страна: %s", user.Country),
+		language.T("Часовой пояс: %s", timezoneName(user.Timezone, now)),
+		language.T("Отчёт за день: %s", dailyTimeName(language, user.ReportTime.Daily)),
+		language.T("Начало месяца: %s", monthStartName(language, user.MonthStart)),
+		language.T("Отчёт за месяц: %s", monthlyTimeName(language, user.ReportTime.Monthly, user.MonthStart)),
+		language.T("Язык: %s", i18n.Language(user.Language).Name()),
+		"Telegram: " + telegram,
+		language.T("Пароль: %s", password),
+	}, "\n")
+}
+
+// languageByName returns the language by its name on the button, e.g. Polski
+func languageByName(name string) (i18n.Language, bool) {
+	for _, language := range i18n.Languages {
+		if language.Name() == strings.TrimSpace(name) {
+			return language, true
+		}
+	}
+	return "", false
+}
+
+// parseClock parses the time of the day like 08:00 or 8:00 into the time after the midnight
+func parseClock(text string) (time.Duration, error) {
+	clock, err := time.Parse("15:04", strings.TrimSpace(text))
+	if err != nil {
+		return 0, err
+	}
+	return time.Duration(clock.Hour())*time.Hour + time.Duration(clock.Minute())*time.Minute, nil
+}
+
+// parseMonthlyTime parses the day of the month and the time like 2 09:00 into the time after the month begins
+func parseMonthlyTime(text string) (time.Duration, error) {
+	day, clock, ok := strings.Cut(strings.TrimSpace(text), " ")
+	if !ok {
+		return 0, fmt.Errorf("the day and the time are expected, got %q", text)
+	}
+	dayNumber, err := strconv.Atoi(day)
+	if err != nil {
+		return 0, err
+	}
+	if dayNumber < 1 || dayNumber > service.MaxMonthlyReportDay {
+		return 0, fmt.Errorf("the day must be from 1 to %d, got %d", service.MaxMonthlyReportDay, dayNumber)
+	}
+	after, err := parseClock(clock)
+	if err != nil {
+		return 0, err
+	}
+	return time.Duration(dayNumber-1)*24*time.Hour + after, nil
+}
+
+// dailyTimeName returns the time of the daily report, e.g. в 08:00
+func dailyTimeName(language i18n.Language, after time.Duration) string {
+	return language.T("в %02d:%02d", int(after.Hours()), int(after.Minutes())%60)
+}
+
+// monthlyTimeName returns the day and the time of the monthly report, e.g. 2-го числа в 09:00,
+// or the day of the financial month if months don't begin on the 1st, e.g. на 2-й день месяца в 09:00
+func monthlyTimeName(language i18n.Language, after time.Duration, monthStart int) string {
+	day := after / (24 * time.Hour)
+	clock := dailyTimeName(language, after-day*24*time.Hour)
+	if monthStart > 1 {
+		return language.T("на %d-й день месяца %s", day+1, clock)
+	}
+	return language.T("%d-го числа %s", day+1, clock)
+}
+
+// monthStartName returns the day when months begin, e.g. 10-го числа
+func monthStartName(language i18n.Language, monthStart int) string {
+	if monthStart < 1 {
+		monthStart = 1
+	}
+	return language.T("%d-го числа", monthStart)
+}
+
+// timezoneName returns the name of the timezone with its current offset, e.g. Europe/Warsaw (GMT+2)
+func timezoneName(name string, now time.Time) string {
+	timezone, err := service.LoadLocation(name)
+	if err != nil {
+		return name
+	}
+	return fmt.Sprintf("%s (%s)", name, gmt(timezone, now))
+}
+
+// gmt returns the offset of the timezone at the time like on the buttons of countries, e.g. GMT+3 or GMT+5.30
+func gmt(timezone *time.Location, now time.Time) string {
+	_, seconds := now.In(timezone).Zone()
+	offset := time.Duration(seconds) * time.Second
+	sign := "+"
+	if offset < 0 {
+		sign, offset = "-", -offset
+	}
+	hours, minutes := int(offset.Hours()), int(offset.Minutes())%60
+	if minutes == 0 {
+		return fmt.Sprintf("GMT%s%d", sign, hours)
+	}
+	return fmt.Sprintf("GMT%s%d.%02d", sign, hours, minutes)
+}
@@ -0,0 +1,17 @@
+package consumer
+
+import (
+	"context"
+	"fmt"
+	"github.com/chucky-1/finance/internal/service"
+	"strings"
+)
+
+// subscriptionLink returns a deep link to the reporter bot with a one-time token which binds the reporter chat to the user
+func subscriptionLink(ctx context.Context, subscriptions *service.Subscription, username, period, botName string) (string, error) {
+	token, err := subscriptions.IssueToken(ctx, username, period)
+	if err != nil {
+		return "", fmt.Errorf("couldn't issue subscription token: %v", err)
+	}
+	return fmt.Sprintf("https://t.me/%s?start=%s", strings.TrimPrefix(botName, "@"), token), nil
+}
@@ -0,0 +1,142 @@
+package consumer
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/sirupsen/logrus"
+
+	"github.com/chucky-1/finance/internal/i18n"
+	"github.com/chucky-1/finance/internal/messenger"
+	"github.com/chucky-1/finance/internal/service"
+)
+
+// buttons of the timezone picker
+const (
+	locationButton        = "Отправить геопозицию"
+	confirmTimezoneButton = "Да, всё верно"
+	rejectTimezoneButton  = "Нет, выбрать другой"
+)
+
+// citiesLimit is how many found cities are offered on the buttons
+const citiesLimit = 5
+
+var cityNotFoundMessage = "Не нашли такой город или страну. Напишите название по-другому, отправьте геопозицию или выберите страну из списка"
+
+var chooseTimezoneAgainMessage = "Выберите страну из списка, напишите свой город или отправьте геопозицию"
+
+// timezonePicker asks the user for the country, the city or the location and finds the timezone in the offline dataset.
+// A country on the buttons is chosen right away, a found city is saved after the user confirms it
+type timezonePicker struct {
+	sender           messenger.Sender
+	waitChoice       int
+	waitConfirmation int
+	// found waits for the confirmation of the user
+	found *service.City
+	// language is the language of the user, the consumer keeps it up to date
+	language i18n.Language
+}
+
+// request sends the translated text with the keyboard of countries and the button which shares the location
+func (p *timezonePicker) request(message *messenger.Message, text string) error {
+	msg := messenger.NewMessage(message, text)
+	msg.Keyboard = messenger.NewKeyboard(countryButtons(time.Now())...)
+	msg.Keyboard.LocationButton = p.language.T(locationButton)
+	p.waitChoice, p.waitConfirmation, p.found = msg.ReplyToID+2, 0, nil
+	if _, err := p.sender.Send(msg); err != nil {
+		return fmt.Errorf("timezonePicker, couldn't send message: %v", err)
+	}
+	return nil
+}
+
+// waits returns true if the message answers a question of the picker
+func (p *timezonePicker) waits(message *messenger.Message) bool {
+	return !message.IsCommand() && (message.ID == p.waitChoice || message.ID == p.waitConfirmation)
+}
+
+// handle returns the chosen country and timezone. The timezone is nil while the picker asks further questions
+func (p *timezonePicker) handle(message *messenger.Message) (string, *time.Location, error) {
+	if message.ID == p.waitConfirmation {
+		return p.handleConfirmation(message)
+	}
+	if message.Location != nil {
+		city := service.NearestCity(message.Location.Latitude, message.Location.Longitude)
+		logrus.Debugf("the nearest city to the location is %s", city)
+		return "", nil, p.confirm(message, city)
+	}
+	if country, timezone, err := parseCountry(message.Text); err == nil {
+		p.waitChoice = 0
+		return country, timezone, nil
+	}
+
+	// the buttons of cities have offsets like Minsk, Belarus (GMT+3)
+	found := service.SearchCities(strings.Split(message.Text, "(")[0], citiesLimit)
+	switch len(found) {
+	case 0:
+		return "", nil, p.request(message, p.language.T(cityNotFoundMessage))
+	case 1:
+		return "", nil, p.confirm(message, found[0])
+	}
+	msg := messenger.NewMessage(message, p.language.T("Выберите свой город"))
+	msg.Keyboard = messenger.NewKeyboard(cityButtons(found, time.Now())...)
+	msg.Keyboard.LocationButton = p.language.T(locationButton)
+	p.waitChoice = msg.ReplyToID + 2
+	if _, err := p.sender.Send(msg); err != nil {
+		return "", nil, fmt.Errorf("timezonePicker, couldn't send message: %v", err)
+	}
+	return "", nil, nil
+}
+
+func (p *timezonePicker) handleConfirmation(message *messenger.Message) (string, *time.Location, error) {
+	switch button(p.language, message.Text, confirmTimezoneButton, rejectTimezoneButton) {
+	case confirmTimezoneButton:
+		timezone, err := service.LoadLocation(p.found.Timezone)
+		if err != nil {
+			return "", nil, err
+		}
+		country := p.found.Country
+		p.waitConfirmation, p.found = 0, nil
+		return country, timezone, nil
+	case rejectTimezoneButton:
+		return "", nil, p.request(message, p.language.T(chooseTimezoneAgainMessage))
+	default:
+		return "", nil, p.confirm(message, p.found)
+	}
+}
+
+// confirm asks the user if the found city is right
+func (p *timezonePicker) confirm(message *messenger.Message, city *service.City) error {
+	msg := messenger.NewMessage(message, p.language.T("%s, часовой пояс %s. Всё верно?", city, timezoneName(city.Timezone, time.Now())))
+	msg.Keyboard = messenger.NewKeyboard(p.language.T(confirmTimezoneButton), p.language.T(rejectTimezoneButton))
+	p.waitChoice, p.waitConfirmation, p.found = 0, msg.ReplyToID+2, city
+	if _, err := p.sender.Send(msg); err != nil {
+		return fmt.Errorf("timezonePicker, couldn't send message: %v", err)
+	}
+	return nil
+}
+
+// button returns the button whose text is the message in the language, so choices are handled regardless of the language
+// of the keyboard. The message is returned as is if it isn't a button
+func button(language i18n.Language, text string, buttons ...string) string {
+	for _, b := range buttons {
+		if text == b || text == language.T(b) {
+			return b
+		}
+	}
+	return text
+}
+
+// cityButtons returns the cities with their current offsets, e.g. Minsk, Belarus (GMT+3)
+func cityButtons(cities []*service.City, now time.Time) []string {
+	buttons := make([]string, 0, len(cities))
+	for _, city := range cities {
+		timezone, err := service.LoadLocation(city.Timezone)
+		if err != nil {
+			logrus.Errorf("consumer couldn't offer %s: %v", city, err)
+			continue
+		}
+		buttons = append(buttons, fmt.Sprintf("%s (%s)", city, gmt(timezone, now)))
+	}
+	return buttons
+}
@@ -0,0 +1,95 @@
+package consumer
+
+import (
+	"context"
+	"fmt"
+	"github.com/chucky-1/finance/internal/i18n"
+	"github.com/chucky-1/finance/internal/messenger"
+	"github.com/chucky-1/finance/internal/model"
+	"github.com/chucky-1/finance/internal/repository"
+	"github.com/sirupsen/logrus"
+	"regexp"
+	"strings"
+	"time"
+)
+
+const token = "token"
+
+var tokenNameRegexp = regexp.MustCompile(`^[\p{L}0-9_-]{1,32}$`)
+
+var tokenUsageMessage = "Токены дают доступ к API приложения\n\n" +
+	"Создать токен только для чтения\n" +
+	"/token new <имя>\n" +
+	"Создать токен для чтения и записи\n" +
+	"/token new <имя> write\n" +
+	"Список токенов\n" +
+	"/token list\n" +
+	"Отозвать токен\n" +
+	"/token revoke <имя>"
+
+var tokenCreatedMessage = "Токен %s (%s) создан:\n\n%s\n\n" +
+	"Сохраните его, больше я его не покажу. Передавайте его в заголовке\nAuthorization: Bearer <токен>"
+
+// handleToken manages api tokens of the user: /token new <name> [read|write], /token list, /token revoke <name>
+func (f *Finance) handleToken(ctx context.Context, message *messenger.Message) error {
+	args := strings.Fields(message.CommandArguments())
+	if len(args) == 0 {
+		return f.sendMessage(message, f.language.T(tokenUsageMessage))
+	}
+
+	newCtx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+	switch {
+	case args[0] == "new" && (len(args) == 2 || len(args) == 3):
+		name, scope := args[1], model.ReadScope
+		if len(args) == 3 {
+			scope = args[2]
+		}
+		if !tokenNameRegexp.MatchString(name) || (scope != model.ReadScope && scope != model.WriteScope) {
+			return f.sendMessage(message, f.language.T(tokenUsageMessage))
+		}
+		apiToken, err := f.tokens.Create(newCtx, f.username, name, scope)
+		if err == repository.DuplicateAPITokenErr {
+			return f.sendMessage(message, f.language.T("Токен %s уже существует", name))
+		}
+		if err != nil {
+			return fmt.Errorf("couldn't create api token: %v", err)
+		}
+		logrus.Debugf("%s created %s api token %s", f.username, scope, name)
+		return f.sendMessage(message, f.language.T(tokenCreatedMessage, name, scope, apiToken))
+	case args[0] == "list" && len(args) == 1:
+		tokens, err := f.tokens.List(newCtx, f.username)
+		if err != nil {
+			return fmt.Errorf("couldn't get api tokens: %v", err)
+		}
+		return f.sendMessage(message, tokensList(f.language, tokens, f.timezone))
+	case args[0] == "revoke" && len(args) == 2:
+		revoked, err := f.tokens.Revoke(newCtx, f.username, args[1])
+		if err != nil {
+			return fmt.Errorf("couldn't revoke api token: %v", err)
+		}
+		if !revoked {
+			return f.sendMessage(message, f.language.T("Токен %s не найден", args[1]))
+		}
+		logrus.Debugf("%s revoked api token %s", f.username, args[1])
+		return f.sendMessage(message, f.language.T("Токен %s отозван", args[1]))
+	default:
+		return f.sendMessage(message, f.language.T(tokenUsageMessage))
+	}
+}
+
+func tokensList(language i18n.Language, tokens []*model.APIToken, timezone *time.Location) string {
+	if len(tokens) == 0 {
+		return language.T("У вас нет токенов")
+	}
+	const layout = "2006-01-02 15:04"
+	list := language.T("Ваши токены:\n")
+	for _, t := range tokens {
+		lastUsed := language.T("не использовался")
+		if t.LastUsedAt != nil {
+			lastUsed = language.T("использован %s", t.LastUsedAt.In(timezone).Format(layout))
+		}
+		list += language.T("\n%s (%s), создан %s, %s", t.Name, t.Scope, t.CreatedAt.In(timezone).Format(layout), lastUsed)
+	}
+	return list
+}
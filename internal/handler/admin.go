@@ -0,0 +1,114 @@
+package handler
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"github.com/chucky-1/finance/internal/repository"
+	"github.com/chucky-1/finance/internal/service"
+	"github.com/sirupsen/logrus"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+type deadReport struct {
+	ID            int64      `json:"id"`
+	Username      string     `json:"username"`
+	Period        string     `json:"period"`
+	Report        string     `json:"report"`
+	Attempts      int        `json:"attempts"`
+	LastError     string     `json:"last_error"`
+	LastAttemptAt *time.Time `json:"last_attempt_at"`
+	CreatedAt     time.Time  `json:"created_at"`
+}
+
+// Admin serves endpoints for administrators. It's disabled when the token is empty
+type Admin struct {
+	outbox *service.Outbox
+	token  string
+}
+
+func NewAdmin(outbox *service.Outbox, token string) *Admin {
+	return &Admin{
+		outbox: outbox,
+		token:  token,
+	}
+}
+
+func (a *Admin) Register(mux *http.ServeMux) {
+	mux.HandleFunc("/admin/outbox/dead", a.authorize(a.deadLetters))
+	mux.HandleFunc("/admin/outbox/replay", a.authorize(a.replay))
+}
+
+// deadLetters returns reports which couldn't be delivered
+func (a *Admin) deadLetters(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	reports, err := a.outbox.DeadLetters(r.Context())
+	if err != nil {
+		logrus.Errorf("admin handler couldn't get dead letters: %v", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	response := make([]deadReport, len(reports))
+	for i, report := range reports {
+		response[i] = deadReport{
+			ID:            report.ID,
+			Username:      report.Username,
+			Period:        report.Period,
+			Report:        report.Text,
+			Attempts:      report.Attempts,
+			LastError:     report.LastError,
+			LastAttemptAt: report.LastAttemptAt,
+			CreatedAt:     report.CreatedAt,
+		}
+	}
+	writeJSON(w, http.StatusOK, response)
+}
+
+// replay returns a dead report to the delivery queue, e.g. POST /admin/outbox/replay?id=12
+func (a *Admin) replay(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	id, err := strconv.ParseInt(r.URL.Query().Get("id"), 10, 64)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	err = a.outbox.Replay(r.Context(), id)
+	if err == repository.ReportNotFoundErr {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		logrus.Errorf("admin handler couldn't replay report %d: %v", id, err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	logrus.Infof("admin handler: report %d returned to the delivery queue", id)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (a *Admin) authorize(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		token := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if a.token == "" || subtle.ConstantTimeCompare([]byte(token), []byte(a.token)) != 1 {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		next(w, r)
+	}
+}
+
+func writeJSON(w http.ResponseWriter, status int, body interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(body); err != nil {
+		logrus.Errorf("handler couldn't write response: %v", err)
+	}
+}
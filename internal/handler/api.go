@@ -0,0 +1,341 @@
+package handler
+
+import (
+	_ "embed"
+	"encoding/json"
+	"errors"
+	"github.com/chucky-1/finance/internal/model"
+	"github.com/chucky-1/finance/internal/repository"
+	"github.com/chucky-1/finance/internal/service"
+	"github.com/sirupsen/logrus"
+	"net/http"
+	"strings"
+	"time"
+)
+
+const (
+	expenses    = "expenses"
+	dayLayout   = "2006-01-02"
+	monthLayout = "2006-01"
+)
+
+//go:embed openapi.yaml
+var openAPI []byte
+
+type entryRequest struct {
+	Category string     `json:"category"`
+	Amount   float64    `json:"amount"`
+	Date     *time.Time `json:"date,omitempty"`
+}
+
+type entryResponse struct {
+	ID       string    `json:"id"`
+	Category string    `json:"category"`
+	Amount   float64   `json:"amount"`
+	Date     time.Time `json:"date"`
+}
+
+type reportResponse struct {
+	From       time.Time          `json:"from"`
+	To         time.Time          `json:"to"`
+	Categories map[string]float64 `json:"categories"`
+	Total      float64            `json:"total"`
+}
+
+type errorResponse struct {
+	Error string `json:"error"`
+}
+
+// userHandler serves a request of the authenticated user
+type userHandler func(w http.ResponseWriter, r *http.Request, user *model.User, timezone *time.Location)
+
+// API serves entries and reports of users, they authenticate with personal tokens created in the bot.
+// Read-only tokens can only GET. Days and months are in the timezone of the user
+type API struct {
+	tokens   *service.APIToken
+	recorder *service.Recorder
+	reporter *service.Reporter
+}
+
+func NewAPI(tokens *service.APIToken, recorder *service.Recorder, reporter *service.Reporter) *API {
+	return &API{
+		tokens:   tokens,
+		recorder: recorder,
+		reporter: reporter,
+	}
+}
+
+func (a *API) Register(mux *http.ServeMux) {
+	mux.HandleFunc("/api/openapi.yaml", a.openAPI)
+	mux.HandleFunc("/api/entries", a.authorize(a.entries))
+	mux.HandleFunc("/api/entries/", a.authorize(a.entry))
+	mux.HandleFunc("/api/reports", a.authorize(a.rangeReport))
+	mux.HandleFunc("/api/reports/daily", a.authorize(a.dailyReport))
+	mux.HandleFunc("/api/reports/monthly", a.authorize(a.monthlyReport))
+}
+
+func (a *API) openAPI(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	w.Header().Set("Content-Type", "application/yaml")
+	if _, err := w.Write(openAPI); err != nil {
+		logrus.Errorf("api handler couldn't write openapi: %v", err)
+	}
+}
+
+// entries lists entries of the days from and to, e.g. GET /api/entries?from=2023-06-01&to=2023-06-30,
+// or creates an entry with POST /api/entries
+func (a *API) entries(w http.ResponseWriter, r *http.Request, user *model.User, timezone *time.Location) {
+	switch r.Method {
+	case http.MethodGet:
+		from, to, err := daysRange(r, timezone)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, err)
+			return
+		}
+		entries, err := a.recorder.Entries(r.Context(), expenses, user.Username, from, to)
+		if err != nil {
+			logrus.Errorf("api handler couldn't get entries of %s: %v", user.Username, err)
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		response := make([]entryResponse, len(entries))
+		for i, entry := range entries {
+			response[i] = toEntryResponse(entry)
+		}
+		writeJSON(w, http.StatusOK, response)
+	case http.MethodPost:
+		request, err := decodeEntry(r)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, err)
+			return
+		}
+		entry := &model.Entry{
+			Kind:     expenses,
+			User:     user.Username,
+			Date:     time.Now().UTC(),
+			Category: &model.Category{Name: request.Category, Amount: request.Amount},
+		}
+		if request.Date != nil {
+			entry.Date = request.Date.UTC()
+		}
+		if err = a.recorder.Add(r.Context(), entry, timezone, user.MonthStart); err != nil {
+			logrus.Errorf("api handler couldn't add entry of %s: %v", user.Username, err)
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		logrus.Debugf("%s added expenses via api: %s: %.2f", user.Username, entry.Category.Name, entry.Category.Amount)
+		writeJSON(w, http.StatusCreated, toEntryResponse(entry))
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
+
+// entry gets, updates or deletes the entry, e.g. DELETE /api/entries/649c1f0e8a5b2d7c3e4f5a6b
+func (a *API) entry(w http.ResponseWriter, r *http.Request, user *model.User, timezone *time.Location) {
+	id := strings.TrimPrefix(r.URL.Path, "/api/entries/")
+	if id == "" || strings.Contains(id, "/") {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		entry, err := a.recorder.Entry(r.Context(), expenses, user.Username, id)
+		if err != nil {
+			a.writeEntryError(w, user, id, err)
+			return
+		}
+		writeJSON(w, http.StatusOK, toEntryResponse(entry))
+	case http.MethodPut:
+		request, err := decodeEntry(r)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, err)
+			return
+		}
+		entry, err := a.recorder.Entry(r.Context(), expenses, user.Username, id)
+		if err != nil {
+			a.writeEntryError(w, user, id, err)
+			return
+		}
+		entry.Category = &model.Category{Name: request.Category, Amount: request.Amount}
+		if request.Date != nil {
+			entry.Date = request.Date.UTC()
+		}
+		if err = a.recorder.Update(r.Context(), entry, timezone, user.MonthStart); err != nil {
+			a.writeEntryError(w, user, id, err)
+			return
+		}
+		writeJSON(w, http.StatusOK, toEntryResponse(entry))
+	case http.MethodDelete:
+		if err := a.recorder.Delete(r.Context(), expenses, user.Username, id, timezone, user.MonthStart); err != nil {
+			a.writeEntryError(w, user, id, err)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
+
+// dailyReport returns expenses of the day, today by default, e.g. GET /api/reports/daily?date=2023-06-28
+func (a *API) dailyReport(w http.ResponseWriter, r *http.Request, user *model.User, timezone *time.Location) {
+	from := service.DayStart(time.Now().UTC(), timezone)
+	if value := r.URL.Query().Get("date"); value != "" {
+		day, err := time.ParseInLocation(dayLayout, value, timezone)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, errors.New("date must be in format YYYY-MM-DD"))
+			return
+		}
+		from = day.UTC()
+	}
+	a.writeReport(w, r, user, from, from.In(timezone).AddDate(0, 0, 1).UTC())
+}
+
+// monthlyReport returns expenses of the financial month, the current one by default, e.g. GET /api/reports/monthly?month=2023-06.
+// The month is the one when the financial month begins
+func (a *API) monthlyReport(w http.ResponseWriter, r *http.Request, user *model.User, timezone *time.Location) {
+	month := service.MonthStart(time.Now().UTC(), timezone, user.MonthStart).In(timezone).Format(monthLayout)
+	if value := r.URL.Query().Get("month"); value != "" {
+		month = value
+	}
+	from, to, err := service.MonthRange(month, timezone, user.MonthStart)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, errors.New("month must be in format YYYY-MM"))
+		return
+	}
+	a.writeReport(w, r, user, from, to)
+}
+
+// rangeReport returns expenses of the days from and to, e.g. GET /api/reports?from=2023-06-01&to=2023-06-15
+func (a *API) rangeReport(w http.ResponseWriter, r *http.Request, user *model.User, timezone *time.Location) {
+	if r.URL.Query().Get("from") == "" || r.URL.Query().Get("to") == "" {
+		writeError(w, http.StatusBadRequest, errors.New("from and to are required"))
+		return
+	}
+	from, to, err := daysRange(r, timezone)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	a.writeReport(w, r, user, from, to)
+}
+
+func (a *API) writeReport(w http.ResponseWriter, r *http.Request, user *model.User, from, to time.Time) {
+	if r.Method != http.MethodGet {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	categories, err := a.reporter.Report(r.Context(), user.Username, from, to)
+	if err != nil {
+		logrus.Errorf("api handler couldn't get report of %s: %v", user.Username, err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	var total float64
+	for _, amount := range categories {
+		total += amount
+	}
+	writeJSON(w, http.StatusOK, reportResponse{
+		From:       from,
+		To:         to,
+		Categories: categories,
+		Total:      total,
+	})
+}
+
+func (a *API) writeEntryError(w http.ResponseWriter, user *model.User, id string, err error) {
+	if err == repository.EntryNotFoundErr {
+		writeError(w, http.StatusNotFound, err)
+		return
+	}
+	logrus.Errorf("api handler couldn't handle entry %s of %s: %v", id, user.Username, err)
+	w.WriteHeader(http.StatusInternalServerError)
+}
+
+func (a *API) authorize(next userHandler) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if !ok {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="finance"`)
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		user, apiToken, err := a.tokens.Authenticate(r.Context(), token)
+		if err == service.InvalidAPITokenErr {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		if err != nil {
+			logrus.Errorf("api handler couldn't authenticate token: %v", err)
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		if r.Method != http.MethodGet && apiToken.Scope != model.WriteScope {
+			writeError(w, http.StatusForbidden, errors.New("token is read-only"))
+			return
+		}
+		timezone, err := service.LoadLocation(user.Timezone)
+		if err != nil {
+			logrus.Errorf("api handler couldn't load timezone of %s: %v", user.Username, err)
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		next(w, r, user, timezone)
+	}
+}
+
+// daysRange parses the days from and to in the timezone, both are today by default. The end of the range is the next day after to
+func daysRange(r *http.Request, timezone *time.Location) (time.Time, time.Time, error) {
+	from := service.DayStart(time.Now().UTC(), timezone).In(timezone)
+	to := from
+	if value := r.URL.Query().Get("from"); value != "" {
+		day, err := time.ParseInLocation(dayLayout, value, timezone)
+		if err != nil {
+			return time.Time{}, time.Time{}, errors.New("from must be in format YYYY-MM-DD")
+		}
+		from = day
+		to = from
+	}
+	if value := r.URL.Query().Get("to"); value != "" {
+		day, err := time.ParseInLocation(dayLayout, value, timezone)
+		if err != nil {
+			return time.Time{}, time.Time{}, errors.New("to must be in format YYYY-MM-DD")
+		}
+		to = day
+	}
+	if to.Before(from) {
+		return time.Time{}, time.Time{}, errors.New("from must not be after to")
+	}
+	// the next day is added in the timezone, so days with daylight saving time changes aren't 24 hours long
+	return from.UTC(), to.AddDate(0, 0, 1).UTC(), nil
+}
+
+func decodeEntry(r *http.Request) (*entryRequest, error) {
+	var request entryRequest
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		return nil, errors.New("body must be an entry in json")
+	}
+	if strings.TrimSpace(request.Category) == "" {
+		return nil, errors.New("category is required")
+	}
+	if request.Amount == 0 {
+		return nil, errors.New("amount must be a number other than zero")
+	}
+	return &request, nil
+}
+
+func toEntryResponse(entry *model.Entry) entryResponse {
+	return entryResponse{
+		ID:       entry.ID,
+		Category: entry.Category.Name,
+		Amount:   entry.Category.Amount,
+		Date:     entry.Date,
+	}
+}
+
+func writeError(w http.ResponseWriter, status int, err error) {
+	writeJSON(w, status, errorResponse{Error: err.Error()})
+}
@@ -0,0 +1,406 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/chucky-1/finance/internal/model"
+	"github.com/chucky-1/finance/internal/repository"
+	"github.com/chucky-1/finance/internal/service"
+)
+
+type fakeUsers struct {
+	user *model.User
+}
+
+func (u *fakeUsers) Create(context.Context, *model.User) error {
+	return nil
+}
+
+func (u *fakeUsers) Get(_ context.Context, username string) (*model.User, error) {
+	if username != u.user.Username {
+		return nil, nil
+	}
+	return u.user, nil
+}
+
+func (u *fakeUsers) GetAll(context.Context) ([]*model.User, error) {
+	return []*model.User{u.user}, nil
+}
+
+func (u *fakeUsers) GetByTelegramID(context.Context, int64) (*model.User, error) {
+	return nil, nil
+}
+
+func (u *fakeUsers) SetTelegramID(context.Context, string, int64) error {
+	return nil
+}
+
+func (u *fakeUsers) UpdatePassword(context.Context, string, string) (bool, error) {
+	return false, nil
+}
+
+func (u *fakeUsers) UpdateTimezone(context.Context, string, string, string) (bool, error) {
+	return false, nil
+}
+
+func (u *fakeUsers) UpdateReportTime(context.Context, string, model.ReportTime) (bool, error) {
+	return false, nil
+}
+
+func (u *fakeUsers) UpdateMonthStart(context.Context, string, int) (bool, error) {
+	return false, nil
+}
+
+func (u *fakeUsers) UpdateLanguage(context.Context, string, string) (bool, error) {
+	return false, nil
+}
+
+func (u *fakeUsers) SetChat(context.Context, string, int64) error {
+	return nil
+}
+
+func (u *fakeUsers) Delete(context.Context, string) (bool, error) {
+	return false, nil
+}
+
+type fakeAPITokens struct {
+	mu     sync.Mutex
+	tokens map[string]*model.APIToken
+}
+
+func (f *fakeAPITokens) Add(_ context.Context, token *model.APIToken, hash string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.tokens[hash] = token
+	return nil
+}
+
+func (f *fakeAPITokens) GetAll(context.Context, string) ([]*model.APIToken, error) {
+	return nil, nil
+}
+
+func (f *fakeAPITokens) Delete(context.Context, string, string) (bool, error) {
+	return false, nil
+}
+
+func (f *fakeAPITokens) Use(_ context.Context, hash string, _ time.Time) (*model.APIToken, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.tokens[hash], nil
+}
+
+// fakeEntries keeps entries in memory and the sums of aggregated periods
+type fakeEntries struct {
+	mu      sync.Mutex
+	lastID  int
+	entries map[string]*model.Entry
+	periods map[string]float64
+}
+
+func (f *fakeEntries) Add(_ context.Context, entry *model.Entry, period string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.periods[period] += entry.Category.Amount
+	return nil
+}
+
+func (f *fakeEntries) AddEntry(_ context.Context, entry *model.Entry) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.lastID++
+	entry.ID = fmt.Sprint(f.lastID)
+	f.entries[entry.ID] = copyEntry(entry)
+	return nil
+}
+
+func (f *fakeEntries) GetEntry(_ context.Context, _, user, id string) (*model.Entry, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	entry, ok := f.entries[id]
+	if !ok || entry.User != user {
+		return nil, repository.EntryNotFoundErr
+	}
+	return copyEntry(entry), nil
+}
+
+func (f *fakeEntries) GetEntries(_ context.Context, _, user string, from, to time.Time) ([]*model.Entry, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	entries := make([]*model.Entry, 0)
+	for id := 1; id <= f.lastID; id++ {
+		entry, ok := f.entries[fmt.Sprint(id)]
+		if ok && entry.User == user && !entry.Date.Before(from) && entry.Date.Before(to) {
+			entries = append(entries, copyEntry(entry))
+		}
+	}
+	return entries, nil
+}
+
+func (f *fakeEntries) UpdateEntry(_ context.Context, entry *model.Entry) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.entries[entry.ID] = copyEntry(entry)
+	return nil
+}
+
+func (f *fakeEntries) DeleteEntry(_ context.Context, _, _, id string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	delete(f.entries, id)
+	return nil
+}
+
+func copyEntry(entry *model.Entry) *model.Entry {
+	category := *entry.Category
+	e := *entry
+	e.Category = &category
+	return &e
+}
+
+type testAPI struct {
+	mux        *http.ServeMux
+	entries    *fakeEntries
+	writeToken string
+	readToken  string
+}
+
+func newTestAPI(t *testing.T) *testAPI {
+	return newTestAPIOfUser(t, &model.User{Username: "dima", Timezone: "Europe/Minsk"})
+}
+
+func newTestAPIOfUser(t *testing.T, user *model.User) *testAPI {
+	entries := &fakeEntries{entries: make(map[string]*model.Entry), periods: make(map[string]float64)}
+	users := &fakeUsers{user: user}
+	tokens := service.NewAPIToken(&fakeAPITokens{tokens: make(map[string]*model.APIToken)}, users)
+	writeToken, err := tokens.Create(context.Background(), "dima", "script", model.WriteScope)
+	require.NoError(t, err)
+	readToken, err := tokens.Create(context.Background(), "dima", "dashboard", model.ReadScope)
+	require.NoError(t, err)
+
+	mux := http.NewServeMux()
+	NewAPI(tokens, service.NewRecorder(entries, entries), service.NewReporter(nil, nil, nil, nil, entries)).Register(mux)
+	return &testAPI{
+		mux:        mux,
+		entries:    entries,
+		writeToken: writeToken,
+		readToken:  readToken,
+	}
+}
+
+func (a *testAPI) serve(t *testing.T, method, target, body string, response interface{}) int {
+	return a.serveWithToken(t, a.writeToken, method, target, body, response)
+}
+
+func (a *testAPI) serveWithToken(t *testing.T, token, method, target, body string, response interface{}) int {
+	request := httptest.NewRequest(method, target, strings.NewReader(body))
+	request.Header.Set("Authorization", "Bearer "+token)
+	recorder := httptest.NewRecorder()
+	a.mux.ServeHTTP(recorder, request)
+	if response != nil {
+		require.NoError(t, json.NewDecoder(recorder.Body).Decode(response))
+	}
+	return recorder.Code
+}
+
+func TestAPI_Entries(t *testing.T) {
+	api := newTestAPI(t)
+
+	var created entryResponse
+	code := api.serve(t, http.MethodPost, "/api/entries", `{"category":"Кофе","amount":3.5}`, &created)
+	require.Equal(t, http.StatusCreated, code)
+	require.Equal(t, "Кофе", created.Category)
+	require.Equal(t, 3.5, api.entries.periods["today"])
+
+	var listed []entryResponse
+	code = api.serve(t, http.MethodGet, "/api/entries", "", &listed)
+	require.Equal(t, http.StatusOK, code)
+	require.Equal(t, []entryResponse{created}, listed)
+
+	var updated entryResponse
+	code = api.serve(t, http.MethodPut, "/api/entries/"+created.ID, `{"category":"Кофе","amount":4}`, &updated)
+	require.Equal(t, http.StatusOK, code)
+	require.Equal(t, 4.0, updated.Amount)
+	require.Equal(t, created.Date, updated.Date)
+	require.Equal(t, 4.0, api.entries.periods["today"])
+
+	var report reportResponse
+	code = api.serve(t, http.MethodGet, "/api/reports/daily", "", &report)
+	require.Equal(t, http.StatusOK, code)
+	require.Equal(t, map[string]float64{"Кофе": 4}, report.Categories)
+	require.Equal(t, 4.0, report.Total)
+
+	code = api.serve(t, http.MethodDelete, "/api/entries/"+created.ID, "", nil)
+	require.Equal(t, http.StatusNoContent, code)
+	require.Equal(t, 0.0, api.entries.periods["today"])
+
+	code = api.serve(t, http.MethodGet, "/api/entries/"+created.ID, "", nil)
+	require.Equal(t, http.StatusNotFound, code)
+}
+
+func TestAPI_EntryInThePastIsNotInTheDailyPeriod(t *testing.T) {
+	api := newTestAPI(t)
+
+	code := api.serve(t, http.MethodPost, "/api/entries", `{"category":"Кофе","amount":3.5,"date":"2023-06-28T12:00:00Z"}`, nil)
+	require.Equal(t, http.StatusCreated, code)
+	require.Equal(t, 0.0, api.entries.periods["today"])
+	require.Equal(t, 3.5, api.entries.periods["2023-06"])
+}
+
+func TestAPI_Reports(t *testing.T) {
+	api := newTestAPI(t)
+	// the user is in Europe/Minsk (GMT+3), so the first entry is on June 28 and the second on June 29
+	for _, body := range []string{
+		`{"category":"Кофе","amount":3.5,"date":"2023-06-28T20:00:00Z"}`,
+		`{"category":"Кофе","amount":2,"date":"2023-06-28T21:30:00Z"}`,
+		`{"category":"Такси","amount":10,"date":"2023-07-01T10:00:00Z"}`,
+	} {
+		require.Equal(t, http.StatusCreated, api.serve(t, http.MethodPost, "/api/entries", body, nil))
+	}
+
+	testTable := []struct {
+		name       string
+		target     string
+		categories map[string]float64
+		total      float64
+	}{
+		{
+			name:       "Day",
+			target:     "/api/reports/daily?date=2023-06-28",
+			categories: map[string]float64{"Кофе": 3.5},
+			total:      3.5,
+		},
+		{
+			name:       "Month",
+			target:     "/api/reports/monthly?month=2023-06",
+			categories: map[string]float64{"Кофе": 5.5},
+			total:      5.5,
+		},
+		{
+			name:       "Range",
+			target:     "/api/reports?from=2023-06-29&to=2023-07-01",
+			categories: map[string]float64{"Кофе": 2, "Такси": 10},
+			total:      12,
+		},
+	}
+
+	for _, testCase := range testTable {
+		t.Run(testCase.name, func(t *testing.T) {
+			var report reportResponse
+			require.Equal(t, http.StatusOK, api.serve(t, http.MethodGet, testCase.target, "", &report))
+			require.Equal(t, testCase.categories, report.Categories)
+			require.Equal(t, testCase.total, report.Total)
+		})
+	}
+}
+
+func TestAPI_FinancialMonth(t *testing.T) {
+	// months of the user begin on the 28th, June 27 is in the month which has begun on May 28
+	api := newTestAPIOfUser(t, &model.User{Username: "dima", Timezone: "Europe/Minsk", MonthStart: 28})
+	for _, body := range []string{
+		`{"category":"Кофе","amount":3.5,"date":"2023-06-27T20:00:00Z"}`,
+		`{"category":"Кофе","amount":2,"date":"2023-06-27T21:30:00Z"}`,
+		`{"category":"Такси","amount":10,"date":"2023-07-27T20:00:00Z"}`,
+	} {
+		require.Equal(t, http.StatusCreated, api.serve(t, http.MethodPost, "/api/entries", body, nil))
+	}
+	require.Equal(t, 3.5, api.entries.periods["2023-05-28"])
+	require.Equal(t, 12.0, api.entries.periods["2023-06-28"])
+
+	var report reportResponse
+	require.Equal(t, http.StatusOK, api.serve(t, http.MethodGet, "/api/reports/monthly?month=2023-06", "", &report))
+	require.Equal(t, map[string]float64{"Кофе": 2, "Такси": 10}, report.Categories)
+}
+
+func TestAPI_BadRequests(t *testing.T) {
+	api := newTestAPI(t)
+
+	testTable := []struct {
+		name   string
+		method string
+		target string
+		body   string
+	}{
+		{
+			name:   "Without category",
+			method: http.MethodPost,
+			target: "/api/entries",
+			body:   `{"amount":3.5}`,
+		},
+		{
+			name:   "Without amount",
+			method: http.MethodPost,
+			target: "/api/entries",
+			body:   `{"category":"Кофе"}`,
+		},
+		{
+			name:   "Not json",
+			method: http.MethodPost,
+			target: "/api/entries",
+			body:   `Кофе 3.5`,
+		},
+		{
+			name:   "Wrong date",
+			method: http.MethodGet,
+			target: "/api/entries?from=28.06.2023",
+		},
+		{
+			name:   "From after to",
+			method: http.MethodGet,
+			target: "/api/reports?from=2023-06-28&to=2023-06-27",
+		},
+		{
+			name:   "Range without to",
+			method: http.MethodGet,
+			target: "/api/reports?from=2023-06-28",
+		},
+	}
+
+	for _, testCase := range testTable {
+		t.Run(testCase.name, func(t *testing.T) {
+			var response errorResponse
+			require.Equal(t, http.StatusBadRequest, api.serve(t, testCase.method, testCase.target, testCase.body, &response))
+			require.NotEmpty(t, response.Error)
+		})
+	}
+}
+
+func TestAPI_Unauthorized(t *testing.T) {
+	api := newTestAPI(t)
+
+	for _, authorization := range []string{"", "Bearer fin_unknown", "Bearer " + api.writeToken + "a", "Basic ZGltYTpzZWNyZXQ="} {
+		request := httptest.NewRequest(http.MethodGet, "/api/entries", nil)
+		request.Header.Set("Authorization", authorization)
+		recorder := httptest.NewRecorder()
+		api.mux.ServeHTTP(recorder, request)
+		require.Equal(t, http.StatusUnauthorized, recorder.Code)
+	}
+}
+
+func TestAPI_ReadOnlyToken(t *testing.T) {
+	api := newTestAPI(t)
+
+	require.Equal(t, http.StatusOK, api.serveWithToken(t, api.readToken, http.MethodGet, "/api/entries", "", nil))
+	require.Equal(t, http.StatusForbidden,
+		api.serveWithToken(t, api.readToken, http.MethodPost, "/api/entries", `{"category":"Кофе","amount":3.5}`, nil))
+	require.Empty(t, api.entries.entries)
+}
+
+func TestAPI_OpenAPI(t *testing.T) {
+	api := newTestAPI(t)
+
+	request := httptest.NewRequest(http.MethodGet, "/api/openapi.yaml", nil)
+	recorder := httptest.NewRecorder()
+	api.mux.ServeHTTP(recorder, request)
+	require.Equal(t, http.StatusOK, recorder.Code)
+	require.Contains(t, recorder.Body.String(), "openapi: 3.0.3")
+}
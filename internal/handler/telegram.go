@@ -0,0 +1,90 @@
+package handler
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"github.com/sirupsen/logrus"
+	"net/http"
+	"strings"
+)
+
+const secretTokenHeader = "X-Telegram-Bot-Api-Secret-Token"
+
+// Telegram receives updates of the bot via webhook. The path and the secret token of the webhook
+// are derived from the secret, so they stay the same after restarts and differ between bots
+type Telegram struct {
+	bot         *tgbotapi.BotAPI
+	path        string
+	secretToken string
+	updates     chan tgbotapi.Update
+}
+
+func NewTelegram(bot *tgbotapi.BotAPI, secret string) *Telegram {
+	return &Telegram{
+		bot:         bot,
+		path:        "/telegram/" + derive(secret, "path:"+bot.Self.UserName),
+		secretToken: derive(secret, "token:"+bot.Self.UserName),
+		updates:     make(chan tgbotapi.Update),
+	}
+}
+
+func (t *Telegram) Register(mux *http.ServeMux) {
+	mux.HandleFunc(t.path, t.receive)
+}
+
+// SetWebhook tells telegram to send updates to the base url of the service
+func (t *Telegram) SetWebhook(baseURL string) error {
+	params := make(tgbotapi.Params)
+	params["url"] = strings.TrimSuffix(baseURL, "/") + t.path
+	params["secret_token"] = t.secretToken
+	if err := params.AddInterface("allowed_updates", []string{"message"}); err != nil {
+		return fmt.Errorf("couldn't add allowed updates: %v", err)
+	}
+	if _, err := t.bot.MakeRequest("setWebhook", params); err != nil {
+		return fmt.Errorf("couldn't set webhook for %s: %v", t.bot.Self.UserName, err)
+	}
+	logrus.Infof("webhook for %s is set", t.bot.Self.UserName)
+	return nil
+}
+
+func (t *Telegram) Updates() tgbotapi.UpdatesChannel {
+	return t.updates
+}
+
+func (t *Telegram) receive(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	if subtle.ConstantTimeCompare([]byte(r.Header.Get(secretTokenHeader)), []byte(t.secretToken)) != 1 {
+		logrus.Infof("telegram handler received update with wrong secret token from %s", r.RemoteAddr)
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+
+	var update tgbotapi.Update
+	if err := json.NewDecoder(r.Body).Decode(&update); err != nil {
+		logrus.Errorf("telegram handler couldn't decode update: %v", err)
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	// telegram retries the update if it isn't accepted, so the consumer isn't skipped while it's busy
+	select {
+	case t.updates <- update:
+		w.WriteHeader(http.StatusOK)
+	case <-r.Context().Done():
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}
+}
+
+func derive(secret, value string) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(value))
+	return hex.EncodeToString(mac.Sum(nil))
+}
@@ -0,0 +1,59 @@
+package handler
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTelegram_Receive(t *testing.T) {
+	bot := &tgbotapi.BotAPI{Self: tgbotapi.User{UserName: "finance_bot"}}
+	webhook := NewTelegram(bot, "secret")
+	mux := http.NewServeMux()
+	webhook.Register(mux)
+
+	received := make(chan tgbotapi.Update, 1)
+	go func() {
+		received <- <-webhook.Updates()
+	}()
+
+	request := httptest.NewRequest(http.MethodPost, webhook.path,
+		strings.NewReader(`{"update_id":1,"message":{"message_id":2,"text":"Кофе 3.5","chat":{"id":3}}}`))
+	request.Header.Set(secretTokenHeader, webhook.secretToken)
+	recorder := httptest.NewRecorder()
+	mux.ServeHTTP(recorder, request)
+	require.Equal(t, http.StatusOK, recorder.Code)
+
+	select {
+	case update := <-received:
+		require.Equal(t, "Кофе 3.5", update.Message.Text)
+		require.Equal(t, int64(3), update.Message.Chat.ID)
+	case <-time.After(time.Second):
+		t.Fatal("update wasn't received")
+	}
+}
+
+func TestTelegram_ReceiveWithWrongSecretToken(t *testing.T) {
+	bot := &tgbotapi.BotAPI{Self: tgbotapi.User{UserName: "finance_bot"}}
+	webhook := NewTelegram(bot, "secret")
+	mux := http.NewServeMux()
+	webhook.Register(mux)
+
+	request := httptest.NewRequest(http.MethodPost, webhook.path, strings.NewReader(`{"update_id":1}`))
+	request.Header.Set(secretTokenHeader, "wrong")
+	recorder := httptest.NewRecorder()
+	mux.ServeHTTP(recorder, request)
+	require.Equal(t, http.StatusUnauthorized, recorder.Code)
+}
+
+func TestTelegram_PathsDifferBetweenBots(t *testing.T) {
+	daily := NewTelegram(&tgbotapi.BotAPI{Self: tgbotapi.User{UserName: "daily_bot"}}, "secret")
+	monthly := NewTelegram(&tgbotapi.BotAPI{Self: tgbotapi.User{UserName: "monthly_bot"}}, "secret")
+	require.NotEqual(t, daily.path, monthly.path)
+	require.NotEqual(t, daily.secretToken, monthly.secretToken)
+}
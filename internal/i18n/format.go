@@ -0,0 +1,75 @@
+package i18n
+
+import (
+	"math"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// months are names of months by languages: the first is the month itself, e.g. Июнь 2023,
+// the second follows the day of the month, e.g. 28 Июня, which is a different declension in Russian and Polish
+var months = map[Language][12][2]string{
+	Russian: {
+		{"Январь", "Января"}, {"Февраль", "Февраля"}, {"Март", "Марта"}, {"Апрель", "Апреля"},
+		{"Май", "Мая"}, {"Июнь", "Июня"}, {"Июль", "Июля"}, {"Август", "Августа"},
+		{"Сентябрь", "Сентября"}, {"Октябрь", "Октября"}, {"Ноябрь", "Ноября"}, {"Декабрь", "Декабря"},
+	},
+	English: {
+		{"January", "January"}, {"February", "February"}, {"March", "March"}, {"April", "April"},
+		{"May", "May"}, {"June", "June"}, {"July", "July"}, {"August", "August"},
+		{"September", "September"}, {"October", "October"}, {"November", "November"}, {"December", "December"},
+	},
+	Polish: {
+		{"Styczeń", "stycznia"}, {"Luty", "lutego"}, {"Marzec", "marca"}, {"Kwiecień", "kwietnia"},
+		{"Maj", "maja"}, {"Czerwiec", "czerwca"}, {"Lipiec", "lipca"}, {"Sierpień", "sierpnia"},
+		{"Wrzesień", "września"}, {"Październik", "października"}, {"Listopad", "listopada"}, {"Grudzień", "grudnia"},
+	},
+}
+
+// numberFormat is how the language writes numbers
+type numberFormat struct {
+	decimal string
+	group   string
+	// minGroupDigits is how many digits the integer part has at least to be grouped, e.g. 5 in Polish: 1234 but 12 345
+	minGroupDigits int
+}
+
+// numberFormats follow CLDR, the group separator is the no-break space where the language uses a space
+var numberFormats = map[Language]numberFormat{
+	Russian: {decimal: ",", group: "\u00a0", minGroupDigits: 4},
+	English: {decimal: ".", group: ",", minGroupDigits: 4},
+	Polish:  {decimal: ",", group: "\u00a0", minGroupDigits: 5},
+}
+
+// Month returns the name of the month, e.g. Июнь
+func (l Language) Month(month time.Month) string {
+	return months[l.orDefault()][month-1][0]
+}
+
+// MonthOfDate returns the name of the month after the day of the month, e.g. Июня in 28 Июня
+func (l Language) MonthOfDate(month time.Month) string {
+	return months[l.orDefault()][month-1][1]
+}
+
+// Number returns the amount with two decimals by the rules of the language, e.g. 1 234,50 in Russian and 1,234.50 in English
+func (l Language) Number(amount float64) string {
+	format := numberFormats[l.orDefault()]
+	text := strconv.FormatFloat(math.Abs(amount), 'f', 2, 64)
+	integer, fraction, _ := strings.Cut(text, ".")
+	if len(integer) >= format.minGroupDigits {
+		var grouped strings.Builder
+		for i, digit := range integer {
+			if i > 0 && (len(integer)-i)%3 == 0 {
+				grouped.WriteString(format.group)
+			}
+			grouped.WriteRune(digit)
+		}
+		integer = grouped.String()
+	}
+	sign := ""
+	if amount < 0 && text != "0.00" {
+		sign = "-"
+	}
+	return sign + integer + format.decimal + fraction
+}
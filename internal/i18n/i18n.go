@@ -0,0 +1,192 @@
+// Package i18n translates messages to the language of the user. Messages are written in Russian in the code
+// and the Russian text is the key of the message in catalogs of other languages, like in gettext
+package i18n
+
+import (
+	"embed"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/sirupsen/logrus"
+)
+
+type Language string
+
+const (
+	Russian Language = "ru"
+	English Language = "en"
+	Polish  Language = "pl"
+)
+
+// Languages are the supported languages in the order they are offered to users
+var Languages = []Language{Russian, English, Polish}
+
+// names are the names of the languages in themselves, so users find their language in any interface
+var names = map[Language]string{
+	Russian: "Русский",
+	English: "English",
+	Polish:  "Polski",
+}
+
+// catalogsData are translations of messages by languages, the Russian catalog has only plural forms
+//
+//go:embed *.json
+var catalogsData embed.FS
+
+// catalog is a translation of messages of one language
+type catalog struct {
+	messages map[string]string
+	// plurals are forms of messages by plural categories, e.g. one, few and many
+	plurals map[string]map[string]string
+}
+
+var catalogs = mustParseCatalogs()
+
+func mustParseCatalogs() map[Language]*catalog {
+	parsed := make(map[Language]*catalog, len(Languages))
+	for _, language := range Languages {
+		data, err := catalogsData.ReadFile(string(language) + ".json")
+		if err != nil {
+			panic(err)
+		}
+		c, err := parseCatalog(data)
+		if err != nil {
+			panic(fmt.Errorf("i18n, catalog %s: %v", language, err))
+		}
+		parsed[language] = c
+	}
+	return parsed
+}
+
+// parseCatalog parses an object whose keys are messages and values are translations
+// or plural forms like {"one": "%d character", "other": "%d characters"}
+func parseCatalog(data []byte) (*catalog, error) {
+	var raw map[string]json.RawMessage
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return nil, err
+	}
+	c := &catalog{
+		messages: make(map[string]string),
+		plurals:  make(map[string]map[string]string),
+	}
+	for key, value := range raw {
+		var message string
+		if err := json.Unmarshal(value, &message); err == nil {
+			c.messages[key] = message
+			continue
+		}
+		var forms map[string]string
+		if err := json.Unmarshal(value, &forms); err != nil {
+			return nil, fmt.Errorf("message %q is neither a string nor plural forms", key)
+		}
+		c.plurals[key] = forms
+	}
+	return c, nil
+}
+
+// Parse returns the supported language by its code, e.g. pl or en-US like telegram sends it
+func Parse(code string) (Language, bool) {
+	code = strings.ToLower(strings.TrimSpace(code))
+	code, _, _ = strings.Cut(strings.ReplaceAll(code, "_", "-"), "-")
+	for _, language := range Languages {
+		if string(language) == code {
+			return language, true
+		}
+	}
+	return "", false
+}
+
+// Detect returns the supported language by its code or Russian, e.g. for the language of the telegram client
+func Detect(code string) Language {
+	language, ok := Parse(code)
+	if !ok {
+		return Russian
+	}
+	return language
+}
+
+// Name returns the name of the language in itself, e.g. Polski
+func (l Language) Name() string {
+	return names[l.orDefault()]
+}
+
+// T translates the message and formats it with the arguments like fmt.Sprintf.
+// The message stays in Russian if the language has no translation of it
+func (l Language) T(message string, args ...interface{}) string {
+	translated := message
+	if l.orDefault() != Russian {
+		if m, ok := catalogs[l.orDefault()].messages[message]; ok {
+			translated = m
+		} else {
+			logrus.Warnf("i18n: no %s translation of %q", l, message)
+		}
+	}
+	if len(args) == 0 {
+		return translated
+	}
+	return fmt.Sprintf(translated, args...)
+}
+
+// Plural translates the message in the plural form of the number and formats it with the arguments,
+// e.g. "Максимум %d символов" is "Максимум 21 символ" in Russian and "Maximum 21 characters" in English
+func (l Language) Plural(message string, n int, args ...interface{}) string {
+	translated := message
+	forms, ok := catalogs[l.orDefault()].plurals[message]
+	if ok {
+		translated = pluralForm(forms, l.pluralCategory(n))
+	} else {
+		logrus.Warnf("i18n: no %s plural forms of %q", l, message)
+	}
+	return fmt.Sprintf(translated, args...)
+}
+
+// pluralForm returns the form of the category, other is the fallback like in CLDR
+func pluralForm(forms map[string]string, category string) string {
+	if form, ok := forms[category]; ok {
+		return form
+	}
+	if form, ok := forms["other"]; ok {
+		return form
+	}
+	return forms["many"]
+}
+
+// pluralCategory returns the CLDR plural category of the integer in the language
+func (l Language) pluralCategory(n int) string {
+	if n < 0 {
+		n = -n
+	}
+	mod10, mod100 := n%10, n%100
+	switch l.orDefault() {
+	case English:
+		if n == 1 {
+			return "one"
+		}
+		return "other"
+	case Polish:
+		switch {
+		case n == 1:
+			return "one"
+		case mod10 >= 2 && mod10 <= 4 && (mod100 < 12 || mod100 > 14):
+			return "few"
+		}
+		return "many"
+	default:
+		switch {
+		case mod10 == 1 && mod100 != 11:
+			return "one"
+		case mod10 >= 2 && mod10 <= 4 && (mod100 < 12 || mod100 > 14):
+			return "few"
+		}
+		return "many"
+	}
+}
+
+// orDefault returns Russian for the empty or unknown language, e.g. of users who registered before languages appeared
+func (l Language) orDefault() Language {
+	if _, ok := names[l]; ok {
+		return l
+	}
+	return Russian
+}
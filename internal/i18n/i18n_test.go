@@ -0,0 +1,203 @@
+package i18n
+
+import (
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+	"unicode"
+
+	"github.com/stretchr/testify/require"
+)
+
+// translatedPackages send messages to users, their Russian strings are the keys of catalogs
+var translatedPackages = []string{"../consumer", "../producer"}
+
+func TestParse(t *testing.T) {
+	testTable := []struct {
+		code     string
+		language Language
+		ok       bool
+	}{
+		{code: "ru", language: Russian, ok: true},
+		{code: "en-US", language: English, ok: true},
+		{code: " PL ", language: Polish, ok: true},
+		{code: "pt-br", ok: false},
+		{code: "", ok: false},
+	}
+
+	for _, testCase := range testTable {
+		language, ok := Parse(testCase.code)
+		require.Equal(t, testCase.ok, ok, testCase.code)
+		require.Equal(t, testCase.language, language, testCase.code)
+	}
+	require.Equal(t, Russian, Detect("de"))
+	require.Equal(t, Polish, Detect("pl"))
+}
+
+func TestLanguage_T(t *testing.T) {
+	require.Equal(t, "Неизвестная команда", Language("").T("Неизвестная команда"))
+	require.Equal(t, "Unknown command", English.T("Неизвестная команда"))
+	require.Equal(t, "Nieznane polecenie", Polish.T("Неизвестная команда"))
+	require.Equal(t, "Token work revoked", English.T("Токен %s отозван", "work"))
+	// the message without a translation stays in Russian
+	require.Equal(t, "Привет, мир", English.T("Привет, мир"))
+}
+
+func TestLanguage_Plural(t *testing.T) {
+	message := "Введите пароль. Максимум %d символов"
+	testTable := []struct {
+		language Language
+		n        int
+		result   string
+	}{
+		{language: Russian, n: 1, result: "Введите пароль. Максимум 1 символ"},
+		{language: Russian, n: 3, result: "Введите пароль. Максимум 3 символа"},
+		{language: Russian, n: 15, result: "Введите пароль. Максимум 15 символов"},
+		{language: Russian, n: 21, result: "Введите пароль. Максимум 21 символ"},
+		{language: English, n: 1, result: "Enter a password. Maximum 1 character"},
+		{language: English, n: 15, result: "Enter a password. Maximum 15 characters"},
+		{language: Polish, n: 1, result: "Wpisz hasło. Maksymalnie 1 znak"},
+		{language: Polish, n: 22, result: "Wpisz hasło. Maksymalnie 22 znaki"},
+		{language: Polish, n: 12, result: "Wpisz hasło. Maksymalnie 12 znaków"},
+	}
+
+	for _, testCase := range testTable {
+		require.Equal(t, testCase.result, testCase.language.Plural(message, testCase.n, testCase.n))
+	}
+}
+
+func TestLanguage_Month(t *testing.T) {
+	require.Equal(t, "Июнь", Russian.Month(time.June))
+	require.Equal(t, "Июня", Russian.MonthOfDate(time.June))
+	require.Equal(t, "June", English.MonthOfDate(time.June))
+	require.Equal(t, "Czerwiec", Polish.Month(time.June))
+	require.Equal(t, "czerwca", Polish.MonthOfDate(time.June))
+}
+
+func TestLanguage_Number(t *testing.T) {
+	testTable := []struct {
+		language Language
+		amount   float64
+		result   string
+	}{
+		{language: Russian, amount: 3.5, result: "3,50"},
+		{language: Russian, amount: 1234.5, result: "1 234,50"},
+		{language: English, amount: 1234567.891, result: "1,234,567.89"},
+		{language: English, amount: -560, result: "-560.00"},
+		{language: English, amount: -0.001, result: "0.00"},
+		{language: Polish, amount: 1234.5, result: "1234,50"},
+		{language: Polish, amount: 12345.5, result: "12 345,50"},
+	}
+
+	for _, testCase := range testTable {
+		require.Equal(t, testCase.result, testCase.language.Number(testCase.amount))
+	}
+}
+
+// TestCatalogs_AreComplete checks that every Russian string of the packages which talk to users is translated
+// with the same verbs, so a new message can't be forgotten in a catalog
+func TestCatalogs_AreComplete(t *testing.T) {
+	messages := make(map[string]bool)
+	for _, dir := range translatedPackages {
+		for message := range russianStrings(t, dir) {
+			messages[message] = true
+		}
+	}
+	require.NotEmpty(t, messages)
+
+	for _, language := range []Language{English, Polish} {
+		c := catalogs[language]
+		for message := range messages {
+			if translated, ok := c.messages[message]; ok {
+				require.Equal(t, verbs(message), verbs(translated), "%s: %q", language, message)
+				continue
+			}
+			forms, ok := c.plurals[message]
+			require.True(t, ok, "%s: no translation of %q", language, message)
+			require.Contains(t, catalogs[Russian].plurals, message)
+			for _, form := range forms {
+				require.Equal(t, verbs(message), verbs(form), "%s: %q", language, message)
+			}
+		}
+		for message := range c.plurals {
+			require.Contains(t, catalogs[Russian].plurals, message, "%s: plural forms of %q", language, message)
+		}
+	}
+}
+
+// russianStrings returns string constants of the non-test files of the package which have cyrillic letters.
+// Concatenated literals are one string like the compiler sees them
+func russianStrings(t *testing.T, dir string) map[string]bool {
+	files, err := filepath.Glob(filepath.Join(dir, "*.go"))
+	require.NoError(t, err)
+	found := make(map[string]bool)
+	fileSet := token.NewFileSet()
+	for _, file := range files {
+		if strings.HasSuffix(file, "_test.go") {
+			continue
+		}
+		parsed, err := parser.ParseFile(fileSet, file, nil, 0)
+		require.NoError(t, err)
+		ast.Inspect(parsed, func(node ast.Node) bool {
+			expr, ok := node.(ast.Expr)
+			if !ok {
+				return true
+			}
+			text, ok := literal(expr)
+			if !ok {
+				return true
+			}
+			if strings.IndexFunc(text, func(r rune) bool { return unicode.Is(unicode.Cyrillic, r) }) >= 0 {
+				found[text] = true
+			}
+			return false
+		})
+	}
+	return found
+}
+
+// literal returns the value of the string literal or of the concatenation of literals
+func literal(expr ast.Expr) (string, bool) {
+	switch e := expr.(type) {
+	case *ast.BasicLit:
+		if e.Kind != token.STRING {
+			return "", false
+		}
+		text, err := strconv.Unquote(e.Value)
+		return text, err == nil
+	case *ast.ParenExpr:
+		return literal(e.X)
+	case *ast.BinaryExpr:
+		if e.Op != token.ADD {
+			return "", false
+		}
+		left, ok := literal(e.X)
+		if !ok {
+			return "", false
+		}
+		right, ok := literal(e.Y)
+		return left + right, ok
+	}
+	return "", false
+}
+
+var verbRegexp = regexp.MustCompile(`%(\[\d+])?[-+# 0]*\d*(\.\d+)?[a-zA-Z%]`)
+
+// verbs returns the sorted verbs of the message without argument indexes, e.g. [%d %s]
+func verbs(message string) []string {
+	found := verbRegexp.FindAllString(message, -1)
+	for i, verb := range found {
+		if strings.HasPrefix(verb, "%[") {
+			found[i] = "%" + verb[strings.Index(verb, "]")+1:]
+		}
+	}
+	sort.Strings(found)
+	return found
+}
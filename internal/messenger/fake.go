@@ -0,0 +1,111 @@
+package messenger
+
+import (
+	"sync"
+	"time"
+)
+
+// fakeBufferSize is how many sent messages the fake keeps until they are read
+const fakeBufferSize = 100
+
+// Fake is an in-memory frontend for tests. Like in telegram, incoming and outgoing messages of a chat share IDs
+type Fake struct {
+	mu      sync.Mutex
+	lastIDs map[int64]int
+	deleted map[int64][]int
+	// languages are languages of clients by users, like telegram sends them
+	languages map[int64]string
+	messages  chan *Message
+	sent      chan *OutgoingMessage
+}
+
+func NewFake() *Fake {
+	return &Fake{
+		lastIDs:   make(map[int64]int),
+		deleted:   make(map[int64][]int),
+		languages: make(map[int64]string),
+		messages:  make(chan *Message),
+		sent:      make(chan *OutgoingMessage, fakeBufferSize),
+	}
+}
+
+func (f *Fake) Send(msg *OutgoingMessage) (int, error) {
+	id := f.nextID(msg.ChatID)
+	f.sent <- msg
+	return id, nil
+}
+
+func (f *Fake) Delete(chatID int64, messageID int) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.deleted[chatID] = append(f.deleted[chatID], messageID)
+	return nil
+}
+
+// Deleted returns IDs of deleted messages of the chat
+func (f *Fake) Deleted(chatID int64) []int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([]int(nil), f.deleted[chatID]...)
+}
+
+// Messages returns the channel of messages written by users
+func (f *Fake) Messages() <-chan *Message {
+	return f.messages
+}
+
+// SetLanguage sets the language of the client of the user, e.g. en, it's in the next messages of the user
+func (f *Fake) SetLanguage(userID int64, language string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.languages[userID] = language
+}
+
+// Write sends the text from the user to the consumer of messages
+func (f *Fake) Write(chatID, userID int64, text string) *Message {
+	msg := &Message{
+		ID:       f.nextID(chatID),
+		ChatID:   chatID,
+		UserID:   userID,
+		Language: f.language(userID),
+		Text:     text,
+	}
+	f.messages <- msg
+	return msg
+}
+
+// WriteLocation sends the location from the user to the consumer of messages
+func (f *Fake) WriteLocation(chatID, userID int64, latitude, longitude float64) *Message {
+	msg := &Message{
+		ID:       f.nextID(chatID),
+		ChatID:   chatID,
+		UserID:   userID,
+		Language: f.language(userID),
+		Location: &Location{Latitude: latitude, Longitude: longitude},
+	}
+	f.messages <- msg
+	return msg
+}
+
+// Read returns the next sent message or nil if nothing is sent during the timeout
+func (f *Fake) Read(timeout time.Duration) *OutgoingMessage {
+	select {
+	case msg := <-f.sent:
+		return msg
+	case <-time.After(timeout):
+		return nil
+	}
+}
+
+func (f *Fake) nextID(chatID int64) int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.lastIDs[chatID]++
+	return f.lastIDs[chatID]
+}
+
+func (f *Fake) language(userID int64) string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.languages[userID]
+}
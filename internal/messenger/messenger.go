@@ -0,0 +1,100 @@
+// Package messenger decouples conversations with users from the frontend they use, e.g. telegram
+package messenger
+
+import "strings"
+
+// Message is an incoming message from a user
+type Message struct {
+	ID       int
+	ChatID   int64
+	UserID   int64
+	Username string // public username of the sender, it may be empty
+	// Language is the IETF code of the language of the client, e.g. en or pt-br, it may be empty
+	Language string
+	Text     string
+	// Location is shared by the user instead of the text, it's nil in other messages
+	Location *Location
+}
+
+// Location is a point on the map
+type Location struct {
+	Latitude  float64
+	Longitude float64
+}
+
+// IsCommand returns true if the message is a command, e.g. /start
+func (m *Message) IsCommand() bool {
+	return strings.HasPrefix(m.Text, "/") && len(m.Text) > 1
+}
+
+// Command returns the command without the slash and the bot name, e.g. subscribe for "/subscribe@finance_bot daily"
+func (m *Message) Command() string {
+	if !m.IsCommand() {
+		return ""
+	}
+	command, _, _ := strings.Cut(m.Text[1:], " ")
+	command, _, _ = strings.Cut(command, "@")
+	return command
+}
+
+// CommandArguments returns the text after the command, e.g. daily for "/subscribe daily"
+func (m *Message) CommandArguments() string {
+	if !m.IsCommand() {
+		return ""
+	}
+	_, args, _ := strings.Cut(m.Text, " ")
+	return args
+}
+
+// OutgoingMessage is a message to a user
+type OutgoingMessage struct {
+	ChatID    int64
+	Text      string
+	ReplyToID int
+	// Keyboard replaces the keyboard of the user, nil keeps the current one
+	Keyboard       *Keyboard
+	RemoveKeyboard bool
+	// Document is sent with the text as a caption
+	Document *Document
+}
+
+// Keyboard is a reply keyboard, each button sends its text
+type Keyboard struct {
+	Rows [][]string
+	// LocationButton is the text of the button in the last row which sends the location of the user, it's optional
+	LocationButton string
+}
+
+// NewKeyboard returns a keyboard with one button in a row
+func NewKeyboard(buttons ...string) *Keyboard {
+	rows := make([][]string, len(buttons))
+	for i, button := range buttons {
+		rows[i] = []string{button}
+	}
+	return &Keyboard{Rows: rows}
+}
+
+type Document struct {
+	Name string
+	Data []byte
+}
+
+// Sender sends messages to users
+type Sender interface {
+	// Send returns the ID of the sent message
+	Send(msg *OutgoingMessage) (int, error)
+}
+
+// Deleter deletes messages of users, e.g. messages with passwords
+type Deleter interface {
+	Delete(chatID int64, messageID int) error
+}
+
+// NewMessage returns a reply to the message
+func NewMessage(replyTo *Message, text string) *OutgoingMessage {
+	return &OutgoingMessage{
+		ChatID:    replyTo.ChatID,
+		Text:      text,
+		ReplyToID: replyTo.ID,
+	}
+}
@@ -0,0 +1,55 @@
+package messenger
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestMessage_Command(t *testing.T) {
+	testTable := []struct {
+		name      string
+		text      string
+		isCommand bool
+		command   string
+		args      string
+	}{
+		{
+			name:      "Command",
+			text:      "/start",
+			isCommand: true,
+			command:   "start",
+		},
+		{
+			name:      "Command with arguments",
+			text:      "/subscribe daily",
+			isCommand: true,
+			command:   "subscribe",
+			args:      "daily",
+		},
+		{
+			name:      "Command with bot name",
+			text:      "/start@finance_bot token",
+			isCommand: true,
+			command:   "start",
+			args:      "token",
+		},
+		{
+			name: "Text",
+			text: "Кофе 3.5",
+		},
+		{
+			name: "Slash",
+			text: "/",
+		},
+	}
+
+	for _, testCase := range testTable {
+		t.Run(testCase.name, func(t *testing.T) {
+			msg := Message{Text: testCase.text}
+			require.Equal(t, testCase.isCommand, msg.IsCommand())
+			require.Equal(t, testCase.command, msg.Command())
+			require.Equal(t, testCase.args, msg.CommandArguments())
+		})
+	}
+}
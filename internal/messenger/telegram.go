@@ -0,0 +1,111 @@
+package messenger
+
+import (
+	"context"
+	"fmt"
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// Telegram is an adapter of a telegram bot
+type Telegram struct {
+	bot *tgbotapi.BotAPI
+}
+
+func NewTelegram(bot *tgbotapi.BotAPI) *Telegram {
+	return &Telegram{
+		bot: bot,
+	}
+}
+
+func (t *Telegram) Send(msg *OutgoingMessage) (int, error) {
+	var chattable tgbotapi.Chattable
+	if msg.Document != nil {
+		document := tgbotapi.NewDocument(msg.ChatID, tgbotapi.FileBytes{Name: msg.Document.Name, Bytes: msg.Document.Data})
+		document.Caption = msg.Text
+		document.ReplyToMessageID = msg.ReplyToID
+		document.AllowSendingWithoutReply = true
+		document.ReplyMarkup = replyMarkup(msg)
+		chattable = document
+	} else {
+		message := tgbotapi.NewMessage(msg.ChatID, msg.Text)
+		message.ReplyToMessageID = msg.ReplyToID
+		// the replied message may be deleted, e.g. a message with a password
+		message.AllowSendingWithoutReply = true
+		message.ReplyMarkup = replyMarkup(msg)
+		chattable = message
+	}
+
+	sent, err := t.bot.Send(chattable)
+	if err != nil {
+		return 0, fmt.Errorf("telegram bot couldn't send message: %v", err)
+	}
+	return sent.MessageID, nil
+}
+
+func (t *Telegram) Delete(chatID int64, messageID int) error {
+	if _, err := t.bot.Request(tgbotapi.NewDeleteMessage(chatID, messageID)); err != nil {
+		return fmt.Errorf("telegram bot couldn't delete message: %v", err)
+	}
+	return nil
+}
+
+// Listen converts telegram updates to messages until the context is done
+func (t *Telegram) Listen(ctx context.Context, updates tgbotapi.UpdatesChannel) <-chan *Message {
+	messages := make(chan *Message)
+	go func() {
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case update := <-updates:
+				if update.Message == nil {
+					continue
+				}
+				select {
+				case messages <- toMessage(update.Message):
+				case <-ctx.Done():
+					return
+				}
+			}
+		}
+	}()
+	return messages
+}
+
+func toMessage(message *tgbotapi.Message) *Message {
+	msg := &Message{
+		ID:     message.MessageID,
+		ChatID: message.Chat.ID,
+		Text:   message.Text,
+	}
+	if message.Location != nil {
+		msg.Location = &Location{Latitude: message.Location.Latitude, Longitude: message.Location.Longitude}
+	}
+	if message.From != nil {
+		msg.UserID = message.From.ID
+		msg.Username = message.From.UserName
+		msg.Language = message.From.LanguageCode
+	}
+	return msg
+}
+
+func replyMarkup(msg *OutgoingMessage) interface{} {
+	if msg.RemoveKeyboard {
+		return tgbotapi.NewRemoveKeyboard(true)
+	}
+	if msg.Keyboard == nil {
+		return nil
+	}
+	rows := make([][]tgbotapi.KeyboardButton, len(msg.Keyboard.Rows), len(msg.Keyboard.Rows)+1)
+	for i, row := range msg.Keyboard.Rows {
+		buttons := make([]tgbotapi.KeyboardButton, len(row))
+		for j, button := range row {
+			buttons[j] = tgbotapi.NewKeyboardButton(button)
+		}
+		rows[i] = buttons
+	}
+	if msg.Keyboard.LocationButton != "" {
+		rows = append(rows, tgbotapi.NewKeyboardButtonRow(tgbotapi.NewKeyboardButtonLocation(msg.Keyboard.LocationButton)))
+	}
+	return tgbotapi.NewReplyKeyboard(rows...)
+}
@@ -0,0 +1,40 @@
+package messenger
+
+import (
+	"testing"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTelegram_ReplyMarkupWithLocationButton(t *testing.T) {
+	keyboard := NewKeyboard("Belarus (GMT+3)")
+	keyboard.LocationButton = "Отправить геопозицию"
+	markup, ok := replyMarkup(&OutgoingMessage{Keyboard: keyboard}).(tgbotapi.ReplyKeyboardMarkup)
+	require.True(t, ok)
+	require.Len(t, markup.Keyboard, 2)
+	require.Equal(t, "Belarus (GMT+3)", markup.Keyboard[0][0].Text)
+	require.False(t, markup.Keyboard[0][0].RequestLocation)
+	require.Equal(t, "Отправить геопозицию", markup.Keyboard[1][0].Text)
+	require.True(t, markup.Keyboard[1][0].RequestLocation)
+}
+
+func TestTelegram_ToMessageWithLocation(t *testing.T) {
+	msg := toMessage(&tgbotapi.Message{
+		MessageID: 3,
+		Chat:      &tgbotapi.Chat{ID: 1},
+		From:      &tgbotapi.User{ID: 2},
+		Location:  &tgbotapi.Location{Latitude: 53.9, Longitude: 27.5667},
+	})
+	require.Equal(t, &Message{ID: 3, ChatID: 1, UserID: 2, Location: &Location{Latitude: 53.9, Longitude: 27.5667}}, msg)
+}
+
+func TestTelegram_ToMessageWithLanguage(t *testing.T) {
+	msg := toMessage(&tgbotapi.Message{
+		MessageID: 3,
+		Chat:      &tgbotapi.Chat{ID: 1},
+		From:      &tgbotapi.User{ID: 2, UserName: "anna", LanguageCode: "pl"},
+		Text:      "Kawa 3.5",
+	})
+	require.Equal(t, &Message{ID: 3, ChatID: 1, UserID: 2, Username: "anna", Language: "pl", Text: "Kawa 3.5"}, msg)
+}
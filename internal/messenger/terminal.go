@@ -0,0 +1,94 @@
+package messenger
+
+import (
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// terminalChatID is the only chat of the terminal, the user of the terminal has the same ID
+const terminalChatID = 1
+
+// Terminal is a frontend for local development, it prints messages of the bot and reads messages of the user
+// from the terminal. Buttons of the last keyboard can be pressed by their numbers
+type Terminal struct {
+	mu       sync.Mutex
+	out      io.Writer
+	lastID   int
+	buttons  []string
+	messages chan *Message
+}
+
+func NewTerminal(out io.Writer) *Terminal {
+	return &Terminal{
+		out:      out,
+		messages: make(chan *Message),
+	}
+}
+
+func (t *Terminal) Send(msg *OutgoingMessage) (int, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.lastID++
+
+	var b strings.Builder
+	b.WriteString("\n")
+	for _, line := range strings.Split(msg.Text, "\n") {
+		b.WriteString("bot> " + line + "\n")
+	}
+	if msg.Document != nil {
+		b.WriteString(fmt.Sprintf("bot> [document %s, %d bytes]\n", msg.Document.Name, len(msg.Document.Data)))
+	}
+	if msg.RemoveKeyboard {
+		t.buttons = nil
+	}
+	// the location button isn't shown, the terminal can't share a location
+	if msg.Keyboard != nil {
+		t.buttons = nil
+		for _, row := range msg.Keyboard.Rows {
+			t.buttons = append(t.buttons, row...)
+		}
+		for i, button := range t.buttons {
+			b.WriteString(fmt.Sprintf("     %d) %s\n", i+1, button))
+		}
+	}
+
+	if _, err := io.WriteString(t.out, b.String()); err != nil {
+		return 0, fmt.Errorf("terminal couldn't write message: %v", err)
+	}
+	return t.lastID, nil
+}
+
+// Delete can't erase the line of the user, it only marks the message as deleted
+func (t *Terminal) Delete(_ int64, messageID int) error {
+	if _, err := fmt.Fprintf(t.out, "     [message %d deleted]\n", messageID); err != nil {
+		return fmt.Errorf("terminal couldn't write message: %v", err)
+	}
+	return nil
+}
+
+// Messages returns the channel of messages written by the user
+func (t *Terminal) Messages() <-chan *Message {
+	return t.messages
+}
+
+// Write sends the line from the user to the consumer of messages. A number of a button presses the button
+func (t *Terminal) Write(line string) *Message {
+	t.mu.Lock()
+	t.lastID++
+	msg := &Message{
+		ID:     t.lastID,
+		ChatID: terminalChatID,
+		UserID: terminalChatID,
+		Text:   line,
+	}
+	if number, err := strconv.Atoi(strings.TrimSpace(line)); err == nil && number >= 1 && number <= len(t.buttons) {
+		msg.Text = t.buttons[number-1]
+	}
+	t.mu.Unlock()
+
+	t.messages <- msg
+	return msg
+}
@@ -0,0 +1,29 @@
+package messenger
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestTerminal_PressButton(t *testing.T) {
+	var out strings.Builder
+	terminal := NewTerminal(&out)
+
+	id, err := terminal.Send(&OutgoingMessage{ChatID: terminalChatID, Text: "Выберете страну", Keyboard: NewKeyboard("Belarus (GMT+3)", "Poland (GMT+2)")})
+	require.NoError(t, err)
+	require.Equal(t, 1, id)
+	require.Equal(t, "\nbot> Выберете страну\n     1) Belarus (GMT+3)\n     2) Poland (GMT+2)\n", out.String())
+
+	go terminal.Write("2")
+	msg := <-terminal.Messages()
+	require.Equal(t, "Poland (GMT+2)", msg.Text)
+	require.Equal(t, 2, msg.ID)
+
+	_, err = terminal.Send(&OutgoingMessage{ChatID: terminalChatID, Text: "Введите пароль", RemoveKeyboard: true})
+	require.NoError(t, err)
+	go terminal.Write("2")
+	msg = <-terminal.Messages()
+	require.Equal(t, "2", msg.Text)
+}
@@ -0,0 +1,63 @@
+package migration
+
+import (
+	"fmt"
+	"io/fs"
+	"regexp"
+	"sort"
+	"strconv"
+	"time"
+)
+
+// fileName is the flyway naming of versioned migrations, e.g. V1__users_table.sql
+var fileName = regexp.MustCompile(`^V(\d+)__(\w+)\.sql$`)
+
+// Status is a migration and the time it was applied, nil if it's pending
+type Status struct {
+	Version     int
+	Description string
+	AppliedAt   *time.Time
+}
+
+type sqlMigration struct {
+	version     int
+	description string
+	script      string
+}
+
+// parseSQL returns migrations of the directory sorted by version. Files which aren't migrations are ignored
+func parseSQL(files fs.FS) ([]*sqlMigration, error) {
+	entries, err := fs.ReadDir(files, ".")
+	if err != nil {
+		return nil, fmt.Errorf("couldn't read migrations: %v", err)
+	}
+	migrations := make([]*sqlMigration, 0, len(entries))
+	versions := make(map[int]string)
+	for _, entry := range entries {
+		matches := fileName.FindStringSubmatch(entry.Name())
+		if entry.IsDir() || matches == nil {
+			continue
+		}
+		version, err := strconv.Atoi(matches[1])
+		if err != nil {
+			return nil, fmt.Errorf("couldn't parse version of %s: %v", entry.Name(), err)
+		}
+		if other, ok := versions[version]; ok {
+			return nil, fmt.Errorf("migrations %s and %s have the same version", other, entry.Name())
+		}
+		versions[version] = entry.Name()
+		script, err := fs.ReadFile(files, entry.Name())
+		if err != nil {
+			return nil, fmt.Errorf("couldn't read migration %s: %v", entry.Name(), err)
+		}
+		migrations = append(migrations, &sqlMigration{
+			version:     version,
+			description: matches[2],
+			script:      string(script),
+		})
+	}
+	sort.Slice(migrations, func(i, j int) bool {
+		return migrations[i].version < migrations[j].version
+	})
+	return migrations, nil
+}
@@ -0,0 +1,47 @@
+package migration
+
+import (
+	"testing"
+	"testing/fstest"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseSQL(t *testing.T) {
+	files := fstest.MapFS{
+		"V10__api_tokens.sql":  {Data: []byte("CREATE TABLE finance.api_tokens ();")},
+		"V2__reports.sql":      {Data: []byte("CREATE TABLE finance.reports ();")},
+		"V1__users_table.sql":  {Data: []byte("CREATE SCHEMA finance;")},
+		"migrations.go":        {Data: []byte("package migrations")},
+		"README.md":            {Data: []byte("# migrations")},
+		"U1__users_table.sql":  {Data: []byte("DROP SCHEMA finance;")},
+		"V3_without_dash.sql":  {Data: []byte("SELECT 1;")},
+		"V4__wrong-name.sql":   {Data: []byte("SELECT 1;")},
+		"nested/V5__table.sql": {Data: []byte("SELECT 1;")},
+	}
+
+	migrations, err := parseSQL(files)
+	require.NoError(t, err)
+	require.Equal(t, []*sqlMigration{
+		{version: 1, description: "users_table", script: "CREATE SCHEMA finance;"},
+		{version: 2, description: "reports", script: "CREATE TABLE finance.reports ();"},
+		{version: 10, description: "api_tokens", script: "CREATE TABLE finance.api_tokens ();"},
+	}, migrations)
+}
+
+func TestParseSQL_SameVersion(t *testing.T) {
+	files := fstest.MapFS{
+		"V1__users_table.sql": {Data: []byte("CREATE SCHEMA finance;")},
+		"V01__users.sql":      {Data: []byte("CREATE SCHEMA finance;")},
+	}
+
+	_, err := parseSQL(files)
+	require.Error(t, err)
+}
+
+func TestNewMongo_SortsMigrations(t *testing.T) {
+	m := NewMongo(nil, []*MongoMigration{{Version: 3}, {Version: 1}, {Version: 2}})
+	for i, migration := range m.migrations {
+		require.Equal(t, i+1, migration.Version)
+	}
+}
@@ -0,0 +1,110 @@
+package migration
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+const (
+	mongoDatabase   = "finance"
+	mongoCollection = "migrations"
+)
+
+// MongoMigration changes data of mongo, e.g. creates indexes or reshapes documents.
+// Instances started together may run it twice, so it must be idempotent
+type MongoMigration struct {
+	Version     int
+	Description string
+	Up          func(ctx context.Context, cli *mongo.Client) error
+}
+
+type mongoVersion struct {
+	Version     int       `bson:"_id"`
+	Description string    `bson:"description"`
+	AppliedAt   time.Time `bson:"applied_at"`
+}
+
+// Mongo applies data migrations and keeps applied versions in the collection finance.migrations
+type Mongo struct {
+	cli        *mongo.Client
+	migrations []*MongoMigration
+}
+
+func NewMongo(cli *mongo.Client, migrations []*MongoMigration) *Mongo {
+	sorted := make([]*MongoMigration, len(migrations))
+	copy(sorted, migrations)
+	sort.Slice(sorted, func(i, j int) bool {
+		return sorted[i].Version < sorted[j].Version
+	})
+	return &Mongo{
+		cli:        cli,
+		migrations: sorted,
+	}
+}
+
+// Migrate applies pending migrations in order and returns their versions
+func (m *Mongo) Migrate(ctx context.Context) ([]int, error) {
+	versions, err := m.applied(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	applied := make([]int, 0)
+	for _, migration := range m.migrations {
+		if _, ok := versions[migration.Version]; ok {
+			continue
+		}
+		if err = migration.Up(ctx, m.cli); err != nil {
+			return applied, fmt.Errorf("mongo migration %d %s error: %v", migration.Version, migration.Description, err)
+		}
+		_, err = m.cli.Database(mongoDatabase).Collection(mongoCollection).InsertOne(ctx, mongoVersion{
+			Version:     migration.Version,
+			Description: migration.Description,
+			AppliedAt:   time.Now().UTC(),
+		})
+		if err != nil && !mongo.IsDuplicateKeyError(err) {
+			return applied, fmt.Errorf("mongo couldn't InsertOne in Migrate method: %v", err)
+		}
+		logrus.Infof("mongo migration %d %s is applied", migration.Version, migration.Description)
+		applied = append(applied, migration.Version)
+	}
+	return applied, nil
+}
+
+// Status returns all migrations, pending ones have no time
+func (m *Mongo) Status(ctx context.Context) ([]*Status, error) {
+	versions, err := m.applied(ctx)
+	if err != nil {
+		return nil, err
+	}
+	statuses := make([]*Status, len(m.migrations))
+	for i, migration := range m.migrations {
+		statuses[i] = &Status{Version: migration.Version, Description: migration.Description}
+		if version, ok := versions[migration.Version]; ok {
+			statuses[i].AppliedAt = &version.AppliedAt
+		}
+	}
+	return statuses, nil
+}
+
+func (m *Mongo) applied(ctx context.Context) (map[int]*mongoVersion, error) {
+	cursor, err := m.cli.Database(mongoDatabase).Collection(mongoCollection).Find(ctx, bson.D{})
+	if err != nil {
+		return nil, fmt.Errorf("mongo couldn't Find in applied method: %v", err)
+	}
+	var documents []*mongoVersion
+	if err = cursor.All(ctx, &documents); err != nil {
+		return nil, fmt.Errorf("mongo couldn't decode versions in applied method: %v", err)
+	}
+	versions := make(map[int]*mongoVersion, len(documents))
+	for _, document := range documents {
+		versions[document.Version] = document
+	}
+	return versions, nil
+}
@@ -0,0 +1,216 @@
+package migration
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io/fs"
+	"time"
+
+	"github.com/jackc/pgx/v4"
+	"github.com/jackc/pgx/v4/pgxpool"
+	"github.com/sirupsen/logrus"
+)
+
+// lockKey is the key of the advisory lock, so instances started together don't apply migrations twice
+const lockKey int64 = 20230628
+
+// Postgres applies sql migrations and keeps applied versions in the table public.finance_migrations.
+// Versions applied by flyway are imported from flyway_schema_history when the table is created
+type Postgres struct {
+	conn  *pgxpool.Pool
+	files fs.FS
+}
+
+func NewPostgres(conn *pgxpool.Pool, files fs.FS) *Postgres {
+	return &Postgres{
+		conn:  conn,
+		files: files,
+	}
+}
+
+// Migrate applies pending migrations in order, each one in a transaction, and returns their versions.
+// It fails if an applied migration has been changed
+func (p *Postgres) Migrate(ctx context.Context) ([]int, error) {
+	migrations, err := parseSQL(p.files)
+	if err != nil {
+		return nil, err
+	}
+
+	conn, err := p.conn.Acquire(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("migration.Postgres, acquire connection error: %v", err)
+	}
+	defer conn.Release()
+	if _, err = conn.Exec(ctx, `SELECT pg_advisory_lock($1)`, lockKey); err != nil {
+		return nil, fmt.Errorf("migration.Postgres, lock error: %v", err)
+	}
+	defer func() {
+		if _, err := conn.Exec(context.Background(), `SELECT pg_advisory_unlock($1)`, lockKey); err != nil {
+			logrus.Errorf("migration.Postgres, unlock error: %v", err)
+		}
+	}()
+
+	if err = p.prepare(ctx, conn); err != nil {
+		return nil, err
+	}
+	checksums, err := p.applied(ctx, conn)
+	if err != nil {
+		return nil, err
+	}
+
+	applied := make([]int, 0)
+	for _, migration := range migrations {
+		checksum, ok := checksums[migration.version]
+		if ok {
+			// versions imported from flyway have no checksum
+			if checksum != "" && checksum != checksumOf(migration.script) {
+				return applied, fmt.Errorf("migration V%d__%s has been changed after it was applied", migration.version, migration.description)
+			}
+			continue
+		}
+		if err = p.apply(ctx, conn, migration); err != nil {
+			return applied, err
+		}
+		logrus.Infof("migration V%d__%s is applied", migration.version, migration.description)
+		applied = append(applied, migration.version)
+	}
+	return applied, nil
+}
+
+// Status returns all migrations, pending ones have no time
+func (p *Postgres) Status(ctx context.Context) ([]*Status, error) {
+	migrations, err := parseSQL(p.files)
+	if err != nil {
+		return nil, err
+	}
+	appliedAt := make(map[int]time.Time)
+	var exists bool
+	if err = p.conn.QueryRow(ctx, `SELECT to_regclass('public.finance_migrations') IS NOT NULL`).Scan(&exists); err != nil {
+		return nil, fmt.Errorf("migration.Postgres, check table error: %v", err)
+	}
+	if exists {
+		rows, err := p.conn.Query(ctx, `SELECT version, applied_at FROM public.finance_migrations`)
+		if err != nil {
+			return nil, fmt.Errorf("migration.Postgres, get applied error: %v", err)
+		}
+		defer rows.Close()
+		for rows.Next() {
+			var (
+				version int
+				at      time.Time
+			)
+			if err = rows.Scan(&version, &at); err != nil {
+				return nil, fmt.Errorf("migration.Postgres, scan applied error: %v", err)
+			}
+			appliedAt[version] = at
+		}
+		if err = rows.Err(); err != nil {
+			return nil, fmt.Errorf("migration.Postgres, rows error: %v", err)
+		}
+	}
+
+	statuses := make([]*Status, len(migrations))
+	for i, migration := range migrations {
+		statuses[i] = &Status{Version: migration.version, Description: migration.description}
+		if at, ok := appliedAt[migration.version]; ok {
+			statuses[i].AppliedAt = &at
+		}
+	}
+	return statuses, nil
+}
+
+// prepare creates the table of applied versions and imports the history of flyway into it
+func (p *Postgres) prepare(ctx context.Context, conn *pgxpool.Conn) error {
+	var exists bool
+	if err := conn.QueryRow(ctx, `SELECT to_regclass('public.finance_migrations') IS NOT NULL`).Scan(&exists); err != nil {
+		return fmt.Errorf("migration.Postgres, check table error: %v", err)
+	}
+	if exists {
+		return nil
+	}
+
+	query := `CREATE TABLE public.finance_migrations
+		(
+			version     int PRIMARY KEY,
+			description text        NOT NULL,
+			checksum    char(64),
+			applied_at  timestamptz NOT NULL DEFAULT now()
+		)`
+	if _, err := conn.Exec(ctx, query); err != nil {
+		return fmt.Errorf("migration.Postgres, create table error: %v", err)
+	}
+
+	var flyway bool
+	if err := conn.QueryRow(ctx, `SELECT to_regclass('public.flyway_schema_history') IS NOT NULL`).Scan(&flyway); err != nil {
+		return fmt.Errorf("migration.Postgres, check flyway table error: %v", err)
+	}
+	if !flyway {
+		return nil
+	}
+	query = `INSERT INTO public.finance_migrations (version, description, applied_at)
+		SELECT version::int, replace(description, ' ', '_'), installed_on FROM public.flyway_schema_history
+		WHERE success AND version IS NOT NULL`
+	commandTag, err := conn.Exec(ctx, query)
+	if err != nil {
+		return fmt.Errorf("migration.Postgres, import flyway history error: %v", err)
+	}
+	logrus.Infof("%d migrations applied by flyway are imported", commandTag.RowsAffected())
+	return nil
+}
+
+// applied returns checksums of applied versions
+func (p *Postgres) applied(ctx context.Context, conn *pgxpool.Conn) (map[int]string, error) {
+	rows, err := conn.Query(ctx, `SELECT version, coalesce(checksum, '') FROM public.finance_migrations`)
+	if err != nil {
+		return nil, fmt.Errorf("migration.Postgres, get applied error: %v", err)
+	}
+	defer rows.Close()
+
+	checksums := make(map[int]string)
+	for rows.Next() {
+		var (
+			version  int
+			checksum string
+		)
+		if err = rows.Scan(&version, &checksum); err != nil {
+			return nil, fmt.Errorf("migration.Postgres, scan applied error: %v", err)
+		}
+		checksums[version] = checksum
+	}
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("migration.Postgres, rows error: %v", err)
+	}
+	return checksums, nil
+}
+
+func (p *Postgres) apply(ctx context.Context, conn *pgxpool.Conn, migration *sqlMigration) error {
+	tx, err := conn.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("migration.Postgres, begin transaction error: %v", err)
+	}
+	defer func() {
+		if err = tx.Rollback(ctx); err != nil && err != pgx.ErrTxClosed {
+			logrus.Errorf("migration.Postgres, rollback error: %v", err)
+		}
+	}()
+
+	// without arguments the script is sent in the simple protocol, so it may have several statements
+	if _, err = tx.Exec(ctx, migration.script); err != nil {
+		return fmt.Errorf("migration V%d__%s error: %v", migration.version, migration.description, err)
+	}
+	query := `INSERT INTO public.finance_migrations (version, description, checksum) VALUES ($1, $2, $3)`
+	if _, err = tx.Exec(ctx, query, migration.version, migration.description, checksumOf(migration.script)); err != nil {
+		return fmt.Errorf("migration.Postgres, save version error: %v", err)
+	}
+	if err = tx.Commit(ctx); err != nil {
+		return fmt.Errorf("migration.Postgres, commit error: %v", err)
+	}
+	return nil
+}
+
+func checksumOf(script string) string {
+	sum := sha256.Sum256([]byte(script))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,17 @@
+package model
+
+import "time"
+
+const (
+	ReadScope  = "read"
+	WriteScope = "write"
+)
+
+// APIToken is a personal token for the http api, only its hash is stored
+type APIToken struct {
+	Username   string
+	Name       string
+	Scope      string
+	CreatedAt  time.Time
+	LastUsedAt *time.Time
+}
@@ -4,9 +4,12 @@ import "time"
 
 // Entry is one record of expenses or income
 type Entry struct {
-	Kind     string    `bson:"kind"` // expense or income
-	User     string    `bson:"user"`
+	ID       string    `bson:"-"`
+	Kind     string    `bson:"kind"`   // expense or income
+	User     string    `bson:"user"`   // the username or the key of the ledger
+	Member   string    `bson:"member"` // who made the entry of a ledger, entries of users have no member
 	Date     time.Time `bson:"date"`
+	MonthKey string    `bson:"month_key"` // the financial month the amount is added to, ledgers and old entries have none
 	Category *Category
 }
 
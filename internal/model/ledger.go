@@ -0,0 +1,46 @@
+package model
+
+import (
+	"fmt"
+	"time"
+)
+
+const (
+	OwnerRole  = "owner"
+	EditorRole = "editor"
+	ViewerRole = "viewer"
+)
+
+// Ledger is a budget shared by several users. Its entries are kept under the key of the ledger instead of a username
+type Ledger struct {
+	ID        int64
+	Name      string
+	Owner     string
+	CreatedAt time.Time
+}
+
+// LedgerMember is a user of the ledger: the owner invites and removes members, editors add entries,
+// viewers only read reports
+type LedgerMember struct {
+	LedgerID int64
+	Username string
+	Role     string
+	JoinedAt time.Time
+}
+
+// Membership is a ledger with the role of the user in it
+type Membership struct {
+	Ledger *Ledger
+	Role   string
+}
+
+// LedgerKey is stored instead of a username in entries of the ledger, finance.users forbids colons in usernames,
+// so they don't collide
+func LedgerKey(id int64) string {
+	return fmt.Sprintf("ledger:%d", id)
+}
+
+// CanEdit returns true if the role allows adding entries
+func (m *Membership) CanEdit() bool {
+	return m.Role == OwnerRole || m.Role == EditorRole
+}
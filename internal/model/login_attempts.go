@@ -0,0 +1,11 @@
+package model
+
+import "time"
+
+// LoginAttempts are failed logins of a username or in a chat
+type LoginAttempts struct {
+	Key           string
+	Failures      int
+	LastFailureAt time.Time
+	LockedUntil   *time.Time
+}
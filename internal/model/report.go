@@ -0,0 +1,27 @@
+package model
+
+import "time"
+
+const (
+	ReportPending   = "pending"
+	ReportDelivered = "delivered"
+	ReportDead      = "dead"
+	// ReportSkipped is never sent, e.g. the user unsubscribed before it was due
+	ReportSkipped = "skipped"
+)
+
+// Report is a generated report which is stored in the outbox until the user receives it
+type Report struct {
+	ID            int64
+	Username      string
+	Period        string // day or month
+	PeriodKey     string // the day or the month the report is about, e.g. 2023-06-28 or 2023-06
+	Text          string
+	Status        string // pending, delivered, dead or skipped
+	Attempts      int
+	LastError     string
+	LastAttemptAt *time.Time
+	NextAttemptAt time.Time
+	CreatedAt     time.Time
+	DeliveredAt   *time.Time
+}
@@ -0,0 +1,13 @@
+package model
+
+import "time"
+
+// Session binds a chat to the account, several chats may use the same account
+type Session struct {
+	ChatID     int64
+	Username   string
+	CreatedAt  time.Time
+	LastSeenAt time.Time
+	// Timezone of the user, it's only set for sessions restored on startup
+	Timezone string
+}
@@ -0,0 +1,8 @@
+package model
+
+// Subscription is a chat where the user receives reports of the period
+type Subscription struct {
+	Username string
+	Period   string // day or month
+	ChatID   int64
+}
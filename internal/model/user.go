@@ -6,5 +6,26 @@ type User struct {
 	Username string
 	Password string
 	Country  string
-	Timezone time.Duration
+	// Timezone is the IANA name of the timezone, e.g. Europe/Warsaw
+	Timezone string
+	// ChatID is the chat where the user registered or logged in the last time, 0 if it's unknown
+	ChatID int64
+	// TGUserID is the telegram user the account is linked to, 0 if it isn't linked.
+	// Accounts created by telegram have no password
+	TGUserID   int64
+	ReportTime ReportTime
+	// MonthStart is the day from 1 to 28 when the financial month of the user begins, e.g. 10 for the payday.
+	// 0 is the calendar month like 1
+	MonthStart int
+	// Language is the code of the language of messages and reports, e.g. en. The empty one is Russian
+	Language string
+}
+
+// ReportTime is when reports are delivered by the local clock of the user. Periods are closed at the local midnight anyway,
+// the report waits until its time. The zero value delivers reports right at the midnight
+type ReportTime struct {
+	// Daily is the time after the day ends, e.g. 8h for 08:00 of the next day
+	Daily time.Duration
+	// Monthly is the day and the time after the month ends, e.g. 33h for 09:00 of the 2nd day of the next month
+	Monthly time.Duration
 }
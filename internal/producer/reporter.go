@@ -2,58 +2,64 @@ package producer
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"github.com/chucky-1/finance/internal/i18n"
+	"github.com/chucky-1/finance/internal/messenger"
+	"github.com/chucky-1/finance/internal/model"
+	"github.com/chucky-1/finance/internal/repository"
 	"github.com/chucky-1/finance/internal/service"
-	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
 	"github.com/sirupsen/logrus"
 	"sort"
 	"strings"
-	"sync"
 	"time"
 )
 
 const (
-	monthPeriod = "month"
-	dayPeriod   = "day"
+	monthPeriod = service.MonthlyReport
+	dayPeriod   = service.DailyReport
+	dailyKey    = "2006-01-02"
 )
 
-type TGUser struct {
-	TGUsername string
-	Username   string
-}
+const (
+	// deliveryInterval is how often the outbox is checked for reports to deliver
+	deliveryInterval = 10 * time.Second
+	// maxWait limits the sleep until the next boundary, so a change of the system clock is noticed
+	maxWait = time.Hour
+	// maxCatchUp limits how far back missed boundaries are replayed
+	maxCatchUp = 31 * 24 * time.Hour
+)
 
+var notSubscribedErr = errors.New("user didn't subscribe on reports")
+
+var invalidTokenMessage = "Ссылка для подписки недействительна или уже использована. " +
+	"Отправьте команду /subscribe daily или /subscribe monthly в основной чат, что бы получить новую ссылку"
+
+// Reporter sends reports. In the single bot mode both reporter bots are the main bot
+// and users subscribe via commands in the main chat, so there are no subscription channels
 type Reporter struct {
-	dailyReporterBot    *tgbotapi.BotAPI
-	dailySubscription   tgbotapi.UpdatesChannel
-	monthlyReporterBot  *tgbotapi.BotAPI
-	monthlySubscription tgbotapi.UpdatesChannel
-
-	reporter *service.Reporter
-
-	// receiving from hub consumer
-	// key: tgUserName, value: username
-	tgUsersChan              <-chan TGUser
-	expectedUsersToSubscribe map[string]string
-
-	// key: username, value: chatID
-	dailyChatsByUserMu   sync.RWMutex
-	dailyChatsByUser     map[string]int64
-	monthlyChatsByUserMu sync.RWMutex
-	monthlyChatsByUser   map[string]int64
+	dailyReporterBot    messenger.Sender
+	dailySubscription   <-chan *messenger.Message
+	monthlyReporterBot  messenger.Sender
+	monthlySubscription <-chan *messenger.Message
+
+	reporter      *service.Reporter
+	outbox        *service.Outbox
+	subscriptions *service.Subscription
+	// scheduled is true when boundaries of users are planned after the last processed one
+	scheduled bool
 }
 
-func NewReporter(dailyReporterBot, monthlyReporterBot *tgbotapi.BotAPI, dailySubscription, monthlySubscription tgbotapi.UpdatesChannel,
-	reporter *service.Reporter, tgUsersChan chan TGUser) *Reporter {
+func NewReporter(dailyReporterBot, monthlyReporterBot messenger.Sender, dailySubscription, monthlySubscription <-chan *messenger.Message,
+	reporter *service.Reporter, outbox *service.Outbox, subscriptions *service.Subscription) *Reporter {
 	return &Reporter{
-		dailyReporterBot:         dailyReporterBot,
-		dailySubscription:        dailySubscription,
-		monthlyReporterBot:       monthlyReporterBot,
-		monthlySubscription:      monthlySubscription,
-		reporter:                 reporter,
-		tgUsersChan:              tgUsersChan,
-		expectedUsersToSubscribe: make(map[string]string),
-		dailyChatsByUser:         make(map[string]int64),
-		monthlyChatsByUser:       make(map[string]int64),
+		dailyReporterBot:    dailyReporterBot,
+		dailySubscription:   dailySubscription,
+		monthlyReporterBot:  monthlyReporterBot,
+		monthlySubscription: monthlySubscription,
+		reporter:            reporter,
+		outbox:              outbox,
+		subscriptions:       subscriptions,
 	}
 }
 
@@ -61,6 +67,7 @@ func (r *Reporter) Produce(ctx context.Context) {
 	logrus.Info("reporter producer started produce")
 	go r.waitSubscribers(ctx)
 	go r.waitTimeToSendReports(ctx)
+	go r.deliverReports(ctx)
 }
 
 func (r *Reporter) waitSubscribers(ctx context.Context) {
@@ -70,53 +77,123 @@ func (r *Reporter) waitSubscribers(ctx context.Context) {
 		case <-ctx.Done():
 			logrus.Infof("reporter producer stopped wait subscribers: %v", ctx.Err())
 			return
-		case tgUser := <-r.tgUsersChan:
-			logrus.Debugf("reporter producer received message to wait for the user's subscriptions: %v", tgUser)
-			r.expectedUsersToSubscribe[tgUser.TGUsername] = tgUser.Username
-		case update := <-r.dailySubscription:
-			logrus.Debugf("reporter producer received message in dailySubscription from %s", update.SentFrom().UserName)
-			username, ok := r.expectedUsersToSubscribe[update.SentFrom().UserName]
-			if !ok {
-				logrus.Infof("reporter producer received message in dailySubscription from unknown user: %s", update.SentFrom().UserName)
-				continue
-			}
-			r.dailyChatsByUserMu.Lock()
-			r.dailyChatsByUser[username] = update.Message.Chat.ID
-			r.dailyChatsByUserMu.Unlock()
-			logrus.Debugf("%s subscribed to daily reports", username)
-		case update := <-r.monthlySubscription:
-			logrus.Debugf("reporter producer received message in monthlyUpdatesChan from %s", update.SentFrom().UserName)
-			username, ok := r.expectedUsersToSubscribe[update.SentFrom().UserName]
-			if !ok {
-				logrus.Infof("reporter producer received message in monthlyUpdatesChan from unknown user: %s", update.SentFrom().UserName)
-				continue
-			}
-			r.monthlyChatsByUserMu.Lock()
-			r.monthlyChatsByUser[username] = update.Message.Chat.ID
-			r.monthlyChatsByUserMu.Unlock()
-			logrus.Debugf("%s subscribed to monthly reports", username)
+		case message := <-r.dailySubscription:
+			r.subscribe(ctx, message, dayPeriod)
+		case message := <-r.monthlySubscription:
+			r.subscribe(ctx, message, monthPeriod)
 		}
 	}
 }
 
-func (r *Reporter) waitTimeToSendReports(ctx context.Context) {
-	logrus.Info("reporter producer started wait time to send reports")
-	t := tickerFromBeginningOrMiddleOfHour(ctx)
-	defer t.Stop()
-	timeUTC := time.Now().UTC()
-	logrus.Infof("reporter produce created ticker from beginning of hour: %v", timeUTC)
+// subscribe binds the chat to the user by the token from the deep link, the bot receives it as "/start <token>"
+func (r *Reporter) subscribe(ctx context.Context, message *messenger.Message, period string) {
+	if message.Command() != "start" {
+		return
+	}
+	bot := r.bot(period)
+	logrus.Debugf("reporter producer received start in %s subscription from chat %d", period, message.ChatID)
 
-	go r.sendAllReports(ctx, timeUTC)
+	newCtx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+	username, err := r.subscriptions.Redeem(newCtx, message.CommandArguments(), period, message.ChatID)
+	if err == service.InvalidTokenErr {
+		logrus.Infof("reporter producer received invalid token in %s subscription from chat %d", period, message.ChatID)
+		text := i18n.Detect(message.Language).T(invalidTokenMessage)
+		if _, err = bot.Send(messenger.NewMessage(message, text)); err != nil {
+			logrus.Errorf("reporter producer couldn't send message: %v", err)
+		}
+		return
+	}
+	if err != nil {
+		logrus.Errorf("reporter producer couldn't subscribe chat %d on %s reports: %v", message.ChatID, period, err)
+		return
+	}
+	logrus.Debugf("%s subscribed to %s reports", username, period)
+	text := r.reporter.Language(username).T("%s, вы подписались на отчёты!", username)
+	if _, err = bot.Send(messenger.NewMessage(message, text)); err != nil {
+		logrus.Errorf("reporter producer couldn't send message: %v", err)
+	}
+}
 
+// Tick sends reports which are due by the time and delivers them. It lets a simulated clock drive the producer
+// instead of Produce, e.g. in the terminal chat
+func (r *Reporter) Tick(ctx context.Context, timeUTC time.Time) {
+	r.processBoundaries(ctx, timeUTC)
+	if err := r.deliverDueReports(ctx, timeUTC); err != nil {
+		logrus.Error(err)
+	}
+}
+
+// waitTimeToSendReports sleeps until the next boundary of a user, so reports are sent at the local midnight of any timezone.
+// The sleep is interrupted when a user is added or moved, their boundary may be earlier
+func (r *Reporter) waitTimeToSendReports(ctx context.Context) {
+	logrus.Info("reporter producer started wait time to send reports")
 	for {
+		r.processBoundaries(ctx, time.Now().UTC())
+
+		timer := time.NewTimer(waitDuration(r.reporter.NextBoundary()))
 		select {
 		case <-ctx.Done():
+			timer.Stop()
 			logrus.Infof("reporter producer stopped wait time to send reports: %v", ctx.Err())
 			return
-		case <-t.C:
-			timeUTC = time.Now().UTC()
-			logrus.Infof("reporter producer: ticker triggered in: %v", timeUTC)
-			r.sendAllReports(ctx, timeUTC)
+		case <-timer.C:
+		case <-r.reporter.Rescheduled():
+			timer.Stop()
+		}
+	}
+}
+
+// waitDuration returns how long to sleep until the next boundary, but not longer than maxWait
+func waitDuration(next time.Time, ok bool) time.Duration {
+	if !ok {
+		return maxWait
+	}
+	wait := time.Until(next)
+	if wait < 0 {
+		return 0
+	}
+	if wait > maxWait {
+		return maxWait
+	}
+	return wait
+}
+
+// processBoundaries sends reports for every boundary after the last processed one up to now,
+// so reports which should have been sent while the service was down are sent too
+func (r *Reporter) processBoundaries(ctx context.Context, timeUTC time.Time) {
+	if !r.scheduled {
+		lastTick, err := r.reporter.LastTick(ctx)
+		if err != nil {
+			logrus.Errorf("reporter producer couldn't get last tick: %v", err)
+			return
+		}
+		if lastTick.IsZero() {
+			// the very first start, there is nothing to catch up
+			lastTick = timeUTC
+			if err = r.reporter.SetLastTick(ctx, lastTick); err != nil {
+				logrus.Errorf("reporter producer couldn't set last tick: %v", err)
+				return
+			}
+		}
+		if oldest := timeUTC.Add(-maxCatchUp); lastTick.Before(oldest) {
+			lastTick = oldest
+		}
+		r.reporter.Schedule(lastTick)
+		r.scheduled = true
+		logrus.Infof("reporter producer scheduled reports after %v", lastTick)
+	}
+
+	for {
+		next, ok := r.reporter.NextBoundary()
+		if !ok || next.After(timeUTC) {
+			return
+		}
+		logrus.Debugf("reporter producer: boundary %v", next)
+		r.sendAllReports(ctx, next)
+		if err := r.reporter.SetLastTick(ctx, next); err != nil {
+			logrus.Errorf("reporter producer couldn't set last tick: %v", err)
+			return
 		}
 	}
 }
@@ -130,9 +207,11 @@ func (r *Reporter) sendAllReports(ctx context.Context, timeUTC time.Time) {
 	}
 }
 
+// sendReports puts the reports into the outbox. Each report is put at most once, so daily expenses
+// are deleted only after their report is in the outbox or has already been issued
 func (r *Reporter) sendReports(ctx context.Context, timeUTC time.Time, period string) error {
 	var (
-		reports map[string]map[string]float64
+		reports []*service.UserReport
 		err     error
 	)
 	switch period {
@@ -145,78 +224,144 @@ func (r *Reporter) sendReports(ctx context.Context, timeUTC time.Time, period st
 			return fmt.Errorf("reporter producer couldn't get monthly report: %v", err)
 		}
 	}
-	tgReports := convertToTGReports(reports, timeUTC, period)
-	for user, report := range tgReports {
-		if err = r.sendReport(user, report, period); err != nil {
-			logrus.Error(err)
+
+	issued := make([]string, 0, len(reports))
+	for _, report := range reports {
+		text := ReportText(report.PeriodKey, period, report.MonthStart, report.Language, report.Categories)
+		err = r.outbox.Enqueue(ctx, report.Username, period, report.PeriodKey, text, report.DeliverAt)
+		if err == repository.ReportUserNotFoundErr {
+			logrus.Infof("reporter producer: %s has been deleted, reports of the user aren't scheduled anymore", report.Username)
+			r.reporter.RemoveUser(report.Username)
+			continue
+		}
+		if err == repository.ReportAlreadyIssuedErr {
+			logrus.Debugf("reporter producer: %s report %s for %s has already been issued", period, report.PeriodKey, report.Username)
+		} else if err != nil {
+			logrus.Errorf("reporter producer couldn't enqueue %s report for %s: %v", period, report.Username, err)
+			continue
+		}
+		issued = append(issued, report.Username)
+	}
+
+	if period == dayPeriod {
+		if err = r.reporter.CleanDailyReports(ctx, issued); err != nil {
+			return fmt.Errorf("reporter producer couldn't clean daily reports: %v", err)
 		}
 	}
 	return nil
 }
 
-func (r *Reporter) sendReport(user, report, period string) error {
-	var (
-		chatID int64
-		ok     bool
-	)
-	switch period {
-	case dayPeriod:
-		r.dailyChatsByUserMu.RLock()
-		chatID, ok = r.dailyChatsByUser[user]
-		r.dailyChatsByUserMu.RUnlock()
-		if !ok {
-			logrus.Debugf("couldn't send a report because don't have a chat with user, user didn't subscribe on daily reports: %s", user)
-			return nil
+// deliverReports periodically sends reports from the outbox.
+// A report is marked as delivered only after telegram accepted it, otherwise it's retried later
+func (r *Reporter) deliverReports(ctx context.Context) {
+	logrus.Info("reporter producer started deliver reports")
+	t := time.NewTicker(deliveryInterval)
+	defer t.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			logrus.Infof("reporter producer stopped deliver reports: %v", ctx.Err())
+			return
+		case <-t.C:
+			if err := r.deliverDueReports(ctx, time.Now().UTC()); err != nil {
+				logrus.Error(err)
+			}
 		}
-	case monthPeriod:
-		r.monthlyChatsByUserMu.RLock()
-		chatID, ok = r.monthlyChatsByUser[user]
-		r.monthlyChatsByUserMu.RUnlock()
-		if !ok {
-			logrus.Debugf("couldn't send a report because don't have a chat with user, user didn't subscribe on monthly reports: %s", user)
-			return nil
+	}
+}
+
+func (r *Reporter) deliverDueReports(ctx context.Context, now time.Time) error {
+	reports, err := r.outbox.Due(ctx, now)
+	if err != nil {
+		return fmt.Errorf("reporter producer couldn't get due reports: %v", err)
+	}
+	for _, report := range reports {
+		r.deliverReport(ctx, report, now)
+	}
+	return nil
+}
+
+// deliverReport skips reports of users who unsubscribed, they are neither delivered nor retried
+func (r *Reporter) deliverReport(ctx context.Context, report *model.Report, now time.Time) {
+	err := r.sendReport(ctx, report.Username, report.Text, report.Period)
+	switch {
+	case err == notSubscribedErr:
+		logrus.Debugf("reporter producer skipped report %d: %v", report.ID, err)
+		if err = r.outbox.Skipped(ctx, report, err); err != nil {
+			logrus.Errorf("reporter producer couldn't mark report %d as skipped: %v", report.ID, err)
 		}
+		return
+	case err != nil:
+		logrus.Debugf("reporter producer couldn't deliver report %d, attempt %d: %v", report.ID, report.Attempts+1, err)
+		if err = r.outbox.Failed(ctx, report, err, now); err != nil {
+			logrus.Errorf("reporter producer couldn't mark report %d as failed: %v", report.ID, err)
+		}
+		return
+	}
+	if err = r.outbox.Delivered(ctx, report, now); err != nil {
+		logrus.Errorf("reporter producer couldn't mark report %d as delivered: %v", report.ID, err)
+	}
+}
+
+func (r *Reporter) sendReport(ctx context.Context, user, report, period string) error {
+	chatID, ok, err := r.subscriptions.ChatID(ctx, user, period)
+	if err != nil {
+		return fmt.Errorf("reporter producer couldn't get subscription: %v", err)
+	}
+	if !ok {
+		return notSubscribedErr
 	}
 
-	message := tgbotapi.NewMessage(chatID, report)
-	_, err := r.dailyReporterBot.Send(message)
+	_, err = r.bot(period).Send(&messenger.OutgoingMessage{ChatID: chatID, Text: report})
 	if err != nil {
 		return fmt.Errorf("reporter producer couldn't send report: %v", err)
 	}
 	return nil
 }
 
-func tickerFromBeginningOrMiddleOfHour(ctx context.Context) *time.Ticker {
-	timer := time.NewTimer(durationBeforeCreateTicker(time.Now().UTC()))
-	select {
-	case <-ctx.Done():
-		return &time.Ticker{}
-	case <-timer.C:
-		return time.NewTicker(30 * time.Minute)
+func (r *Reporter) bot(period string) messenger.Sender {
+	if period == monthPeriod {
+		return r.monthlyReporterBot
 	}
+	return r.dailyReporterBot
 }
 
-func durationBeforeCreateTicker(timeUTC time.Time) time.Duration {
-	return timeUTC.Truncate(30 * time.Minute).Add(30 * time.Minute).Sub(timeUTC)
+// ReportText returns the text of the report as the reporter bots send it, period is service.DailyReport or
+// service.MonthlyReport and the key is the day or the month, e.g. 2023-06-28, 2023-06 or 2023-06-10 for the month which
+// begins on June 10. Financial months which don't begin on the 1st are titled by their days. Month names and numbers
+// follow the language
+func ReportText(periodKey, period string, monthStart int, language i18n.Language, categories map[string]float64) string {
+	return convertToTGReport(language, reportTitle(periodKey, period, monthStart, language), categories)
 }
 
-func convertToTGReports(reports map[string]map[string]float64, timeUTC time.Time, period string) map[string]string {
-	year, month, day := timeUTC.Add(-time.Hour).Date()
-	var title string
+// reportTitle returns the title by the key of the period, e.g. "28 Июня" for 2023-06-28, "Июнь 2023" for 2023-06
+// or "10 Июня - 9 Июля 2023" for 2023-06-10. The month without the day begins on the month start day
+func reportTitle(periodKey, period string, monthStart int, language i18n.Language) string {
 	switch period {
 	case dayPeriod:
-		title = fmt.Sprintf("%d %s\n", day, translateWithDeclension(month.String()))
+		date, err := time.Parse(dailyKey, periodKey)
+		if err != nil {
+			logrus.Errorf("reporter producer couldn't parse period key %s: %v", periodKey, err)
+			return ""
+		}
+		return language.T("%d %s", date.Day(), language.MonthOfDate(date.Month())) + "\n"
 	case monthPeriod:
-		title = fmt.Sprintf("%s %d\n", translate(month.String()), year)
-	}
-	tgReports := make(map[string]string)
-	for user, categories := range reports {
-		tgReports[user] = convertToTGReport(title, categories)
+		from, err := service.MonthFirstDay(periodKey, monthStart)
+		if err != nil {
+			logrus.Errorf("reporter producer couldn't parse period key %s: %v", periodKey, err)
+			return ""
+		}
+		if from.Day() == 1 {
+			return fmt.Sprintf("%s %d\n", language.Month(from.Month()), from.Year())
+		}
+		to := from.AddDate(0, 1, -1)
+		return language.T("%d %s - %d %s %d", from.Day(), language.MonthOfDate(from.Month()),
+			to.Day(), language.MonthOfDate(to.Month()), to.Year()) + "\n"
 	}
-	return tgReports
+	return ""
 }
 
-func convertToTGReport(title string, categories map[string]float64) string {
+func convertToTGReport(language i18n.Language, title string, categories map[string]float64) string {
 	sortedCategories := make([]string, len(categories))
 	i := 0
 	for category := range categories {
@@ -228,68 +373,8 @@ func convertToTGReport(title string, categories map[string]float64) string {
 	report := title
 	var total float64
 	for _, category := range sortedCategories {
-		report += fmt.Sprintf("%s - %.2f\n", strings.TrimSuffix(category, ".Amount"), categories[category])
+		report += fmt.Sprintf("%s - %s\n", strings.TrimSuffix(category, ".Amount"), language.Number(categories[category]))
 		total += categories[category]
 	}
-	return fmt.Sprintf("%s\nИтого - %.2f", report, total)
-}
-
-func translate(month string) string {
-	switch month {
-	case "January":
-		return "Январь"
-	case "February":
-		return "Февраль"
-	case "March":
-		return "Март"
-	case "April":
-		return "Апрель"
-	case "May":
-		return "Май"
-	case "June":
-		return "Июнь"
-	case "July":
-		return "Июль"
-	case "August":
-		return "Август"
-	case "September":
-		return "Сентябрь"
-	case "October":
-		return "Октябрь"
-	case "November":
-		return "Ноябрь"
-	case "December":
-		return "Декабрь"
-	}
-	return ""
-}
-
-func translateWithDeclension(month string) string {
-	switch month {
-	case "January":
-		return "Января"
-	case "February":
-		return "Февраля"
-	case "March":
-		return "Марта"
-	case "April":
-		return "Апреля"
-	case "May":
-		return "Мая"
-	case "June":
-		return "Июня"
-	case "July":
-		return "Июля"
-	case "August":
-		return "Августа"
-	case "September":
-		return "Сентября"
-	case "October":
-		return "Октября"
-	case "November":
-		return "Ноября"
-	case "December":
-		return "Декабря"
-	}
-	return ""
+	return report + "\n" + language.T("Итого - %s", language.Number(total))
 }
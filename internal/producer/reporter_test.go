@@ -1,7 +1,12 @@
 package producer
 
 import (
+	"context"
 	"fmt"
+	"github.com/chucky-1/finance/internal/i18n"
+	"github.com/chucky-1/finance/internal/model"
+	"github.com/chucky-1/finance/internal/repository"
+	"github.com/chucky-1/finance/internal/service"
 	"github.com/stretchr/testify/require"
 	"strconv"
 	"strings"
@@ -9,39 +14,221 @@ import (
 	"time"
 )
 
-func Test_TimerBeforeCreateTicker(t *testing.T) {
-	testTable := []struct {
-		name    string
-		timeUTC time.Time
-		result  time.Duration
-	}{
-		{
-			name:    "Before 30 minutes",
-			timeUTC: time.Date(2023, 6, 28, 15, 15, 0, 0, time.UTC),
-			result:  15 * time.Minute,
-		},
-		{
-			name:    "After 30 minutes",
-			timeUTC: time.Date(2023, 6, 28, 15, 40, 0, 0, time.UTC),
-			result:  20 * time.Minute,
-		},
-		{
-			name:    "In 30 minutes",
-			timeUTC: time.Date(2023, 6, 28, 15, 30, 0, 0, time.UTC),
-			result:  30 * time.Minute,
-		},
-		{
-			name:    "In 0 minute",
-			timeUTC: time.Date(2023, 6, 28, 15, 0, 0, 0, time.UTC),
-			result:  30 * time.Minute,
-		},
+// fakeStorage keeps everything the reporter needs in memory, every user has the same expenses
+type fakeStorage struct {
+	lastTick time.Time
+	// added are reports of the outbox like "day 2023-06-28"
+	added []string
+	// due reports are delivered and marked as delivered, failed or skipped by IDs
+	due       []*model.Report
+	delivered []int64
+	failed    []int64
+	skipped   []int64
+	// cleaned are users whose daily expenses are deleted
+	cleaned []string
+	// deleted is the user who has been deleted while the service was running
+	deleted string
+}
+
+func (s *fakeStorage) Get(context.Context, *model.Entry, string) (map[string]float64, error) {
+	return nil, nil
+}
+
+func (s *fakeStorage) GetByUsernames(_ context.Context, usernames []string, _, _ string) (map[string]map[string]float64, error) {
+	reports := make(map[string]map[string]float64, len(usernames))
+	for _, username := range usernames {
+		reports[username] = map[string]float64{"Кофе": 3.5}
 	}
+	return reports, nil
+}
 
-	for _, testCase := range testTable {
-		t.Run(testCase.name, func(t *testing.T) {
-			require.Equal(t, testCase.result, durationBeforeCreateTicker(testCase.timeUTC))
-		})
+func (s *fakeStorage) DeleteByUsernames(_ context.Context, usernames []string, _, _ string) error {
+	s.cleaned = append(s.cleaned, usernames...)
+	return nil
+}
+
+func (s *fakeStorage) DeleteUser(context.Context, string, string) error {
+	return nil
+}
+
+func (s *fakeStorage) GetLastTick(context.Context, string) (time.Time, error) {
+	return s.lastTick, nil
+}
+
+func (s *fakeStorage) SetLastTick(_ context.Context, _ string, tick time.Time) error {
+	s.lastTick = tick
+	return nil
+}
+
+func (s *fakeStorage) IsIssued(_ context.Context, _, period, periodKey string) (bool, error) {
+	for _, added := range s.added {
+		if added == period+" "+periodKey {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func (s *fakeStorage) Add(_ context.Context, report *model.Report) error {
+	if report.Username == s.deleted {
+		return repository.ReportUserNotFoundErr
 	}
+	if issued, _ := s.IsIssued(context.Background(), report.Username, report.Period, report.PeriodKey); issued {
+		return repository.ReportAlreadyIssuedErr
+	}
+	s.added = append(s.added, report.Period+" "+report.PeriodKey)
+	return nil
+}
+
+func (s *fakeStorage) GetDue(context.Context, time.Time, int) ([]*model.Report, error) {
+	return s.due, nil
+}
+
+func (s *fakeStorage) GetDead(context.Context, int) ([]*model.Report, error) {
+	return nil, nil
+}
+
+func (s *fakeStorage) MarkDelivered(_ context.Context, id int64, _ time.Time) error {
+	s.delivered = append(s.delivered, id)
+	return nil
+}
+
+func (s *fakeStorage) MarkFailed(_ context.Context, id int64, _ string, _, _ time.Time, _ bool) error {
+	s.failed = append(s.failed, id)
+	return nil
+}
+
+func (s *fakeStorage) MarkSkipped(_ context.Context, id int64, _ string) error {
+	s.skipped = append(s.skipped, id)
+	return nil
+}
+
+func (s *fakeStorage) Replay(context.Context, int64, time.Time) error {
+	return nil
+}
+
+// fakeSubscriptions has no subscriptions
+type fakeSubscriptions struct{}
+
+func (fakeSubscriptions) Set(context.Context, *model.Subscription) error {
+	return nil
+}
+
+func (fakeSubscriptions) Get(context.Context, string, string) (*model.Subscription, error) {
+	return nil, nil
+}
+
+func (fakeSubscriptions) Delete(context.Context, string, string) error {
+	return nil
+}
+
+func newTestReporter(t *testing.T, storage *fakeStorage, timezone, username string) *Reporter {
+	reporter := service.NewReporter(storage, storage, storage, storage, nil)
+	location, err := service.LoadLocation(timezone)
+	require.NoError(t, err)
+	reporter.AddTimezone(location, username)
+	return NewReporter(nil, nil, nil, nil, reporter, service.NewOutbox(storage, 3), nil)
+}
+
+func Test_ProcessBoundariesCatchesUpMissedDays(t *testing.T) {
+	ctx := context.Background()
+	storage := &fakeStorage{lastTick: time.Date(2023, 6, 28, 12, 0, 0, 0, time.UTC)}
+	// the day ends at 18:15 by UTC in +5:45
+	producer := newTestReporter(t, storage, "Asia/Kathmandu", "ram")
+
+	producer.processBoundaries(ctx, time.Date(2023, 6, 30, 18, 20, 0, 0, time.UTC))
+	require.Equal(t, []string{"day 2023-06-28", "day 2023-06-29", "day 2023-06-30", "month 2023-06"}, storage.added)
+	require.Equal(t, time.Date(2023, 6, 30, 18, 15, 0, 0, time.UTC), storage.lastTick)
+
+	producer.processBoundaries(ctx, time.Date(2023, 7, 1, 18, 14, 0, 0, time.UTC))
+	require.Len(t, storage.added, 4)
+	producer.processBoundaries(ctx, time.Date(2023, 7, 1, 18, 15, 0, 0, time.UTC))
+	require.Equal(t, "day 2023-07-01", storage.added[4])
+}
+
+func Test_ProcessBoundariesCleansIssuedDays(t *testing.T) {
+	// the report of June 28 was enqueued, but the service stopped before its daily expenses were deleted
+	storage := &fakeStorage{lastTick: time.Date(2023, 6, 28, 20, 0, 0, 0, time.UTC), added: []string{"day 2023-06-28"}}
+	producer := newTestReporter(t, storage, "Europe/Minsk", "dima")
+
+	producer.processBoundaries(context.Background(), time.Date(2023, 6, 29, 21, 0, 0, 0, time.UTC))
+	require.Equal(t, []string{"day 2023-06-28", "day 2023-06-29"}, storage.added)
+	require.Equal(t, []string{"dima", "dima"}, storage.cleaned)
+}
+
+func Test_ProcessBoundariesForgetsDeletedUsers(t *testing.T) {
+	storage := &fakeStorage{lastTick: time.Date(2023, 6, 29, 20, 0, 0, 0, time.UTC), deleted: "dima"}
+	producer := newTestReporter(t, storage, "Europe/Minsk", "dima")
+
+	producer.processBoundaries(context.Background(), time.Date(2023, 6, 29, 21, 0, 0, 0, time.UTC))
+	require.Empty(t, storage.added)
+	require.Empty(t, storage.cleaned)
+	_, ok := producer.reporter.NextBoundary()
+	require.False(t, ok)
+}
+
+func Test_ProcessBoundariesFirstStart(t *testing.T) {
+	storage := &fakeStorage{}
+	producer := newTestReporter(t, storage, "Europe/Minsk", "dima")
+
+	now := time.Date(2023, 6, 30, 21, 30, 0, 0, time.UTC)
+	producer.processBoundaries(context.Background(), now)
+	require.Empty(t, storage.added)
+	require.Equal(t, now, storage.lastTick)
+	next, ok := producer.reporter.NextBoundary()
+	require.True(t, ok)
+	require.Equal(t, time.Date(2023, 7, 1, 21, 0, 0, 0, time.UTC), next)
+}
+
+func Test_ProcessBoundariesLimitedByMaxCatchUp(t *testing.T) {
+	storage := &fakeStorage{lastTick: time.Date(2022, 6, 30, 21, 0, 0, 0, time.UTC)}
+	producer := newTestReporter(t, storage, "Europe/Minsk", "dima")
+
+	producer.processBoundaries(context.Background(), time.Date(2023, 6, 30, 22, 0, 0, 0, time.UTC))
+	// 31 days and 2 months since May 30 22:00
+	require.Len(t, storage.added, 33)
+	require.Equal(t, []string{"day 2023-05-31", "month 2023-05"}, storage.added[:2])
+	require.Equal(t, []string{"day 2023-06-30", "month 2023-06"}, storage.added[31:])
+}
+
+func Test_DeliverReportsSkipsNotSubscribed(t *testing.T) {
+	storage := &fakeStorage{due: []*model.Report{{ID: 7, Username: "dima", Period: dayPeriod, PeriodKey: "2023-06-28"}}}
+	producer := newTestReporter(t, storage, "Europe/Minsk", "dima")
+	producer.subscriptions = service.NewSubscription(fakeSubscriptions{}, nil, "secret")
+
+	require.NoError(t, producer.deliverDueReports(context.Background(), time.Now().UTC()))
+	require.Equal(t, []int64{7}, storage.skipped)
+	require.Empty(t, storage.delivered)
+	require.Empty(t, storage.failed)
+}
+
+func Test_WaitDuration(t *testing.T) {
+	require.Equal(t, maxWait, waitDuration(time.Time{}, false))
+	require.Equal(t, time.Duration(0), waitDuration(time.Now().Add(-time.Minute), true))
+	require.Equal(t, maxWait, waitDuration(time.Now().Add(2*maxWait), true))
+	wait := waitDuration(time.Now().Add(10*time.Minute), true)
+	require.True(t, wait > 9*time.Minute && wait <= 10*time.Minute)
+}
+
+func Test_ReportTitle(t *testing.T) {
+	require.Equal(t, "28 Июня\n", reportTitle("2023-06-28", dayPeriod, 10, i18n.Russian))
+	require.Equal(t, "Июнь 2023\n", reportTitle("2023-06", monthPeriod, 0, i18n.Russian))
+	require.Equal(t, "Июнь 2023\n", reportTitle("2023-06", monthPeriod, 1, i18n.Russian))
+	require.Equal(t, "10 Декабря - 9 Января 2024\n", reportTitle("2023-12-10", monthPeriod, 10, i18n.Russian))
+	require.Equal(t, "10 Декабря - 9 Января 2024\n", reportTitle("2023-12-10", monthPeriod, 0, i18n.Russian))
+	require.Equal(t, "10 Декабря - 9 Января 2024\n", reportTitle("2023-12", monthPeriod, 10, i18n.Russian))
+}
+
+func Test_ReportTextInLanguages(t *testing.T) {
+	categories := map[string]float64{"Rent": 1200, "Food": 25.6}
+	require.Equal(t, "28 Июня\nFood - 25,60\nRent - 1\u00a0200,00\n\nИтого - 1\u00a0225,60",
+		ReportText("2023-06-28", dayPeriod, 0, i18n.Russian, categories))
+	require.Equal(t, "June 28\nFood - 25.60\nRent - 1,200.00\n\nTotal - 1,225.60",
+		ReportText("2023-06-28", dayPeriod, 0, i18n.English, categories))
+	require.Equal(t, "Czerwiec 2023\nFood - 25,60\nRent - 1200,00\n\nRazem - 1225,60",
+		ReportText("2023-06", monthPeriod, 1, i18n.Polish, categories))
+	require.Equal(t, "December 10 - January 9, 2024\n", reportTitle("2023-12-10", monthPeriod, 10, i18n.English))
+	require.Equal(t, "10 grudnia - 9 stycznia 2024\n", reportTitle("2023-12-10", monthPeriod, 10, i18n.Polish))
 }
 
 func Test_ConvertToTGReports(t *testing.T) {
@@ -77,7 +264,7 @@ func Test_ConvertToTGReports(t *testing.T) {
 
 	for _, testCase := range testTable {
 		t.Run(testCase.name, func(t *testing.T) {
-			report := convertToTGReport(testCase.title, testCase.categories)
+			report := convertToTGReport(i18n.Russian, testCase.title, testCase.categories)
 			fmt.Println(report)
 			var total float64
 			for _, v := range testCase.categories {
@@ -85,7 +272,7 @@ func Test_ConvertToTGReports(t *testing.T) {
 			}
 			sl := strings.Split(report, "Итого - ")
 			require.Equal(t, 2, len(sl))
-			ttl, err := strconv.ParseFloat(sl[1], 64)
+			ttl, err := strconv.ParseFloat(strings.NewReplacer("\u00a0", "", ",", ".").Replace(sl[1]), 64)
 			if err != nil {
 				t.Fatal(err)
 			}
@@ -0,0 +1,88 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/chucky-1/finance/internal/model"
+	"github.com/jackc/pgx/v4"
+	"github.com/jackc/pgx/v4/pgxpool"
+	"time"
+)
+
+var DuplicateAPITokenErr = errors.New("api token with this name already exists")
+
+type APIToken interface {
+	Add(ctx context.Context, token *model.APIToken, hash string) error
+	GetAll(ctx context.Context, username string) ([]*model.APIToken, error)
+	// Delete returns false if the user doesn't have the token
+	Delete(ctx context.Context, username, name string) (bool, error)
+	// Use sets the last usage of the token with the hash and returns the token or nil if there isn't such token
+	Use(ctx context.Context, hash string, now time.Time) (*model.APIToken, error)
+}
+
+type APITokenPostgres struct {
+	conn *pgxpool.Pool
+}
+
+func NewAPITokenPostgres(conn *pgxpool.Pool) *APITokenPostgres {
+	return &APITokenPostgres{
+		conn: conn,
+	}
+}
+
+func (a *APITokenPostgres) Add(ctx context.Context, token *model.APIToken, hash string) error {
+	query := `INSERT INTO finance.api_tokens (username, name, hash, scope, created_at) VALUES ($1, $2, $3, $4, $5) ON CONFLICT DO NOTHING`
+	commandTag, err := a.conn.Exec(ctx, query, token.Username, token.Name, hash, token.Scope, token.CreatedAt)
+	if err != nil {
+		return fmt.Errorf("repository.APIToken, add token error: %v", err)
+	}
+	if commandTag.RowsAffected() != 1 {
+		return DuplicateAPITokenErr
+	}
+	return nil
+}
+
+func (a *APITokenPostgres) GetAll(ctx context.Context, username string) ([]*model.APIToken, error) {
+	query := `SELECT username, name, scope, created_at, last_used_at FROM finance.api_tokens WHERE username = $1 ORDER BY created_at, name`
+	rows, err := a.conn.Query(ctx, query, username)
+	if err != nil {
+		return nil, fmt.Errorf("repository.APIToken, get all tokens error: %v", err)
+	}
+	defer rows.Close()
+
+	tokens := make([]*model.APIToken, 0)
+	for rows.Next() {
+		var token model.APIToken
+		if err = rows.Scan(&token.Username, &token.Name, &token.Scope, &token.CreatedAt, &token.LastUsedAt); err != nil {
+			return nil, fmt.Errorf("repository.APIToken, scan token error: %v", err)
+		}
+		tokens = append(tokens, &token)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("repository.APIToken, rows error: %v", err)
+	}
+	return tokens, nil
+}
+
+func (a *APITokenPostgres) Delete(ctx context.Context, username, name string) (bool, error) {
+	query := `DELETE FROM finance.api_tokens WHERE username = $1 AND name = $2`
+	commandTag, err := a.conn.Exec(ctx, query, username, name)
+	if err != nil {
+		return false, fmt.Errorf("repository.APIToken, delete token error: %v", err)
+	}
+	return commandTag.RowsAffected() == 1, nil
+}
+
+func (a *APITokenPostgres) Use(ctx context.Context, hash string, now time.Time) (*model.APIToken, error) {
+	query := `UPDATE finance.api_tokens SET last_used_at = $1 WHERE hash = $2
+		RETURNING username, name, scope, created_at, last_used_at`
+	var token model.APIToken
+	err := a.conn.QueryRow(ctx, query, now, hash).Scan(&token.Username, &token.Name, &token.Scope, &token.CreatedAt, &token.LastUsedAt)
+	if err != nil && err != pgx.ErrNoRows {
+		return nil, fmt.Errorf("repository.APIToken, use token error: %v", err)
+	} else if err == pgx.ErrNoRows {
+		return nil, nil
+	}
+	return &token, nil
+}
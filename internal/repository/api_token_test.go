@@ -0,0 +1,64 @@
+package repository
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/chucky-1/finance/internal/model"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAPITokenPostgres(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	defer func() {
+		_, err := postgresPool.Exec(ctx, `TRUNCATE TABLE finance.users, finance.api_tokens`)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}()
+
+	err := NewPostgres(postgresPool).Create(ctx, &model.User{Username: "user", Password: "password", Country: "Belarus", Timezone: "Europe/Minsk"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tokenRepo := NewAPITokenPostgres(postgresPool)
+	now := time.Now().UTC().Truncate(time.Millisecond)
+	token := &model.APIToken{Username: "user", Name: "script", Scope: model.ReadScope, CreatedAt: now}
+	if err = tokenRepo.Add(ctx, token, "hash"); err != nil {
+		t.Fatal(err)
+	}
+	require.Equal(t, DuplicateAPITokenErr, tokenRepo.Add(ctx, token, "another hash"))
+
+	used, err := tokenRepo.Use(ctx, "hash", now.Add(time.Minute))
+	if err != nil {
+		t.Fatal(err)
+	}
+	require.Equal(t, "script", used.Name)
+	require.True(t, now.Add(time.Minute).Equal(*used.LastUsedAt))
+
+	unknown, err := tokenRepo.Use(ctx, "unknown", now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	require.Nil(t, unknown)
+
+	tokens, err := tokenRepo.GetAll(ctx, "user")
+	if err != nil {
+		t.Fatal(err)
+	}
+	require.Len(t, tokens, 1)
+
+	deleted, err := tokenRepo.Delete(ctx, "user", "script")
+	if err != nil {
+		t.Fatal(err)
+	}
+	require.True(t, deleted)
+	deleted, err = tokenRepo.Delete(ctx, "user", "script")
+	if err != nil {
+		t.Fatal(err)
+	}
+	require.False(t, deleted)
+}
@@ -0,0 +1,167 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/chucky-1/finance/internal/model"
+	"github.com/sirupsen/logrus"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"time"
+)
+
+// entriesCollection keeps every entry, the aggregated periods can't be listed or changed
+const entriesCollection = "entries"
+
+var EntryNotFoundErr = errors.New("entry not found")
+
+type Entries interface {
+	// AddEntry sets the ID of the entry
+	AddEntry(ctx context.Context, entry *model.Entry) error
+	GetEntry(ctx context.Context, kind, user, id string) (*model.Entry, error)
+	// GetEntries returns entries of the user from the beginning to the end of the range, not including the end
+	GetEntries(ctx context.Context, kind, user string, from, to time.Time) ([]*model.Entry, error)
+	UpdateEntry(ctx context.Context, entry *model.Entry) error
+	DeleteEntry(ctx context.Context, kind, user, id string) error
+}
+
+type entryDocument struct {
+	ID       primitive.ObjectID `bson:"_id,omitempty"`
+	User     string             `bson:"user"`
+	Member   string             `bson:"member,omitempty"`
+	Date     time.Time          `bson:"date"`
+	MonthKey string             `bson:"month_key,omitempty"`
+	Category string             `bson:"category"`
+	Amount   float64            `bson:"amount"`
+}
+
+func (m *Mongo) AddEntry(ctx context.Context, entry *model.Entry) error {
+	result, err := m.cli.Database(entry.Kind).Collection(entriesCollection).InsertOne(ctx, toEntryDocument(entry))
+	if err != nil {
+		return fmt.Errorf("mongo couldn't InsertOne in AddEntry method: %v", err)
+	}
+	entry.ID = result.InsertedID.(primitive.ObjectID).Hex()
+	return nil
+}
+
+func (m *Mongo) GetEntry(ctx context.Context, kind, user, id string) (*model.Entry, error) {
+	filter, ok := entryFilter(user, id)
+	if !ok {
+		return nil, EntryNotFoundErr
+	}
+	var document entryDocument
+	err := m.cli.Database(kind).Collection(entriesCollection).FindOne(ctx, filter).Decode(&document)
+	if err == mongo.ErrNoDocuments {
+		return nil, EntryNotFoundErr
+	}
+	if err != nil {
+		return nil, fmt.Errorf("mongo couldn't FindOne in GetEntry method: %v", err)
+	}
+	return toEntry(kind, &document), nil
+}
+
+func (m *Mongo) GetEntries(ctx context.Context, kind, user string, from, to time.Time) ([]*model.Entry, error) {
+	cursor, err := m.cli.Database(kind).Collection(entriesCollection).Find(ctx,
+		bson.D{
+			{Key: "user", Value: user},
+			{Key: "date", Value: bson.D{{Key: "$gte", Value: from}, {Key: "$lt", Value: to}}},
+		},
+		options.Find().SetSort(bson.D{{Key: "date", Value: 1}, {Key: "_id", Value: 1}}))
+	if err != nil {
+		return nil, fmt.Errorf("mongo couldn't Find in GetEntries method: %v", err)
+	}
+	defer func(cursor *mongo.Cursor, ctx context.Context) {
+		err = cursor.Close(ctx)
+		if err != nil {
+			logrus.Errorf("mongo couldn't close cursor in GetEntries method")
+		}
+	}(cursor, ctx)
+
+	entries := make([]*model.Entry, 0)
+	for cursor.Next(ctx) {
+		var document entryDocument
+		if err = cursor.Decode(&document); err != nil {
+			return nil, fmt.Errorf("mongo couldn't Decode in GetEntries method: %v", err)
+		}
+		entries = append(entries, toEntry(kind, &document))
+	}
+	if err = cursor.Err(); err != nil {
+		return nil, fmt.Errorf("cursor err in GetEntries method: %v", err)
+	}
+	return entries, nil
+}
+
+func (m *Mongo) UpdateEntry(ctx context.Context, entry *model.Entry) error {
+	filter, ok := entryFilter(entry.User, entry.ID)
+	if !ok {
+		return EntryNotFoundErr
+	}
+	document := toEntryDocument(entry)
+	result, err := m.cli.Database(entry.Kind).Collection(entriesCollection).UpdateOne(ctx, filter,
+		bson.D{{Key: "$set", Value: bson.D{
+			{Key: "date", Value: document.Date},
+			{Key: "month_key", Value: document.MonthKey},
+			{Key: "category", Value: document.Category},
+			{Key: "amount", Value: document.Amount},
+		}}})
+	if err != nil {
+		return fmt.Errorf("mongo couldn't UpdateOne in UpdateEntry method: %v", err)
+	}
+	if result.MatchedCount == 0 {
+		return EntryNotFoundErr
+	}
+	return nil
+}
+
+func (m *Mongo) DeleteEntry(ctx context.Context, kind, user, id string) error {
+	filter, ok := entryFilter(user, id)
+	if !ok {
+		return EntryNotFoundErr
+	}
+	result, err := m.cli.Database(kind).Collection(entriesCollection).DeleteOne(ctx, filter)
+	if err != nil {
+		return fmt.Errorf("mongo couldn't DeleteOne in DeleteEntry method: %v", err)
+	}
+	if result.DeletedCount == 0 {
+		return EntryNotFoundErr
+	}
+	return nil
+}
+
+// entryFilter returns false if the id isn't an id of an entry
+func entryFilter(user, id string) (bson.D, bool) {
+	objectID, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return nil, false
+	}
+	return bson.D{{Key: "_id", Value: objectID}, {Key: "user", Value: user}}, true
+}
+
+func toEntryDocument(entry *model.Entry) *entryDocument {
+	return &entryDocument{
+		User:     entry.User,
+		Member:   entry.Member,
+		Date:     entry.Date,
+		MonthKey: entry.MonthKey,
+		Category: entry.Category.Name,
+		Amount:   entry.Category.Amount,
+	}
+}
+
+func toEntry(kind string, document *entryDocument) *model.Entry {
+	return &model.Entry{
+		ID:       document.ID.Hex(),
+		Kind:     kind,
+		User:     document.User,
+		Member:   document.Member,
+		Date:     document.Date.UTC(),
+		MonthKey: document.MonthKey,
+		Category: &model.Category{
+			Name:   document.Category,
+			Amount: document.Amount,
+		},
+	}
+}
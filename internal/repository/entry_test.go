@@ -0,0 +1,69 @@
+package repository
+
+import (
+	"context"
+	"github.com/chucky-1/finance/internal/model"
+	"github.com/stretchr/testify/require"
+	"testing"
+	"time"
+)
+
+func TestMongo_Entries(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	defer func() {
+		err := mongoCli.Database("expenses").Collection(entriesCollection).Drop(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}()
+
+	date := time.Date(2023, 6, 28, 12, 0, 0, 0, time.UTC)
+	coffee := &model.Entry{
+		Kind:     "expenses",
+		User:     "Dima",
+		Date:     date,
+		MonthKey: "2023-06",
+		Category: &model.Category{Name: "Coffee", Amount: 3.5},
+	}
+	food := &model.Entry{
+		Kind:     "expenses",
+		User:     "Dima",
+		Date:     date.Add(24 * time.Hour),
+		Category: &model.Category{Name: "Food", Amount: 12},
+	}
+	shared := &model.Entry{
+		Kind:     "expenses",
+		User:     model.LedgerKey(1),
+		Member:   "Anna",
+		Date:     date,
+		Category: &model.Category{Name: "Rent", Amount: 500},
+	}
+	for _, entry := range []*model.Entry{coffee, food, shared} {
+		require.NoError(t, financeRepo.AddEntry(ctx, entry))
+		require.NotEmpty(t, entry.ID)
+	}
+
+	entries, err := financeRepo.GetEntries(ctx, "expenses", "Dima", date, date.Add(24*time.Hour))
+	require.NoError(t, err)
+	require.Equal(t, []*model.Entry{coffee}, entries)
+	entries, err = financeRepo.GetEntries(ctx, "expenses", model.LedgerKey(1), date, date.Add(24*time.Hour))
+	require.NoError(t, err)
+	require.Equal(t, []*model.Entry{shared}, entries)
+
+	coffee.Category.Amount = 4
+	coffee.MonthKey = "2023-06-10"
+	require.NoError(t, financeRepo.UpdateEntry(ctx, coffee))
+	entry, err := financeRepo.GetEntry(ctx, "expenses", "Dima", coffee.ID)
+	require.NoError(t, err)
+	require.Equal(t, coffee, entry)
+
+	_, err = financeRepo.GetEntry(ctx, "expenses", "Anna", coffee.ID)
+	require.Equal(t, EntryNotFoundErr, err)
+	require.Equal(t, EntryNotFoundErr, financeRepo.DeleteEntry(ctx, "expenses", "Anna", coffee.ID))
+	require.Equal(t, EntryNotFoundErr, financeRepo.DeleteEntry(ctx, "expenses", "Dima", "wrong"))
+
+	require.NoError(t, financeRepo.DeleteEntry(ctx, "expenses", "Dima", coffee.ID))
+	_, err = financeRepo.GetEntry(ctx, "expenses", "Dima", coffee.ID)
+	require.Equal(t, EntryNotFoundErr, err)
+}
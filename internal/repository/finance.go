@@ -27,6 +27,8 @@ type Getter interface {
 
 type Cleaner interface {
 	DeleteByUsernames(ctx context.Context, users []string, kind, period string) error
+	// DeleteUser deletes the aggregated periods and the entries of the user
+	DeleteUser(ctx context.Context, user, kind string) error
 }
 
 type Mongo struct {
@@ -122,6 +124,20 @@ func (m *Mongo) DeleteByUsernames(ctx context.Context, users []string, kind, per
 	return nil
 }
 
+func (m *Mongo) DeleteUser(ctx context.Context, user, kind string) error {
+	collections, err := m.cli.Database(kind).ListCollectionNames(ctx, bson.D{})
+	if err != nil {
+		return fmt.Errorf("mongo couldn't ListCollectionNames in DeleteUser method: %v", err)
+	}
+	for _, collection := range collections {
+		_, err = m.cli.Database(kind).Collection(collection).DeleteMany(ctx, bson.D{{Key: "user", Value: user}})
+		if err != nil {
+			return fmt.Errorf("mongo couldn't DeleteMany in DeleteUser method: %v", err)
+		}
+	}
+	return nil
+}
+
 func unmarshal(categories map[string]float64, data *bson.D) (map[string]float64, error) {
 	for key, object := range data.Map() {
 		if key == "_id" || key == "user" {
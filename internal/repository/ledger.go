@@ -0,0 +1,188 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/chucky-1/finance/internal/model"
+	"github.com/jackc/pgx/v4"
+	"github.com/jackc/pgx/v4/pgxpool"
+	"github.com/sirupsen/logrus"
+	"time"
+)
+
+var DuplicateLedgerMemberErr = errors.New("user is already a member of the ledger")
+
+// Ledger keeps shared ledgers, their members and one-time invites, only hashes of invite codes are stored
+type Ledger interface {
+	// Create sets the ID of the ledger and adds the owner to its members
+	Create(ctx context.Context, ledger *model.Ledger) error
+	// GetAll returns ledgers of the user with the role of the user in them
+	GetAll(ctx context.Context, username string) ([]*model.Membership, error)
+	// GetMembership returns nil if the user isn't a member of the ledger
+	GetMembership(ctx context.Context, ledgerID int64, username string) (*model.Membership, error)
+	GetMembers(ctx context.Context, ledgerID int64) ([]*model.LedgerMember, error)
+	// DeleteMember returns false if the user isn't a member of the ledger, the owner can't be deleted
+	DeleteMember(ctx context.Context, ledgerID int64, username string) (bool, error)
+	AddInvite(ctx context.Context, hash string, ledgerID int64, role string, expiresAt time.Time) error
+	// Join marks the invite as used and adds the user to the members of its ledger. It returns nil if the invite
+	// is unknown, used or expired and DuplicateLedgerMemberErr if the user is a member already, then the invite stays unused
+	Join(ctx context.Context, hash, username string, now time.Time) (*model.Membership, error)
+}
+
+type LedgerPostgres struct {
+	conn *pgxpool.Pool
+}
+
+func NewLedgerPostgres(conn *pgxpool.Pool) *LedgerPostgres {
+	return &LedgerPostgres{
+		conn: conn,
+	}
+}
+
+func (l *LedgerPostgres) Create(ctx context.Context, ledger *model.Ledger) error {
+	tx, err := l.conn.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("repository.Ledger, begin transaction error: %v", err)
+	}
+	defer func() {
+		if err = tx.Rollback(ctx); err != nil && err != pgx.ErrTxClosed {
+			logrus.Errorf("repository.Ledger, rollback error: %v", err)
+		}
+	}()
+
+	query := `INSERT INTO finance.ledgers (name, owner, created_at) VALUES ($1, $2, $3) RETURNING id`
+	if err = tx.QueryRow(ctx, query, ledger.Name, ledger.Owner, ledger.CreatedAt).Scan(&ledger.ID); err != nil {
+		return fmt.Errorf("repository.Ledger, create ledger error: %v", err)
+	}
+	query = `INSERT INTO finance.ledger_members (ledger_id, username, role, joined_at) VALUES ($1, $2, $3, $4)`
+	if _, err = tx.Exec(ctx, query, ledger.ID, ledger.Owner, model.OwnerRole, ledger.CreatedAt); err != nil {
+		return fmt.Errorf("repository.Ledger, add owner error: %v", err)
+	}
+	if err = tx.Commit(ctx); err != nil {
+		return fmt.Errorf("repository.Ledger, commit error: %v", err)
+	}
+	return nil
+}
+
+func (l *LedgerPostgres) GetAll(ctx context.Context, username string) ([]*model.Membership, error) {
+	query := `SELECT l.id, l.name, l.owner, l.created_at, m.role FROM finance.ledgers l
+		JOIN finance.ledger_members m ON m.ledger_id = l.id WHERE m.username = $1 ORDER BY l.id`
+	rows, err := l.conn.Query(ctx, query, username)
+	if err != nil {
+		return nil, fmt.Errorf("repository.Ledger, get all ledgers error: %v", err)
+	}
+	defer rows.Close()
+
+	memberships := make([]*model.Membership, 0)
+	for rows.Next() {
+		membership := model.Membership{Ledger: &model.Ledger{}}
+		err = rows.Scan(&membership.Ledger.ID, &membership.Ledger.Name, &membership.Ledger.Owner, &membership.Ledger.CreatedAt,
+			&membership.Role)
+		if err != nil {
+			return nil, fmt.Errorf("repository.Ledger, scan ledger error: %v", err)
+		}
+		memberships = append(memberships, &membership)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("repository.Ledger, rows error: %v", err)
+	}
+	return memberships, nil
+}
+
+func (l *LedgerPostgres) GetMembership(ctx context.Context, ledgerID int64, username string) (*model.Membership, error) {
+	query := `SELECT l.id, l.name, l.owner, l.created_at, m.role FROM finance.ledgers l
+		JOIN finance.ledger_members m ON m.ledger_id = l.id WHERE l.id = $1 AND m.username = $2`
+	membership := model.Membership{Ledger: &model.Ledger{}}
+	err := l.conn.QueryRow(ctx, query, ledgerID, username).Scan(&membership.Ledger.ID, &membership.Ledger.Name,
+		&membership.Ledger.Owner, &membership.Ledger.CreatedAt, &membership.Role)
+	if err == pgx.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("repository.Ledger, get membership error: %v", err)
+	}
+	return &membership, nil
+}
+
+func (l *LedgerPostgres) GetMembers(ctx context.Context, ledgerID int64) ([]*model.LedgerMember, error) {
+	query := `SELECT ledger_id, username, role, joined_at FROM finance.ledger_members WHERE ledger_id = $1 ORDER BY joined_at, username`
+	rows, err := l.conn.Query(ctx, query, ledgerID)
+	if err != nil {
+		return nil, fmt.Errorf("repository.Ledger, get members error: %v", err)
+	}
+	defer rows.Close()
+
+	members := make([]*model.LedgerMember, 0)
+	for rows.Next() {
+		var member model.LedgerMember
+		if err = rows.Scan(&member.LedgerID, &member.Username, &member.Role, &member.JoinedAt); err != nil {
+			return nil, fmt.Errorf("repository.Ledger, scan member error: %v", err)
+		}
+		members = append(members, &member)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("repository.Ledger, rows error: %v", err)
+	}
+	return members, nil
+}
+
+func (l *LedgerPostgres) DeleteMember(ctx context.Context, ledgerID int64, username string) (bool, error) {
+	query := `DELETE FROM finance.ledger_members WHERE ledger_id = $1 AND username = $2 AND role <> $3`
+	commandTag, err := l.conn.Exec(ctx, query, ledgerID, username, model.OwnerRole)
+	if err != nil {
+		return false, fmt.Errorf("repository.Ledger, delete member error: %v", err)
+	}
+	return commandTag.RowsAffected() == 1, nil
+}
+
+func (l *LedgerPostgres) AddInvite(ctx context.Context, hash string, ledgerID int64, role string, expiresAt time.Time) error {
+	query := `INSERT INTO finance.ledger_invites (hash, ledger_id, role, expires_at) VALUES ($1, $2, $3, $4)`
+	if _, err := l.conn.Exec(ctx, query, hash, ledgerID, role, expiresAt); err != nil {
+		return fmt.Errorf("repository.Ledger, add invite error: %v", err)
+	}
+	return nil
+}
+
+func (l *LedgerPostgres) Join(ctx context.Context, hash, username string, now time.Time) (*model.Membership, error) {
+	tx, err := l.conn.Begin(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("repository.Ledger, begin transaction error: %v", err)
+	}
+	defer func() {
+		if err = tx.Rollback(ctx); err != nil && err != pgx.ErrTxClosed {
+			logrus.Errorf("repository.Ledger, rollback error: %v", err)
+		}
+	}()
+
+	query := `UPDATE finance.ledger_invites SET used_at = $1
+		WHERE hash = $2 AND used_at IS NULL AND expires_at > $1 RETURNING ledger_id, role`
+	membership := model.Membership{Ledger: &model.Ledger{}}
+	err = tx.QueryRow(ctx, query, now, hash).Scan(&membership.Ledger.ID, &membership.Role)
+	if err == pgx.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("repository.Ledger, use invite error: %v", err)
+	}
+
+	query = `INSERT INTO finance.ledger_members (ledger_id, username, role, joined_at) VALUES ($1, $2, $3, $4) ON CONFLICT DO NOTHING`
+	commandTag, err := tx.Exec(ctx, query, membership.Ledger.ID, username, membership.Role, now)
+	if err != nil {
+		return nil, fmt.Errorf("repository.Ledger, add member error: %v", err)
+	}
+	if commandTag.RowsAffected() != 1 {
+		return nil, DuplicateLedgerMemberErr
+	}
+
+	query = `SELECT name, owner, created_at FROM finance.ledgers WHERE id = $1`
+	err = tx.QueryRow(ctx, query, membership.Ledger.ID).Scan(&membership.Ledger.Name, &membership.Ledger.Owner,
+		&membership.Ledger.CreatedAt)
+	if err != nil {
+		return nil, fmt.Errorf("repository.Ledger, get ledger error: %v", err)
+	}
+	if err = tx.Commit(ctx); err != nil {
+		return nil, fmt.Errorf("repository.Ledger, commit error: %v", err)
+	}
+	return &membership, nil
+}
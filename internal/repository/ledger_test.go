@@ -0,0 +1,73 @@
+package repository
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/chucky-1/finance/internal/model"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLedgerPostgres(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	defer func() {
+		_, err := postgresPool.Exec(ctx, `TRUNCATE TABLE finance.users CASCADE`)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}()
+
+	for _, username := range []string{"Dima", "Anna"} {
+		err := NewPostgres(postgresPool).Create(ctx, &model.User{Username: username, Password: "password", Country: "Belarus", Timezone: "Europe/Minsk"})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	ledgerRepo := NewLedgerPostgres(postgresPool)
+	now := time.Now().UTC().Truncate(time.Millisecond)
+	ledger := &model.Ledger{Name: "Home", Owner: "Dima", CreatedAt: now}
+	require.NoError(t, ledgerRepo.Create(ctx, ledger))
+	require.NotZero(t, ledger.ID)
+
+	membership, err := ledgerRepo.GetMembership(ctx, ledger.ID, "Dima")
+	require.NoError(t, err)
+	require.Equal(t, model.OwnerRole, membership.Role)
+	require.Equal(t, "Home", membership.Ledger.Name)
+	membership, err = ledgerRepo.GetMembership(ctx, ledger.ID, "Anna")
+	require.NoError(t, err)
+	require.Nil(t, membership)
+
+	require.NoError(t, ledgerRepo.AddInvite(ctx, "hash", ledger.ID, model.EditorRole, now.Add(time.Hour)))
+	require.NoError(t, ledgerRepo.AddInvite(ctx, "expired", ledger.ID, model.ViewerRole, now.Add(-time.Hour)))
+
+	// the owner can't join again and the invite stays for the one it's meant for
+	_, err = ledgerRepo.Join(ctx, "hash", "Dima", now)
+	require.Equal(t, DuplicateLedgerMemberErr, err)
+	membership, err = ledgerRepo.Join(ctx, "hash", "Anna", now)
+	require.NoError(t, err)
+	require.Equal(t, model.EditorRole, membership.Role)
+	require.Equal(t, "Dima", membership.Ledger.Owner)
+	for _, hash := range []string{"hash", "expired", "unknown"} {
+		membership, err = ledgerRepo.Join(ctx, hash, "Anna", now)
+		require.NoError(t, err)
+		require.Nil(t, membership, hash)
+	}
+
+	memberships, err := ledgerRepo.GetAll(ctx, "Anna")
+	require.NoError(t, err)
+	require.Len(t, memberships, 1)
+	require.Equal(t, ledger.ID, memberships[0].Ledger.ID)
+	members, err := ledgerRepo.GetMembers(ctx, ledger.ID)
+	require.NoError(t, err)
+	require.Len(t, members, 2)
+
+	deleted, err := ledgerRepo.DeleteMember(ctx, ledger.ID, "Dima")
+	require.NoError(t, err)
+	require.False(t, deleted)
+	deleted, err = ledgerRepo.DeleteMember(ctx, ledger.ID, "Anna")
+	require.NoError(t, err)
+	require.True(t, deleted)
+}
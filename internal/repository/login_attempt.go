@@ -0,0 +1,73 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"github.com/chucky-1/finance/internal/model"
+	"github.com/jackc/pgx/v4"
+	"github.com/jackc/pgx/v4/pgxpool"
+	"time"
+)
+
+type LoginAttempts interface {
+	// Get returns nil if there weren't failures
+	Get(ctx context.Context, key string) (*model.LoginAttempts, error)
+	// Fail counts the failure, failures before windowStart are forgotten
+	Fail(ctx context.Context, key string, now, windowStart time.Time) (*model.LoginAttempts, error)
+	// Lock forgets failures and locks the key until the time
+	Lock(ctx context.Context, key string, until time.Time) error
+	Reset(ctx context.Context, key string) error
+}
+
+type LoginAttemptPostgres struct {
+	conn *pgxpool.Pool
+}
+
+func NewLoginAttemptPostgres(conn *pgxpool.Pool) *LoginAttemptPostgres {
+	return &LoginAttemptPostgres{
+		conn: conn,
+	}
+}
+
+func (l *LoginAttemptPostgres) Get(ctx context.Context, key string) (*model.LoginAttempts, error) {
+	query := `SELECT key, failures, last_failure_at, locked_until FROM finance.login_attempts WHERE key=$1`
+	var attempts model.LoginAttempts
+	err := l.conn.QueryRow(ctx, query, key).Scan(&attempts.Key, &attempts.Failures, &attempts.LastFailureAt, &attempts.LockedUntil)
+	if err == pgx.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("repository.LoginAttempts, get attempts error: %v", err)
+	}
+	return &attempts, nil
+}
+
+func (l *LoginAttemptPostgres) Fail(ctx context.Context, key string, now, windowStart time.Time) (*model.LoginAttempts, error) {
+	query := `INSERT INTO finance.login_attempts (key, failures, last_failure_at) VALUES ($1, 1, $2)
+		ON CONFLICT (key) DO UPDATE SET
+			failures = CASE WHEN login_attempts.last_failure_at < $3 THEN 1 ELSE login_attempts.failures + 1 END,
+			last_failure_at = $2
+		RETURNING key, failures, last_failure_at, locked_until`
+	var attempts model.LoginAttempts
+	err := l.conn.QueryRow(ctx, query, key, now, windowStart).
+		Scan(&attempts.Key, &attempts.Failures, &attempts.LastFailureAt, &attempts.LockedUntil)
+	if err != nil {
+		return nil, fmt.Errorf("repository.LoginAttempts, fail error: %v", err)
+	}
+	return &attempts, nil
+}
+
+func (l *LoginAttemptPostgres) Lock(ctx context.Context, key string, until time.Time) error {
+	query := `UPDATE finance.login_attempts SET failures=0, locked_until=$2 WHERE key=$1`
+	if _, err := l.conn.Exec(ctx, query, key, until); err != nil {
+		return fmt.Errorf("repository.LoginAttempts, lock error: %v", err)
+	}
+	return nil
+}
+
+func (l *LoginAttemptPostgres) Reset(ctx context.Context, key string) error {
+	if _, err := l.conn.Exec(ctx, `DELETE FROM finance.login_attempts WHERE key=$1`, key); err != nil {
+		return fmt.Errorf("repository.LoginAttempts, reset error: %v", err)
+	}
+	return nil
+}
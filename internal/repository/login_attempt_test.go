@@ -0,0 +1,49 @@
+package repository
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestLoginAttemptPostgres(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	defer func() {
+		_, err := postgresPool.Exec(ctx, `TRUNCATE TABLE finance.login_attempts`)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}()
+
+	attemptsRepo := NewLoginAttemptPostgres(postgresPool)
+	now := time.Now().UTC().Truncate(time.Millisecond)
+
+	attempts, err := attemptsRepo.Get(ctx, "user:dima")
+	require.NoError(t, err)
+	require.Nil(t, attempts)
+
+	for i := 1; i <= 3; i++ {
+		attempts, err = attemptsRepo.Fail(ctx, "user:dima", now, now.Add(-time.Hour))
+		require.NoError(t, err)
+		require.Equal(t, i, attempts.Failures)
+	}
+
+	// the failures are older than the window, so the counting starts again
+	attempts, err = attemptsRepo.Fail(ctx, "user:dima", now.Add(2*time.Hour), now.Add(time.Hour))
+	require.NoError(t, err)
+	require.Equal(t, 1, attempts.Failures)
+
+	require.NoError(t, attemptsRepo.Lock(ctx, "user:dima", now.Add(3*time.Hour)))
+	attempts, err = attemptsRepo.Get(ctx, "user:dima")
+	require.NoError(t, err)
+	require.Equal(t, 0, attempts.Failures)
+	require.True(t, now.Add(3*time.Hour).Equal(*attempts.LockedUntil))
+
+	require.NoError(t, attemptsRepo.Reset(ctx, "user:dima"))
+	attempts, err = attemptsRepo.Get(ctx, "user:dima")
+	require.NoError(t, err)
+	require.Nil(t, attempts)
+}
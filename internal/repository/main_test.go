@@ -4,7 +4,6 @@ import (
 	"context"
 	"fmt"
 	"os"
-	"os/exec"
 	"testing"
 
 	"github.com/jackc/pgx/v4/pgxpool"
@@ -13,6 +12,9 @@ import (
 	"github.com/sirupsen/logrus"
 	"go.mongodb.org/mongo-driver/mongo"
 	"go.mongodb.org/mongo-driver/mongo/options"
+
+	"github.com/chucky-1/finance/internal/migration"
+	"github.com/chucky-1/finance/migrations"
 )
 
 var (
@@ -83,14 +85,7 @@ func initialPostgres(ctx context.Context, pool *dockertest.Pool) *dockertest.Res
 
 	authRepo = NewPostgres(postgresPool)
 
-	cmd := exec.Command("flyway",
-		"-user=postgres",
-		"-password=password123",
-		"-locations=filesystem:../../migrations",
-		fmt.Sprintf("-url=jdbc:postgresql://%v/postgres", dbHostAndPort),
-		"migrate")
-
-	err = cmd.Run()
+	_, err = migration.NewPostgres(postgresPool, migrations.Postgres).Migrate(ctx)
 	if err != nil {
 		logrus.Fatalf("There are errors in migrations: %s", err)
 	}
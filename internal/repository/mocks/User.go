@@ -28,6 +28,30 @@ func (_m *User) Create(ctx context.Context, user *model.User) error {
 	return r0
 }
 
+// Delete provides a mock function with given fields: ctx, username
+func (_m *User) Delete(ctx context.Context, username string) (bool, error) {
+	ret := _m.Called(ctx, username)
+
+	var r0 bool
+	var r1 error
+	if rf, ok := ret.Get(0).(func(context.Context, string) (bool, error)); ok {
+		return rf(ctx, username)
+	}
+	if rf, ok := ret.Get(0).(func(context.Context, string) bool); ok {
+		r0 = rf(ctx, username)
+	} else {
+		r0 = ret.Get(0).(bool)
+	}
+
+	if rf, ok := ret.Get(1).(func(context.Context, string) error); ok {
+		r1 = rf(ctx, username)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
 // Get provides a mock function with given fields: ctx, username
 func (_m *User) Get(ctx context.Context, username string) (*model.User, error) {
 	ret := _m.Called(ctx, username)
@@ -54,6 +78,206 @@ func (_m *User) Get(ctx context.Context, username string) (*model.User, error) {
 	return r0, r1
 }
 
+// GetAll provides a mock function with given fields: ctx
+func (_m *User) GetAll(ctx context.Context) ([]*model.User, error) {
+	ret := _m.Called(ctx)
+
+	var r0 []*model.User
+	var r1 error
+	if rf, ok := ret.Get(0).(func(context.Context) ([]*model.User, error)); ok {
+		return rf(ctx)
+	}
+	if rf, ok := ret.Get(0).(func(context.Context) []*model.User); ok {
+		r0 = rf(ctx)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).([]*model.User)
+		}
+	}
+
+	if rf, ok := ret.Get(1).(func(context.Context) error); ok {
+		r1 = rf(ctx)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// GetByTelegramID provides a mock function with given fields: ctx, tgUserID
+func (_m *User) GetByTelegramID(ctx context.Context, tgUserID int64) (*model.User, error) {
+	ret := _m.Called(ctx, tgUserID)
+
+	var r0 *model.User
+	var r1 error
+	if rf, ok := ret.Get(0).(func(context.Context, int64) (*model.User, error)); ok {
+		return rf(ctx, tgUserID)
+	}
+	if rf, ok := ret.Get(0).(func(context.Context, int64) *model.User); ok {
+		r0 = rf(ctx, tgUserID)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(*model.User)
+		}
+	}
+
+	if rf, ok := ret.Get(1).(func(context.Context, int64) error); ok {
+		r1 = rf(ctx, tgUserID)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// SetChat provides a mock function with given fields: ctx, username, chatID
+func (_m *User) SetChat(ctx context.Context, username string, chatID int64) error {
+	ret := _m.Called(ctx, username, chatID)
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(context.Context, string, int64) error); ok {
+		r0 = rf(ctx, username, chatID)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
+// SetTelegramID provides a mock function with given fields: ctx, username, tgUserID
+func (_m *User) SetTelegramID(ctx context.Context, username string, tgUserID int64) error {
+	ret := _m.Called(ctx, username, tgUserID)
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(context.Context, string, int64) error); ok {
+		r0 = rf(ctx, username, tgUserID)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
+// UpdateLanguage provides a mock function with given fields: ctx, username, language
+func (_m *User) UpdateLanguage(ctx context.Context, username string, language string) (bool, error) {
+	ret := _m.Called(ctx, username, language)
+
+	var r0 bool
+	var r1 error
+	if rf, ok := ret.Get(0).(func(context.Context, string, string) (bool, error)); ok {
+		return rf(ctx, username, language)
+	}
+	if rf, ok := ret.Get(0).(func(context.Context, string, string) bool); ok {
+		r0 = rf(ctx, username, language)
+	} else {
+		r0 = ret.Get(0).(bool)
+	}
+
+	if rf, ok := ret.Get(1).(func(context.Context, string, string) error); ok {
+		r1 = rf(ctx, username, language)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// UpdateMonthStart provides a mock function with given fields: ctx, username, monthStart
+func (_m *User) UpdateMonthStart(ctx context.Context, username string, monthStart int) (bool, error) {
+	ret := _m.Called(ctx, username, monthStart)
+
+	var r0 bool
+	var r1 error
+	if rf, ok := ret.Get(0).(func(context.Context, string, int) (bool, error)); ok {
+		return rf(ctx, username, monthStart)
+	}
+	if rf, ok := ret.Get(0).(func(context.Context, string, int) bool); ok {
+		r0 = rf(ctx, username, monthStart)
+	} else {
+		r0 = ret.Get(0).(bool)
+	}
+
+	if rf, ok := ret.Get(1).(func(context.Context, string, int) error); ok {
+		r1 = rf(ctx, username, monthStart)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// UpdatePassword provides a mock function with given fields: ctx, username, password
+func (_m *User) UpdatePassword(ctx context.Context, username string, password string) (bool, error) {
+	ret := _m.Called(ctx, username, password)
+
+	var r0 bool
+	var r1 error
+	if rf, ok := ret.Get(0).(func(context.Context, string, string) (bool, error)); ok {
+		return rf(ctx, username, password)
+	}
+	if rf, ok := ret.Get(0).(func(context.Context, string, string) bool); ok {
+		r0 = rf(ctx, username, password)
+	} else {
+		r0 = ret.Get(0).(bool)
+	}
+
+	if rf, ok := ret.Get(1).(func(context.Context, string, string) error); ok {
+		r1 = rf(ctx, username, password)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// UpdateReportTime provides a mock function with given fields: ctx, username, reportTime
+func (_m *User) UpdateReportTime(ctx context.Context, username string, reportTime model.ReportTime) (bool, error) {
+	ret := _m.Called(ctx, username, reportTime)
+
+	var r0 bool
+	var r1 error
+	if rf, ok := ret.Get(0).(func(context.Context, string, model.ReportTime) (bool, error)); ok {
+		return rf(ctx, username, reportTime)
+	}
+	if rf, ok := ret.Get(0).(func(context.Context, string, model.ReportTime) bool); ok {
+		r0 = rf(ctx, username, reportTime)
+	} else {
+		r0 = ret.Get(0).(bool)
+	}
+
+	if rf, ok := ret.Get(1).(func(context.Context, string, model.ReportTime) error); ok {
+		r1 = rf(ctx, username, reportTime)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// UpdateTimezone provides a mock function with given fields: ctx, username, country, timezone
+func (_m *User) UpdateTimezone(ctx context.Context, username string, country string, timezone string) (bool, error) {
+	ret := _m.Called(ctx, username, country, timezone)
+
+	var r0 bool
+	var r1 error
+	if rf, ok := ret.Get(0).(func(context.Context, string, string, string) (bool, error)); ok {
+		return rf(ctx, username, country, timezone)
+	}
+	if rf, ok := ret.Get(0).(func(context.Context, string, string, string) bool); ok {
+		r0 = rf(ctx, username, country, timezone)
+	} else {
+		r0 = ret.Get(0).(bool)
+	}
+
+	if rf, ok := ret.Get(1).(func(context.Context, string, string, string) error); ok {
+		r1 = rf(ctx, username, country, timezone)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
 type mockConstructorTestingTNewUser interface {
 	mock.TestingT
 	Cleanup(func())
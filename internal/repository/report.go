@@ -0,0 +1,193 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/chucky-1/finance/internal/model"
+	"github.com/jackc/pgx/v4"
+	"github.com/jackc/pgx/v4/pgxpool"
+	"github.com/sirupsen/logrus"
+	"time"
+)
+
+var (
+	ReportNotFoundErr      = errors.New("report not found")
+	ReportAlreadyIssuedErr = errors.New("report has already been issued")
+	ReportUserNotFoundErr  = errors.New("user of the report not found")
+)
+
+type Outbox interface {
+	// Add returns ReportAlreadyIssuedErr if a report for this period has already been added
+	// and ReportUserNotFoundErr if the user has been deleted
+	Add(ctx context.Context, report *model.Report) error
+	GetDue(ctx context.Context, now time.Time, limit int) ([]*model.Report, error)
+	GetDead(ctx context.Context, limit int) ([]*model.Report, error)
+	MarkDelivered(ctx context.Context, id int64, deliveredAt time.Time) error
+	// MarkFailed keeps the error and the time of the attempt, dead reports aren't retried
+	MarkFailed(ctx context.Context, id int64, lastError string, attemptAt, nextAttemptAt time.Time, dead bool) error
+	// MarkSkipped closes the pending report which isn't sent with the reason
+	MarkSkipped(ctx context.Context, id int64, reason string) error
+	Replay(ctx context.Context, id int64, now time.Time) error
+}
+
+type Issued interface {
+	IsIssued(ctx context.Context, username, period, periodKey string) (bool, error)
+}
+
+type ReportPostgres struct {
+	conn *pgxpool.Pool
+}
+
+func NewReportPostgres(conn *pgxpool.Pool) *ReportPostgres {
+	return &ReportPostgres{
+		conn: conn,
+	}
+}
+
+func (r *ReportPostgres) Add(ctx context.Context, report *model.Report) error {
+	tx, err := r.conn.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("repository.Outbox, begin transaction error: %v", err)
+	}
+	defer func() {
+		if err = tx.Rollback(ctx); err != nil && err != pgx.ErrTxClosed {
+			logrus.Errorf("repository.Outbox, rollback error: %v", err)
+		}
+	}()
+
+	// the user can't be deleted until the report is added
+	query := `SELECT 1 FROM finance.users WHERE username=$1 FOR SHARE`
+	var exists int
+	err = tx.QueryRow(ctx, query, report.Username).Scan(&exists)
+	if err == pgx.ErrNoRows {
+		return ReportUserNotFoundErr
+	}
+	if err != nil {
+		return fmt.Errorf("repository.Outbox, get user error: %v", err)
+	}
+
+	query = `INSERT INTO finance.reports_issued (username, period, period_key) VALUES ($1, $2, $3) ON CONFLICT DO NOTHING`
+	commandTag, err := tx.Exec(ctx, query, report.Username, report.Period, report.PeriodKey)
+	if err != nil {
+		return fmt.Errorf("repository.Outbox, issue report error: %v", err)
+	}
+	if commandTag.RowsAffected() != 1 {
+		return ReportAlreadyIssuedErr
+	}
+
+	query = `INSERT INTO finance.reports_outbox (username, period, period_key, report, status, next_attempt_at)
+		VALUES ($1, $2, $3, $4, $5, $6) RETURNING id, created_at`
+	err = tx.QueryRow(ctx, query, report.Username, report.Period, report.PeriodKey, report.Text, model.ReportPending,
+		report.NextAttemptAt).Scan(&report.ID, &report.CreatedAt)
+	if err != nil {
+		return fmt.Errorf("repository.Outbox, add report error: %v", err)
+	}
+	if err = tx.Commit(ctx); err != nil {
+		return fmt.Errorf("repository.Outbox, commit error: %v", err)
+	}
+	report.Status = model.ReportPending
+	return nil
+}
+
+func (r *ReportPostgres) IsIssued(ctx context.Context, username, period, periodKey string) (bool, error) {
+	query := `SELECT EXISTS(SELECT 1 FROM finance.reports_issued WHERE username=$1 AND period=$2 AND period_key=$3)`
+	var issued bool
+	if err := r.conn.QueryRow(ctx, query, username, period, periodKey).Scan(&issued); err != nil {
+		return false, fmt.Errorf("repository.Issued, is issued error: %v", err)
+	}
+	return issued, nil
+}
+
+func (r *ReportPostgres) GetDue(ctx context.Context, now time.Time, limit int) ([]*model.Report, error) {
+	query := `SELECT id, username, period, period_key, report, status, attempts, last_error, last_attempt_at, next_attempt_at, created_at,
+		delivered_at
+		FROM finance.reports_outbox WHERE status = $1 AND next_attempt_at <= $2 ORDER BY next_attempt_at LIMIT $3`
+	return r.query(ctx, query, model.ReportPending, now, limit)
+}
+
+func (r *ReportPostgres) GetDead(ctx context.Context, limit int) ([]*model.Report, error) {
+	query := `SELECT id, username, period, period_key, report, status, attempts, last_error, last_attempt_at, next_attempt_at, created_at,
+		delivered_at
+		FROM finance.reports_outbox WHERE status = $1 ORDER BY created_at DESC LIMIT $2`
+	return r.query(ctx, query, model.ReportDead, limit)
+}
+
+func (r *ReportPostgres) MarkDelivered(ctx context.Context, id int64, deliveredAt time.Time) error {
+	query := `UPDATE finance.reports_outbox SET status = $1, attempts = attempts + 1, last_error = '', last_attempt_at = $2,
+		delivered_at = $2 WHERE id = $3`
+	commandTag, err := r.conn.Exec(ctx, query, model.ReportDelivered, deliveredAt, id)
+	if err != nil {
+		return fmt.Errorf("repository.Outbox, mark delivered error: %v", err)
+	}
+	if commandTag.RowsAffected() != 1 {
+		return ReportNotFoundErr
+	}
+	return nil
+}
+
+func (r *ReportPostgres) MarkFailed(ctx context.Context, id int64, lastError string, attemptAt, nextAttemptAt time.Time,
+	dead bool) error {
+	status := model.ReportPending
+	if dead {
+		status = model.ReportDead
+	}
+	query := `UPDATE finance.reports_outbox SET status = $1, attempts = attempts + 1, last_error = $2, last_attempt_at = $3,
+		next_attempt_at = $4 WHERE id = $5`
+	commandTag, err := r.conn.Exec(ctx, query, status, lastError, attemptAt, nextAttemptAt, id)
+	if err != nil {
+		return fmt.Errorf("repository.Outbox, mark failed error: %v", err)
+	}
+	if commandTag.RowsAffected() != 1 {
+		return ReportNotFoundErr
+	}
+	return nil
+}
+
+func (r *ReportPostgres) MarkSkipped(ctx context.Context, id int64, reason string) error {
+	query := `UPDATE finance.reports_outbox SET status = $1, last_error = $2 WHERE id = $3 AND status = $4`
+	commandTag, err := r.conn.Exec(ctx, query, model.ReportSkipped, reason, id, model.ReportPending)
+	if err != nil {
+		return fmt.Errorf("repository.Outbox, mark skipped error: %v", err)
+	}
+	if commandTag.RowsAffected() != 1 {
+		return ReportNotFoundErr
+	}
+	return nil
+}
+
+// Replay returns a dead report to the queue with a fresh attempts counter
+func (r *ReportPostgres) Replay(ctx context.Context, id int64, now time.Time) error {
+	query := `UPDATE finance.reports_outbox SET status = $1, attempts = 0, next_attempt_at = $2 WHERE id = $3 AND status = $4`
+	commandTag, err := r.conn.Exec(ctx, query, model.ReportPending, now, id, model.ReportDead)
+	if err != nil {
+		return fmt.Errorf("repository.Outbox, replay report error: %v", err)
+	}
+	if commandTag.RowsAffected() != 1 {
+		return ReportNotFoundErr
+	}
+	return nil
+}
+
+func (r *ReportPostgres) query(ctx context.Context, query string, args ...interface{}) ([]*model.Report, error) {
+	rows, err := r.conn.Query(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("repository.Outbox, query reports error: %v", err)
+	}
+	defer rows.Close()
+
+	reports := make([]*model.Report, 0)
+	for rows.Next() {
+		var report model.Report
+		err = rows.Scan(&report.ID, &report.Username, &report.Period, &report.PeriodKey, &report.Text, &report.Status, &report.Attempts,
+			&report.LastError, &report.LastAttemptAt, &report.NextAttemptAt, &report.CreatedAt, &report.DeliveredAt)
+		if err != nil {
+			return nil, fmt.Errorf("repository.Outbox, scan report error: %v", err)
+		}
+		reports = append(reports, &report)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("repository.Outbox, rows error: %v", err)
+	}
+	return reports, nil
+}
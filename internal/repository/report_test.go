@@ -0,0 +1,215 @@
+package repository
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/chucky-1/finance/internal/model"
+	"github.com/stretchr/testify/require"
+)
+
+// createReportUser creates the user of the reports, reports of unknown users aren't added
+func createReportUser(ctx context.Context, t *testing.T) {
+	require.NoError(t, authRepo.Create(ctx, &model.User{Username: "user", Country: "Belarus", Timezone: "Europe/Minsk"}))
+}
+
+func TestReportPostgres_AddGetDueMarkDelivered(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	defer func() {
+		_, err := postgresPool.Exec(ctx, `TRUNCATE TABLE finance.reports_outbox, finance.reports_issued, finance.users CASCADE`)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}()
+
+	createReportUser(ctx, t)
+	reportRepo := NewReportPostgres(postgresPool)
+	now := time.Now().UTC()
+	report := model.Report{
+		Username:      "user",
+		Period:        "day",
+		PeriodKey:     "2023-06-28",
+		Text:          "report",
+		NextAttemptAt: now.Add(-time.Minute),
+	}
+	err := reportRepo.Add(ctx, &report)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	reports, err := reportRepo.GetDue(ctx, now, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	require.Equal(t, 1, len(reports))
+	require.Equal(t, report.ID, reports[0].ID)
+	require.Equal(t, report.Text, reports[0].Text)
+
+	err = reportRepo.MarkDelivered(ctx, report.ID, now)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	reports, err = reportRepo.GetDue(ctx, now, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	require.Equal(t, 0, len(reports))
+}
+
+func TestReportPostgres_MarkFailedReplay(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	defer func() {
+		_, err := postgresPool.Exec(ctx, `TRUNCATE TABLE finance.reports_outbox, finance.reports_issued, finance.users CASCADE`)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}()
+
+	createReportUser(ctx, t)
+	reportRepo := NewReportPostgres(postgresPool)
+	now := time.Now().UTC()
+	report := model.Report{
+		Username:      "user",
+		Period:        "month",
+		PeriodKey:     "2023-06",
+		Text:          "report",
+		NextAttemptAt: now,
+	}
+	err := reportRepo.Add(ctx, &report)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = reportRepo.MarkFailed(ctx, report.ID, "telegram is unavailable", now, now.Add(time.Minute), true)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	dead, err := reportRepo.GetDead(ctx, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	require.Equal(t, 1, len(dead))
+	require.Equal(t, 1, dead[0].Attempts)
+	require.Equal(t, "telegram is unavailable", dead[0].LastError)
+	require.NotNil(t, dead[0].LastAttemptAt)
+	require.WithinDuration(t, now, *dead[0].LastAttemptAt, time.Millisecond)
+
+	err = reportRepo.Replay(ctx, report.ID, now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = reportRepo.Replay(ctx, report.ID, now)
+	require.Equal(t, ReportNotFoundErr, err)
+
+	reports, err := reportRepo.GetDue(ctx, now, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	require.Equal(t, 1, len(reports))
+	require.Equal(t, 0, reports[0].Attempts)
+}
+
+func TestReportPostgres_MarkSkipped(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	defer func() {
+		_, err := postgresPool.Exec(ctx, `TRUNCATE TABLE finance.reports_outbox, finance.reports_issued, finance.users CASCADE`)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}()
+
+	createReportUser(ctx, t)
+	reportRepo := NewReportPostgres(postgresPool)
+	now := time.Now().UTC()
+	report := model.Report{
+		Username:      "user",
+		Period:        "day",
+		PeriodKey:     "2023-06-28",
+		Text:          "report",
+		NextAttemptAt: now,
+	}
+	err := reportRepo.Add(ctx, &report)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = reportRepo.MarkSkipped(ctx, report.ID, "user didn't subscribe on reports")
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = reportRepo.MarkSkipped(ctx, report.ID, "user didn't subscribe on reports")
+	require.Equal(t, ReportNotFoundErr, err)
+
+	var status, lastError string
+	var deliveredAt *time.Time
+	err = postgresPool.QueryRow(ctx, `SELECT status, last_error, delivered_at FROM finance.reports_outbox WHERE id = $1`, report.ID).
+		Scan(&status, &lastError, &deliveredAt)
+	if err != nil {
+		t.Fatal(err)
+	}
+	require.Equal(t, model.ReportSkipped, status)
+	require.Equal(t, "user didn't subscribe on reports", lastError)
+	require.Nil(t, deliveredAt)
+
+	reports, err := reportRepo.GetDue(ctx, now, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	require.Empty(t, reports)
+}
+
+func TestReportPostgres_AddIssuedOnce(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	defer func() {
+		_, err := postgresPool.Exec(ctx, `TRUNCATE TABLE finance.reports_outbox, finance.reports_issued, finance.users CASCADE`)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}()
+
+	createReportUser(ctx, t)
+	reportRepo := NewReportPostgres(postgresPool)
+	report := model.Report{
+		Username:      "user",
+		Period:        "day",
+		PeriodKey:     "2023-06-28",
+		Text:          "report",
+		NextAttemptAt: time.Now().UTC(),
+	}
+
+	issued, err := reportRepo.IsIssued(ctx, report.Username, report.Period, report.PeriodKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	require.False(t, issued)
+
+	err = reportRepo.Add(ctx, &report)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = reportRepo.Add(ctx, &report)
+	require.Equal(t, ReportAlreadyIssuedErr, err)
+
+	unknown := report
+	unknown.Username = "unknown"
+	require.Equal(t, ReportUserNotFoundErr, reportRepo.Add(ctx, &unknown))
+
+	issued, err = reportRepo.IsIssued(ctx, report.Username, report.Period, report.PeriodKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	require.True(t, issued)
+
+	reports, err := reportRepo.GetDue(ctx, time.Now().UTC(), 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	require.Equal(t, 1, len(reports))
+}
@@ -0,0 +1,47 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"github.com/jackc/pgx/v4"
+	"github.com/jackc/pgx/v4/pgxpool"
+	"time"
+)
+
+// Scheduler keeps the last processed tick of schedulers, so missed ticks can be replayed after downtime
+type Scheduler interface {
+	GetLastTick(ctx context.Context, name string) (time.Time, error)
+	SetLastTick(ctx context.Context, name string, tick time.Time) error
+}
+
+type SchedulerPostgres struct {
+	conn *pgxpool.Pool
+}
+
+func NewSchedulerPostgres(conn *pgxpool.Pool) *SchedulerPostgres {
+	return &SchedulerPostgres{
+		conn: conn,
+	}
+}
+
+// GetLastTick returns zero time if the scheduler has never ticked
+func (s *SchedulerPostgres) GetLastTick(ctx context.Context, name string) (time.Time, error) {
+	query := `SELECT last_tick FROM finance.scheduler WHERE name=$1`
+	var lastTick time.Time
+	err := s.conn.QueryRow(ctx, query, name).Scan(&lastTick)
+	if err != nil && err != pgx.ErrNoRows {
+		return time.Time{}, fmt.Errorf("repository.Scheduler, get last tick error: %v", err)
+	} else if err == pgx.ErrNoRows {
+		return time.Time{}, nil
+	}
+	return lastTick.UTC(), nil
+}
+
+func (s *SchedulerPostgres) SetLastTick(ctx context.Context, name string, tick time.Time) error {
+	query := `INSERT INTO finance.scheduler (name, last_tick) VALUES ($1, $2) ON CONFLICT (name) DO UPDATE SET last_tick = excluded.last_tick`
+	_, err := s.conn.Exec(ctx, query, name, tick)
+	if err != nil {
+		return fmt.Errorf("repository.Scheduler, set last tick error: %v", err)
+	}
+	return nil
+}
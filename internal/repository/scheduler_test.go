@@ -0,0 +1,41 @@
+package repository
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestSchedulerPostgres_SetGetLastTick(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	defer func() {
+		_, err := postgresPool.Exec(ctx, `TRUNCATE TABLE finance.scheduler`)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}()
+
+	schedulerRepo := NewSchedulerPostgres(postgresPool)
+
+	lastTick, err := schedulerRepo.GetLastTick(ctx, "reports")
+	if err != nil {
+		t.Fatal(err)
+	}
+	require.True(t, lastTick.IsZero())
+
+	tick := time.Date(2023, 6, 28, 15, 30, 0, 0, time.UTC)
+	for _, tick = range []time.Time{tick, tick.Add(30 * time.Minute)} {
+		if err = schedulerRepo.SetLastTick(ctx, "reports", tick); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	lastTick, err = schedulerRepo.GetLastTick(ctx, "reports")
+	if err != nil {
+		t.Fatal(err)
+	}
+	require.Equal(t, tick, lastTick)
+}
@@ -0,0 +1,112 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"github.com/chucky-1/finance/internal/model"
+	"github.com/jackc/pgx/v4/pgxpool"
+	"time"
+)
+
+type Session interface {
+	// Create binds the chat to the user, the previous session of the chat is replaced
+	Create(ctx context.Context, session *model.Session) error
+	GetAll(ctx context.Context, username string) ([]*model.Session, error)
+	// GetActive returns sessions of all users seen after the time with timezones of the users
+	GetActive(ctx context.Context, since time.Time) ([]*model.Session, error)
+	// Touch saves the activity of the session, it returns false if the user doesn't have a session in the chat
+	Touch(ctx context.Context, username string, chatID int64, now time.Time) (bool, error)
+	// Exists returns false if the user doesn't have a session in the chat
+	Exists(ctx context.Context, username string, chatID int64) (bool, error)
+	// Delete returns false if the user doesn't have a session in the chat
+	Delete(ctx context.Context, username string, chatID int64) (bool, error)
+	// DeleteIdle deletes sessions which weren't seen since the time and returns how many were deleted
+	DeleteIdle(ctx context.Context, before time.Time) (int64, error)
+}
+
+type SessionPostgres struct {
+	conn *pgxpool.Pool
+}
+
+func NewSessionPostgres(conn *pgxpool.Pool) *SessionPostgres {
+	return &SessionPostgres{
+		conn: conn,
+	}
+}
+
+func (s *SessionPostgres) Create(ctx context.Context, session *model.Session) error {
+	query := `INSERT INTO finance.sessions (chat_id, username, created_at, last_seen_at) VALUES ($1, $2, $3, $4)
+		ON CONFLICT (chat_id) DO UPDATE SET username = $2, created_at = $3, last_seen_at = $4`
+	_, err := s.conn.Exec(ctx, query, session.ChatID, session.Username, session.CreatedAt, session.LastSeenAt)
+	if err != nil {
+		return fmt.Errorf("repository.Session, create session error: %v", err)
+	}
+	return nil
+}
+
+func (s *SessionPostgres) GetAll(ctx context.Context, username string) ([]*model.Session, error) {
+	query := `SELECT chat_id, username, created_at, last_seen_at, '' FROM finance.sessions
+		WHERE username = $1 ORDER BY created_at, chat_id`
+	return s.query(ctx, query, username)
+}
+
+func (s *SessionPostgres) GetActive(ctx context.Context, since time.Time) ([]*model.Session, error) {
+	query := `SELECT s.chat_id, s.username, s.created_at, s.last_seen_at, u.timezone FROM finance.sessions s
+		JOIN finance.users u ON u.username = s.username WHERE s.last_seen_at >= $1 ORDER BY s.chat_id`
+	return s.query(ctx, query, since)
+}
+
+func (s *SessionPostgres) query(ctx context.Context, query string, args ...interface{}) ([]*model.Session, error) {
+	rows, err := s.conn.Query(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("repository.Session, get sessions error: %v", err)
+	}
+	defer rows.Close()
+
+	sessions := make([]*model.Session, 0)
+	for rows.Next() {
+		var session model.Session
+		if err = rows.Scan(&session.ChatID, &session.Username, &session.CreatedAt, &session.LastSeenAt, &session.Timezone); err != nil {
+			return nil, fmt.Errorf("repository.Session, scan session error: %v", err)
+		}
+		sessions = append(sessions, &session)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("repository.Session, rows error: %v", err)
+	}
+	return sessions, nil
+}
+
+func (s *SessionPostgres) Touch(ctx context.Context, username string, chatID int64, now time.Time) (bool, error) {
+	commandTag, err := s.conn.Exec(ctx, `UPDATE finance.sessions SET last_seen_at = $3 WHERE username = $1 AND chat_id = $2`,
+		username, chatID, now)
+	if err != nil {
+		return false, fmt.Errorf("repository.Session, touch session error: %v", err)
+	}
+	return commandTag.RowsAffected() == 1, nil
+}
+
+func (s *SessionPostgres) Exists(ctx context.Context, username string, chatID int64) (bool, error) {
+	query := `SELECT EXISTS(SELECT 1 FROM finance.sessions WHERE username = $1 AND chat_id = $2)`
+	var exists bool
+	if err := s.conn.QueryRow(ctx, query, username, chatID).Scan(&exists); err != nil {
+		return false, fmt.Errorf("repository.Session, session exists error: %v", err)
+	}
+	return exists, nil
+}
+
+func (s *SessionPostgres) Delete(ctx context.Context, username string, chatID int64) (bool, error) {
+	commandTag, err := s.conn.Exec(ctx, `DELETE FROM finance.sessions WHERE username = $1 AND chat_id = $2`, username, chatID)
+	if err != nil {
+		return false, fmt.Errorf("repository.Session, delete session error: %v", err)
+	}
+	return commandTag.RowsAffected() == 1, nil
+}
+
+func (s *SessionPostgres) DeleteIdle(ctx context.Context, before time.Time) (int64, error) {
+	commandTag, err := s.conn.Exec(ctx, `DELETE FROM finance.sessions WHERE last_seen_at < $1`, before)
+	if err != nil {
+		return 0, fmt.Errorf("repository.Session, delete idle sessions error: %v", err)
+	}
+	return commandTag.RowsAffected(), nil
+}
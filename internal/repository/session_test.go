@@ -0,0 +1,69 @@
+package repository
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/chucky-1/finance/internal/model"
+)
+
+func TestSessionPostgres(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	defer func() {
+		_, err := postgresPool.Exec(ctx, `TRUNCATE TABLE finance.users CASCADE`)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}()
+
+	require.NoError(t, authRepo.Create(ctx, &model.User{Username: "dima", Password: "secret", Country: "Belarus", Timezone: "Europe/Minsk"}))
+	sessionRepo := NewSessionPostgres(postgresPool)
+	now := time.Now().UTC().Truncate(time.Millisecond)
+
+	phone := &model.Session{ChatID: 1, Username: "dima", CreatedAt: now.Add(-time.Hour), LastSeenAt: now.Add(-time.Hour)}
+	laptop := &model.Session{ChatID: 2, Username: "dima", CreatedAt: now, LastSeenAt: now}
+	require.NoError(t, sessionRepo.Create(ctx, phone))
+	require.NoError(t, sessionRepo.Create(ctx, laptop))
+
+	sessions, err := sessionRepo.GetAll(ctx, "dima")
+	require.NoError(t, err)
+	require.Len(t, sessions, 2)
+	require.Equal(t, int64(1), sessions[0].ChatID)
+	require.True(t, now.Equal(sessions[1].LastSeenAt))
+
+	ok, err := sessionRepo.Touch(ctx, "dima", 1, now.Add(time.Minute))
+	require.NoError(t, err)
+	require.True(t, ok)
+	ok, err = sessionRepo.Touch(ctx, "anna", 2, now.Add(time.Minute))
+	require.NoError(t, err)
+	require.False(t, ok)
+	ok, err = sessionRepo.Exists(ctx, "dima", 2)
+	require.NoError(t, err)
+	require.True(t, ok)
+	sessions, err = sessionRepo.GetActive(ctx, now.Add(time.Second))
+	require.NoError(t, err)
+	require.Len(t, sessions, 1)
+	require.Equal(t, int64(1), sessions[0].ChatID)
+	require.Equal(t, "Europe/Minsk", sessions[0].Timezone)
+
+	deleted, err := sessionRepo.DeleteIdle(ctx, now.Add(time.Second))
+	require.NoError(t, err)
+	require.Equal(t, int64(1), deleted)
+
+	ok, err = sessionRepo.Delete(ctx, "anna", 1)
+	require.NoError(t, err)
+	require.False(t, ok)
+	ok, err = sessionRepo.Delete(ctx, "dima", 1)
+	require.NoError(t, err)
+	require.True(t, ok)
+	sessions, err = sessionRepo.GetAll(ctx, "dima")
+	require.NoError(t, err)
+	require.Empty(t, sessions)
+	ok, err = sessionRepo.Exists(ctx, "dima", 2)
+	require.NoError(t, err)
+	require.False(t, ok)
+}
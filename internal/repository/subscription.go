@@ -0,0 +1,58 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"github.com/chucky-1/finance/internal/model"
+	"github.com/jackc/pgx/v4"
+	"github.com/jackc/pgx/v4/pgxpool"
+)
+
+type Subscription interface {
+	Set(ctx context.Context, subscription *model.Subscription) error
+	Get(ctx context.Context, username, period string) (*model.Subscription, error)
+	Delete(ctx context.Context, username, period string) error
+}
+
+type SubscriptionPostgres struct {
+	conn *pgxpool.Pool
+}
+
+func NewSubscriptionPostgres(conn *pgxpool.Pool) *SubscriptionPostgres {
+	return &SubscriptionPostgres{
+		conn: conn,
+	}
+}
+
+// Set creates the subscription or moves it to another chat
+func (s *SubscriptionPostgres) Set(ctx context.Context, subscription *model.Subscription) error {
+	query := `INSERT INTO finance.report_subscriptions (username, period, chat_id) VALUES ($1, $2, $3)
+		ON CONFLICT (username, period) DO UPDATE SET chat_id = excluded.chat_id`
+	_, err := s.conn.Exec(ctx, query, subscription.Username, subscription.Period, subscription.ChatID)
+	if err != nil {
+		return fmt.Errorf("repository.Subscription, set subscription error: %v", err)
+	}
+	return nil
+}
+
+// Get returns nil if the user isn't subscribed
+func (s *SubscriptionPostgres) Get(ctx context.Context, username, period string) (*model.Subscription, error) {
+	query := `SELECT username, period, chat_id FROM finance.report_subscriptions WHERE username=$1 AND period=$2`
+	var subscription model.Subscription
+	err := s.conn.QueryRow(ctx, query, username, period).Scan(&subscription.Username, &subscription.Period, &subscription.ChatID)
+	if err != nil && err != pgx.ErrNoRows {
+		return nil, fmt.Errorf("repository.Subscription, get subscription error: %v", err)
+	} else if err == pgx.ErrNoRows {
+		return nil, nil
+	}
+	return &subscription, nil
+}
+
+func (s *SubscriptionPostgres) Delete(ctx context.Context, username, period string) error {
+	query := `DELETE FROM finance.report_subscriptions WHERE username=$1 AND period=$2`
+	_, err := s.conn.Exec(ctx, query, username, period)
+	if err != nil {
+		return fmt.Errorf("repository.Subscription, delete subscription error: %v", err)
+	}
+	return nil
+}
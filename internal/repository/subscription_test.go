@@ -0,0 +1,54 @@
+package repository
+
+import (
+	"context"
+	"testing"
+
+	"github.com/chucky-1/finance/internal/model"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSubscriptionPostgres_SetGetDelete(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	defer func() {
+		_, err := postgresPool.Exec(ctx, `TRUNCATE TABLE finance.report_subscriptions`)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}()
+
+	subscriptionRepo := NewSubscriptionPostgres(postgresPool)
+	subscription := model.Subscription{
+		Username: "user",
+		Period:   "day",
+		ChatID:   1,
+	}
+	err := subscriptionRepo.Set(ctx, &subscription)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// moving to another chat
+	subscription.ChatID = 2
+	err = subscriptionRepo.Set(ctx, &subscription)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s, err := subscriptionRepo.Get(ctx, subscription.Username, subscription.Period)
+	if err != nil {
+		t.Fatal(err)
+	}
+	require.Equal(t, &subscription, s)
+
+	err = subscriptionRepo.Delete(ctx, subscription.Username, subscription.Period)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s, err = subscriptionRepo.Get(ctx, subscription.Username, subscription.Period)
+	if err != nil {
+		t.Fatal(err)
+	}
+	require.Nil(t, s)
+}
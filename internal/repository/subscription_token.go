@@ -0,0 +1,48 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"github.com/jackc/pgx/v4"
+	"github.com/jackc/pgx/v4/pgxpool"
+	"time"
+)
+
+// SubscriptionToken keeps one-time tokens which bind reporter chats to users
+type SubscriptionToken interface {
+	Add(ctx context.Context, nonce, username, period string, expiresAt time.Time) error
+	// Use marks the token as used and returns its username or empty string if the token is unknown, used or expired
+	Use(ctx context.Context, nonce, period string, now time.Time) (string, error)
+}
+
+type SubscriptionTokenPostgres struct {
+	conn *pgxpool.Pool
+}
+
+func NewSubscriptionTokenPostgres(conn *pgxpool.Pool) *SubscriptionTokenPostgres {
+	return &SubscriptionTokenPostgres{
+		conn: conn,
+	}
+}
+
+func (s *SubscriptionTokenPostgres) Add(ctx context.Context, nonce, username, period string, expiresAt time.Time) error {
+	query := `INSERT INTO finance.subscription_tokens (nonce, username, period, expires_at) VALUES ($1, $2, $3, $4)`
+	_, err := s.conn.Exec(ctx, query, nonce, username, period, expiresAt)
+	if err != nil {
+		return fmt.Errorf("repository.SubscriptionToken, add token error: %v", err)
+	}
+	return nil
+}
+
+func (s *SubscriptionTokenPostgres) Use(ctx context.Context, nonce, period string, now time.Time) (string, error) {
+	query := `UPDATE finance.subscription_tokens SET used_at = $1
+		WHERE nonce = $2 AND period = $3 AND used_at IS NULL AND expires_at > $1 RETURNING username`
+	var username string
+	err := s.conn.QueryRow(ctx, query, now, nonce, period).Scan(&username)
+	if err != nil && err != pgx.ErrNoRows {
+		return "", fmt.Errorf("repository.SubscriptionToken, use token error: %v", err)
+	} else if err == pgx.ErrNoRows {
+		return "", nil
+	}
+	return username, nil
+}
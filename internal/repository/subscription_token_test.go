@@ -0,0 +1,71 @@
+package repository
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestSubscriptionTokenPostgres_AddUse(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	defer func() {
+		_, err := postgresPool.Exec(ctx, `TRUNCATE TABLE finance.subscription_tokens`)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}()
+
+	tokenRepo := NewSubscriptionTokenPostgres(postgresPool)
+	now := time.Now().UTC()
+	err := tokenRepo.Add(ctx, "nonce", "user", "day", now.Add(time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// another period
+	username, err := tokenRepo.Use(ctx, "nonce", "month", now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	require.Equal(t, "", username)
+
+	username, err = tokenRepo.Use(ctx, "nonce", "day", now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	require.Equal(t, "user", username)
+
+	// the token is one-time
+	username, err = tokenRepo.Use(ctx, "nonce", "day", now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	require.Equal(t, "", username)
+}
+
+func TestSubscriptionTokenPostgres_UseExpired(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	defer func() {
+		_, err := postgresPool.Exec(ctx, `TRUNCATE TABLE finance.subscription_tokens`)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}()
+
+	tokenRepo := NewSubscriptionTokenPostgres(postgresPool)
+	now := time.Now().UTC()
+	err := tokenRepo.Add(ctx, "nonce", "user", "day", now.Add(-time.Minute))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	username, err := tokenRepo.Use(ctx, "nonce", "day", now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	require.Equal(t, "", username)
+}
@@ -7,15 +7,42 @@ import (
 	"github.com/chucky-1/finance/internal/model"
 	"github.com/jackc/pgx/v4"
 	"github.com/jackc/pgx/v4/pgxpool"
+	"github.com/sirupsen/logrus"
 )
 
-var DuplicateUserErr = errors.New("user with this username already exists")
+var (
+	DuplicateUserErr        = errors.New("user with this username already exists")
+	TelegramUserIsLinkedErr = errors.New("telegram user is linked to another account")
+)
 
 //go:generate mockery --name=User
 
 type User interface {
 	Create(ctx context.Context, user *model.User) error
 	Get(ctx context.Context, username string) (*model.User, error)
+	GetAll(ctx context.Context) ([]*model.User, error)
+	// GetByTelegramID returns nil if no account is linked to the telegram user
+	GetByTelegramID(ctx context.Context, tgUserID int64) (*model.User, error)
+	// SetTelegramID returns TelegramUserIsLinkedErr if the telegram user is linked to another account
+	SetTelegramID(ctx context.Context, username string, tgUserID int64) error
+	UpdatePassword(ctx context.Context, username, password string) (bool, error)
+	// UpdateTimezone returns false if there is no such user
+	UpdateTimezone(ctx context.Context, username, country, timezone string) (bool, error)
+	// UpdateReportTime returns false if there is no such user
+	UpdateReportTime(ctx context.Context, username string, reportTime model.ReportTime) (bool, error)
+	// UpdateMonthStart returns false if there is no such user
+	UpdateMonthStart(ctx context.Context, username string, monthStart int) (bool, error)
+	// UpdateLanguage returns false if there is no such user
+	UpdateLanguage(ctx context.Context, username, language string) (bool, error)
+	SetChat(ctx context.Context, username string, chatID int64) error
+	Delete(ctx context.Context, username string) (bool, error)
+}
+
+const userColumns = `username, password, country, timezone, chat_id, coalesce(tg_user_id, 0), daily_report_time, monthly_report_time, month_start, language`
+
+func userFields(user *model.User) []interface{} {
+	return []interface{}{&user.Username, &user.Password, &user.Country, &user.Timezone, &user.ChatID, &user.TGUserID,
+		&user.ReportTime.Daily, &user.ReportTime.Monthly, &user.MonthStart, &user.Language}
 }
 
 type Postgres struct {
@@ -29,8 +56,10 @@ func NewPostgres(conn *pgxpool.Pool) *Postgres {
 }
 
 func (u *Postgres) Create(ctx context.Context, user *model.User) error {
-	query := `INSERT INTO finance.users (username, password, country, timezone) VALUES ($1, $2, $3, $4) ON CONFLICT DO NOTHING`
-	commandTag, err := u.conn.Exec(ctx, query, user.Username, user.Password, user.Country, user.Timezone)
+	query := `INSERT INTO finance.users (username, password, country, timezone, chat_id, tg_user_id, daily_report_time, monthly_report_time, month_start,
+		language) VALUES ($1, $2, $3, $4, $5, NULLIF($6, 0), $7, $8, $9, $10) ON CONFLICT DO NOTHING`
+	commandTag, err := u.conn.Exec(ctx, query, user.Username, user.Password, user.Country, user.Timezone, user.ChatID, user.TGUserID,
+		user.ReportTime.Daily, user.ReportTime.Monthly, user.MonthStart, user.Language)
 	if err != nil {
 		return fmt.Errorf("repository.User, create user error: %v", err)
 	}
@@ -41,9 +70,9 @@ func (u *Postgres) Create(ctx context.Context, user *model.User) error {
 }
 
 func (u *Postgres) Get(ctx context.Context, username string) (*model.User, error) {
-	query := `SELECT username, password, country, timezone FROM finance.users WHERE username=$1`
+	query := `SELECT ` + userColumns + ` FROM finance.users WHERE username=$1`
 	var user model.User
-	err := u.conn.QueryRow(ctx, query, username).Scan(&user.Username, &user.Password, &user.Country, &user.Timezone)
+	err := u.conn.QueryRow(ctx, query, username).Scan(userFields(&user)...)
 	if err != nil && err != pgx.ErrNoRows {
 		return nil, fmt.Errorf("repository.User, get user error: %v", err)
 	} else if err == pgx.ErrNoRows {
@@ -51,3 +80,139 @@ func (u *Postgres) Get(ctx context.Context, username string) (*model.User, error
 	}
 	return &user, nil
 }
+
+func (u *Postgres) GetByTelegramID(ctx context.Context, tgUserID int64) (*model.User, error) {
+	query := `SELECT ` + userColumns + ` FROM finance.users WHERE tg_user_id=$1`
+	var user model.User
+	err := u.conn.QueryRow(ctx, query, tgUserID).Scan(userFields(&user)...)
+	if err == pgx.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("repository.User, get user by telegram id error: %v", err)
+	}
+	return &user, nil
+}
+
+func (u *Postgres) SetTelegramID(ctx context.Context, username string, tgUserID int64) error {
+	query := `UPDATE finance.users SET tg_user_id=$2
+		WHERE username=$1 AND NOT EXISTS (SELECT 1 FROM finance.users WHERE tg_user_id=$2 AND username<>$1)`
+	commandTag, err := u.conn.Exec(ctx, query, username, tgUserID)
+	if err != nil {
+		return fmt.Errorf("repository.User, set telegram id error: %v", err)
+	}
+	if commandTag.RowsAffected() != 1 {
+		return TelegramUserIsLinkedErr
+	}
+	return nil
+}
+
+func (u *Postgres) GetAll(ctx context.Context) ([]*model.User, error) {
+	query := `SELECT ` + userColumns + ` FROM finance.users ORDER BY username`
+	rows, err := u.conn.Query(ctx, query)
+	if err != nil {
+		return nil, fmt.Errorf("repository.User, get all users error: %v", err)
+	}
+	defer rows.Close()
+
+	users := make([]*model.User, 0)
+	for rows.Next() {
+		var user model.User
+		if err = rows.Scan(userFields(&user)...); err != nil {
+			return nil, fmt.Errorf("repository.User, scan user error: %v", err)
+		}
+		users = append(users, &user)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("repository.User, rows error: %v", err)
+	}
+	return users, nil
+}
+
+// UpdatePassword returns false if there is no such user
+func (u *Postgres) UpdatePassword(ctx context.Context, username, password string) (bool, error) {
+	query := `UPDATE finance.users SET password=$2 WHERE username=$1`
+	commandTag, err := u.conn.Exec(ctx, query, username, password)
+	if err != nil {
+		return false, fmt.Errorf("repository.User, update password error: %v", err)
+	}
+	return commandTag.RowsAffected() == 1, nil
+}
+
+func (u *Postgres) UpdateTimezone(ctx context.Context, username, country, timezone string) (bool, error) {
+	query := `UPDATE finance.users SET country=$2, timezone=$3 WHERE username=$1`
+	commandTag, err := u.conn.Exec(ctx, query, username, country, timezone)
+	if err != nil {
+		return false, fmt.Errorf("repository.User, update timezone error: %v", err)
+	}
+	return commandTag.RowsAffected() == 1, nil
+}
+
+func (u *Postgres) UpdateReportTime(ctx context.Context, username string, reportTime model.ReportTime) (bool, error) {
+	query := `UPDATE finance.users SET daily_report_time=$2, monthly_report_time=$3 WHERE username=$1`
+	commandTag, err := u.conn.Exec(ctx, query, username, reportTime.Daily, reportTime.Monthly)
+	if err != nil {
+		return false, fmt.Errorf("repository.User, update report time error: %v", err)
+	}
+	return commandTag.RowsAffected() == 1, nil
+}
+
+func (u *Postgres) UpdateMonthStart(ctx context.Context, username string, monthStart int) (bool, error) {
+	query := `UPDATE finance.users SET month_start=$2 WHERE username=$1`
+	commandTag, err := u.conn.Exec(ctx, query, username, monthStart)
+	if err != nil {
+		return false, fmt.Errorf("repository.User, update month start error: %v", err)
+	}
+	return commandTag.RowsAffected() == 1, nil
+}
+
+func (u *Postgres) UpdateLanguage(ctx context.Context, username, language string) (bool, error) {
+	query := `UPDATE finance.users SET language=$2 WHERE username=$1`
+	commandTag, err := u.conn.Exec(ctx, query, username, language)
+	if err != nil {
+		return false, fmt.Errorf("repository.User, update language error: %v", err)
+	}
+	return commandTag.RowsAffected() == 1, nil
+}
+
+func (u *Postgres) SetChat(ctx context.Context, username string, chatID int64) error {
+	query := `UPDATE finance.users SET chat_id=$2 WHERE username=$1`
+	if _, err := u.conn.Exec(ctx, query, username, chatID); err != nil {
+		return fmt.Errorf("repository.User, set chat error: %v", err)
+	}
+	return nil
+}
+
+// Delete deletes the user with subscriptions and reports, api tokens, sessions and ledgers are deleted by foreign keys.
+// It returns false if there is no such user
+func (u *Postgres) Delete(ctx context.Context, username string) (bool, error) {
+	tx, err := u.conn.Begin(ctx)
+	if err != nil {
+		return false, fmt.Errorf("repository.User, begin transaction error: %v", err)
+	}
+	defer func() {
+		if err = tx.Rollback(ctx); err != nil && err != pgx.ErrTxClosed {
+			logrus.Errorf("repository.User, rollback error: %v", err)
+		}
+	}()
+
+	for _, table := range []string{"report_subscriptions", "subscription_tokens", "reports_outbox", "reports_issued"} {
+		if _, err = tx.Exec(ctx, fmt.Sprintf(`DELETE FROM finance.%s WHERE username=$1`, table), username); err != nil {
+			return false, fmt.Errorf("repository.User, delete from %s error: %v", table, err)
+		}
+	}
+	if _, err = tx.Exec(ctx, `DELETE FROM finance.login_attempts WHERE key='user:' || $1`, username); err != nil {
+		return false, fmt.Errorf("repository.User, delete login attempts error: %v", err)
+	}
+	commandTag, err := tx.Exec(ctx, `DELETE FROM finance.users WHERE username=$1`, username)
+	if err != nil {
+		return false, fmt.Errorf("repository.User, delete user error: %v", err)
+	}
+	if commandTag.RowsAffected() != 1 {
+		return false, nil
+	}
+	if err = tx.Commit(ctx); err != nil {
+		return false, fmt.Errorf("repository.User, commit error: %v", err)
+	}
+	return true, nil
+}
@@ -29,7 +29,7 @@ func TestUserPostgres_CreateGet(t *testing.T) {
 		Username: "user",
 		Password: "secret",
 		Country:  "Belarus",
-		Timezone: 3 * time.Hour,
+		Timezone: "Europe/Minsk",
 	}
 	err := authRepo.Create(ctx, &user)
 	if err != nil {
@@ -42,7 +42,7 @@ func TestUserPostgres_CreateGet(t *testing.T) {
 	require.Equal(t, &user, u)
 }
 
-func TestUserPostgres_CreateGetTimezoneWith30Minute(t *testing.T) {
+func TestUserPostgres_CreateGetTimezoneWith30MinuteOffset(t *testing.T) {
 	ctx, cancel := context.WithCancel(context.Background())
 	defer cancel()
 	defer func() {
@@ -56,7 +56,7 @@ func TestUserPostgres_CreateGetTimezoneWith30Minute(t *testing.T) {
 		Username: "user",
 		Password: "secret",
 		Country:  "Belarus",
-		Timezone: 3*time.Hour + 30*time.Minute,
+		Timezone: "Asia/Tehran",
 	}
 	err := authRepo.Create(ctx, &user)
 	if err != nil {
@@ -83,7 +83,7 @@ func TestUserPostgres_CreateSetDuplicate(t *testing.T) {
 		Username: "user",
 		Password: "secret",
 		Country:  "Belarus",
-		Timezone: 3 * time.Hour,
+		Timezone: "Europe/Minsk",
 	}
 	err := authRepo.Create(ctx, &user)
 	if err != nil {
@@ -93,3 +93,199 @@ func TestUserPostgres_CreateSetDuplicate(t *testing.T) {
 	err = authRepo.Create(ctx, &user)
 	require.Error(t, DuplicateUserErr)
 }
+
+func TestUserPostgres_CreateWithColon(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	// the username would collide with the key of the ledger in mongo
+	err := authRepo.Create(ctx, &model.User{
+		Username: model.LedgerKey(1),
+		Password: "secret",
+		Country:  "Belarus",
+		Timezone: "Europe/Minsk",
+	})
+	require.Error(t, err)
+
+	u, err := authRepo.Get(ctx, model.LedgerKey(1))
+	require.NoError(t, err)
+	require.Nil(t, u)
+}
+
+func TestUserPostgres_GetAll(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	defer func() {
+		_, err := postgresPool.Exec(ctx, `TRUNCATE TABLE finance.users`)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}()
+
+	users := []*model.User{
+		{
+			Username: "Dima",
+			Password: "secret",
+			Country:  "Belarus",
+			Timezone: "Europe/Minsk",
+		},
+		{
+			Username: "Liza",
+			Password: "secret",
+			Country:  "Poland",
+			Timezone: "Europe/Warsaw",
+		},
+	}
+	for _, user := range users {
+		if err := authRepo.Create(ctx, user); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	all, err := authRepo.GetAll(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	require.Equal(t, users, all)
+}
+
+func TestUserPostgres_UpdatePasswordDelete(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	defer func() {
+		_, err := postgresPool.Exec(ctx, `TRUNCATE TABLE finance.users CASCADE`)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}()
+
+	user := model.User{
+		Username: "user",
+		Password: "secret",
+		Country:  "Belarus",
+		Timezone: "Europe/Minsk",
+	}
+	require.NoError(t, authRepo.Create(ctx, &user))
+
+	ok, err := authRepo.UpdatePassword(ctx, user.Username, "newSecret")
+	require.NoError(t, err)
+	require.True(t, ok)
+	u, err := authRepo.Get(ctx, user.Username)
+	require.NoError(t, err)
+	require.Equal(t, "newSecret", u.Password)
+
+	ok, err = authRepo.UpdatePassword(ctx, "unknown", "newSecret")
+	require.NoError(t, err)
+	require.False(t, ok)
+
+	ok, err = authRepo.UpdateTimezone(ctx, user.Username, "Georgia", "Asia/Tbilisi")
+	require.NoError(t, err)
+	require.True(t, ok)
+	u, err = authRepo.Get(ctx, user.Username)
+	require.NoError(t, err)
+	require.Equal(t, "Georgia", u.Country)
+	require.Equal(t, "Asia/Tbilisi", u.Timezone)
+
+	ok, err = authRepo.UpdateTimezone(ctx, "unknown", "Georgia", "Asia/Tbilisi")
+	require.NoError(t, err)
+	require.False(t, ok)
+
+	reportTime := model.ReportTime{Daily: 21*time.Hour + 30*time.Minute, Monthly: 33 * time.Hour}
+	ok, err = authRepo.UpdateReportTime(ctx, user.Username, reportTime)
+	require.NoError(t, err)
+	require.True(t, ok)
+	u, err = authRepo.Get(ctx, user.Username)
+	require.NoError(t, err)
+	require.Equal(t, reportTime, u.ReportTime)
+
+	ok, err = authRepo.UpdateReportTime(ctx, "unknown", reportTime)
+	require.NoError(t, err)
+	require.False(t, ok)
+
+	ok, err = authRepo.UpdateMonthStart(ctx, user.Username, 10)
+	require.NoError(t, err)
+	require.True(t, ok)
+	u, err = authRepo.Get(ctx, user.Username)
+	require.NoError(t, err)
+	require.Equal(t, 10, u.MonthStart)
+
+	ok, err = authRepo.UpdateMonthStart(ctx, "unknown", 10)
+	require.NoError(t, err)
+	require.False(t, ok)
+
+	ok, err = authRepo.UpdateLanguage(ctx, user.Username, "pl")
+	require.NoError(t, err)
+	require.True(t, ok)
+	u, err = authRepo.Get(ctx, user.Username)
+	require.NoError(t, err)
+	require.Equal(t, "pl", u.Language)
+
+	ok, err = authRepo.UpdateLanguage(ctx, "unknown", "pl")
+	require.NoError(t, err)
+	require.False(t, ok)
+
+	// rows of the user without foreign keys are deleted with the user
+	_, err = postgresPool.Exec(ctx, `INSERT INTO finance.report_subscriptions (username, period, chat_id) VALUES ($1, 'day', 1)`, user.Username)
+	require.NoError(t, err)
+	_, err = postgresPool.Exec(ctx, `INSERT INTO finance.subscription_tokens (nonce, username, period, expires_at) VALUES ('nonce', $1, 'day', now())`,
+		user.Username)
+	require.NoError(t, err)
+	require.NoError(t, NewReportPostgres(postgresPool).Add(ctx, &model.Report{Username: user.Username, Period: "day", PeriodKey: "2023-06-28",
+		NextAttemptAt: time.Now().UTC()}))
+
+	ok, err = authRepo.Delete(ctx, user.Username)
+	require.NoError(t, err)
+	require.True(t, ok)
+	u, err = authRepo.Get(ctx, user.Username)
+	require.NoError(t, err)
+	require.Nil(t, u)
+	for _, table := range []string{"report_subscriptions", "subscription_tokens", "reports_outbox", "reports_issued"} {
+		var count int
+		require.NoError(t, postgresPool.QueryRow(ctx, `SELECT count(*) FROM finance.`+table+` WHERE username=$1`, user.Username).Scan(&count))
+		require.Zero(t, count, table)
+	}
+
+	ok, err = authRepo.Delete(ctx, user.Username)
+	require.NoError(t, err)
+	require.False(t, ok)
+}
+
+func TestUserPostgres_TelegramID(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	defer func() {
+		_, err := postgresPool.Exec(ctx, `TRUNCATE TABLE finance.users CASCADE`)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}()
+
+	telegramUser := model.User{
+		Username: "tg_z",
+		Country:  "Belarus",
+		Timezone: "Europe/Minsk",
+		ChatID:   1,
+		TGUserID: 35,
+	}
+	require.NoError(t, authRepo.Create(ctx, &telegramUser))
+	user := model.User{
+		Username: "user",
+		Password: "secret",
+		Country:  "Belarus",
+		Timezone: "Europe/Minsk",
+	}
+	require.NoError(t, authRepo.Create(ctx, &user))
+
+	u, err := authRepo.GetByTelegramID(ctx, 35)
+	require.NoError(t, err)
+	require.Equal(t, &telegramUser, u)
+	u, err = authRepo.GetByTelegramID(ctx, 36)
+	require.NoError(t, err)
+	require.Nil(t, u)
+
+	require.Equal(t, TelegramUserIsLinkedErr, authRepo.SetTelegramID(ctx, user.Username, 35))
+	require.NoError(t, authRepo.SetTelegramID(ctx, user.Username, 36))
+	u, err = authRepo.GetByTelegramID(ctx, 36)
+	require.NoError(t, err)
+	require.Equal(t, user.Username, u.Username)
+}
@@ -0,0 +1,91 @@
+package service
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"github.com/chucky-1/finance/internal/model"
+	"github.com/chucky-1/finance/internal/repository"
+	"strings"
+	"time"
+)
+
+const (
+	// apiTokenPrefix makes tokens recognizable, e.g. by secret scanners
+	apiTokenPrefix = "fin_"
+	apiTokenLength = 32
+)
+
+var InvalidAPITokenErr = errors.New("api token is invalid or revoked")
+
+type APIToken struct {
+	repo  repository.APIToken
+	users repository.User
+}
+
+func NewAPIToken(repo repository.APIToken, users repository.User) *APIToken {
+	return &APIToken{
+		repo:  repo,
+		users: users,
+	}
+}
+
+// Create returns the token, it can't be shown again because only its hash is stored
+func (a *APIToken) Create(ctx context.Context, username, name, scope string) (string, error) {
+	random := make([]byte, apiTokenLength)
+	if _, err := rand.Read(random); err != nil {
+		return "", fmt.Errorf("couldn't generate api token: %v", err)
+	}
+	token := apiTokenPrefix + base64.RawURLEncoding.EncodeToString(random)
+	err := a.repo.Add(ctx, &model.APIToken{
+		Username:  username,
+		Name:      name,
+		Scope:     scope,
+		CreatedAt: time.Now().UTC(),
+	}, hashAPIToken(token))
+	if err != nil {
+		return "", err
+	}
+	return token, nil
+}
+
+func (a *APIToken) List(ctx context.Context, username string) ([]*model.APIToken, error) {
+	return a.repo.GetAll(ctx, username)
+}
+
+// Revoke returns false if the user doesn't have the token
+func (a *APIToken) Revoke(ctx context.Context, username, name string) (bool, error) {
+	return a.repo.Delete(ctx, username, name)
+}
+
+// Authenticate returns the owner of the token and the token itself
+func (a *APIToken) Authenticate(ctx context.Context, token string) (*model.User, *model.APIToken, error) {
+	if !strings.HasPrefix(token, apiTokenPrefix) {
+		return nil, nil, InvalidAPITokenErr
+	}
+	apiToken, err := a.repo.Use(ctx, hashAPIToken(token), time.Now().UTC())
+	if err != nil {
+		return nil, nil, err
+	}
+	if apiToken == nil {
+		return nil, nil, InvalidAPITokenErr
+	}
+	user, err := a.users.Get(ctx, apiToken.Username)
+	if err != nil {
+		return nil, nil, err
+	}
+	if user == nil {
+		return nil, nil, InvalidAPITokenErr
+	}
+	return user, apiToken, nil
+}
+
+// hashAPIToken doesn't need a salt because tokens are random
+func hashAPIToken(token string) string {
+	hash := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(hash[:])
+}
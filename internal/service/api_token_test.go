@@ -0,0 +1,84 @@
+package service
+
+import (
+	"context"
+	"github.com/chucky-1/finance/internal/model"
+	"github.com/chucky-1/finance/internal/repository"
+	"github.com/chucky-1/finance/internal/repository/mocks"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+	"strings"
+	"testing"
+	"time"
+)
+
+type fakeAPITokens struct {
+	tokens map[string]*model.APIToken
+}
+
+func (f *fakeAPITokens) Add(_ context.Context, token *model.APIToken, hash string) error {
+	for _, t := range f.tokens {
+		if t.Username == token.Username && t.Name == token.Name {
+			return repository.DuplicateAPITokenErr
+		}
+	}
+	f.tokens[hash] = token
+	return nil
+}
+
+func (f *fakeAPITokens) GetAll(context.Context, string) ([]*model.APIToken, error) {
+	return nil, nil
+}
+
+func (f *fakeAPITokens) Delete(_ context.Context, username, name string) (bool, error) {
+	for hash, t := range f.tokens {
+		if t.Username == username && t.Name == name {
+			delete(f.tokens, hash)
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func (f *fakeAPITokens) Use(_ context.Context, hash string, now time.Time) (*model.APIToken, error) {
+	token, ok := f.tokens[hash]
+	if !ok {
+		return nil, nil
+	}
+	token.LastUsedAt = &now
+	return token, nil
+}
+
+func TestAPIToken_CreateAuthenticateRevoke(t *testing.T) {
+	ctx := context.Background()
+	userRepo := new(mocks.User)
+	user := &model.User{Username: "dima"}
+	userRepo.On("Get", mock.Anything, "dima").Return(user, nil)
+	tokenRepo := &fakeAPITokens{tokens: make(map[string]*model.APIToken)}
+	tokens := NewAPIToken(tokenRepo, userRepo)
+
+	token, err := tokens.Create(ctx, "dima", "script", model.WriteScope)
+	require.NoError(t, err)
+	require.True(t, strings.HasPrefix(token, apiTokenPrefix))
+	for hash := range tokenRepo.tokens {
+		require.NotContains(t, hash, token[len(apiTokenPrefix):])
+	}
+
+	_, err = tokens.Create(ctx, "dima", "script", model.ReadScope)
+	require.Equal(t, repository.DuplicateAPITokenErr, err)
+
+	authenticated, apiToken, err := tokens.Authenticate(ctx, token)
+	require.NoError(t, err)
+	require.Equal(t, user, authenticated)
+	require.Equal(t, model.WriteScope, apiToken.Scope)
+	require.NotNil(t, apiToken.LastUsedAt)
+
+	_, _, err = tokens.Authenticate(ctx, token+"a")
+	require.Equal(t, InvalidAPITokenErr, err)
+
+	revoked, err := tokens.Revoke(ctx, "dima", "script")
+	require.NoError(t, err)
+	require.True(t, revoked)
+	_, _, err = tokens.Authenticate(ctx, token)
+	require.Equal(t, InvalidAPITokenErr, err)
+}
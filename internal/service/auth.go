@@ -3,56 +3,283 @@ package service
 import (
 	"context"
 	"crypto/sha1"
+	"crypto/subtle"
 	"errors"
 	"fmt"
 	"github.com/chucky-1/finance/internal/model"
 	"github.com/chucky-1/finance/internal/repository"
+	"github.com/sirupsen/logrus"
+	"regexp"
+	"strconv"
+	"time"
 )
 
 var (
 	UserNotFoundErr  = errors.New("user not found")
 	WrongPasswordErr = errors.New("wrong password")
+	// TelegramLinkedErr is returned when the telegram user or the account is already linked to another one
+	TelegramLinkedErr = errors.New("telegram user or account is already linked")
+	// InvalidUsernameErr is returned when the username has other characters than latin letters, digits and _
+	InvalidUsernameErr = errors.New("username must have 3-15 latin letters, digits or _")
 )
 
+// telegramUsername is a telegram username which also fits usernames of accounts
+var telegramUsername = regexp.MustCompile(`^[a-zA-Z0-9_]{3,15}$`)
+
+// ValidUsername returns true if the username fits new accounts. Old accounts may have other characters,
+// but no colon, so usernames never collide with keys of ledgers
+func ValidUsername(username string) bool {
+	return telegramUsername.MatchString(username)
+}
+
 type Authorization interface {
 	Register(ctx context.Context, user *model.User) error
-	Login(ctx context.Context, username, password string) (*model.User, error)
+	// Login returns LoginBlockedError when there were too many failed attempts of the username or in the chat
+	Login(ctx context.Context, username, password string, chatID int64) (*model.User, error)
+	// RegisterTelegram creates the account of the telegram user without a password
+	RegisterTelegram(ctx context.Context, user *model.User) error
+	// LoginTelegram returns UserNotFoundErr if no account is linked to the telegram user
+	LoginTelegram(ctx context.Context, tgUserID, chatID int64) (*model.User, error)
+	// LinkTelegram links the account to the telegram user, so it's resumed by /start
+	LinkTelegram(ctx context.Context, username string, tgUserID int64) error
+	// ChangePassword returns WrongPasswordErr if the old password doesn't match,
+	// accounts without a password set it without the old one
+	ChangePassword(ctx context.Context, username, oldPassword, newPassword string) error
 }
 
+// Auth keeps passwords as argon2id hashes. Hashes of the old SHA-1 scheme with the global salt
+// are still verified and replaced on the next successful login
 type Auth struct {
-	repo repository.User
-	salt string
+	repo     repository.User
+	attempts repository.LoginAttempts
+	salt     string
 }
 
-func NewAuth(repo repository.User, salt string) *Auth {
+func NewAuth(repo repository.User, attempts repository.LoginAttempts, salt string) *Auth {
 	return &Auth{
-		repo: repo,
-		salt: salt,
+		repo:     repo,
+		attempts: attempts,
+		salt:     salt,
 	}
 }
 
+// Register returns InvalidUsernameErr if the username doesn't fit
 func (a *Auth) Register(ctx context.Context, user *model.User) error {
-	user.Password = a.generatePassword(user.Password)
+	if !ValidUsername(user.Username) {
+		return InvalidUsernameErr
+	}
+	hash, err := hashPassword(user.Password)
+	if err != nil {
+		return err
+	}
+	user.Password = hash
 	return a.repo.Create(ctx, user)
 }
 
-func (a *Auth) Login(ctx context.Context, username, password string) (*model.User, error) {
+// Login binds the user to the chat. Failed attempts are delayed and the account is locked after too many of them
+func (a *Auth) Login(ctx context.Context, username, password string, chatID int64) (*model.User, error) {
+	now := time.Now().UTC()
+	if err := a.checkAttempts(ctx, username, chatID, now); err != nil {
+		return nil, err
+	}
+
 	user, err := a.repo.Get(ctx, username)
 	if err != nil {
 		return nil, err
 	}
 	if user == nil {
+		if err = a.fail(ctx, nil, chatID, now); err != nil {
+			return nil, err
+		}
 		return nil, UserNotFoundErr
 	}
-	password = a.generatePassword(password)
-	if password != user.Password {
+
+	ok, needsRehash, err := a.checkPassword(user, password)
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		if err = a.fail(ctx, user, chatID, now); err != nil {
+			return nil, err
+		}
 		return nil, WrongPasswordErr
 	}
+
+	if err = a.resetAttempts(ctx, username, chatID); err != nil {
+		return nil, err
+	}
+	if needsRehash {
+		a.rehash(ctx, user, password)
+	}
+	if user.ChatID != chatID {
+		if err = a.repo.SetChat(ctx, username, chatID); err != nil {
+			return nil, err
+		}
+		user.ChatID = chatID
+	}
 	return user, nil
 }
 
-func (a *Auth) generatePassword(password string) string {
+// RegisterTelegram uses the telegram username if it fits and isn't taken, otherwise the username is made of the telegram id,
+// e.g. tg_3f8k2l1. The username of the user is set to the chosen one
+func (a *Auth) RegisterTelegram(ctx context.Context, user *model.User) error {
+	candidates := make([]string, 0, 2)
+	if ValidUsername(user.Username) {
+		candidates = append(candidates, user.Username)
+	}
+	candidates = append(candidates, "tg_"+strconv.FormatInt(user.TGUserID, 36))
+
+	user.Password = ""
+	for _, username := range candidates {
+		user.Username = username
+		err := a.repo.Create(ctx, user)
+		if err != repository.DuplicateUserErr {
+			return err
+		}
+	}
+	linked, err := a.repo.GetByTelegramID(ctx, user.TGUserID)
+	if err != nil {
+		return err
+	}
+	if linked != nil {
+		return TelegramLinkedErr
+	}
+	return repository.DuplicateUserErr
+}
+
+func (a *Auth) LoginTelegram(ctx context.Context, tgUserID, chatID int64) (*model.User, error) {
+	user, err := a.repo.GetByTelegramID(ctx, tgUserID)
+	if err != nil {
+		return nil, err
+	}
+	if user == nil {
+		return nil, UserNotFoundErr
+	}
+	if user.ChatID != chatID {
+		if err = a.repo.SetChat(ctx, user.Username, chatID); err != nil {
+			return nil, err
+		}
+		user.ChatID = chatID
+	}
+	return user, nil
+}
+
+func (a *Auth) LinkTelegram(ctx context.Context, username string, tgUserID int64) error {
+	user, err := a.repo.Get(ctx, username)
+	if err != nil {
+		return err
+	}
+	if user == nil {
+		return UserNotFoundErr
+	}
+	if user.TGUserID == tgUserID {
+		return nil
+	}
+	if user.TGUserID != 0 {
+		return TelegramLinkedErr
+	}
+	err = a.repo.SetTelegramID(ctx, username, tgUserID)
+	if err == repository.TelegramUserIsLinkedErr {
+		return TelegramLinkedErr
+	}
+	return err
+}
+
+// Unlock forgets failed attempts of the user, so the user can log in right away
+func (a *Auth) Unlock(ctx context.Context, username string) error {
+	user, err := a.repo.Get(ctx, username)
+	if err != nil {
+		return err
+	}
+	if user == nil {
+		return UserNotFoundErr
+	}
+	return a.attempts.Reset(ctx, userAttemptsKey(username))
+}
+
+// ChangePassword sets the new password of the user if the old one is right
+func (a *Auth) ChangePassword(ctx context.Context, username, oldPassword, newPassword string) error {
+	user, err := a.repo.Get(ctx, username)
+	if err != nil {
+		return err
+	}
+	if user == nil {
+		return UserNotFoundErr
+	}
+	if user.Password != "" {
+		ok, _, err := a.checkPassword(user, oldPassword)
+		if err != nil {
+			return err
+		}
+		if !ok {
+			return WrongPasswordErr
+		}
+	}
+	return a.ResetPassword(ctx, username, newPassword)
+}
+
+// checkPassword verifies the password by the hash of the user, needsRehash is true if the hash is outdated
+func (a *Auth) checkPassword(user *model.User, password string) (ok, needsRehash bool, err error) {
+	switch {
+	case user.Password == "":
+		// accounts created by telegram have no password
+		return false, false, nil
+	case isArgon2Hash(user.Password):
+		if ok, needsRehash, err = verifyPassword(user.Password, password); err != nil {
+			return false, false, fmt.Errorf("couldn't verify password of %s: %v", user.Username, err)
+		}
+		return ok, needsRehash, nil
+	default:
+		return subtle.ConstantTimeCompare([]byte(a.legacyHash(password)), []byte(user.Password)) == 1, true, nil
+	}
+}
+
+// rehash replaces the hash of the user, the user is logged in even if it fails
+func (a *Auth) rehash(ctx context.Context, user *model.User, password string) {
+	hash, err := hashPassword(password)
+	if err != nil {
+		logrus.Errorf("auth service couldn't rehash password of %s: %v", user.Username, err)
+		return
+	}
+	if _, err = a.repo.UpdatePassword(ctx, user.Username, hash); err != nil {
+		logrus.Errorf("auth service couldn't update password of %s: %v", user.Username, err)
+		return
+	}
+	user.Password = hash
+	logrus.Infof("auth service upgraded the password hash of %s", user.Username)
+}
+
+// legacyHash is the SHA-1 hash of the old scheme, it's only used to verify passwords which haven't been upgraded yet
+func (a *Auth) legacyHash(password string) string {
 	hash := sha1.New()
 	hash.Write([]byte(password))
 	return fmt.Sprintf("%x", hash.Sum([]byte(a.salt)))
 }
+
+// ResetPassword sets the new password of the user
+func (a *Auth) ResetPassword(ctx context.Context, username, password string) error {
+	hash, err := hashPassword(password)
+	if err != nil {
+		return err
+	}
+	ok, err := a.repo.UpdatePassword(ctx, username, hash)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return UserNotFoundErr
+	}
+	return nil
+}
+
+// Delete deletes the account of the user, expenses are deleted by the reporter
+func (a *Auth) Delete(ctx context.Context, username string) error {
+	ok, err := a.repo.Delete(ctx, username)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return UserNotFoundErr
+	}
+	return nil
+}
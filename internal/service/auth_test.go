@@ -1,19 +1,228 @@
 package service
 
 import (
+	"context"
+	"github.com/chucky-1/finance/internal/model"
+	"github.com/chucky-1/finance/internal/repository"
 	"github.com/chucky-1/finance/internal/repository/mocks"
 	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/mock"
 	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/argon2"
+	"strings"
 	"testing"
 )
 
-func TestAuth_generatePassword(t *testing.T) {
+func TestAuth_legacyHash(t *testing.T) {
 	userRepo := new(mocks.User)
 	salt := "iuyuofritu"
-	userServ := NewAuth(userRepo, salt)
+	userServ := NewAuth(userRepo, newFakeLoginAttempts(), salt)
 	inputPassword := "myNewStrongPassword"
-	hashPasswordOne := userServ.generatePassword(inputPassword)
-	hashPasswordTwo := userServ.generatePassword(inputPassword)
+	hashPasswordOne := userServ.legacyHash(inputPassword)
+	hashPasswordTwo := userServ.legacyHash(inputPassword)
 	require.Equal(t, hashPasswordOne, hashPasswordTwo)
 	logrus.Infof("hash password: %s", hashPasswordOne)
 }
+
+func TestAuth_Register(t *testing.T) {
+	userRepo := new(mocks.User)
+	userServ := NewAuth(userRepo, newFakeLoginAttempts(), "iuyuofritu")
+	userRepo.On("Create", mock.Anything, mock.Anything).Return(nil)
+
+	user := &model.User{Username: "dima", Password: "secret"}
+	require.NoError(t, userServ.Register(context.Background(), user))
+	require.True(t, strings.HasPrefix(user.Password, "$argon2id$v=19$m=65536,t=1,p=4$"))
+	ok, needsRehash, err := verifyPassword(user.Password, "secret")
+	require.NoError(t, err)
+	require.True(t, ok)
+	require.False(t, needsRehash)
+
+	for _, username := range []string{"ledger:1", "дима", "di", "dima dima"} {
+		require.Equal(t, InvalidUsernameErr, userServ.Register(context.Background(), &model.User{Username: username, Password: "secret"}))
+	}
+	userRepo.AssertNumberOfCalls(t, "Create", 1)
+}
+
+func TestAuth_Login(t *testing.T) {
+	salt := "iuyuofritu"
+	argon2Password, err := hashPassword("secret")
+	require.NoError(t, err)
+	oldArgon2Password := (&argon2Hash{memory: 1024, time: 1, threads: 1, salt: []byte("0123456789abcdef"),
+		key: argon2.IDKey([]byte("secret"), []byte("0123456789abcdef"), 1, 1024, 1, 32)}).String()
+
+	testTable := []struct {
+		name     string
+		password string
+		hash     string
+		err      error
+		rehashed bool
+	}{
+		{
+			name:     "Argon2",
+			password: "secret",
+			hash:     argon2Password,
+		},
+		{
+			name:     "Argon2 with wrong password",
+			password: "wrong",
+			hash:     argon2Password,
+			err:      WrongPasswordErr,
+		},
+		{
+			name:     "Argon2 with old parameters",
+			password: "secret",
+			hash:     oldArgon2Password,
+			rehashed: true,
+		},
+		{
+			name:     "Legacy SHA-1",
+			password: "secret",
+			hash:     NewAuth(nil, nil, salt).legacyHash("secret"),
+			rehashed: true,
+		},
+		{
+			name:     "Legacy SHA-1 with wrong password",
+			password: "wrong",
+			hash:     NewAuth(nil, nil, salt).legacyHash("secret"),
+			err:      WrongPasswordErr,
+		},
+	}
+
+	for _, testCase := range testTable {
+		t.Run(testCase.name, func(t *testing.T) {
+			userRepo := mocks.NewUser(t)
+			userServ := NewAuth(userRepo, newFakeLoginAttempts(), salt)
+			userRepo.On("Get", mock.Anything, "dima").Return(&model.User{Username: "dima", Password: testCase.hash}, nil)
+			var newHash string
+			if testCase.rehashed {
+				userRepo.On("UpdatePassword", mock.Anything, "dima", mock.Anything).
+					Run(func(args mock.Arguments) { newHash = args.String(2) }).Return(true, nil)
+			}
+
+			user, err := userServ.Login(context.Background(), "dima", testCase.password, 0)
+			require.Equal(t, testCase.err, err)
+			if err != nil {
+				return
+			}
+			require.Equal(t, "dima", user.Username)
+			if testCase.rehashed {
+				require.Equal(t, newHash, user.Password)
+				ok, needsRehash, err := verifyPassword(newHash, testCase.password)
+				require.NoError(t, err)
+				require.True(t, ok)
+				require.False(t, needsRehash)
+			}
+		})
+	}
+}
+
+func TestAuth_LoginUnknownUser(t *testing.T) {
+	userRepo := new(mocks.User)
+	userServ := NewAuth(userRepo, newFakeLoginAttempts(), "iuyuofritu")
+	userRepo.On("Get", mock.Anything, "dima").Return(nil, nil)
+
+	_, err := userServ.Login(context.Background(), "dima", "secret", 0)
+	require.Equal(t, UserNotFoundErr, err)
+}
+
+func TestAuth_ResetPassword(t *testing.T) {
+	userRepo := new(mocks.User)
+	userServ := NewAuth(userRepo, newFakeLoginAttempts(), "iuyuofritu")
+	userRepo.On("UpdatePassword", mock.Anything, "dima", mock.MatchedBy(func(hash string) bool {
+		ok, _, err := verifyPassword(hash, "newSecret")
+		return err == nil && ok
+	})).Return(true, nil)
+	userRepo.On("UpdatePassword", mock.Anything, "anna", mock.Anything).Return(false, nil)
+
+	require.NoError(t, userServ.ResetPassword(context.Background(), "dima", "newSecret"))
+	require.Equal(t, UserNotFoundErr, userServ.ResetPassword(context.Background(), "anna", "newSecret"))
+}
+
+func TestAuth_ChangePassword(t *testing.T) {
+	userRepo := new(mocks.User)
+	userServ := NewAuth(userRepo, newFakeLoginAttempts(), "iuyuofritu")
+	hash, err := hashPassword("secret")
+	require.NoError(t, err)
+	userRepo.On("Get", mock.Anything, "dima").Return(&model.User{Username: "dima", Password: hash}, nil)
+	userRepo.On("Get", mock.Anything, "tg_user").Return(&model.User{Username: "tg_user"}, nil)
+	userRepo.On("Get", mock.Anything, "anna").Return(nil, nil)
+	userRepo.On("UpdatePassword", mock.Anything, mock.Anything, mock.MatchedBy(func(hash string) bool {
+		ok, _, err := verifyPassword(hash, "newSecret")
+		return err == nil && ok
+	})).Return(true, nil)
+
+	ctx := context.Background()
+	require.Equal(t, WrongPasswordErr, userServ.ChangePassword(ctx, "dima", "wrong", "newSecret"))
+	userRepo.AssertNotCalled(t, "UpdatePassword", mock.Anything, "dima", mock.Anything)
+	require.NoError(t, userServ.ChangePassword(ctx, "dima", "secret", "newSecret"))
+	require.NoError(t, userServ.ChangePassword(ctx, "tg_user", "", "newSecret"))
+	require.Equal(t, UserNotFoundErr, userServ.ChangePassword(ctx, "anna", "secret", "newSecret"))
+}
+
+func TestAuth_Delete(t *testing.T) {
+	userRepo := new(mocks.User)
+	userServ := NewAuth(userRepo, newFakeLoginAttempts(), "iuyuofritu")
+	userRepo.On("Delete", mock.Anything, "dima").Return(true, nil)
+	userRepo.On("Delete", mock.Anything, "anna").Return(false, nil)
+
+	require.NoError(t, userServ.Delete(context.Background(), "dima"))
+	require.Equal(t, UserNotFoundErr, userServ.Delete(context.Background(), "anna"))
+}
+
+func TestAuth_RegisterTelegram(t *testing.T) {
+	userRepo := new(mocks.User)
+	userServ := NewAuth(userRepo, newFakeLoginAttempts(), "iuyuofritu")
+	userRepo.On("Create", mock.Anything, mock.MatchedBy(func(user *model.User) bool {
+		return user.Username == "dima"
+	})).Return(repository.DuplicateUserErr)
+	userRepo.On("Create", mock.Anything, mock.Anything).Return(nil)
+
+	user := &model.User{Username: "dima", TGUserID: 123456789}
+	require.NoError(t, userServ.RegisterTelegram(context.Background(), user))
+	require.Equal(t, "tg_21i3v9", user.Username)
+	require.Empty(t, user.Password)
+
+	user = &model.User{Username: "not a username", TGUserID: 35}
+	require.NoError(t, userServ.RegisterTelegram(context.Background(), user))
+	require.Equal(t, "tg_z", user.Username)
+}
+
+func TestAuth_RegisterTelegramLinkedUser(t *testing.T) {
+	userRepo := new(mocks.User)
+	userServ := NewAuth(userRepo, newFakeLoginAttempts(), "iuyuofritu")
+	userRepo.On("Create", mock.Anything, mock.Anything).Return(repository.DuplicateUserErr)
+	userRepo.On("GetByTelegramID", mock.Anything, int64(35)).Return(&model.User{Username: "tg_z", TGUserID: 35}, nil)
+
+	err := userServ.RegisterTelegram(context.Background(), &model.User{Username: "dima", TGUserID: 35})
+	require.Equal(t, TelegramLinkedErr, err)
+}
+
+func TestAuth_LoginTelegram(t *testing.T) {
+	userRepo := new(mocks.User)
+	userServ := NewAuth(userRepo, newFakeLoginAttempts(), "iuyuofritu")
+	userRepo.On("GetByTelegramID", mock.Anything, int64(35)).Return(&model.User{Username: "dima", TGUserID: 35, ChatID: 1}, nil)
+	userRepo.On("GetByTelegramID", mock.Anything, int64(36)).Return(nil, nil)
+	userRepo.On("SetChat", mock.Anything, "dima", int64(2)).Return(nil)
+
+	user, err := userServ.LoginTelegram(context.Background(), 35, 2)
+	require.NoError(t, err)
+	require.Equal(t, int64(2), user.ChatID)
+	userRepo.AssertCalled(t, "SetChat", mock.Anything, "dima", int64(2))
+
+	_, err = userServ.LoginTelegram(context.Background(), 36, 2)
+	require.Equal(t, UserNotFoundErr, err)
+}
+
+func TestAuth_LinkTelegram(t *testing.T) {
+	userRepo := new(mocks.User)
+	userServ := NewAuth(userRepo, newFakeLoginAttempts(), "iuyuofritu")
+	userRepo.On("Get", mock.Anything, "dima").Return(&model.User{Username: "dima"}, nil)
+	userRepo.On("Get", mock.Anything, "anna").Return(&model.User{Username: "anna", TGUserID: 36}, nil)
+	userRepo.On("SetTelegramID", mock.Anything, "dima", int64(35)).Return(nil)
+	userRepo.On("SetTelegramID", mock.Anything, "dima", int64(36)).Return(repository.TelegramUserIsLinkedErr)
+
+	require.NoError(t, userServ.LinkTelegram(context.Background(), "dima", 35))
+	require.Equal(t, TelegramLinkedErr, userServ.LinkTelegram(context.Background(), "dima", 36))
+	require.NoError(t, userServ.LinkTelegram(context.Background(), "anna", 36))
+	require.Equal(t, TelegramLinkedErr, userServ.LinkTelegram(context.Background(), "anna", 35))
+}
@@ -0,0 +1,86 @@
+package service
+
+import (
+	"time"
+
+	"github.com/chucky-1/finance/internal/model"
+)
+
+// boundary is the moment when the day or the month of the user ends, the report of the ended period is due then
+type boundary struct {
+	at       time.Time
+	username string
+	// key is the ended period, e.g. 2023-06-30 or 2023-06
+	key string
+	// index is the position in the queue, heap.Fix needs it
+	index int
+}
+
+// boundaries is a priority queue for container/heap, the earliest boundary is the first
+type boundaries []*boundary
+
+func (b boundaries) Len() int {
+	return len(b)
+}
+
+func (b boundaries) Less(i, j int) bool {
+	if b[i].at.Equal(b[j].at) {
+		return b[i].username < b[j].username
+	}
+	return b[i].at.Before(b[j].at)
+}
+
+func (b boundaries) Swap(i, j int) {
+	b[i], b[j] = b[j], b[i]
+	b[i].index = i
+	b[j].index = j
+}
+
+func (b *boundaries) Push(x any) {
+	item := x.(*boundary)
+	item.index = len(*b)
+	*b = append(*b, item)
+}
+
+func (b *boundaries) Pop() any {
+	old := *b
+	item := old[len(old)-1]
+	old[len(old)-1] = nil
+	item.index = -1
+	*b = old[:len(old)-1]
+	return item
+}
+
+// nextBoundary returns the first local midnight after the time which ends the day or the financial month in the timezone
+// and the key of the ended period. Any offset works, e.g. +5:45 or +13:45
+func nextBoundary(period string, after time.Time, timezone *time.Location, monthStart int) (time.Time, string) {
+	local := after.In(timezone)
+	next := localMidnight(local.Year(), local.Month(), local.Day()+1, timezone)
+	if period == MonthlyReport {
+		start := MonthStart(after, timezone, monthStart).In(timezone)
+		next = localMidnight(start.Year(), start.Month()+1, start.Day(), timezone)
+	}
+	return next, periodKey(period, next, timezone, monthStart)
+}
+
+// deliveryTime returns when the report of the ended period is delivered: the local midnight after the period
+// plus the report time of the user by the local clock, so 08:00 stays 08:00 when the clocks change at night.
+// A time which the clocks skip may be before the boundary, then the report is delivered as soon as it's made
+func deliveryTime(period, key string, timezone *time.Location, reportTime model.ReportTime, monthStart int) time.Time {
+	after := reportTime.Daily
+	start, err := time.Parse(dailyKey, key)
+	if period == MonthlyReport {
+		after = reportTime.Monthly
+		start, err = MonthFirstDay(key, monthStart)
+	}
+	if err != nil {
+		return time.Time{}
+	}
+	days := int(after / (24 * time.Hour))
+	after -= time.Duration(days) * 24 * time.Hour
+	month, day := start.Month(), start.Day()+1+days
+	if period == MonthlyReport {
+		month, day = month+1, start.Day()+days
+	}
+	return time.Date(start.Year(), month, day, int(after.Hours()), int(after.Minutes())%60, 0, 0, timezone).UTC()
+}
@@ -0,0 +1,164 @@
+package service
+
+import (
+	_ "embed"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// citiesData is the offline dataset of cities, the timezone is searched without network
+//
+//go:embed cities.tsv
+var citiesData string
+
+// earthRadius is the mean radius of the earth in kilometers
+const earthRadius = 6371.0
+
+// City is a place of the dataset with its IANA timezone
+type City struct {
+	Name      string
+	Country   string
+	Timezone  string
+	Latitude  float64
+	Longitude float64
+	// aliases are other names of the city or its country, e.g. in russian
+	aliases []string
+}
+
+// String returns the city with its country, e.g. Minsk, Belarus. SearchCities finds the city by it
+func (c *City) String() string {
+	return c.Name + ", " + c.Country
+}
+
+var cities = mustParseCities(citiesData)
+
+func mustParseCities(data string) []*City {
+	parsed, err := parseCities(data)
+	if err != nil {
+		panic(err)
+	}
+	return parsed
+}
+
+// parseCities parses lines like Minsk<TAB>Belarus<TAB>Europe/Minsk<TAB>53.9<TAB>27.5667<TAB>Минск,Беларусь, lines with # are comments
+func parseCities(data string) ([]*City, error) {
+	parsed := make([]*City, 0)
+	for i, line := range strings.Split(data, "\n") {
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		fields := strings.Split(line, "\t")
+		if len(fields) != 6 {
+			return nil, fmt.Errorf("cities, line %d: 6 fields are expected, got %d", i+1, len(fields))
+		}
+		latitude, err := strconv.ParseFloat(fields[3], 64)
+		if err != nil {
+			return nil, fmt.Errorf("cities, line %d: couldn't parse latitude: %v", i+1, err)
+		}
+		longitude, err := strconv.ParseFloat(fields[4], 64)
+		if err != nil {
+			return nil, fmt.Errorf("cities, line %d: couldn't parse longitude: %v", i+1, err)
+		}
+		city := &City{
+			Name:      fields[0],
+			Country:   fields[1],
+			Timezone:  fields[2],
+			Latitude:  latitude,
+			Longitude: longitude,
+		}
+		if fields[5] != "" {
+			city.aliases = strings.Split(fields[5], ",")
+		}
+		parsed = append(parsed, city)
+	}
+	return parsed, nil
+}
+
+// SearchCities returns up to limit cities by the name of the city or its country, e.g. Minsk, Минск, Belarus or "Minsk, Belarus".
+// Cities with the same name come first, then cities of the country and cities whose name starts with the query
+func SearchCities(query string, limit int) []*City {
+	query = normalizeName(query)
+	if query == "" {
+		return nil
+	}
+	name, country, withCountry := strings.Cut(query, ",")
+	name, country = strings.TrimSpace(name), strings.TrimSpace(country)
+
+	var byName, byCountry, byPrefix []*City
+	for _, city := range cities {
+		switch {
+		case withCountry:
+			if city.hasName(name) && normalizeName(city.Country) == country {
+				byName = append(byName, city)
+			}
+		case city.hasName(query):
+			byName = append(byName, city)
+		case normalizeName(city.Country) == query:
+			byCountry = append(byCountry, city)
+		case city.hasPrefix(query):
+			byPrefix = append(byPrefix, city)
+		}
+	}
+	found := append(append(byName, byCountry...), byPrefix...)
+	if len(found) > limit {
+		found = found[:limit]
+	}
+	return found
+}
+
+// NearestCity returns the city which is the closest to the point, e.g. to the location sent by the user
+func NearestCity(latitude, longitude float64) *City {
+	var nearest *City
+	minDistance := math.Inf(1)
+	for _, city := range cities {
+		if d := distance(latitude, longitude, city.Latitude, city.Longitude); d < minDistance {
+			nearest, minDistance = city, d
+		}
+	}
+	return nearest
+}
+
+func (c *City) hasName(name string) bool {
+	if normalizeName(c.Name) == name {
+		return true
+	}
+	for _, alias := range c.aliases {
+		if normalizeName(alias) == name {
+			return true
+		}
+	}
+	return false
+}
+
+func (c *City) hasPrefix(prefix string) bool {
+	if strings.HasPrefix(normalizeName(c.Name), prefix) {
+		return true
+	}
+	for _, alias := range c.aliases {
+		if strings.HasPrefix(normalizeName(alias), prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// normalizeName makes names comparable regardless of the case and the spelling, e.g. "Санкт-Петербург" and "санкт петербург"
+func normalizeName(name string) string {
+	name = strings.ToLower(name)
+	name = strings.NewReplacer("ё", "е", "-", " ", "_", " ").Replace(name)
+	return strings.Join(strings.Fields(name), " ")
+}
+
+// distance returns the distance between two points in kilometers by the haversine formula
+func distance(latitude1, longitude1, latitude2, longitude2 float64) float64 {
+	radians := func(degrees float64) float64 {
+		return degrees * math.Pi / 180
+	}
+	dLatitude := radians(latitude2 - latitude1)
+	dLongitude := radians(longitude2 - longitude1)
+	a := math.Pow(math.Sin(dLatitude/2), 2) +
+		math.Cos(radians(latitude1))*math.Cos(radians(latitude2))*math.Pow(math.Sin(dLongitude/2), 2)
+	return 2 * earthRadius * math.Asin(math.Sqrt(a))
+}
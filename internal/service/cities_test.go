@@ -0,0 +1,84 @@
+package service
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestCities_TimezonesAreLoaded(t *testing.T) {
+	require.NotEmpty(t, cities)
+	for _, city := range cities {
+		_, err := LoadLocation(city.Timezone)
+		require.NoError(t, err, city.String())
+	}
+}
+
+func TestSearchCities(t *testing.T) {
+	testTable := []struct {
+		name   string
+		query  string
+		result []string
+	}{
+		{
+			name:   "City",
+			query:  "minsk",
+			result: []string{"Minsk, Belarus"},
+		},
+		{
+			name:   "City in russian",
+			query:  "  Санкт петербург ",
+			result: []string{"Saint Petersburg, Russia"},
+		},
+		{
+			name:   "City with the country",
+			query:  "Los Angeles, United States",
+			result: []string{"Los Angeles, United States"},
+		},
+		{
+			name:   "Country",
+			query:  "Belarus",
+			result: []string{"Minsk, Belarus", "Brest, Belarus", "Grodno, Belarus"},
+		},
+		{
+			name:   "Beginning of the name",
+			query:  "Kathm",
+			result: []string{"Kathmandu, Nepal"},
+		},
+		{
+			name:   "Unknown",
+			query:  "Atlantis",
+			result: nil,
+		},
+		{
+			name:   "Empty",
+			query:  " ",
+			result: nil,
+		},
+	}
+
+	for _, testCase := range testTable {
+		t.Run(testCase.name, func(t *testing.T) {
+			var result []string
+			for _, city := range SearchCities(testCase.query, 3) {
+				result = append(result, city.String())
+			}
+			require.Equal(t, testCase.result, result)
+		})
+	}
+}
+
+func TestNearestCity(t *testing.T) {
+	// Pruszków is near Warsaw
+	require.Equal(t, "Europe/Warsaw", NearestCity(52.17, 20.81).Timezone)
+	// Pokhara is in Nepal, the offset is +5:45
+	require.Equal(t, "Asia/Kathmandu", NearestCity(28.21, 83.99).Timezone)
+	// the Chatham Islands are across the date line from New Zealand
+	require.Equal(t, "Pacific/Chatham", NearestCity(-44.0, -176.4).Timezone)
+}
+
+func TestDistance(t *testing.T) {
+	// Minsk - Warsaw is about 476 km
+	require.InDelta(t, 476, distance(53.9, 27.5667, 52.25, 21), 5)
+	require.Zero(t, distance(53.9, 27.5667, 53.9, 27.5667))
+}
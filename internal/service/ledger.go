@@ -0,0 +1,221 @@
+package service
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"github.com/chucky-1/finance/internal/model"
+	"github.com/chucky-1/finance/internal/repository"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+const (
+	// MaxLedgerNameLength is the length of the name column of ledgers
+	MaxLedgerNameLength = 32
+	// invite codes are sent to another user by hand, 9 bytes are 12 characters
+	ledgerInviteLength = 9
+	ledgerInviteTTL    = 24 * time.Hour
+)
+
+var (
+	LedgerNotFoundErr       = errors.New("ledger not found or the user isn't its member")
+	LedgerForbiddenErr      = errors.New("the role of the user in the ledger doesn't allow it")
+	LedgerMemberNotFoundErr = errors.New("user isn't a member of the ledger")
+	InvalidLedgerNameErr    = errors.New("ledger name is empty or too long")
+	InvalidLedgerRoleErr    = errors.New("members are invited only as editors or viewers")
+	InvalidLedgerInviteErr  = errors.New("ledger invite is invalid, used or expired")
+)
+
+// LedgerReport is the expenses of the ledger by categories, Members are the same expenses split by the members who made them
+type LedgerReport struct {
+	Ledger     *model.Ledger
+	Categories map[string]float64
+	Members    map[string]map[string]float64
+}
+
+// Ledger shares budgets between users. Entries of ledgers are kept like entries of users under the key of the ledger,
+// they aren't aggregated into periods, so they don't get into daily and monthly reports of users
+type Ledger struct {
+	repo    repository.Ledger
+	entries repository.Entries
+}
+
+func NewLedger(repo repository.Ledger, entries repository.Entries) *Ledger {
+	return &Ledger{
+		repo:    repo,
+		entries: entries,
+	}
+}
+
+// Create creates the ledger and makes the user its owner
+func (l *Ledger) Create(ctx context.Context, owner, name string) (*model.Ledger, error) {
+	name = strings.TrimSpace(name)
+	if name == "" || utf8.RuneCountInString(name) > MaxLedgerNameLength {
+		return nil, InvalidLedgerNameErr
+	}
+	ledger := &model.Ledger{
+		Name:      name,
+		Owner:     owner,
+		CreatedAt: time.Now().UTC(),
+	}
+	if err := l.repo.Create(ctx, ledger); err != nil {
+		return nil, err
+	}
+	return ledger, nil
+}
+
+// List returns ledgers of the user with the role of the user in them
+func (l *Ledger) List(ctx context.Context, username string) ([]*model.Membership, error) {
+	return l.repo.GetAll(ctx, username)
+}
+
+// Membership returns LedgerNotFoundErr if the user isn't a member of the ledger
+func (l *Ledger) Membership(ctx context.Context, ledgerID int64, username string) (*model.Membership, error) {
+	membership, err := l.repo.GetMembership(ctx, ledgerID, username)
+	if err != nil {
+		return nil, err
+	}
+	if membership == nil {
+		return nil, LedgerNotFoundErr
+	}
+	return membership, nil
+}
+
+// Invite returns a one-time code which adds a member with the role to the ledger, only the owner invites members.
+// The code can't be shown again because only its hash is stored
+func (l *Ledger) Invite(ctx context.Context, ledgerID int64, username, role string) (string, error) {
+	if role != model.EditorRole && role != model.ViewerRole {
+		return "", InvalidLedgerRoleErr
+	}
+	membership, err := l.Membership(ctx, ledgerID, username)
+	if err != nil {
+		return "", err
+	}
+	if membership.Role != model.OwnerRole {
+		return "", LedgerForbiddenErr
+	}
+	random := make([]byte, ledgerInviteLength)
+	if _, err = rand.Read(random); err != nil {
+		return "", fmt.Errorf("couldn't generate ledger invite: %v", err)
+	}
+	code := base64.RawURLEncoding.EncodeToString(random)
+	if err = l.repo.AddInvite(ctx, hashLedgerInvite(code), ledgerID, role, time.Now().UTC().Add(ledgerInviteTTL)); err != nil {
+		return "", err
+	}
+	return code, nil
+}
+
+// Join adds the user to the ledger of the invite code with the role of the invite.
+// It returns repository.DuplicateLedgerMemberErr if the user is a member already
+func (l *Ledger) Join(ctx context.Context, code, username string) (*model.Membership, error) {
+	membership, err := l.repo.Join(ctx, hashLedgerInvite(strings.TrimSpace(code)), username, time.Now().UTC())
+	if err != nil {
+		return nil, err
+	}
+	if membership == nil {
+		return nil, InvalidLedgerInviteErr
+	}
+	return membership, nil
+}
+
+// Members returns members of the ledger, every member sees them
+func (l *Ledger) Members(ctx context.Context, ledgerID int64, username string) ([]*model.LedgerMember, error) {
+	if _, err := l.Membership(ctx, ledgerID, username); err != nil {
+		return nil, err
+	}
+	return l.repo.GetMembers(ctx, ledgerID)
+}
+
+// Remove removes the member from the ledger. The owner removes other members, the rest of members can only leave.
+// Entries of the member stay in the ledger
+func (l *Ledger) Remove(ctx context.Context, ledgerID int64, username, member string) error {
+	membership, err := l.Membership(ctx, ledgerID, username)
+	if err != nil {
+		return err
+	}
+	if member == membership.Ledger.Owner || (member != username && membership.Role != model.OwnerRole) {
+		return LedgerForbiddenErr
+	}
+	deleted, err := l.repo.DeleteMember(ctx, ledgerID, member)
+	if err != nil {
+		return err
+	}
+	if !deleted {
+		return LedgerMemberNotFoundErr
+	}
+	return nil
+}
+
+// Add keeps the expense of the user in the ledger with the user as its member, viewers can't add expenses
+func (l *Ledger) Add(ctx context.Context, ledgerID int64, username string, category *model.Category, date time.Time) (*model.Entry, error) {
+	membership, err := l.Membership(ctx, ledgerID, username)
+	if err != nil {
+		return nil, err
+	}
+	if !membership.CanEdit() {
+		return nil, LedgerForbiddenErr
+	}
+	entry := &model.Entry{
+		Kind:     "expenses",
+		User:     model.LedgerKey(ledgerID),
+		Member:   username,
+		Date:     date,
+		Category: category,
+	}
+	if err = l.entries.AddEntry(ctx, entry); err != nil {
+		return nil, err
+	}
+	return entry, nil
+}
+
+// Restore keeps the imported entry of the ledger. The member may have left the ledger since the entry was made,
+// so only the ledger must exist
+func (l *Ledger) Restore(ctx context.Context, ledgerID int64, entry *model.Entry) error {
+	members, err := l.repo.GetMembers(ctx, ledgerID)
+	if err != nil {
+		return err
+	}
+	if len(members) == 0 {
+		return LedgerNotFoundErr
+	}
+	entry.User = model.LedgerKey(ledgerID)
+	return l.entries.AddEntry(ctx, entry)
+}
+
+// Report sums the expenses of the ledger by categories and by members from the beginning to the end of the range,
+// not including the end. Every member can read reports
+func (l *Ledger) Report(ctx context.Context, ledgerID int64, username string, from, to time.Time) (*LedgerReport, error) {
+	membership, err := l.Membership(ctx, ledgerID, username)
+	if err != nil {
+		return nil, err
+	}
+	entries, err := l.entries.GetEntries(ctx, "expenses", model.LedgerKey(ledgerID), from, to)
+	if err != nil {
+		return nil, err
+	}
+	report := &LedgerReport{
+		Ledger:     membership.Ledger,
+		Categories: make(map[string]float64),
+		Members:    make(map[string]map[string]float64),
+	}
+	for _, entry := range entries {
+		report.Categories[entry.Category.Name] += entry.Category.Amount
+		if report.Members[entry.Member] == nil {
+			report.Members[entry.Member] = make(map[string]float64)
+		}
+		report.Members[entry.Member][entry.Category.Name] += entry.Category.Amount
+	}
+	return report, nil
+}
+
+// hashLedgerInvite doesn't need a salt because codes are random
+func hashLedgerInvite(code string) string {
+	hash := sha256.Sum256([]byte(code))
+	return hex.EncodeToString(hash[:])
+}
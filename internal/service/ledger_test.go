@@ -0,0 +1,176 @@
+package service
+
+import (
+	"context"
+	"github.com/chucky-1/finance/internal/model"
+	"github.com/chucky-1/finance/internal/repository"
+	"github.com/stretchr/testify/require"
+	"testing"
+	"time"
+)
+
+// fakeLedgers keeps ledgers with their members, invites are kept by hashes until they're used
+type fakeLedgers struct {
+	ledgers map[int64]*model.Ledger
+	members map[int64]map[string]string
+	invites map[string]*model.Membership
+}
+
+func newFakeLedgers() *fakeLedgers {
+	return &fakeLedgers{
+		ledgers: make(map[int64]*model.Ledger),
+		members: make(map[int64]map[string]string),
+		invites: make(map[string]*model.Membership),
+	}
+}
+
+func (f *fakeLedgers) Create(_ context.Context, ledger *model.Ledger) error {
+	ledger.ID = int64(len(f.ledgers) + 1)
+	f.ledgers[ledger.ID] = ledger
+	f.members[ledger.ID] = map[string]string{ledger.Owner: model.OwnerRole}
+	return nil
+}
+
+func (f *fakeLedgers) GetAll(context.Context, string) ([]*model.Membership, error) {
+	return nil, nil
+}
+
+func (f *fakeLedgers) GetMembership(_ context.Context, ledgerID int64, username string) (*model.Membership, error) {
+	role, ok := f.members[ledgerID][username]
+	if !ok {
+		return nil, nil
+	}
+	return &model.Membership{Ledger: f.ledgers[ledgerID], Role: role}, nil
+}
+
+func (f *fakeLedgers) GetMembers(_ context.Context, ledgerID int64) ([]*model.LedgerMember, error) {
+	members := make([]*model.LedgerMember, 0)
+	for username, role := range f.members[ledgerID] {
+		members = append(members, &model.LedgerMember{LedgerID: ledgerID, Username: username, Role: role})
+	}
+	return members, nil
+}
+
+func (f *fakeLedgers) DeleteMember(_ context.Context, ledgerID int64, username string) (bool, error) {
+	role, ok := f.members[ledgerID][username]
+	if !ok || role == model.OwnerRole {
+		return false, nil
+	}
+	delete(f.members[ledgerID], username)
+	return true, nil
+}
+
+func (f *fakeLedgers) AddInvite(_ context.Context, hash string, ledgerID int64, role string, _ time.Time) error {
+	f.invites[hash] = &model.Membership{Ledger: f.ledgers[ledgerID], Role: role}
+	return nil
+}
+
+func (f *fakeLedgers) Join(_ context.Context, hash, username string, _ time.Time) (*model.Membership, error) {
+	invite, ok := f.invites[hash]
+	if !ok {
+		return nil, nil
+	}
+	if _, ok = f.members[invite.Ledger.ID][username]; ok {
+		return nil, repository.DuplicateLedgerMemberErr
+	}
+	delete(f.invites, hash)
+	f.members[invite.Ledger.ID][username] = invite.Role
+	return invite, nil
+}
+
+func TestLedger_Roles(t *testing.T) {
+	ctx := context.Background()
+	ledgers := NewLedger(newFakeLedgers(), &fakePeriods{})
+
+	_, err := ledgers.Create(ctx, "Dima", "  ")
+	require.Equal(t, InvalidLedgerNameErr, err)
+	ledger, err := ledgers.Create(ctx, "Dima", "Home")
+	require.NoError(t, err)
+
+	_, err = ledgers.Invite(ctx, ledger.ID, "Dima", model.OwnerRole)
+	require.Equal(t, InvalidLedgerRoleErr, err)
+	_, err = ledgers.Invite(ctx, ledger.ID, "Anna", model.EditorRole)
+	require.Equal(t, LedgerNotFoundErr, err)
+	code, err := ledgers.Invite(ctx, ledger.ID, "Dima", model.ViewerRole)
+	require.NoError(t, err)
+
+	_, err = ledgers.Join(ctx, code, "Dima")
+	require.Equal(t, repository.DuplicateLedgerMemberErr, err)
+	membership, err := ledgers.Join(ctx, code, "Anna")
+	require.NoError(t, err)
+	require.Equal(t, model.ViewerRole, membership.Role)
+	_, err = ledgers.Join(ctx, code, "Oleg")
+	require.Equal(t, InvalidLedgerInviteErr, err)
+
+	// only the owner invites, viewers don't add expenses
+	_, err = ledgers.Invite(ctx, ledger.ID, "Anna", model.EditorRole)
+	require.Equal(t, LedgerForbiddenErr, err)
+	_, err = ledgers.Add(ctx, ledger.ID, "Anna", &model.Category{Name: "Food", Amount: 10}, time.Now().UTC())
+	require.Equal(t, LedgerForbiddenErr, err)
+
+	// the owner can't leave and members can't remove others
+	require.Equal(t, LedgerForbiddenErr, ledgers.Remove(ctx, ledger.ID, "Dima", "Dima"))
+	require.Equal(t, LedgerForbiddenErr, ledgers.Remove(ctx, ledger.ID, "Anna", "Dima"))
+	require.Equal(t, LedgerMemberNotFoundErr, ledgers.Remove(ctx, ledger.ID, "Dima", "Oleg"))
+	require.NoError(t, ledgers.Remove(ctx, ledger.ID, "Anna", "Anna"))
+	_, err = ledgers.Members(ctx, ledger.ID, "Anna")
+	require.Equal(t, LedgerNotFoundErr, err)
+}
+
+func TestLedger_ReportByMembers(t *testing.T) {
+	ctx := context.Background()
+	entries := &fakePeriods{}
+	ledgers := NewLedger(newFakeLedgers(), entries)
+	ledger, err := ledgers.Create(ctx, "Dima", "Home")
+	require.NoError(t, err)
+	code, err := ledgers.Invite(ctx, ledger.ID, "Dima", model.EditorRole)
+	require.NoError(t, err)
+	_, err = ledgers.Join(ctx, code, "Anna")
+	require.NoError(t, err)
+
+	date := time.Date(2023, 6, 28, 12, 0, 0, 0, time.UTC)
+	for _, expense := range []struct {
+		username string
+		category string
+		amount   float64
+	}{
+		{username: "Dima", category: "Food", amount: 10},
+		{username: "Anna", category: "Food", amount: 5.5},
+		{username: "Anna", category: "Rent", amount: 500},
+	} {
+		entry, err := ledgers.Add(ctx, ledger.ID, expense.username, &model.Category{Name: expense.category, Amount: expense.amount}, date)
+		require.NoError(t, err)
+		require.Equal(t, model.LedgerKey(ledger.ID), entry.User)
+		require.Equal(t, expense.username, entry.Member)
+	}
+
+	report, err := ledgers.Report(ctx, ledger.ID, "Anna", date.Add(-time.Hour), date.Add(time.Hour))
+	require.NoError(t, err)
+	require.Equal(t, map[string]float64{"Food": 15.5, "Rent": 500}, report.Categories)
+	require.Equal(t, map[string]map[string]float64{
+		"Dima": {"Food": 10},
+		"Anna": {"Food": 5.5, "Rent": 500},
+	}, report.Members)
+
+	_, err = ledgers.Report(ctx, ledger.ID, "Oleg", date.Add(-time.Hour), date.Add(time.Hour))
+	require.Equal(t, LedgerNotFoundErr, err)
+}
+
+func TestLedger_Restore(t *testing.T) {
+	ctx := context.Background()
+	entries := &fakePeriods{}
+	ledgers := NewLedger(newFakeLedgers(), entries)
+	ledger, err := ledgers.Create(ctx, "Dima", "Home")
+	require.NoError(t, err)
+
+	// Anna has left the ledger, her entries are restored anyway
+	date := time.Date(2023, 6, 28, 12, 0, 0, 0, time.UTC)
+	entry := &model.Entry{Kind: "expenses", Member: "Anna", Date: date, Category: &model.Category{Name: "Food", Amount: 5.5}}
+	require.NoError(t, ledgers.Restore(ctx, ledger.ID, entry))
+	require.Equal(t, model.LedgerKey(ledger.ID), entry.User)
+	report, err := ledgers.Report(ctx, ledger.ID, "Dima", date.Add(-time.Hour), date.Add(time.Hour))
+	require.NoError(t, err)
+	require.Equal(t, map[string]map[string]float64{"Anna": {"Food": 5.5}}, report.Members)
+
+	require.Equal(t, LedgerNotFoundErr, ledgers.Restore(ctx, ledger.ID+1, entry))
+}
@@ -0,0 +1,121 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/chucky-1/finance/internal/model"
+)
+
+const (
+	// freeLoginAttempts fail without delay, then every next attempt waits twice as long
+	freeLoginAttempts = 3
+	firstLoginDelay   = 5 * time.Second
+	maxLoginDelay     = 5 * time.Minute
+	// maxLoginFailures of a username lock the account
+	maxLoginFailures = 10
+	lockDuration     = time.Hour
+	// failuresWindow is how long failures are remembered
+	failuresWindow = 24 * time.Hour
+)
+
+// LoginBlockedError is returned when there were too many failed logins, the next attempt is possible after Until
+type LoginBlockedError struct {
+	Until time.Time
+	// Locked is true when the account is locked, otherwise attempts are only delayed
+	Locked bool
+	// OwnerChatID is the chat of the owner to notify about the lock. It's set only by the attempt which locked the account
+	OwnerChatID int64
+}
+
+func (e *LoginBlockedError) Error() string {
+	if e.Locked {
+		return fmt.Sprintf("account is locked until %s", e.Until.Format(time.RFC3339))
+	}
+	return fmt.Sprintf("login is delayed until %s", e.Until.Format(time.RFC3339))
+}
+
+func userAttemptsKey(username string) string {
+	return "user:" + username
+}
+
+func chatAttemptsKey(chatID int64) string {
+	return fmt.Sprintf("chat:%d", chatID)
+}
+
+// loginDelay returns the delay after the failures: nothing, then 5s, 10s, 20s ... but no more than 5 minutes
+func loginDelay(failures int) time.Duration {
+	if failures < freeLoginAttempts {
+		return 0
+	}
+	delay := firstLoginDelay
+	for i := freeLoginAttempts; i < failures; i++ {
+		delay *= 2
+		if delay >= maxLoginDelay {
+			return maxLoginDelay
+		}
+	}
+	return delay
+}
+
+// blocked returns the error if the next attempt isn't allowed yet
+func blocked(attempts *model.LoginAttempts, now time.Time) *LoginBlockedError {
+	if attempts == nil {
+		return nil
+	}
+	if attempts.LockedUntil != nil && now.Before(*attempts.LockedUntil) {
+		return &LoginBlockedError{Until: *attempts.LockedUntil, Locked: true}
+	}
+	if attempts.Failures == 0 || attempts.LastFailureAt.Before(now.Add(-failuresWindow)) {
+		return nil
+	}
+	if until := attempts.LastFailureAt.Add(loginDelay(attempts.Failures)); now.Before(until) {
+		return &LoginBlockedError{Until: until}
+	}
+	return nil
+}
+
+// checkAttempts returns LoginBlockedError if attempts of the username or in the chat aren't allowed yet
+func (a *Auth) checkAttempts(ctx context.Context, username string, chatID int64, now time.Time) error {
+	for _, key := range []string{userAttemptsKey(username), chatAttemptsKey(chatID)} {
+		attempts, err := a.attempts.Get(ctx, key)
+		if err != nil {
+			return err
+		}
+		if err := blocked(attempts, now); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// fail counts the failed attempt in the chat and of the user if the user exists.
+// It returns LoginBlockedError when the account gets locked
+func (a *Auth) fail(ctx context.Context, user *model.User, chatID int64, now time.Time) error {
+	if _, err := a.attempts.Fail(ctx, chatAttemptsKey(chatID), now, now.Add(-failuresWindow)); err != nil {
+		return err
+	}
+	if user == nil {
+		return nil
+	}
+	attempts, err := a.attempts.Fail(ctx, userAttemptsKey(user.Username), now, now.Add(-failuresWindow))
+	if err != nil {
+		return err
+	}
+	if attempts.Failures < maxLoginFailures {
+		return nil
+	}
+	until := now.Add(lockDuration)
+	if err = a.attempts.Lock(ctx, userAttemptsKey(user.Username), until); err != nil {
+		return err
+	}
+	return &LoginBlockedError{Until: until, Locked: true, OwnerChatID: user.ChatID}
+}
+
+func (a *Auth) resetAttempts(ctx context.Context, username string, chatID int64) error {
+	if err := a.attempts.Reset(ctx, userAttemptsKey(username)); err != nil {
+		return err
+	}
+	return a.attempts.Reset(ctx, chatAttemptsKey(chatID))
+}
@@ -0,0 +1,156 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+
+	"github.com/chucky-1/finance/internal/model"
+	"github.com/chucky-1/finance/internal/repository/mocks"
+)
+
+type fakeLoginAttempts struct {
+	mu       sync.Mutex
+	attempts map[string]*model.LoginAttempts
+}
+
+func newFakeLoginAttempts() *fakeLoginAttempts {
+	return &fakeLoginAttempts{attempts: make(map[string]*model.LoginAttempts)}
+}
+
+func (f *fakeLoginAttempts) Get(_ context.Context, key string) (*model.LoginAttempts, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	attempts, ok := f.attempts[key]
+	if !ok {
+		return nil, nil
+	}
+	copied := *attempts
+	return &copied, nil
+}
+
+func (f *fakeLoginAttempts) Fail(_ context.Context, key string, now, windowStart time.Time) (*model.LoginAttempts, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	attempts, ok := f.attempts[key]
+	if !ok || attempts.LastFailureAt.Before(windowStart) {
+		fresh := &model.LoginAttempts{Key: key}
+		if ok {
+			fresh.LockedUntil = attempts.LockedUntil
+		}
+		attempts = fresh
+		f.attempts[key] = attempts
+	}
+	attempts.Failures++
+	attempts.LastFailureAt = now
+	copied := *attempts
+	return &copied, nil
+}
+
+func (f *fakeLoginAttempts) Lock(_ context.Context, key string, until time.Time) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.attempts[key].Failures = 0
+	f.attempts[key].LockedUntil = &until
+	return nil
+}
+
+func (f *fakeLoginAttempts) Reset(_ context.Context, key string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	delete(f.attempts, key)
+	return nil
+}
+
+// failBefore moves the last failure back in time as if the delay has passed
+func (f *fakeLoginAttempts) failBefore(key string, ago time.Duration) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.attempts[key].LastFailureAt = f.attempts[key].LastFailureAt.Add(-ago)
+}
+
+func TestLoginDelay(t *testing.T) {
+	require.Equal(t, time.Duration(0), loginDelay(2))
+	require.Equal(t, 5*time.Second, loginDelay(3))
+	require.Equal(t, 10*time.Second, loginDelay(4))
+	require.Equal(t, 40*time.Second, loginDelay(6))
+	require.Equal(t, maxLoginDelay, loginDelay(20))
+}
+
+func TestAuth_LoginDelayAndLock(t *testing.T) {
+	ctx := context.Background()
+	hash, err := hashPassword("secret")
+	require.NoError(t, err)
+	userRepo := new(mocks.User)
+	userRepo.On("Get", mock.Anything, "dima").Return(&model.User{Username: "dima", Password: hash, ChatID: 1}, nil)
+	attempts := newFakeLoginAttempts()
+	auth := NewAuth(userRepo, attempts, "")
+
+	for i := 0; i < freeLoginAttempts; i++ {
+		_, err = auth.Login(ctx, "dima", "wrong", 2)
+		require.Equal(t, WrongPasswordErr, err)
+	}
+	_, err = auth.Login(ctx, "dima", "secret", 2)
+	var blockedErr *LoginBlockedError
+	require.True(t, errors.As(err, &blockedErr), "the right password must wait too")
+	require.False(t, blockedErr.Locked)
+
+	for i := freeLoginAttempts; i < maxLoginFailures-1; i++ {
+		attempts.failBefore(userAttemptsKey("dima"), maxLoginDelay)
+		attempts.failBefore(chatAttemptsKey(2), maxLoginDelay)
+		_, err = auth.Login(ctx, "dima", "wrong", 2)
+		require.Equal(t, WrongPasswordErr, err)
+	}
+	attempts.failBefore(userAttemptsKey("dima"), maxLoginDelay)
+	attempts.failBefore(chatAttemptsKey(2), maxLoginDelay)
+	_, err = auth.Login(ctx, "dima", "wrong", 2)
+	require.True(t, errors.As(err, &blockedErr))
+	require.True(t, blockedErr.Locked)
+	require.Equal(t, int64(1), blockedErr.OwnerChatID)
+
+	// the lock applies to every chat, but the owner is notified only once
+	_, err = auth.Login(ctx, "dima", "secret", 1)
+	require.True(t, errors.As(err, &blockedErr))
+	require.True(t, blockedErr.Locked)
+	require.Zero(t, blockedErr.OwnerChatID)
+
+	require.NoError(t, auth.Unlock(ctx, "dima"))
+	user, err := auth.Login(ctx, "dima", "secret", 1)
+	require.NoError(t, err)
+	require.Equal(t, "dima", user.Username)
+}
+
+func TestAuth_LoginDelaysGuessesOfUsernamesInChat(t *testing.T) {
+	ctx := context.Background()
+	userRepo := new(mocks.User)
+	userRepo.On("Get", mock.Anything, mock.Anything).Return(nil, nil)
+	auth := NewAuth(userRepo, newFakeLoginAttempts(), "")
+
+	for i := 0; i < freeLoginAttempts; i++ {
+		_, err := auth.Login(ctx, "user"+string(rune('a'+i)), "secret", 2)
+		require.Equal(t, UserNotFoundErr, err)
+	}
+	_, err := auth.Login(ctx, "anna", "secret", 2)
+	var blockedErr *LoginBlockedError
+	require.True(t, errors.As(err, &blockedErr))
+
+	_, err = auth.Login(ctx, "anna", "secret", 3)
+	require.Equal(t, UserNotFoundErr, err)
+}
+
+func TestAuth_LoginBindsChat(t *testing.T) {
+	hash, err := hashPassword("secret")
+	require.NoError(t, err)
+	userRepo := mocks.NewUser(t)
+	userRepo.On("Get", mock.Anything, "dima").Return(&model.User{Username: "dima", Password: hash, ChatID: 1}, nil)
+	userRepo.On("SetChat", mock.Anything, "dima", int64(2)).Return(nil)
+
+	user, err := NewAuth(userRepo, newFakeLoginAttempts(), "").Login(context.Background(), "dima", "secret", 2)
+	require.NoError(t, err)
+	require.Equal(t, int64(2), user.ChatID)
+}
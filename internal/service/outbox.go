@@ -0,0 +1,80 @@
+package service
+
+import (
+	"context"
+	"github.com/chucky-1/finance/internal/model"
+	"github.com/chucky-1/finance/internal/repository"
+	"time"
+)
+
+const (
+	dueReportsLimit  = 100
+	deadReportsLimit = 100
+	firstRetryDelay  = 30 * time.Second
+	maxRetryDelay    = time.Hour
+)
+
+// Outbox keeps generated reports until they are delivered
+type Outbox struct {
+	repo        repository.Outbox
+	maxAttempts int
+}
+
+func NewOutbox(repo repository.Outbox, maxAttempts int) *Outbox {
+	return &Outbox{
+		repo:        repo,
+		maxAttempts: maxAttempts,
+	}
+}
+
+// Enqueue puts the report which is due at the time, the past time delivers it right away.
+// It returns repository.ReportAlreadyIssuedErr if the report for this period has already been enqueued
+func (o *Outbox) Enqueue(ctx context.Context, username, period, periodKey, text string, deliverAt time.Time) error {
+	return o.repo.Add(ctx, &model.Report{
+		Username:      username,
+		Period:        period,
+		PeriodKey:     periodKey,
+		Text:          text,
+		NextAttemptAt: deliverAt.UTC(),
+	})
+}
+
+func (o *Outbox) Due(ctx context.Context, now time.Time) ([]*model.Report, error) {
+	return o.repo.GetDue(ctx, now, dueReportsLimit)
+}
+
+func (o *Outbox) Delivered(ctx context.Context, report *model.Report, now time.Time) error {
+	return o.repo.MarkDelivered(ctx, report.ID, now)
+}
+
+// Failed schedules the next attempt with exponential backoff.
+// When attempts run out, the report goes to the dead letters
+func (o *Outbox) Failed(ctx context.Context, report *model.Report, sendErr error, now time.Time) error {
+	attempts := report.Attempts + 1
+	return o.repo.MarkFailed(ctx, report.ID, sendErr.Error(), now, now.Add(retryDelay(attempts)), attempts >= o.maxAttempts)
+}
+
+// Skipped closes the report which won't be sent, it's neither delivered nor retried
+func (o *Outbox) Skipped(ctx context.Context, report *model.Report, reason error) error {
+	return o.repo.MarkSkipped(ctx, report.ID, reason.Error())
+}
+
+func (o *Outbox) DeadLetters(ctx context.Context) ([]*model.Report, error) {
+	return o.repo.GetDead(ctx, deadReportsLimit)
+}
+
+func (o *Outbox) Replay(ctx context.Context, id int64) error {
+	return o.repo.Replay(ctx, id, time.Now().UTC())
+}
+
+// retryDelay returns the delay before the next attempt: 30s, 1m, 2m, 4m ... but no more than an hour
+func retryDelay(attempts int) time.Duration {
+	delay := firstRetryDelay
+	for i := 1; i < attempts; i++ {
+		delay *= 2
+		if delay >= maxRetryDelay {
+			return maxRetryDelay
+		}
+	}
+	return delay
+}
@@ -0,0 +1,42 @@
+package service
+
+import (
+	"github.com/stretchr/testify/require"
+	"testing"
+	"time"
+)
+
+func TestOutbox_RetryDelay(t *testing.T) {
+	testTable := []struct {
+		name     string
+		attempts int
+		result   time.Duration
+	}{
+		{
+			name:     "First attempt",
+			attempts: 1,
+			result:   30 * time.Second,
+		},
+		{
+			name:     "Third attempt",
+			attempts: 3,
+			result:   2 * time.Minute,
+		},
+		{
+			name:     "Capped by an hour",
+			attempts: 8,
+			result:   time.Hour,
+		},
+		{
+			name:     "Many attempts",
+			attempts: 100,
+			result:   time.Hour,
+		},
+	}
+
+	for _, testCase := range testTable {
+		t.Run(testCase.name, func(t *testing.T) {
+			require.Equal(t, testCase.result, retryDelay(testCase.attempts))
+		})
+	}
+}
@@ -0,0 +1,97 @@
+package service
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+
+	"golang.org/x/crypto/argon2"
+)
+
+// argon2id parameters of new hashes, hashes with other parameters are upgraded on login
+const (
+	argon2Prefix    = "$argon2id$"
+	argon2Time      = 1
+	argon2Memory    = 64 * 1024
+	argon2Threads   = 4
+	argon2KeyLength = 32
+	argon2SaltSize  = 16
+)
+
+var invalidHashErr = errors.New("invalid password hash")
+
+// argon2Hash is a hash in the PHC string format: $argon2id$v=19$m=65536,t=1,p=4$<salt>$<key>
+type argon2Hash struct {
+	memory  uint32
+	time    uint32
+	threads uint8
+	salt    []byte
+	key     []byte
+}
+
+// hashPassword returns the argon2id hash of the password with a random salt
+func hashPassword(password string) (string, error) {
+	salt := make([]byte, argon2SaltSize)
+	if _, err := rand.Read(salt); err != nil {
+		return "", fmt.Errorf("couldn't generate salt: %v", err)
+	}
+	hash := &argon2Hash{
+		memory:  argon2Memory,
+		time:    argon2Time,
+		threads: argon2Threads,
+		salt:    salt,
+		key:     argon2.IDKey([]byte(password), salt, argon2Time, argon2Memory, argon2Threads, argon2KeyLength),
+	}
+	return hash.String(), nil
+}
+
+// verifyPassword compares the password with the argon2id hash.
+// needsRehash is true when the hash was made with other parameters than new hashes
+func verifyPassword(encoded, password string) (ok, needsRehash bool, err error) {
+	hash, err := parseArgon2Hash(encoded)
+	if err != nil {
+		return false, false, err
+	}
+	key := argon2.IDKey([]byte(password), hash.salt, hash.time, hash.memory, hash.threads, uint32(len(hash.key)))
+	if subtle.ConstantTimeCompare(key, hash.key) != 1 {
+		return false, false, nil
+	}
+	needsRehash = hash.memory != argon2Memory || hash.time != argon2Time || hash.threads != argon2Threads ||
+		len(hash.key) != argon2KeyLength
+	return true, needsRehash, nil
+}
+
+func isArgon2Hash(encoded string) bool {
+	return strings.HasPrefix(encoded, argon2Prefix)
+}
+
+func parseArgon2Hash(encoded string) (*argon2Hash, error) {
+	parts := strings.Split(encoded, "$")
+	if len(parts) != 6 || parts[1] != "argon2id" {
+		return nil, invalidHashErr
+	}
+	var version int
+	if _, err := fmt.Sscanf(parts[2], "v=%d", &version); err != nil || version != argon2.Version {
+		return nil, invalidHashErr
+	}
+	var hash argon2Hash
+	if _, err := fmt.Sscanf(parts[3], "m=%d,t=%d,p=%d", &hash.memory, &hash.time, &hash.threads); err != nil {
+		return nil, invalidHashErr
+	}
+	var err error
+	if hash.salt, err = base64.RawStdEncoding.DecodeString(parts[4]); err != nil {
+		return nil, invalidHashErr
+	}
+	if hash.key, err = base64.RawStdEncoding.DecodeString(parts[5]); err != nil || len(hash.key) == 0 {
+		return nil, invalidHashErr
+	}
+	return &hash, nil
+}
+
+func (h *argon2Hash) String() string {
+	return fmt.Sprintf("%sv=%d$m=%d,t=%d,p=%d$%s$%s", argon2Prefix, argon2.Version, h.memory, h.time, h.threads,
+		base64.RawStdEncoding.EncodeToString(h.salt), base64.RawStdEncoding.EncodeToString(h.key))
+}
@@ -0,0 +1,36 @@
+package service
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestHashPassword(t *testing.T) {
+	hashOne, err := hashPassword("secret")
+	require.NoError(t, err)
+	hashTwo, err := hashPassword("secret")
+	require.NoError(t, err)
+	require.NotEqual(t, hashOne, hashTwo, "salts must be random")
+
+	ok, _, err := verifyPassword(hashOne, "secret")
+	require.NoError(t, err)
+	require.True(t, ok)
+	ok, _, err = verifyPassword(hashOne, "Secret")
+	require.NoError(t, err)
+	require.False(t, ok)
+}
+
+func TestVerifyPassword_InvalidHash(t *testing.T) {
+	for _, hash := range []string{
+		"",
+		"$argon2id$v=19$m=65536,t=1,p=4$c2FsdA",
+		"$argon2i$v=19$m=65536,t=1,p=4$c2FsdA$a2V5",
+		"$argon2id$v=16$m=65536,t=1,p=4$c2FsdA$a2V5",
+		"$argon2id$v=19$m=65536$c2FsdA$a2V5",
+		"$argon2id$v=19$m=65536,t=1,p=4$c2FsdA$!!!",
+	} {
+		_, _, err := verifyPassword(hash, "secret")
+		require.Equalf(t, invalidHashErr, err, "hash %q", hash)
+	}
+}
@@ -4,26 +4,251 @@ import (
 	"context"
 	"github.com/chucky-1/finance/internal/model"
 	"github.com/chucky-1/finance/internal/repository"
+	"github.com/sirupsen/logrus"
+	"time"
 )
 
 const (
 	monthlyPeriod = "2006-01"
-	dailyPeriod   = "today"
+	// financialPeriod is the key of financial months which don't begin on the 1st, it's their first day
+	financialPeriod = "2006-01-02"
+	dailyPeriod     = "today"
 )
 
 type Recorder struct {
-	repo repository.Recorder
+	repo    repository.Recorder
+	entries repository.Entries
 }
 
-func NewRecorder(repo repository.Recorder) *Recorder {
+func NewRecorder(repo repository.Recorder, entries repository.Entries) *Recorder {
 	return &Recorder{
-		repo: repo,
+		repo:    repo,
+		entries: entries,
 	}
 }
 
-func (f *Recorder) Add(ctx context.Context, entry *model.Entry) error {
-	if err := f.repo.Add(ctx, entry, entry.Date.Format(monthlyPeriod)); err != nil {
+// Add keeps the entry and adds it to the aggregated periods. The timezone of the user tells
+// whether the entry belongs to the current day, which is reported at the end of the day,
+// and with the month start it tells the financial month of the entry. The month is kept in the entry,
+// so the entry is taken from the same month when it changes after the settings do
+func (f *Recorder) Add(ctx context.Context, entry *model.Entry, timezone *time.Location, monthStart int) error {
+	entry.MonthKey = MonthKey(entry.Date, timezone, monthStart)
+	if err := f.entries.AddEntry(ctx, entry); err != nil {
 		return err
 	}
-	return f.repo.Add(ctx, entry, dailyPeriod)
+	return f.aggregate(ctx, entry, entry.Category.Amount, timezone)
+}
+
+func (f *Recorder) Entry(ctx context.Context, kind, username, id string) (*model.Entry, error) {
+	return f.entries.GetEntry(ctx, kind, username, id)
+}
+
+// Entries returns entries of the user from the beginning to the end of the range, not including the end
+func (f *Recorder) Entries(ctx context.Context, kind, username string, from, to time.Time) ([]*model.Entry, error) {
+	return f.entries.GetEntries(ctx, kind, username, from, to)
+}
+
+// Update replaces the category, the amount and the date of the entry and moves the amount between aggregated periods.
+// The old amount is taken from the month it was added to, the new one goes to the month by the current settings
+func (f *Recorder) Update(ctx context.Context, entry *model.Entry, timezone *time.Location, monthStart int) error {
+	old, err := f.entries.GetEntry(ctx, entry.Kind, entry.User, entry.ID)
+	if err != nil {
+		return err
+	}
+	old.MonthKey = entryMonthKey(old, timezone, monthStart)
+	entry.MonthKey = MonthKey(entry.Date, timezone, monthStart)
+	if err = f.entries.UpdateEntry(ctx, entry); err != nil {
+		return err
+	}
+	if err = f.aggregate(ctx, old, -old.Category.Amount, timezone); err != nil {
+		return err
+	}
+	return f.aggregate(ctx, entry, entry.Category.Amount, timezone)
+}
+
+func (f *Recorder) Delete(ctx context.Context, kind, username, id string, timezone *time.Location, monthStart int) error {
+	entry, err := f.entries.GetEntry(ctx, kind, username, id)
+	if err != nil {
+		return err
+	}
+	if err = f.entries.DeleteEntry(ctx, kind, username, id); err != nil {
+		return err
+	}
+	entry.MonthKey = entryMonthKey(entry, timezone, monthStart)
+	return f.aggregate(ctx, entry, -entry.Category.Amount, timezone)
+}
+
+// ChangeMonthStart moves expenses of the user between financial months when the month start changes. Only entries
+// since the beginning of the current month by the previous or the new start are moved, earlier months are already reported.
+// Entries keep their months, so the change is undone by the change back even if it has failed partway
+func (f *Recorder) ChangeMonthStart(ctx context.Context, username string, timezone *time.Location, previous, monthStart int, nowUTC time.Time) error {
+	var from, to time.Time
+	for _, start := range []int{previous, monthStart} {
+		monthFrom, monthTo, err := MonthRange(MonthKey(nowUTC, timezone, start), timezone, start)
+		if err != nil {
+			return err
+		}
+		if from.IsZero() || monthFrom.Before(from) {
+			from = monthFrom
+		}
+		if monthTo.After(to) {
+			to = monthTo
+		}
+	}
+	entries, err := f.entries.GetEntries(ctx, "expenses", username, from, to)
+	if err != nil {
+		return err
+	}
+	// old entries get their months before any entry is moved, otherwise the change back would take them by the new start
+	for _, entry := range entries {
+		if entry.MonthKey != "" {
+			continue
+		}
+		entry.MonthKey = MonthKey(entry.Date, timezone, previous)
+		if err = f.entries.UpdateEntry(ctx, entry); err != nil {
+			return err
+		}
+	}
+	for _, entry := range entries {
+		previousKey, key := entry.MonthKey, MonthKey(entry.Date, timezone, monthStart)
+		if previousKey == key {
+			continue
+		}
+		if err = f.move(ctx, entry, previousKey, key); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// move moves the amount of the entry from the month to another one. The steps which are done are undone if the next one
+// fails, so the entry and the months agree unless the undo fails too
+func (f *Recorder) move(ctx context.Context, entry *model.Entry, from, to string) error {
+	entry.MonthKey = to
+	if err := f.entries.UpdateEntry(ctx, entry); err != nil {
+		return err
+	}
+	err := f.repo.Add(ctx, monthlyDelta(entry, -entry.Category.Amount), from)
+	if err == nil {
+		if err = f.repo.Add(ctx, monthlyDelta(entry, entry.Category.Amount), to); err == nil {
+			return nil
+		}
+		if undoErr := f.repo.Add(ctx, monthlyDelta(entry, entry.Category.Amount), from); undoErr != nil {
+			logrus.Errorf("recorder couldn't return %.2f of entry %s to %s: %v", entry.Category.Amount, entry.ID, from, undoErr)
+		}
+	}
+	entry.MonthKey = from
+	if undoErr := f.entries.UpdateEntry(ctx, entry); undoErr != nil {
+		logrus.Errorf("recorder couldn't return entry %s to %s: %v", entry.ID, from, undoErr)
+	}
+	return err
+}
+
+// entryMonthKey returns the month which the entry was added to, entries which don't keep it are taken
+// by the settings
+func entryMonthKey(entry *model.Entry, timezone *time.Location, monthStart int) string {
+	if entry.MonthKey != "" {
+		return entry.MonthKey
+	}
+	return MonthKey(entry.Date, timezone, monthStart)
+}
+
+// aggregate adds the amount to the month of the entry and to the current day if the entry is in it
+func (f *Recorder) aggregate(ctx context.Context, entry *model.Entry, amount float64, timezone *time.Location) error {
+	delta := monthlyDelta(entry, amount)
+	if err := f.repo.Add(ctx, delta, entry.MonthKey); err != nil {
+		return err
+	}
+	if !inCurrentDay(entry.Date, time.Now().UTC(), timezone) {
+		return nil
+	}
+	return f.repo.Add(ctx, delta, dailyPeriod)
+}
+
+// monthlyDelta returns the change of the category of the entry in the aggregated periods
+func monthlyDelta(entry *model.Entry, amount float64) *model.Entry {
+	return &model.Entry{
+		Kind: entry.Kind,
+		User: entry.User,
+		Date: entry.Date,
+		Category: &model.Category{
+			Name:   entry.Category.Name,
+			Amount: amount,
+		},
+	}
+}
+
+// inCurrentDay returns true if the date is in the current day of the timezone, older entries are already reported
+func inCurrentDay(date, nowUTC time.Time, timezone *time.Location) bool {
+	return !date.Before(DayStart(nowUTC, timezone))
+}
+
+// DayStart returns the beginning of the day of the timezone in UTC
+func DayStart(timeUTC time.Time, timezone *time.Location) time.Time {
+	local := timeUTC.In(timezone)
+	return time.Date(local.Year(), local.Month(), local.Day(), 0, 0, 0, 0, timezone).UTC()
+}
+
+// MonthStart returns the beginning of the financial month of the timezone in UTC.
+// The month begins on the day from 1 to 28, 0 is the calendar month
+func MonthStart(timeUTC time.Time, timezone *time.Location, monthStart int) time.Time {
+	local := timeUTC.In(timezone)
+	day := monthStartDay(monthStart)
+	month := local.Month()
+	if local.Day() < day {
+		month--
+	}
+	return localMidnight(local.Year(), month, day, timezone)
+}
+
+// MonthRange returns the beginning and the end of the financial month by its key in UTC, e.g. 2023-06-10 is from June 10
+// to July 10. The month like 2023-06 begins on the month start day
+func MonthRange(key string, timezone *time.Location, monthStart int) (time.Time, time.Time, error) {
+	first, err := MonthFirstDay(key, monthStart)
+	if err != nil {
+		return time.Time{}, time.Time{}, err
+	}
+	from := localMidnight(first.Year(), first.Month(), first.Day(), timezone)
+	return from, localMidnight(first.Year(), first.Month()+1, first.Day(), timezone), nil
+}
+
+// MonthFirstDay returns the date of the first day of the financial month by its key, the month like 2023-06
+// begins on the month start day
+func MonthFirstDay(key string, monthStart int) (time.Time, error) {
+	if first, err := time.Parse(financialPeriod, key); err == nil {
+		return first, nil
+	}
+	month, err := time.Parse(monthlyPeriod, key)
+	if err != nil {
+		return time.Time{}, err
+	}
+	return month.AddDate(0, 0, monthStartDay(monthStart)-1), nil
+}
+
+// MonthKey returns the key of the financial month of the time. It's the month like 2023-06 for calendar months and
+// the first day like 2023-06-10 for months which begin on another day, so different months never have the same key
+func MonthKey(timeUTC time.Time, timezone *time.Location, monthStart int) string {
+	first := MonthStart(timeUTC, timezone, monthStart).In(timezone)
+	if monthStartDay(monthStart) == 1 {
+		return first.Format(monthlyPeriod)
+	}
+	return first.Format(financialPeriod)
+}
+
+func monthStartDay(monthStart int) int {
+	if monthStart < 1 {
+		return 1
+	}
+	return monthStart
+}
+
+// localMidnight returns the beginning of the day of the timezone in UTC. The clocks may go forward at midnight,
+// then the day starts at 01:00, but time.Date returns 23:00 of the previous day
+func localMidnight(year int, month time.Month, day int, timezone *time.Location) time.Time {
+	midnight := time.Date(year, month, day, 0, 0, 0, 0, timezone)
+	date := time.Date(year, month, day, 0, 0, 0, 0, time.UTC).Format(dailyKey)
+	for midnight.In(timezone).Format(dailyKey) < date {
+		midnight = midnight.Add(time.Hour)
+	}
+	return midnight.UTC()
 }
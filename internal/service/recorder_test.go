@@ -0,0 +1,237 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"github.com/chucky-1/finance/internal/model"
+	"github.com/chucky-1/finance/internal/repository"
+	"github.com/stretchr/testify/require"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestRecorder_DayAndMonthStart(t *testing.T) {
+	testTable := []struct {
+		name       string
+		timeUTC    time.Time
+		timezone   string
+		dayStart   time.Time
+		monthStart time.Time
+	}{
+		{
+			name:       "UTC",
+			timezone:   "UTC",
+			timeUTC:    time.Date(2023, 6, 28, 12, 0, 0, 0, time.UTC),
+			dayStart:   time.Date(2023, 6, 28, 0, 0, 0, 0, time.UTC),
+			monthStart: time.Date(2023, 6, 1, 0, 0, 0, 0, time.UTC),
+		},
+		{
+			name:       "Next day and month in the timezone",
+			timeUTC:    time.Date(2023, 6, 30, 22, 0, 0, 0, time.UTC),
+			timezone:   "Europe/Minsk",
+			dayStart:   time.Date(2023, 6, 30, 21, 0, 0, 0, time.UTC),
+			monthStart: time.Date(2023, 6, 30, 21, 0, 0, 0, time.UTC),
+		},
+		{
+			name:       "Previous day in the timezone",
+			timeUTC:    time.Date(2023, 6, 28, 5, 0, 0, 0, time.UTC),
+			timezone:   "America/Los_Angeles",
+			dayStart:   time.Date(2023, 6, 27, 7, 0, 0, 0, time.UTC),
+			monthStart: time.Date(2023, 6, 1, 7, 0, 0, 0, time.UTC),
+		},
+		{
+			name:       "Daylight saving time starts during the day",
+			timeUTC:    time.Date(2023, 3, 26, 12, 0, 0, 0, time.UTC),
+			timezone:   "Europe/Warsaw",
+			dayStart:   time.Date(2023, 3, 25, 23, 0, 0, 0, time.UTC),
+			monthStart: time.Date(2023, 2, 28, 23, 0, 0, 0, time.UTC),
+		},
+	}
+
+	for _, testCase := range testTable {
+		t.Run(testCase.name, func(t *testing.T) {
+			timezone, err := LoadLocation(testCase.timezone)
+			require.NoError(t, err)
+			require.Equal(t, testCase.dayStart, DayStart(testCase.timeUTC, timezone))
+			require.Equal(t, testCase.monthStart, MonthStart(testCase.timeUTC, timezone, 0))
+		})
+	}
+}
+
+func TestRecorder_InCurrentDay(t *testing.T) {
+	minsk, err := LoadLocation("Europe/Minsk")
+	require.NoError(t, err)
+	now := time.Date(2023, 6, 28, 22, 0, 0, 0, time.UTC)
+	require.True(t, inCurrentDay(now, now, minsk))
+	require.True(t, inCurrentDay(time.Date(2023, 6, 28, 21, 0, 0, 0, time.UTC), now, minsk))
+	require.False(t, inCurrentDay(time.Date(2023, 6, 28, 20, 59, 0, 0, time.UTC), now, minsk))
+	require.True(t, inCurrentDay(time.Date(2023, 6, 28, 0, 0, 0, 0, time.UTC), now, time.UTC))
+}
+
+// fakePeriods keeps entries and sums of categories by periods like 2023-06
+type fakePeriods struct {
+	entries []*model.Entry
+	periods map[string]map[string]float64
+	// failPeriod fails the next addition to the period
+	failPeriod string
+}
+
+func (f *fakePeriods) Add(_ context.Context, entry *model.Entry, period string) error {
+	if period == f.failPeriod {
+		f.failPeriod = ""
+		return errors.New("mongo is unavailable")
+	}
+	if f.periods[period] == nil {
+		f.periods[period] = make(map[string]float64)
+	}
+	f.periods[period][entry.Category.Name] += entry.Category.Amount
+	return nil
+}
+
+func (f *fakePeriods) AddEntry(_ context.Context, entry *model.Entry) error {
+	entry.ID = strconv.Itoa(len(f.entries) + 1)
+	f.entries = append(f.entries, copyEntry(entry))
+	return nil
+}
+
+func (f *fakePeriods) GetEntry(_ context.Context, _, _, id string) (*model.Entry, error) {
+	for _, entry := range f.entries {
+		if entry.ID == id {
+			return copyEntry(entry), nil
+		}
+	}
+	return nil, repository.EntryNotFoundErr
+}
+
+func (f *fakePeriods) GetEntries(_ context.Context, _, _ string, from, to time.Time) ([]*model.Entry, error) {
+	entries := make([]*model.Entry, 0)
+	for _, entry := range f.entries {
+		if !entry.Date.Before(from) && entry.Date.Before(to) {
+			entries = append(entries, entry)
+		}
+	}
+	return entries, nil
+}
+
+func (f *fakePeriods) UpdateEntry(_ context.Context, entry *model.Entry) error {
+	for i := range f.entries {
+		if f.entries[i].ID == entry.ID {
+			f.entries[i] = copyEntry(entry)
+			return nil
+		}
+	}
+	return repository.EntryNotFoundErr
+}
+
+// copyEntry keeps the entry apart from the one of the caller
+func copyEntry(entry *model.Entry) *model.Entry {
+	category := *entry.Category
+	e := *entry
+	e.Category = &category
+	return &e
+}
+
+func (f *fakePeriods) DeleteEntry(_ context.Context, _, _, id string) error {
+	for i := range f.entries {
+		if f.entries[i].ID == id {
+			f.entries = append(f.entries[:i], f.entries[i+1:]...)
+			return nil
+		}
+	}
+	return repository.EntryNotFoundErr
+}
+
+func TestRecorder_FinancialMonth(t *testing.T) {
+	minsk, err := LoadLocation("Europe/Minsk")
+	require.NoError(t, err)
+	// months begin on the 10th, July 5 is in the month which has begun on June 10
+	require.Equal(t, time.Date(2023, 6, 9, 21, 0, 0, 0, time.UTC), MonthStart(time.Date(2023, 7, 5, 12, 0, 0, 0, time.UTC), minsk, 10))
+	require.Equal(t, "2023-06-10", MonthKey(time.Date(2023, 7, 9, 20, 59, 0, 0, time.UTC), minsk, 10))
+	require.Equal(t, "2023-07-10", MonthKey(time.Date(2023, 7, 9, 21, 0, 0, 0, time.UTC), minsk, 10))
+	require.Equal(t, "2023-12-10", MonthKey(time.Date(2024, 1, 5, 0, 0, 0, 0, time.UTC), minsk, 10))
+	// the calendar month keeps its key, so it never matches a financial month
+	require.Equal(t, "2023-06", MonthKey(time.Date(2023, 6, 9, 20, 59, 0, 0, time.UTC), minsk, 1))
+
+	from, to, err := MonthRange("2023-12-10", minsk, 0)
+	require.NoError(t, err)
+	require.Equal(t, time.Date(2023, 12, 9, 21, 0, 0, 0, time.UTC), from)
+	require.Equal(t, time.Date(2024, 1, 9, 21, 0, 0, 0, time.UTC), to)
+	// the month without the day begins on the month start day
+	monthFrom, monthTo, err := MonthRange("2023-12", minsk, 10)
+	require.NoError(t, err)
+	require.Equal(t, from, monthFrom)
+	require.Equal(t, to, monthTo)
+}
+
+func TestRecorder_AddToFinancialMonth(t *testing.T) {
+	ctx := context.Background()
+	minsk, err := LoadLocation("Europe/Minsk")
+	require.NoError(t, err)
+	periods := &fakePeriods{periods: make(map[string]map[string]float64)}
+	recorder := NewRecorder(periods, periods)
+
+	for _, day := range []int{5, 12} {
+		entry := &model.Entry{Kind: "expenses", User: "dima", Date: time.Date(2023, 7, day, 12, 0, 0, 0, time.UTC),
+			Category: &model.Category{Name: "Кофе", Amount: float64(day)}}
+		require.NoError(t, recorder.Add(ctx, entry, minsk, 10))
+	}
+	require.Equal(t, map[string]float64{"Кофе": 5}, periods.periods["2023-06-10"])
+	require.Equal(t, map[string]float64{"Кофе": 12}, periods.periods["2023-07-10"])
+}
+
+func TestRecorder_ChangeMonthStart(t *testing.T) {
+	ctx := context.Background()
+	minsk, err := LoadLocation("Europe/Minsk")
+	require.NoError(t, err)
+	periods := &fakePeriods{periods: make(map[string]map[string]float64)}
+	recorder := NewRecorder(periods, periods)
+	for _, date := range []time.Time{
+		time.Date(2023, 5, 20, 12, 0, 0, 0, time.UTC),
+		time.Date(2023, 6, 3, 12, 0, 0, 0, time.UTC),
+		time.Date(2023, 6, 12, 12, 0, 0, 0, time.UTC),
+	} {
+		entry := &model.Entry{Kind: "expenses", User: "dima", Date: date, Category: &model.Category{Name: "Кофе", Amount: float64(date.Day())}}
+		require.NoError(t, recorder.Add(ctx, entry, minsk, 0))
+	}
+
+	// June 3 is before the payday, so it's in the month which has begun on May 10, May 20 has already been reported
+	require.NoError(t, recorder.ChangeMonthStart(ctx, "dima", minsk, 0, 10, time.Date(2023, 6, 15, 12, 0, 0, 0, time.UTC)))
+	require.Equal(t, map[string]float64{"Кофе": 20}, periods.periods["2023-05"])
+	require.Equal(t, map[string]float64{"Кофе": 3}, periods.periods["2023-05-10"])
+	require.Equal(t, map[string]float64{"Кофе": 12}, periods.periods["2023-06-10"])
+	require.Equal(t, map[string]float64{"Кофе": 0}, periods.periods["2023-06"])
+	// the entries keep their new months
+	require.Equal(t, []string{"2023-05", "2023-05-10", "2023-06-10"},
+		[]string{periods.entries[0].MonthKey, periods.entries[1].MonthKey, periods.entries[2].MonthKey})
+}
+
+func TestRecorder_UpdateDeleteAfterSettingsChange(t *testing.T) {
+	ctx := context.Background()
+	minsk, err := LoadLocation("Europe/Minsk")
+	require.NoError(t, err)
+	periods := &fakePeriods{periods: make(map[string]map[string]float64)}
+	recorder := NewRecorder(periods, periods)
+
+	// it's July 1 in Minsk, but still June 30 in UTC
+	coffee := &model.Entry{Kind: "expenses", User: "dima", Date: time.Date(2023, 6, 30, 22, 30, 0, 0, time.UTC),
+		Category: &model.Category{Name: "Кофе", Amount: 3.5}}
+	require.NoError(t, recorder.Add(ctx, coffee, minsk, 0))
+	food := &model.Entry{Kind: "expenses", User: "dima", Date: time.Date(2023, 6, 12, 12, 0, 0, 0, time.UTC),
+		Category: &model.Category{Name: "Еда", Amount: 12}}
+	require.NoError(t, recorder.Add(ctx, food, minsk, 0))
+	require.Equal(t, map[string]float64{"Кофе": 3.5}, periods.periods["2023-07"])
+
+	// the timezone and the month start have changed, the amounts are taken from the months they were added to
+	require.NoError(t, recorder.Delete(ctx, "expenses", "dima", coffee.ID, time.UTC, 0))
+	require.Equal(t, map[string]float64{"Кофе": 0}, periods.periods["2023-07"])
+	require.Equal(t, map[string]float64{"Еда": 12}, periods.periods["2023-06"])
+
+	food.Category.Amount = 10
+	require.NoError(t, recorder.Update(ctx, food, minsk, 10))
+	require.Equal(t, map[string]float64{"Еда": 0}, periods.periods["2023-06"])
+	require.Equal(t, map[string]float64{"Еда": 10}, periods.periods["2023-06-10"])
+	stored, err := periods.GetEntry(ctx, "expenses", "dima", food.ID)
+	require.NoError(t, err)
+	require.Equal(t, "2023-06-10", stored.MonthKey)
+}
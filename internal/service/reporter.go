@@ -1,38 +1,106 @@
 package service
 
 import (
+	"container/heap"
 	"context"
 	"github.com/sirupsen/logrus"
+	"sort"
 	"sync"
 	"time"
 
+	"github.com/chucky-1/finance/internal/i18n"
+	"github.com/chucky-1/finance/internal/model"
 	"github.com/chucky-1/finance/internal/repository"
 )
 
+const (
+	// reportsScheduler is the name under which the last processed tick of reports is stored
+	reportsScheduler = "reports"
+	dailyKey         = "2006-01-02"
+)
+
+const (
+	DailyReport   = "day"
+	MonthlyReport = "month"
+)
+
+// UserReport is the expenses of one user for a closed period
+type UserReport struct {
+	Username   string
+	PeriodKey  string // the day or the month the report is about, e.g. 2023-06-28, 2023-06 or 2023-06-10 if months begin on the 10th
+	Categories map[string]float64
+	// DeliverAt is the report time chosen by the user, the report waits in the outbox until then
+	DeliverAt time.Time
+	// MonthStart is the day when financial months of the user begin, 0 is the calendar month
+	MonthStart int
+	// Language is the language of the report, e.g. of month names and numbers
+	Language i18n.Language
+}
+
 type Reporter struct {
 	getter    repository.Getter
 	cleaner   repository.Cleaner
+	scheduler repository.Scheduler
+	issued    repository.Issued
+	entries   repository.Entries
 	timezones *timezones
 }
 
+// timezones schedules reports of users. Each user has the next boundary of the day and of the month in the queues,
+// so the producer sleeps until the earliest one
 type timezones struct {
-	// key: timezone, value: usernames
+	// key: name of the timezone, value: usernames
 	mu        sync.RWMutex
-	timezones map[time.Duration][]string
+	timezones map[string][]string
+	// key: username, value: timezone
+	users map[string]*time.Location
+	// key: username, value: when reports are delivered, users without it get reports at the midnight
+	reportTimes map[string]model.ReportTime
+	// key: username, value: the day when financial months begin, users without it have calendar months
+	monthStarts map[string]int
+	// key: username, value: the language of messages and reports, users without it get them in Russian
+	languages map[string]i18n.Language
+	// key: period, value: the queue of boundaries of all users
+	queues map[string]*boundaries
+	// key: username, value: boundaries of the user by periods
+	scheduled map[string]map[string]*boundary
+	// cursor is the time up to which boundaries are taken, boundaries of new users are after it
+	cursor time.Time
+	// key: period, value: keys of reports by usernames which are issued right away after a timezone change
+	pending map[string]map[string]string
+	// pendingAt is when pending reports appeared
+	pendingAt time.Time
+	// changed receives a value when a boundary may have become earlier, e.g. a user is added
+	changed chan struct{}
 }
 
-func NewReporter(getter repository.Getter, cleaner repository.Cleaner) *Reporter {
+func NewReporter(getter repository.Getter, cleaner repository.Cleaner, scheduler repository.Scheduler, issued repository.Issued,
+	entries repository.Entries) *Reporter {
 	return &Reporter{
-		getter:  getter,
-		cleaner: cleaner,
-		timezones: &timezones{
-			timezones: make(map[time.Duration][]string),
-		},
+		getter:    getter,
+		cleaner:   cleaner,
+		scheduler: scheduler,
+		issued:    issued,
+		entries:   entries,
+		timezones: newTimezones(),
 	}
 }
 
-func (r *Reporter) DailyReportsIfDayChanges(ctx context.Context, timeUTC time.Time) (map[string]map[string]float64, error) {
-	usernames := r.timezones.getUsersWhoseDayChanges(timeUTC)
+// DailyReportsIfDayChanges returns reports of users whose day has ended by the time and pending reports of users who changed
+// the timezone, except already issued reports. The daily expenses stay in the storage until CleanDailyReports is called.
+// Daily expenses of users whose reports have already been issued are deleted right away, otherwise they'd get into the next day
+func (r *Reporter) DailyReportsIfDayChanges(ctx context.Context, timeUTC time.Time) ([]*UserReport, error) {
+	keys := r.timezones.takePending(DailyReport)
+	for username, key := range r.timezones.take(DailyReport, timeUTC) {
+		keys[username] = key
+	}
+	usernames, issued, err := r.notIssued(ctx, keys, DailyReport)
+	if err != nil {
+		return nil, err
+	}
+	if err = r.CleanDailyReports(ctx, issued); err != nil {
+		return nil, err
+	}
 	if len(usernames) == 0 {
 		return nil, nil
 	}
@@ -40,81 +108,437 @@ func (r *Reporter) DailyReportsIfDayChanges(ctx context.Context, timeUTC time.Ti
 	if err != nil {
 		return nil, err
 	}
-	err = r.cleaner.DeleteByUsernames(ctx, usernames, "expenses", dailyPeriod)
-	if err != nil {
-		return nil, err
+	return r.timezones.withDelivery(DailyReport, toUserReports(reports, keys)), nil
+}
+
+// CleanDailyReports deletes the daily expenses of users whose reports have been issued
+func (r *Reporter) CleanDailyReports(ctx context.Context, usernames []string) error {
+	if len(usernames) == 0 {
+		return nil
 	}
-	return reports, nil
+	return r.cleaner.DeleteByUsernames(ctx, usernames, "expenses", dailyPeriod)
 }
 
-func (r *Reporter) MonthlyReportsIfMonthChanges(ctx context.Context, timeUTC time.Time) (map[string]map[string]float64, error) {
-	usernames := r.timezones.getUsersWhoseMonthChanges(timeUTC)
+// DeleteUserData deletes all expenses of the user
+func (r *Reporter) DeleteUserData(ctx context.Context, username string) error {
+	return r.cleaner.DeleteUser(ctx, username, "expenses")
+}
+
+// MonthlyReportsIfMonthChanges returns reports of users whose month has ended by the time and pending reports of users who changed
+// the timezone, except already issued reports
+func (r *Reporter) MonthlyReportsIfMonthChanges(ctx context.Context, timeUTC time.Time) ([]*UserReport, error) {
+	keys := r.timezones.takePending(MonthlyReport)
+	for username, key := range r.timezones.take(MonthlyReport, timeUTC) {
+		keys[username] = key
+	}
+	usernames, _, err := r.notIssued(ctx, keys, MonthlyReport)
+	if err != nil {
+		return nil, err
+	}
 	if len(usernames) == 0 {
 		return nil, nil
 	}
-	reports, err := r.getter.GetByUsernames(ctx, usernames, "expenses", timeUTC.Add(24*-time.Hour).Format(monthlyPeriod))
+
+	// monthly expenses are stored by months, so users are requested by the months of their reports
+	byMonth := make(map[string][]string)
+	for _, username := range usernames {
+		byMonth[keys[username]] = append(byMonth[keys[username]], username)
+	}
+	reports := make(map[string]map[string]float64, len(usernames))
+	for month, users := range byMonth {
+		monthReports, err := r.getter.GetByUsernames(ctx, users, "expenses", month)
+		if err != nil {
+			return nil, err
+		}
+		for username, categories := range monthReports {
+			reports[username] = categories
+		}
+	}
+	return r.timezones.withDelivery(MonthlyReport, toUserReports(reports, keys)), nil
+}
+
+// notIssued splits users into those whose reports with the keys haven't been issued yet and those whose reports have,
+// they're sorted for stable order of requests
+func (r *Reporter) notIssued(ctx context.Context, keys map[string]string, period string) ([]string, []string, error) {
+	notIssued := make([]string, 0, len(keys))
+	issued := make([]string, 0)
+	for username, key := range keys {
+		ok, err := r.issued.IsIssued(ctx, username, period, key)
+		if err != nil {
+			return nil, nil, err
+		}
+		if ok {
+			logrus.Debugf("service reporter: %s report %s for %s has already been issued", period, key, username)
+			issued = append(issued, username)
+			continue
+		}
+		notIssued = append(notIssued, username)
+	}
+	sort.Strings(notIssued)
+	sort.Strings(issued)
+	return notIssued, issued, nil
+}
+
+func toUserReports(reports map[string]map[string]float64, keys map[string]string) []*UserReport {
+	userReports := make([]*UserReport, 0, len(reports))
+	for username, categories := range reports {
+		userReports = append(userReports, &UserReport{
+			Username:   username,
+			PeriodKey:  keys[username],
+			Categories: categories,
+		})
+	}
+	sort.Slice(userReports, func(i, j int) bool {
+		return userReports[i].Username < userReports[j].Username
+	})
+	return userReports
+}
+
+// periodKey returns the day or the financial month which has just ended in the timezone at timeUTC
+func periodKey(period string, timeUTC time.Time, timezone *time.Location, monthStart int) string {
+	ended := timeUTC.In(timezone).AddDate(0, 0, -1)
+	if period == MonthlyReport {
+		return MonthKey(ended, timezone, monthStart)
+	}
+	return ended.Format(dailyKey)
+}
+
+// lastEnded returns the last day or financial month which has completely ended in the timezone at timeUTC
+func lastEnded(period string, timeUTC time.Time, timezone *time.Location, monthStart int) string {
+	if period == MonthlyReport {
+		return MonthKey(MonthStart(timeUTC, timezone, monthStart).In(timezone).AddDate(0, 0, -1), timezone, monthStart)
+	}
+	return timeUTC.In(timezone).AddDate(0, 0, -1).Format(dailyKey)
+}
+
+// Report sums the expenses of the user by categories from the beginning to the end of the range, not including the end
+func (r *Reporter) Report(ctx context.Context, username string, from, to time.Time) (map[string]float64, error) {
+	entries, err := r.entries.GetEntries(ctx, "expenses", username, from, to)
 	if err != nil {
 		return nil, err
 	}
-	return reports, nil
+	categories := make(map[string]float64)
+	for _, entry := range entries {
+		categories[entry.Category.Name] += entry.Category.Amount
+	}
+	return categories, nil
 }
 
-func (r *Reporter) AddTimezone(timezone time.Duration, username string) {
+func (r *Reporter) AddTimezone(timezone *time.Location, username string) {
 	r.timezones.add(timezone, username)
 }
 
-// getUsersWhoseDayChanges returns users who have 00:00 local time
-// When by UTC 12:00 the day changes in the time zones +12 and -12
-func (t *timezones) getUsersWhoseDayChanges(timeUTC time.Time) []string {
-	timezone := getTimezoneWhereDayChanges(timeUTC.Hour(), timeUTC.Minute())
-	if timezone.Hours() == 12 {
-		return append(t.get(timezone), t.get(-timezone)...)
+// SetReportTime changes when reports of the user are delivered, reports which are already in the outbox keep their time
+func (r *Reporter) SetReportTime(username string, reportTime model.ReportTime) {
+	r.timezones.mu.Lock()
+	defer r.timezones.mu.Unlock()
+	r.timezones.reportTimes[username] = reportTime
+}
+
+// SetMonthStart changes the day when financial months of the user begin. If the month has already ended by the new start
+// but not by the previous one, its report is due right away like after a timezone change
+func (r *Reporter) SetMonthStart(username string, monthStart int, now time.Time) {
+	r.timezones.setMonthStart(username, monthStart, now)
+}
+
+// MonthStart returns the day when financial months of the user begin, 0 is the calendar month
+func (r *Reporter) MonthStart(username string) int {
+	r.timezones.mu.RLock()
+	defer r.timezones.mu.RUnlock()
+	return r.timezones.monthStarts[username]
+}
+
+// SetLanguage changes the language of messages and reports of the user, reports which are already in the outbox keep their language
+func (r *Reporter) SetLanguage(username string, language i18n.Language) {
+	r.timezones.mu.Lock()
+	defer r.timezones.mu.Unlock()
+	r.timezones.languages[username] = language
+}
+
+// Language returns the language of messages and reports of the user, the empty one is Russian
+func (r *Reporter) Language(username string) i18n.Language {
+	r.timezones.mu.RLock()
+	defer r.timezones.mu.RUnlock()
+	return r.timezones.languages[username]
+}
+
+// SetTimezone moves the user to the timezone right away. Reports which are already issued aren't issued again,
+// and if the day or the month has already ended in the new timezone but not in the old one, its report is due
+// right away, so no report is skipped
+func (r *Reporter) SetTimezone(timezone *time.Location, username string, now time.Time) {
+	r.timezones.set(timezone, username, now)
+}
+
+// RemoveUser stops scheduling reports of the user, e.g. when the user is deleted
+func (r *Reporter) RemoveUser(username string) {
+	r.timezones.remove(username)
+}
+
+// Schedule plans the next boundaries of all users after the time. The producer calls it on start with the last
+// processed boundary, so boundaries which passed while the service was down are due right away
+func (r *Reporter) Schedule(after time.Time) {
+	r.timezones.schedule(after)
+}
+
+// NextBoundary returns the time when the next report is due, it's false if there are no users
+func (r *Reporter) NextBoundary() (time.Time, bool) {
+	return r.timezones.next()
+}
+
+// Rescheduled receives a value when the next boundary may have become earlier, e.g. a user is registered
+func (r *Reporter) Rescheduled() <-chan struct{} {
+	return r.timezones.changed
+}
+
+// Timezone returns the timezone by which reports of the user are scheduled
+func (r *Reporter) Timezone(username string) (*time.Location, bool) {
+	r.timezones.mu.RLock()
+	defer r.timezones.mu.RUnlock()
+	timezone, ok := r.timezones.users[username]
+	return timezone, ok
+}
+
+// LastTick returns the last tick for which reports were sent or zero time if there wasn't any
+func (r *Reporter) LastTick(ctx context.Context) (time.Time, error) {
+	return r.scheduler.GetLastTick(ctx, reportsScheduler)
+}
+
+func (r *Reporter) SetLastTick(ctx context.Context, tick time.Time) error {
+	return r.scheduler.SetLastTick(ctx, reportsScheduler, tick)
+}
+
+// take returns keys of reports by usernames whose boundaries have passed by the time and schedules their next boundaries.
+// A user gets one report of the period at a time, the next one is taken by the next call
+func (t *timezones) take(period string, timeUTC time.Time) map[string]string {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if timeUTC.After(t.cursor) {
+		t.cursor = timeUTC
+	}
+	keys := make(map[string]string)
+	queue := t.queues[period]
+	for queue.Len() > 0 {
+		first := (*queue)[0]
+		if _, ok := keys[first.username]; ok || first.at.After(timeUTC) {
+			break
+		}
+		keys[first.username] = first.key
+		first.at, first.key = nextBoundary(period, first.at, t.users[first.username], t.monthStarts[first.username])
+		heap.Fix(queue, first.index)
 	}
-	return t.get(timezone)
+	return keys
 }
 
-// getUsersWhoseMonthChanges returns users who have the 1st date
-// When by UTC 12:00 the day changes in time zones +12 and -12, but the dates will be different
-func (t *timezones) getUsersWhoseMonthChanges(timeUTC time.Time) []string {
-	timezone := getTimezoneWhereDayChanges(timeUTC.Hour(), timeUTC.Minute())
-	if timezone.Hours() != 12 && timeUTC.Add(timezone).Day() == 1 {
-		return t.get(timezone)
+// next returns the earliest boundary, pending reports are due since they appeared
+func (t *timezones) next() (time.Time, bool) {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	var next time.Time
+	for _, queue := range t.queues {
+		if queue.Len() > 0 && (next.IsZero() || (*queue)[0].at.Before(next)) {
+			next = (*queue)[0].at
+		}
 	}
-	if timezone.Hours() == 12 && timeUTC.Add(timezone).Day() == 1 {
-		return t.get(timezone)
+	if len(t.pending[DailyReport])+len(t.pending[MonthlyReport]) > 0 && (next.IsZero() || t.pendingAt.Before(next)) {
+		next = t.pendingAt
 	}
-	if timezone.Hours() == 12 && timeUTC.Add(-timezone).Day() == 1 {
-		return t.get(-timezone)
+	return next, !next.IsZero()
+}
+
+// schedule plans the next boundaries of all users after the time
+func (t *timezones) schedule(after time.Time) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.cursor = after
+	for username, timezone := range t.users {
+		t.scheduleUser(username, timezone, after)
+	}
+	t.notify()
+}
+
+// scheduleUser puts the next boundaries of the user after the time into the queues, the mutex must be locked
+func (t *timezones) scheduleUser(username string, timezone *time.Location, after time.Time) {
+	if t.scheduled[username] == nil {
+		t.scheduled[username] = make(map[string]*boundary, len(t.queues))
+	}
+	for period, queue := range t.queues {
+		at, key := nextBoundary(period, after, timezone, t.monthStarts[username])
+		if b, ok := t.scheduled[username][period]; ok {
+			b.at, b.key = at, key
+			heap.Fix(queue, b.index)
+			continue
+		}
+		b := &boundary{at: at, username: username, key: key}
+		heap.Push(queue, b)
+		t.scheduled[username][period] = b
+	}
+}
+
+// notify wakes up the producer without blocking, one value is enough for any number of changes
+func (t *timezones) notify() {
+	select {
+	case t.changed <- struct{}{}:
+	default:
 	}
-	return nil
 }
 
-func (t *timezones) add(key time.Duration, value string) {
+func newTimezones() *timezones {
+	return &timezones{
+		timezones:   make(map[string][]string),
+		users:       make(map[string]*time.Location),
+		reportTimes: make(map[string]model.ReportTime),
+		monthStarts: make(map[string]int),
+		languages:   make(map[string]i18n.Language),
+		queues: map[string]*boundaries{
+			DailyReport:   {},
+			MonthlyReport: {},
+		},
+		scheduled: make(map[string]map[string]*boundary),
+		pending: map[string]map[string]string{
+			DailyReport:   make(map[string]string),
+			MonthlyReport: make(map[string]string),
+		},
+		changed: make(chan struct{}, 1),
+	}
+}
+
+// add does nothing if the user is already in the timezone, so the user doesn't receive the same report twice
+func (t *timezones) add(key *time.Location, value string) {
 	t.mu.Lock()
 	defer t.mu.Unlock()
+	for _, username := range t.timezones[key.String()] {
+		if username == value {
+			return
+		}
+	}
 	logrus.Debugf("service timezone: add %s by %v", value, key)
-	t.timezones[key] = append(t.timezones[key], value)
+	after := time.Now().UTC()
+	if t.cursor.After(after) {
+		// the clock is simulated, e.g. in the terminal chat
+		after = t.cursor
+	}
+	t.put(key, value, after)
 }
 
-func (t *timezones) get(key time.Duration) []string {
+// put adds the user to the timezone and schedules the next boundaries after the time, the mutex must be locked
+func (t *timezones) put(key *time.Location, value string, after time.Time) {
+	t.timezones[key.String()] = append(t.timezones[key.String()], value)
+	t.users[value] = key
+	t.scheduleUser(value, key, after)
+	t.notify()
+}
+
+// set moves the user from the previous timezone. When the user moves east, the day or the month may have already ended
+// in the new timezone, then its report becomes pending. Moving west cancels pending reports of periods which haven't ended
+func (t *timezones) set(key *time.Location, value string, now time.Time) {
 	t.mu.Lock()
 	defer t.mu.Unlock()
-	users, ok := t.timezones[key]
-	if !ok {
-		return nil
+	previous, ok := t.users[value]
+	if ok && previous.String() == key.String() {
+		return
+	}
+	if ok {
+		users := t.timezones[previous.String()]
+		for i, username := range users {
+			if username == value {
+				t.timezones[previous.String()] = append(users[:i:i], users[i+1:]...)
+				break
+			}
+		}
+		monthStart := t.monthStarts[value]
+		t.setPending(value, now, previous, key, monthStart, monthStart)
+	}
+	logrus.Debugf("service timezone: move %s from %v to %v", value, previous, key)
+	t.put(key, value, now)
+}
+
+// remove forgets the user with the boundaries and pending reports of the user
+func (t *timezones) remove(value string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if timezone, ok := t.users[value]; ok {
+		users := t.timezones[timezone.String()]
+		for i, username := range users {
+			if username == value {
+				t.timezones[timezone.String()] = append(users[:i:i], users[i+1:]...)
+				break
+			}
+		}
+	}
+	for period, b := range t.scheduled[value] {
+		heap.Remove(t.queues[period], b.index)
 	}
-	return users
+	for _, pending := range t.pending {
+		delete(pending, value)
+	}
+	delete(t.scheduled, value)
+	delete(t.users, value)
+	delete(t.reportTimes, value)
+	delete(t.monthStarts, value)
+	delete(t.languages, value)
+	logrus.Debugf("service timezone: remove %s", value)
 }
 
-// getTimezoneWhereDayChanges returns the timezone in which the day changes.
-// When by UTC 12:00 the day changes in the timezone +12 and -12, but the function returns only one value +12
-func getTimezoneWhereDayChanges(hourUTC, minuteUTC int) time.Duration {
-	hourPlusMinute := time.Duration(hourUTC)*time.Hour + time.Duration(minuteUTC)*time.Minute
-	if hourPlusMinute >= 12*time.Hour {
-		return 24*time.Hour - hourPlusMinute
+// setMonthStart reschedules the monthly report of the user by the new month start, a user without a timezone only
+// keeps it until the user is added
+func (t *timezones) setMonthStart(value string, monthStart int, now time.Time) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	previous := t.monthStarts[value]
+	t.monthStarts[value] = monthStart
+	timezone, ok := t.users[value]
+	if !ok || monthStartDay(previous) == monthStartDay(monthStart) {
+		return
 	}
-	if hourPlusMinute < 12*time.Hour {
-		return -hourPlusMinute
+	logrus.Debugf("service timezone: months of %s begin on the %d day instead of the %d", value, monthStartDay(monthStart), monthStartDay(previous))
+	t.setPending(value, now, timezone, timezone, previous, monthStart)
+	t.scheduleUser(value, timezone, now)
+	t.notify()
+}
+
+// setPending makes the reports of periods which have ended by the new calendar of the user but not by the previous one
+// pending, and cancels pending reports of periods which haven't ended by the new calendar. The mutex must be locked
+func (t *timezones) setPending(value string, now time.Time, previous, timezone *time.Location, previousStart, monthStart int) {
+	for period, pending := range t.pending {
+		endedKey := lastEnded(period, now, timezone, monthStart)
+		if endedKey > lastEnded(period, now, previous, previousStart) {
+			if len(t.pending[DailyReport])+len(t.pending[MonthlyReport]) == 0 {
+				t.pendingAt = now
+			}
+			pending[value] = endedKey
+		} else if pending[value] > endedKey {
+			delete(pending, value)
+		}
+	}
+}
+
+// withDelivery sets the delivery time, the month start and the language of the reports by the calendars of their users
+func (t *timezones) withDelivery(period string, reports []*UserReport) []*UserReport {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	for _, report := range reports {
+		timezone, ok := t.users[report.Username]
+		if !ok {
+			timezone = time.UTC
+		}
+		report.MonthStart = t.monthStarts[report.Username]
+		report.Language = t.languages[report.Username]
+		report.DeliverAt = deliveryTime(period, report.PeriodKey, timezone, t.reportTimes[report.Username], report.MonthStart)
 	}
-	return 0
+	return reports
+}
+
+// takePending returns pending reports of the period and forgets them
+func (t *timezones) takePending(period string) map[string]string {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	pending := t.pending[period]
+	t.pending[period] = make(map[string]string)
+	return pending
+}
+
+func (t *timezones) get(key *time.Location) []string {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	return t.timezones[key.String()]
 }
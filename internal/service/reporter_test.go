@@ -1,195 +1,565 @@
 package service
 
 import (
-	"github.com/sirupsen/logrus"
+	"context"
+	"github.com/chucky-1/finance/internal/i18n"
+	"github.com/chucky-1/finance/internal/model"
 	"github.com/stretchr/testify/require"
 	"testing"
 	"time"
 )
 
-func TestTimezone_GetUsersWhoseDayChangesInThePositiveTimezone(t *testing.T) {
-	tz := timezones{
-		timezones: make(map[time.Duration][]string),
-	}
-	tz.add(3*time.Hour, "Dima")
-	tz.add(2*time.Hour, "Pasha")
-	tz.add(4*time.Hour, "Luisa")
-	tz.add(-3*time.Hour, "Elena")
+// fakeGetter returns the same expenses of every user for every period and remembers requested periods and cleaned users
+type fakeGetter struct {
+	periods []string
+	cleaned []string
+}
 
-	users := tz.getUsersWhoseDayChanges(time.Now().UTC().Truncate(24 * time.Hour).Add(21 * time.Hour))
-	logrus.Info(users)
-	require.Equal(t, 1, len(users))
-	require.Equal(t, "Dima", users[0])
+func (g *fakeGetter) Get(context.Context, *model.Entry, string) (map[string]float64, error) {
+	return nil, nil
 }
 
-func TestTimezone_GetUsersWhoseDayChangesInTheNegativeTimezone(t *testing.T) {
-	tz := timezones{
-		timezones: make(map[time.Duration][]string),
+func (g *fakeGetter) GetByUsernames(_ context.Context, usernames []string, _, period string) (map[string]map[string]float64, error) {
+	g.periods = append(g.periods, period)
+	reports := make(map[string]map[string]float64, len(usernames))
+	for _, username := range usernames {
+		reports[username] = map[string]float64{"Кофе": 3.5}
 	}
-	tz.add(3*time.Hour, "Dima")
-	tz.add(2*time.Hour, "Pasha")
-	tz.add(4*time.Hour, "Luisa")
-	tz.add(-3*time.Hour, "Elena")
+	return reports, nil
+}
 
-	users := tz.getUsersWhoseDayChanges(time.Now().UTC().Truncate(24 * time.Hour).Add(3 * time.Hour))
-	logrus.Info(users)
-	require.Equal(t, 1, len(users))
-	require.Equal(t, "Elena", users[0])
+func (g *fakeGetter) DeleteByUsernames(_ context.Context, usernames []string, _, _ string) error {
+	g.cleaned = append(g.cleaned, usernames...)
+	return nil
 }
 
-func TestTimezone_GetUsersWhoseDayChangesIn12ByUTC(t *testing.T) {
-	tz := timezones{
-		timezones: make(map[time.Duration][]string),
+func (g *fakeGetter) DeleteUser(context.Context, string, string) error {
+	return nil
+}
+
+// fakeIssued keeps issued reports like username/period/key
+type fakeIssued map[string]bool
+
+func (i fakeIssued) IsIssued(_ context.Context, username, period, periodKey string) (bool, error) {
+	return i[username+"/"+period+"/"+periodKey], nil
+}
+
+// location loads the timezone, zones of the tests have no daylight saving time unless the test is about it
+func location(t *testing.T, name string) *time.Location {
+	timezone, err := LoadLocation(name)
+	require.NoError(t, err)
+	return timezone
+}
+
+func TestTimezone_TakeDayBoundariesOfAnyOffset(t *testing.T) {
+	tz := newTimezones()
+	tz.add(location(t, "Europe/Minsk"), "Dima")
+	tz.add(location(t, "America/Sao_Paulo"), "Elena")
+	tz.add(location(t, "Asia/Kathmandu"), "Ram")
+	tz.add(location(t, "Pacific/Chatham"), "Kiri")
+	tz.add(location(t, "Pacific/Kiritimati"), "Teuea")
+	tz.add(location(t, "Etc/GMT+12"), "Julia")
+	tz.schedule(time.Date(2023, 6, 30, 9, 0, 0, 0, time.UTC))
+
+	testTable := []struct {
+		at       time.Time
+		username string
+		key      string
+	}{
+		// +14
+		{at: time.Date(2023, 6, 30, 10, 0, 0, 0, time.UTC), username: "Teuea", key: "2023-06-30"},
+		// +12:45
+		{at: time.Date(2023, 6, 30, 11, 15, 0, 0, time.UTC), username: "Kiri", key: "2023-06-30"},
+		// -12
+		{at: time.Date(2023, 6, 30, 12, 0, 0, 0, time.UTC), username: "Julia", key: "2023-06-29"},
+		// +5:45
+		{at: time.Date(2023, 6, 30, 18, 15, 0, 0, time.UTC), username: "Ram", key: "2023-06-30"},
+		{at: time.Date(2023, 6, 30, 21, 0, 0, 0, time.UTC), username: "Dima", key: "2023-06-30"},
+		{at: time.Date(2023, 7, 1, 3, 0, 0, 0, time.UTC), username: "Elena", key: "2023-06-30"},
 	}
-	tz.add(3*time.Hour, "Dima")
-	tz.add(2*time.Hour, "Pasha")
-	tz.add(4*time.Hour, "Luiza")
-	tz.add(-3*time.Hour, "Elena")
-	tz.add(12*time.Hour, "Petrov")
-	tz.add(-12*time.Hour, "Julia")
-
-	// The day changes in 12:00 by UTC in timezones +12 and -12
-	users := tz.getUsersWhoseDayChanges(time.Now().UTC().Truncate(24 * time.Hour).Add(12 * time.Hour))
-	logrus.Info(users)
-	require.Equal(t, 2, len(users))
-	require.Equal(t, "Petrov", users[0])
-	require.Equal(t, "Julia", users[1])
-}
-
-func TestTimezone_GetUsersWhoseDayChangesIn12ByUTCUserOnlyInPositiveTimezone(t *testing.T) {
-	tz := timezones{
-		timezones: make(map[time.Duration][]string),
+	for _, testCase := range testTable {
+		next, ok := tz.next()
+		require.True(t, ok)
+		require.Equal(t, testCase.at, next)
+		require.Empty(t, tz.take(DailyReport, testCase.at.Add(-time.Second)))
+		require.Equal(t, map[string]string{testCase.username: testCase.key}, tz.take(DailyReport, testCase.at))
+		// July starts with the day except in -12
+		monthly := tz.take(MonthlyReport, testCase.at)
+		if testCase.username == "Julia" {
+			require.Empty(t, monthly)
+		} else {
+			require.Equal(t, map[string]string{testCase.username: "2023-06"}, monthly)
+		}
 	}
-	tz.add(12*time.Hour, "Julia")
+	// the next day of the earliest user
+	next, _ := tz.next()
+	require.Equal(t, time.Date(2023, 7, 1, 10, 0, 0, 0, time.UTC), next)
+}
+
+func TestTimezone_TakeMonthBoundaries(t *testing.T) {
+	tz := newTimezones()
+	tz.add(location(t, "Europe/Minsk"), "Dima")
+	tz.add(location(t, "Etc/GMT+12"), "Liza")
+	tz.schedule(time.Date(2023, 6, 29, 12, 0, 0, 0, time.UTC))
 
-	// The day changes in 12:00 by UTC in timezones +12 and -12
-	users := tz.getUsersWhoseDayChanges(time.Now().UTC().Truncate(24 * time.Hour).Add(12 * time.Hour))
-	logrus.Info(users)
-	require.Equal(t, 1, len(users))
-	require.Equal(t, "Julia", users[0])
+	require.Empty(t, tz.take(MonthlyReport, time.Date(2023, 6, 30, 20, 59, 0, 0, time.UTC)))
+	require.Equal(t, map[string]string{"Dima": "2023-06"}, tz.take(MonthlyReport, time.Date(2023, 6, 30, 21, 0, 0, 0, time.UTC)))
+	require.Equal(t, map[string]string{"Liza": "2023-06"}, tz.take(MonthlyReport, time.Date(2023, 7, 1, 12, 0, 0, 0, time.UTC)))
+	require.Empty(t, tz.take(MonthlyReport, time.Date(2023, 7, 30, 12, 0, 0, 0, time.UTC)))
+	require.Equal(t, map[string]string{"Dima": "2023-07"}, tz.take(MonthlyReport, time.Date(2023, 7, 31, 21, 0, 0, 0, time.UTC)))
 }
 
-func TestTimezone_GetUsersWhoseDayChangesIn12ByUTCWithoutUsers(t *testing.T) {
-	tz := timezones{
-		timezones: make(map[time.Duration][]string),
-	}
-	require.Equal(t, 0, len(tz.getUsersWhoseDayChanges(time.Now().UTC().Truncate(24*time.Hour).Add(12*time.Hour))))
+func TestTimezone_TakeOneReportAtATime(t *testing.T) {
+	tz := newTimezones()
+	tz.add(location(t, "Europe/Minsk"), "Dima")
+	tz.schedule(time.Date(2023, 6, 28, 0, 0, 0, 0, time.UTC))
+
+	// the service was down for days, the days are reported one by one
+	now := time.Date(2023, 7, 1, 0, 0, 0, 0, time.UTC)
+	require.Equal(t, map[string]string{"Dima": "2023-06-28"}, tz.take(DailyReport, now))
+	require.Equal(t, map[string]string{"Dima": "2023-06-29"}, tz.take(DailyReport, now))
+	require.Equal(t, map[string]string{"Dima": "2023-06-30"}, tz.take(DailyReport, now))
+	require.Empty(t, tz.take(DailyReport, now))
 }
 
-func TestTimezone_GetUsersWhoseDayChangesSriLanka(t *testing.T) {
-	tz := timezones{
-		timezones: make(map[time.Duration][]string),
-	}
-	tz.add((5*time.Hour)+(30*time.Minute), "Dima")
-	users := tz.getUsersWhoseDayChanges(time.Now().UTC().Truncate(24 * time.Hour).Add(18*time.Hour + 30*time.Minute))
-	logrus.Info(users)
-	require.Equal(t, 1, len(users))
-	require.Equal(t, "Dima", users[0])
+func TestTimezone_NextWithoutUsers(t *testing.T) {
+	tz := newTimezones()
+	_, ok := tz.next()
+	require.False(t, ok)
+	require.Empty(t, tz.take(DailyReport, time.Now()))
 }
 
-func TestTimezone_GetUsersWhoseMonthChanges(t *testing.T) {
-	tz := timezones{
-		timezones: make(map[time.Duration][]string),
-	}
-	tz.add(3*time.Hour, "Dima")
+func TestTimezone_AddNotifiesScheduler(t *testing.T) {
+	tz := newTimezones()
+	tz.add(location(t, "Europe/Minsk"), "Dima")
+	tz.add(location(t, "Europe/Warsaw"), "Pasha")
+	require.Len(t, tz.changed, 1)
+	<-tz.changed
+
+	// new users are scheduled after now
+	next, ok := tz.next()
+	require.True(t, ok)
+	require.True(t, next.After(time.Now()))
+	require.True(t, next.Before(time.Now().Add(24*time.Hour)))
+}
 
+func TestNextBoundary(t *testing.T) {
 	testTable := []struct {
-		name    string
-		timeUTC time.Time
-		result  []string
+		name       string
+		period     string
+		after      time.Time
+		timezone   string
+		monthStart int
+		at         time.Time
+		key        string
 	}{
 		{
-			name:    "Success",
-			timeUTC: time.Date(2023, 6, 30, 21, 0, 0, 0, time.UTC),
-			result: []string{
-				"Dima",
-			},
+			name:     "Day in summer",
+			period:   DailyReport,
+			after:    time.Date(2023, 7, 1, 12, 0, 0, 0, time.UTC),
+			timezone: "Europe/Warsaw",
+			at:       time.Date(2023, 7, 1, 22, 0, 0, 0, time.UTC),
+			key:      "2023-07-01",
 		},
 		{
-			name:    "Day changes but month not",
-			timeUTC: time.Date(2023, 6, 29, 21, 0, 0, 0, time.UTC),
-			result:  nil,
+			name:     "Day in winter",
+			period:   DailyReport,
+			after:    time.Date(2023, 12, 1, 12, 0, 0, 0, time.UTC),
+			timezone: "Europe/Warsaw",
+			at:       time.Date(2023, 12, 1, 23, 0, 0, 0, time.UTC),
+			key:      "2023-12-01",
+		},
+		{
+			name:     "Exactly at the boundary",
+			period:   DailyReport,
+			after:    time.Date(2023, 7, 1, 21, 0, 0, 0, time.UTC),
+			timezone: "Europe/Minsk",
+			at:       time.Date(2023, 7, 2, 21, 0, 0, 0, time.UTC),
+			key:      "2023-07-02",
+		},
+		{
+			name:     "The clocks go forward at midnight",
+			period:   DailyReport,
+			after:    time.Date(2022, 9, 10, 12, 0, 0, 0, time.UTC),
+			timezone: "America/Santiago",
+			at:       time.Date(2022, 9, 11, 4, 0, 0, 0, time.UTC),
+			key:      "2022-09-10",
+		},
+		{
+			name:     "Month",
+			period:   MonthlyReport,
+			after:    time.Date(2023, 12, 15, 0, 0, 0, 0, time.UTC),
+			timezone: "Asia/Kathmandu",
+			at:       time.Date(2023, 12, 31, 18, 15, 0, 0, time.UTC),
+			key:      "2023-12",
+		},
+		{
+			name:       "Financial month before the start day",
+			period:     MonthlyReport,
+			after:      time.Date(2023, 7, 5, 12, 0, 0, 0, time.UTC),
+			timezone:   "Europe/Minsk",
+			monthStart: 10,
+			at:         time.Date(2023, 7, 9, 21, 0, 0, 0, time.UTC),
+			key:        "2023-06-10",
+		},
+		{
+			name:       "Financial month after the start day",
+			period:     MonthlyReport,
+			after:      time.Date(2023, 12, 9, 21, 0, 0, 0, time.UTC),
+			timezone:   "Europe/Minsk",
+			monthStart: 10,
+			at:         time.Date(2024, 1, 9, 21, 0, 0, 0, time.UTC),
+			key:        "2023-12-10",
 		},
 	}
 
 	for _, testCase := range testTable {
 		t.Run(testCase.name, func(t *testing.T) {
-			require.Equal(t, testCase.result, tz.getUsersWhoseMonthChanges(testCase.timeUTC))
+			at, key := nextBoundary(testCase.period, testCase.after, location(t, testCase.timezone), testCase.monthStart)
+			require.Equal(t, testCase.at, at)
+			require.Equal(t, testCase.key, key)
 		})
 	}
 }
 
-func TestTimezone_GetUsersWhoseMonthChanges12Timezone(t *testing.T) {
-	tz := timezones{
-		timezones: make(map[time.Duration][]string),
+func TestDeliveryTime(t *testing.T) {
+	testTable := []struct {
+		name       string
+		period     string
+		key        string
+		timezone   string
+		reportTime model.ReportTime
+		monthStart int
+		result     time.Time
+	}{
+		{
+			name:     "Midnight by default",
+			period:   DailyReport,
+			key:      "2023-06-30",
+			timezone: "Europe/Minsk",
+			result:   time.Date(2023, 6, 30, 21, 0, 0, 0, time.UTC),
+		},
+		{
+			name:       "Morning of the next day",
+			period:     DailyReport,
+			key:        "2023-06-30",
+			timezone:   "Europe/Minsk",
+			reportTime: model.ReportTime{Daily: 8 * time.Hour},
+			result:     time.Date(2023, 7, 1, 5, 0, 0, 0, time.UTC),
+		},
+		{
+			name:       "Local clock after the clocks go back",
+			period:     DailyReport,
+			key:        "2023-10-28",
+			timezone:   "Europe/Warsaw",
+			reportTime: model.ReportTime{Daily: 21*time.Hour + 30*time.Minute},
+			result:     time.Date(2023, 10, 29, 20, 30, 0, 0, time.UTC),
+		},
+		{
+			name:       "Day and time of the next month",
+			period:     MonthlyReport,
+			key:        "2023-12",
+			timezone:   "Asia/Kathmandu",
+			reportTime: model.ReportTime{Monthly: 33 * time.Hour},
+			result:     time.Date(2024, 1, 2, 3, 15, 0, 0, time.UTC),
+		},
+		{
+			name:       "Financial month",
+			period:     MonthlyReport,
+			key:        "2023-12-10",
+			timezone:   "Europe/Minsk",
+			reportTime: model.ReportTime{Monthly: 9 * time.Hour},
+			monthStart: 10,
+			result:     time.Date(2024, 1, 10, 6, 0, 0, 0, time.UTC),
+		},
+	}
+
+	for _, testCase := range testTable {
+		t.Run(testCase.name, func(t *testing.T) {
+			result := deliveryTime(testCase.period, testCase.key, location(t, testCase.timezone), testCase.reportTime, testCase.monthStart)
+			require.Equal(t, testCase.result, result)
+		})
 	}
-	tz.add(12*time.Hour, "Dima")
-	tz.add(-12*time.Hour, "Liza")
+}
+
+func TestReporter_ReportsAreDeliveredAtReportTime(t *testing.T) {
+	ctx := context.Background()
+	reporter := NewReporter(&fakeGetter{}, nil, nil, fakeIssued{}, nil)
+	reporter.AddTimezone(location(t, "Europe/Minsk"), "Dima")
+	reporter.AddTimezone(location(t, "Europe/Minsk"), "Julia")
+	reporter.SetReportTime("Julia", model.ReportTime{Daily: 8 * time.Hour, Monthly: 24*time.Hour + 9*time.Hour})
+	reporter.Schedule(time.Date(2023, 6, 30, 12, 0, 0, 0, time.UTC))
+
+	// the day is closed at the midnight for everyone, but Julia reads the report in the morning
+	midnight := time.Date(2023, 6, 30, 21, 0, 0, 0, time.UTC)
+	daily, err := reporter.DailyReportsIfDayChanges(ctx, midnight)
+	require.NoError(t, err)
+	require.Len(t, daily, 2)
+	require.Equal(t, midnight, daily[0].DeliverAt)
+	require.Equal(t, time.Date(2023, 7, 1, 5, 0, 0, 0, time.UTC), daily[1].DeliverAt)
+
+	monthly, err := reporter.MonthlyReportsIfMonthChanges(ctx, midnight)
+	require.NoError(t, err)
+	require.Len(t, monthly, 2)
+	require.Equal(t, midnight, monthly[0].DeliverAt)
+	require.Equal(t, time.Date(2023, 7, 2, 6, 0, 0, 0, time.UTC), monthly[1].DeliverAt)
+}
+
+func TestReporter_ReportsAreInLanguageOfUser(t *testing.T) {
+	reporter := NewReporter(&fakeGetter{}, nil, nil, fakeIssued{}, nil)
+	reporter.AddTimezone(location(t, "Europe/Warsaw"), "Anna")
+	reporter.AddTimezone(location(t, "Europe/Warsaw"), "Dima")
+	reporter.SetLanguage("Anna", i18n.Polish)
+	reporter.Schedule(time.Date(2023, 6, 30, 12, 0, 0, 0, time.UTC))
 
+	daily, err := reporter.DailyReportsIfDayChanges(context.Background(), time.Date(2023, 6, 30, 22, 0, 0, 0, time.UTC))
+	require.NoError(t, err)
+	require.Len(t, daily, 2)
+	require.Equal(t, i18n.Polish, daily[0].Language)
+	require.Equal(t, i18n.Language(""), daily[1].Language)
+	require.Equal(t, i18n.Polish, reporter.Language("Anna"))
+}
+
+func TestTimezone_AddGet(t *testing.T) {
+	tz := newTimezones()
+	tz.add(location(t, "Europe/Minsk"), "Dima")
+	require.Equal(t, tz.timezones["Europe/Minsk"], tz.get(location(t, "Europe/Minsk")))
+}
+
+func TestTimezone_AddTwice(t *testing.T) {
+	tz := newTimezones()
+	tz.add(location(t, "Europe/Minsk"), "Dima")
+	tz.add(location(t, "Europe/Minsk"), "Dima")
+	require.Equal(t, []string{"Dima"}, tz.get(location(t, "Europe/Minsk")))
+}
+
+func TestTimezone_GetEmptyResult(t *testing.T) {
+	tz := newTimezones()
+	require.Equal(t, 0, len(tz.get(location(t, "Europe/Minsk"))))
+}
+
+func TestReporter_PeriodKey(t *testing.T) {
 	testTable := []struct {
-		name    string
-		timeUTC time.Time
-		result  []string
+		name       string
+		period     string
+		timeUTC    time.Time
+		timezone   string
+		monthStart int
+		result     string
 	}{
 		{
-			name:    "Success for positive timezone",
-			timeUTC: time.Date(2023, 6, 30, 12, 0, 0, 0, time.UTC),
-			result: []string{
-				"Dima",
-			},
+			name:     "Day in the positive timezone",
+			period:   DailyReport,
+			timeUTC:  time.Date(2023, 6, 30, 21, 0, 0, 0, time.UTC),
+			timezone: "Europe/Minsk",
+			result:   "2023-06-30",
+		},
+		{
+			name:     "Day in the negative timezone",
+			period:   DailyReport,
+			timeUTC:  time.Date(2023, 7, 1, 3, 0, 0, 0, time.UTC),
+			timezone: "America/Sao_Paulo",
+			result:   "2023-06-30",
+		},
+		{
+			name:     "Day in the timezone +12",
+			period:   DailyReport,
+			timeUTC:  time.Date(2023, 6, 30, 12, 0, 0, 0, time.UTC),
+			timezone: "Etc/GMT-12",
+			result:   "2023-06-30",
 		},
 		{
-			name:    "Success for negative timezone",
-			timeUTC: time.Date(2023, 6, 1, 12, 0, 0, 0, time.UTC),
-			result: []string{
-				"Liza",
-			},
+			name:     "Day in the timezone -12",
+			period:   DailyReport,
+			timeUTC:  time.Date(2023, 6, 30, 12, 0, 0, 0, time.UTC),
+			timezone: "Etc/GMT+12",
+			result:   "2023-06-29",
 		},
 		{
-			name:    "Day changes but month not",
-			timeUTC: time.Date(2023, 6, 29, 12, 0, 0, 0, time.UTC),
-			result:  nil,
+			name:     "Month",
+			period:   MonthlyReport,
+			timeUTC:  time.Date(2023, 6, 30, 21, 0, 0, 0, time.UTC),
+			timezone: "Europe/Minsk",
+			result:   "2023-06",
+		},
+		{
+			name:       "Financial month is named by its first day",
+			period:     MonthlyReport,
+			timeUTC:    time.Date(2023, 7, 9, 21, 0, 0, 0, time.UTC),
+			timezone:   "Europe/Minsk",
+			monthStart: 10,
+			result:     "2023-06-10",
 		},
 	}
 
 	for _, testCase := range testTable {
 		t.Run(testCase.name, func(t *testing.T) {
-			require.Equal(t, testCase.result, tz.getUsersWhoseMonthChanges(testCase.timeUTC))
+			require.Equal(t, testCase.result, periodKey(testCase.period, testCase.timeUTC, location(t, testCase.timezone), testCase.monthStart))
 		})
 	}
 }
 
-// TestTimezone_GetTimezoneWhereDayChangesInThePositiveTimezone the day changes in 21:00 by UTC in time zone +3
-func TestTimezone_GetTimezoneWhereDayChangesInThePositiveTimezone(t *testing.T) {
-	require.Equal(t, getTimezoneWhereDayChanges(21, 0), 3*time.Hour)
+func TestTimezone_SetEastAndBack(t *testing.T) {
+	tz := newTimezones()
+	tz.add(location(t, "America/Sao_Paulo"), "Elena")
+
+	// it's 19:00 of June 30 in -3 and already 01:00 of July 1 in +3
+	now := time.Date(2023, 6, 30, 22, 0, 0, 0, time.UTC)
+	tz.set(location(t, "Europe/Minsk"), "Elena", now)
+	require.Empty(t, tz.get(location(t, "America/Sao_Paulo")))
+	require.Equal(t, []string{"Elena"}, tz.get(location(t, "Europe/Minsk")))
+	require.Equal(t, "2023-06-30", tz.pending[DailyReport]["Elena"])
+	require.Equal(t, "2023-06", tz.pending[MonthlyReport]["Elena"])
+
+	// moving back before the next tick cancels the reports, the day hasn't ended in -3 yet
+	tz.set(location(t, "America/Sao_Paulo"), "Elena", now)
+	require.Empty(t, tz.takePending(DailyReport))
+	require.Empty(t, tz.takePending(MonthlyReport))
 }
 
-// TestTimezone_GetTimezoneWhereDayChangesInTheNegativeTimezone the day changes in 3:00 by UTC in time zone -3
-func TestTimezone_GetTimezoneWhereDayChangesInTheNegativeTimezone(t *testing.T) {
-	require.Equal(t, getTimezoneWhereDayChanges(3, 0), -3*time.Hour)
+func TestTimezone_SetWest(t *testing.T) {
+	tz := newTimezones()
+	tz.add(location(t, "Europe/Minsk"), "Dima")
+
+	tz.set(location(t, "America/Sao_Paulo"), "Dima", time.Date(2023, 6, 30, 22, 0, 0, 0, time.UTC))
+	require.Equal(t, []string{"Dima"}, tz.get(location(t, "America/Sao_Paulo")))
+	require.Empty(t, tz.takePending(DailyReport))
+	require.Empty(t, tz.takePending(MonthlyReport))
+}
+
+func TestReporter_SetTimezoneEastIssuesEndedPeriods(t *testing.T) {
+	ctx := context.Background()
+	getter := &fakeGetter{}
+	reporter := NewReporter(getter, nil, nil, fakeIssued{}, nil)
+	reporter.AddTimezone(location(t, "America/Sao_Paulo"), "Elena")
+
+	now := time.Date(2023, 6, 30, 22, 0, 0, 0, time.UTC)
+	reporter.SetTimezone(location(t, "Europe/Minsk"), "Elena", now)
+	timezone, ok := reporter.Timezone("Elena")
+	require.True(t, ok)
+	require.Equal(t, "Europe/Minsk", timezone.String())
+	// the pending reports are due right away
+	next, ok := reporter.NextBoundary()
+	require.True(t, ok)
+	require.Equal(t, now, next)
+
+	tick := now.Add(time.Minute)
+	daily, err := reporter.DailyReportsIfDayChanges(ctx, tick)
+	require.NoError(t, err)
+	require.Len(t, daily, 1)
+	require.Equal(t, "2023-06-30", daily[0].PeriodKey)
+	monthly, err := reporter.MonthlyReportsIfMonthChanges(ctx, tick)
+	require.NoError(t, err)
+	require.Len(t, monthly, 1)
+	require.Equal(t, "2023-06", monthly[0].PeriodKey)
+	require.Equal(t, []string{dailyPeriod, "2023-06"}, getter.periods)
+
+	// pending reports are issued once, the old timezone doesn't get reports anymore
+	daily, err = reporter.DailyReportsIfDayChanges(ctx, tick.Add(time.Minute))
+	require.NoError(t, err)
+	require.Empty(t, daily)
+	daily, err = reporter.DailyReportsIfDayChanges(ctx, time.Date(2023, 7, 1, 3, 0, 0, 0, time.UTC))
+	require.NoError(t, err)
+	require.Empty(t, daily)
+	daily, err = reporter.DailyReportsIfDayChanges(ctx, time.Date(2023, 7, 1, 21, 0, 0, 0, time.UTC))
+	require.NoError(t, err)
+	require.Len(t, daily, 1)
+	require.Equal(t, "2023-07-01", daily[0].PeriodKey)
 }
 
-// TestTimezone_GetTimezoneWhereDayChangesSriLanka the day changes in 18:30 by UTC in time zone +5:30
-func TestTimezone_GetTimezoneWhereDayChangesSriLanka(t *testing.T) {
-	require.Equal(t, getTimezoneWhereDayChanges(18, 30), 5*time.Hour+30*time.Minute)
+func TestReporter_SetMonthStart(t *testing.T) {
+	ctx := context.Background()
+	issued := fakeIssued{}
+	reporter := NewReporter(&fakeGetter{}, nil, nil, issued, nil)
+	reporter.SetMonthStart("Dima", 10, time.Date(2023, 5, 1, 0, 0, 0, 0, time.UTC))
+	reporter.AddTimezone(location(t, "Europe/Minsk"), "Dima")
+	reporter.Schedule(time.Date(2023, 6, 5, 12, 0, 0, 0, time.UTC))
+	require.Equal(t, 10, reporter.MonthStart("Dima"))
+	// the month which has begun on May 10 ends on June 10
+	require.Equal(t, time.Date(2023, 6, 9, 21, 0, 0, 0, time.UTC), reporter.timezones.scheduled["Dima"][MonthlyReport].at)
+
+	// May has ended by calendar months, but not by the previous start, so its report is due right away
+	now := time.Date(2023, 6, 5, 13, 0, 0, 0, time.UTC)
+	reporter.SetMonthStart("Dima", 1, now)
+	next, ok := reporter.NextBoundary()
+	require.True(t, ok)
+	require.Equal(t, now, next)
+	monthly, err := reporter.MonthlyReportsIfMonthChanges(ctx, now)
+	require.NoError(t, err)
+	require.Len(t, monthly, 1)
+	require.Equal(t, "2023-05", monthly[0].PeriodKey)
+	require.Equal(t, 1, monthly[0].MonthStart)
+	require.Equal(t, time.Date(2023, 6, 30, 21, 0, 0, 0, time.UTC), reporter.timezones.scheduled["Dima"][MonthlyReport].at)
+	issued["Dima/month/2023-05"] = true
+
+	// the payday is later, the current month goes on
+	reporter.SetMonthStart("Dima", 10, now)
+	require.Empty(t, reporter.timezones.pending[MonthlyReport])
+	require.Equal(t, time.Date(2023, 6, 9, 21, 0, 0, 0, time.UTC), reporter.timezones.scheduled["Dima"][MonthlyReport].at)
+
+	// the month which has begun on May 10 isn't the calendar May which has been reported
+	monthly, err = reporter.MonthlyReportsIfMonthChanges(ctx, time.Date(2023, 6, 9, 21, 0, 0, 0, time.UTC))
+	require.NoError(t, err)
+	require.Len(t, monthly, 1)
+	require.Equal(t, "2023-05-10", monthly[0].PeriodKey)
 }
 
-// TestTimezone_GetTimezoneWhereDayChanges12 the day changes in 12:00 by UTC in time zones +12 and -12, but func returns only +12
-func TestTimezone_GetTimezoneWhereDayChanges12(t *testing.T) {
-	require.Equal(t, getTimezoneWhereDayChanges(12, 0), 12*time.Hour)
+func TestReporter_SetMonthStartAfterCalendarMonth(t *testing.T) {
+	ctx := context.Background()
+	issued := fakeIssued{"Dima/month/2023-06": true}
+	getter := &fakeGetter{}
+	reporter := NewReporter(getter, nil, nil, issued, nil)
+	reporter.AddTimezone(location(t, "Europe/Minsk"), "Dima")
+	reporter.Schedule(time.Date(2023, 7, 5, 12, 0, 0, 0, time.UTC))
+
+	// calendar June has been reported, the month from June 10 to July 10 is reported on July 10
+	reporter.SetMonthStart("Dima", 10, time.Date(2023, 7, 5, 12, 0, 0, 0, time.UTC))
+	require.Empty(t, reporter.timezones.pending[MonthlyReport])
+	monthly, err := reporter.MonthlyReportsIfMonthChanges(ctx, time.Date(2023, 7, 9, 21, 0, 0, 0, time.UTC))
+	require.NoError(t, err)
+	require.Len(t, monthly, 1)
+	require.Equal(t, "2023-06-10", monthly[0].PeriodKey)
+	require.Equal(t, []string{"2023-06-10"}, getter.periods)
+	require.Equal(t, time.Date(2023, 7, 9, 21, 0, 0, 0, time.UTC), monthly[0].DeliverAt)
 }
 
-func TestTimezone_AddGet(t *testing.T) {
-	tz := timezones{
-		timezones: make(map[time.Duration][]string),
+func TestReporter_RemoveUser(t *testing.T) {
+	reporter := NewReporter(&fakeGetter{}, nil, nil, fakeIssued{}, nil)
+	reporter.AddTimezone(location(t, "Europe/Minsk"), "Dima")
+	reporter.AddTimezone(location(t, "Asia/Kathmandu"), "Ram")
+	reporter.AddTimezone(location(t, "America/Sao_Paulo"), "Elena")
+	reporter.Schedule(time.Date(2023, 6, 30, 12, 0, 0, 0, time.UTC))
+
+	reporter.RemoveUser("Ram")
+	reporter.RemoveUser("Unknown")
+	_, ok := reporter.Timezone("Ram")
+	require.False(t, ok)
+	require.Empty(t, reporter.timezones.get(location(t, "Asia/Kathmandu")))
+	next, ok := reporter.NextBoundary()
+	require.True(t, ok)
+	require.Equal(t, time.Date(2023, 6, 30, 21, 0, 0, 0, time.UTC), next)
+	for _, queue := range reporter.timezones.queues {
+		require.Len(t, *queue, 2)
 	}
-	tz.add(3*time.Hour, "Dima")
-	require.Equal(t, tz.timezones[3*time.Hour], tz.get(3*time.Hour))
 }
 
-func TestTimezone_GetEmptyResult(t *testing.T) {
-	tz := timezones{
-		timezones: make(map[time.Duration][]string),
-	}
-	require.Equal(t, 0, len(tz.get(3*time.Hour)))
+func TestReporter_SetTimezoneWestDoesNotRepeatReports(t *testing.T) {
+	ctx := context.Background()
+	issued := fakeIssued{"Dima/day/2023-06-30": true}
+	getter := &fakeGetter{}
+	reporter := NewReporter(getter, getter, nil, issued, nil)
+	reporter.AddTimezone(location(t, "Europe/Minsk"), "Dima")
+
+	// the report of June 30 was issued at 00:00 in +3, the day ends again at 00:00 in -3
+	reporter.SetTimezone(location(t, "America/Sao_Paulo"), "Dima", time.Date(2023, 6, 30, 22, 0, 0, 0, time.UTC))
+	daily, err := reporter.DailyReportsIfDayChanges(ctx, time.Date(2023, 7, 1, 3, 0, 0, 0, time.UTC))
+	require.NoError(t, err)
+	require.Empty(t, daily)
+	// the expenses after the issued report belong to June 30, so they don't get into the report of July 1
+	require.Equal(t, []string{"Dima"}, getter.cleaned)
+	daily, err = reporter.DailyReportsIfDayChanges(ctx, time.Date(2023, 7, 2, 3, 0, 0, 0, time.UTC))
+	require.NoError(t, err)
+	require.Len(t, daily, 1)
+	require.Equal(t, []string{"Dima"}, getter.cleaned)
+	require.Equal(t, "2023-07-01", daily[0].PeriodKey)
 }
@@ -0,0 +1,89 @@
+package service
+
+import (
+	"context"
+	"time"
+
+	"github.com/chucky-1/finance/internal/model"
+	"github.com/chucky-1/finance/internal/repository"
+)
+
+// sessionTouchInterval limits how often the last activity of a chat is saved
+const sessionTouchInterval = time.Minute
+
+// Session keeps chats logged in until they log out, are revoked from another chat or stay idle longer than idleTimeout
+type Session struct {
+	repo        repository.Session
+	idleTimeout time.Duration
+}
+
+func NewSession(repo repository.Session, idleTimeout time.Duration) *Session {
+	return &Session{
+		repo:        repo,
+		idleTimeout: idleTimeout,
+	}
+}
+
+// Start logs the chat in, the previous session of the chat ends
+func (s *Session) Start(ctx context.Context, username string, chatID int64) (*model.Session, error) {
+	now := time.Now().UTC()
+	session := &model.Session{
+		ChatID:     chatID,
+		Username:   username,
+		CreatedAt:  now,
+		LastSeenAt: now,
+	}
+	if err := s.repo.Create(ctx, session); err != nil {
+		return nil, err
+	}
+	return session, nil
+}
+
+// List returns sessions of the user which aren't expired
+func (s *Session) List(ctx context.Context, username string) ([]*model.Session, error) {
+	sessions, err := s.repo.GetAll(ctx, username)
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now().UTC()
+	active := make([]*model.Session, 0, len(sessions))
+	for _, session := range sessions {
+		if !s.Expired(session, now) {
+			active = append(active, session)
+		}
+	}
+	return active, nil
+}
+
+// Restore deletes expired sessions and returns the rest, they're restored on startup
+func (s *Session) Restore(ctx context.Context) ([]*model.Session, error) {
+	since := time.Now().UTC().Add(-s.idleTimeout)
+	if _, err := s.repo.DeleteIdle(ctx, since); err != nil {
+		return nil, err
+	}
+	return s.repo.GetActive(ctx, since)
+}
+
+func (s *Session) Expired(session *model.Session, now time.Time) bool {
+	return now.Sub(session.LastSeenAt) > s.idleTimeout
+}
+
+// Touch saves the activity of the chat. It's saved at most once a sessionTouchInterval,
+// so LastSeenAt of the session may be behind by this interval. It returns false if the session has ended
+// in another process, e.g. the user was deleted by the command line, then the chat must log in again
+func (s *Session) Touch(ctx context.Context, session *model.Session, now time.Time) (bool, error) {
+	if now.Sub(session.LastSeenAt) < sessionTouchInterval {
+		return s.repo.Exists(ctx, session.Username, session.ChatID)
+	}
+	ok, err := s.repo.Touch(ctx, session.Username, session.ChatID, now)
+	if err != nil || !ok {
+		return false, err
+	}
+	session.LastSeenAt = now
+	return true, nil
+}
+
+// End logs the chat out, it returns false if the user doesn't have a session in the chat
+func (s *Session) End(ctx context.Context, username string, chatID int64) (bool, error) {
+	return s.repo.Delete(ctx, username, chatID)
+}
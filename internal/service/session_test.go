@@ -0,0 +1,148 @@
+package service
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/chucky-1/finance/internal/model"
+)
+
+// fakeSessions keeps sessions by chats
+type fakeSessions struct {
+	mu       sync.Mutex
+	sessions map[int64]*model.Session
+	touches  int
+}
+
+func (f *fakeSessions) Create(_ context.Context, session *model.Session) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	copied := *session
+	f.sessions[session.ChatID] = &copied
+	return nil
+}
+
+func (f *fakeSessions) GetAll(_ context.Context, username string) ([]*model.Session, error) {
+	return f.filter(func(s *model.Session) bool { return s.Username == username }), nil
+}
+
+func (f *fakeSessions) GetActive(_ context.Context, since time.Time) ([]*model.Session, error) {
+	return f.filter(func(s *model.Session) bool { return !s.LastSeenAt.Before(since) }), nil
+}
+
+func (f *fakeSessions) Touch(_ context.Context, username string, chatID int64, now time.Time) (bool, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.touches++
+	session, ok := f.sessions[chatID]
+	if !ok || session.Username != username {
+		return false, nil
+	}
+	session.LastSeenAt = now
+	return true, nil
+}
+
+func (f *fakeSessions) Exists(_ context.Context, username string, chatID int64) (bool, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	session, ok := f.sessions[chatID]
+	return ok && session.Username == username, nil
+}
+
+func (f *fakeSessions) Delete(_ context.Context, username string, chatID int64) (bool, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	session, ok := f.sessions[chatID]
+	if !ok || session.Username != username {
+		return false, nil
+	}
+	delete(f.sessions, chatID)
+	return true, nil
+}
+
+func (f *fakeSessions) DeleteIdle(_ context.Context, before time.Time) (int64, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	var deleted int64
+	for chatID, session := range f.sessions {
+		if session.LastSeenAt.Before(before) {
+			delete(f.sessions, chatID)
+			deleted++
+		}
+	}
+	return deleted, nil
+}
+
+func (f *fakeSessions) filter(keep func(*model.Session) bool) []*model.Session {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	sessions := make([]*model.Session, 0)
+	for _, session := range f.sessions {
+		if keep(session) {
+			copied := *session
+			sessions = append(sessions, &copied)
+		}
+	}
+	return sessions
+}
+
+func TestSession_ListAndRestoreSkipIdle(t *testing.T) {
+	ctx := context.Background()
+	now := time.Now().UTC()
+	repo := &fakeSessions{sessions: map[int64]*model.Session{
+		1: {ChatID: 1, Username: "dima", CreatedAt: now.Add(-48 * time.Hour), LastSeenAt: now.Add(-25 * time.Hour)},
+		2: {ChatID: 2, Username: "dima", CreatedAt: now.Add(-48 * time.Hour), LastSeenAt: now.Add(-time.Hour)},
+	}}
+	sessions := NewSession(repo, 24*time.Hour)
+
+	list, err := sessions.List(ctx, "dima")
+	require.NoError(t, err)
+	require.Len(t, list, 1)
+	require.Equal(t, int64(2), list[0].ChatID)
+
+	restored, err := sessions.Restore(ctx)
+	require.NoError(t, err)
+	require.Len(t, restored, 1)
+	require.Equal(t, int64(2), restored[0].ChatID)
+	require.NotContains(t, repo.sessions, int64(1))
+}
+
+func TestSession_Touch(t *testing.T) {
+	ctx := context.Background()
+	repo := &fakeSessions{sessions: make(map[int64]*model.Session)}
+	sessions := NewSession(repo, 24*time.Hour)
+	session, err := sessions.Start(ctx, "dima", 1)
+	require.NoError(t, err)
+
+	ok, err := sessions.Touch(ctx, session, session.LastSeenAt.Add(time.Second))
+	require.NoError(t, err)
+	require.True(t, ok)
+	require.Equal(t, 0, repo.touches)
+	now := session.LastSeenAt.Add(2 * sessionTouchInterval)
+	ok, err = sessions.Touch(ctx, session, now)
+	require.NoError(t, err)
+	require.True(t, ok)
+	require.Equal(t, 1, repo.touches)
+	require.Equal(t, now, session.LastSeenAt)
+
+	require.False(t, sessions.Expired(session, now.Add(24*time.Hour)))
+	require.True(t, sessions.Expired(session, now.Add(25*time.Hour)))
+
+	ok, err = sessions.End(ctx, "anna", 1)
+	require.NoError(t, err)
+	require.False(t, ok)
+	ok, err = sessions.End(ctx, "dima", 1)
+	require.NoError(t, err)
+	require.True(t, ok)
+	// the session ended elsewhere, the chat finds it out by the next message
+	ok, err = sessions.Touch(ctx, session, now.Add(time.Second))
+	require.NoError(t, err)
+	require.False(t, ok)
+	ok, err = sessions.Touch(ctx, session, now.Add(2*sessionTouchInterval))
+	require.NoError(t, err)
+	require.False(t, ok)
+}
@@ -0,0 +1,141 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/sirupsen/logrus"
+
+	"github.com/chucky-1/finance/internal/i18n"
+	"github.com/chucky-1/finance/internal/model"
+	"github.com/chucky-1/finance/internal/repository"
+)
+
+// MaxMonthlyReportDay is the last day of the month when the monthly report may be delivered, every month has it
+const MaxMonthlyReportDay = 28
+
+var (
+	InvalidReportTimeErr = errors.New("report time is out of range")
+	InvalidMonthStartErr = errors.New("month start must be from 1 to 28")
+	InvalidLanguageErr   = errors.New("language isn't supported")
+)
+
+// Settings changes the profile of the user after the registration
+type Settings struct {
+	users    repository.User
+	reporter *Reporter
+	recorder *Recorder
+}
+
+func NewSettings(users repository.User, reporter *Reporter, recorder *Recorder) *Settings {
+	return &Settings{
+		users:    users,
+		reporter: reporter,
+		recorder: recorder,
+	}
+}
+
+// Profile returns UserNotFoundErr if there is no such user
+func (s *Settings) Profile(ctx context.Context, username string) (*model.User, error) {
+	user, err := s.users.Get(ctx, username)
+	if err != nil {
+		return nil, err
+	}
+	if user == nil {
+		return nil, UserNotFoundErr
+	}
+	return user, nil
+}
+
+// ChangeTimezone saves the country and the timezone of the user, reports are scheduled by the new timezone right away
+func (s *Settings) ChangeTimezone(ctx context.Context, username, country string, timezone *time.Location) error {
+	ok, err := s.users.UpdateTimezone(ctx, username, country, timezone.String())
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return UserNotFoundErr
+	}
+	s.reporter.SetTimezone(timezone, username, time.Now().UTC())
+	return nil
+}
+
+// Timezone returns the current timezone of the user, it's false if the reporter doesn't know the user
+func (s *Settings) Timezone(username string) (*time.Location, bool) {
+	return s.reporter.Timezone(username)
+}
+
+// ChangeReportTime saves when reports of the user are delivered, it returns InvalidReportTimeErr if the daily report
+// isn't within the day or the monthly report is later than the 28th day
+func (s *Settings) ChangeReportTime(ctx context.Context, username string, reportTime model.ReportTime) error {
+	if reportTime.Daily < 0 || reportTime.Daily >= 24*time.Hour ||
+		reportTime.Monthly < 0 || reportTime.Monthly >= MaxMonthlyReportDay*24*time.Hour {
+		return InvalidReportTimeErr
+	}
+	ok, err := s.users.UpdateReportTime(ctx, username, reportTime)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return UserNotFoundErr
+	}
+	s.reporter.SetReportTime(username, reportTime)
+	return nil
+}
+
+// ChangeMonthStart moves expenses of the current month to the new months and saves the day when financial months
+// of the user begin, the next monthly report is about the new month. The expenses are moved back if it fails,
+// so the user keeps the previous start. It returns InvalidMonthStartErr if the day is out of range
+func (s *Settings) ChangeMonthStart(ctx context.Context, username string, monthStart int) error {
+	if monthStart < 1 || monthStart > MaxMonthlyReportDay {
+		return InvalidMonthStartErr
+	}
+	timezone, ok := s.reporter.Timezone(username)
+	if !ok {
+		return UserNotFoundErr
+	}
+	previous := s.reporter.MonthStart(username)
+	now := time.Now().UTC()
+	err := s.recorder.ChangeMonthStart(ctx, username, timezone, previous, monthStart, now)
+	if err == nil {
+		ok, err = s.users.UpdateMonthStart(ctx, username, monthStart)
+		if err == nil && !ok {
+			err = UserNotFoundErr
+		}
+	}
+	if err != nil {
+		if undoErr := s.recorder.ChangeMonthStart(ctx, username, timezone, monthStart, previous, now); undoErr != nil {
+			logrus.Errorf("settings service couldn't move expenses of %s back to months from the %d: %v", username, previous, undoErr)
+		}
+		return err
+	}
+	s.reporter.SetMonthStart(username, monthStart, now)
+	return nil
+}
+
+// MonthStart returns the day when financial months of the user begin, 0 is the calendar month
+func (s *Settings) MonthStart(username string) int {
+	return s.reporter.MonthStart(username)
+}
+
+// ChangeLanguage saves the language of messages and reports of the user, it returns InvalidLanguageErr if the language isn't supported
+func (s *Settings) ChangeLanguage(ctx context.Context, username string, language i18n.Language) error {
+	if _, ok := i18n.Parse(string(language)); !ok {
+		return InvalidLanguageErr
+	}
+	ok, err := s.users.UpdateLanguage(ctx, username, string(language))
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return UserNotFoundErr
+	}
+	s.reporter.SetLanguage(username, language)
+	return nil
+}
+
+// Language returns the language of messages and reports of the user, the empty one is Russian
+func (s *Settings) Language(username string) i18n.Language {
+	return s.reporter.Language(username)
+}
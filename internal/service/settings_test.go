@@ -0,0 +1,154 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+
+	"github.com/chucky-1/finance/internal/i18n"
+	"github.com/chucky-1/finance/internal/model"
+	"github.com/chucky-1/finance/internal/repository/mocks"
+)
+
+func TestSettings_ChangeTimezone(t *testing.T) {
+	ctx := context.Background()
+	userRepo := new(mocks.User)
+	userRepo.On("UpdateTimezone", mock.Anything, "dima", "Georgia", "Asia/Tbilisi").Return(true, nil)
+	userRepo.On("UpdateTimezone", mock.Anything, "anna", mock.Anything, mock.Anything).Return(false, nil)
+	reporter := NewReporter(nil, nil, nil, nil, nil)
+	reporter.AddTimezone(location(t, "Europe/Minsk"), "dima")
+	settings := NewSettings(userRepo, reporter, nil)
+
+	require.NoError(t, settings.ChangeTimezone(ctx, "dima", "Georgia", location(t, "Asia/Tbilisi")))
+	timezone, ok := settings.Timezone("dima")
+	require.True(t, ok)
+	require.Equal(t, "Asia/Tbilisi", timezone.String())
+
+	require.Equal(t, UserNotFoundErr, settings.ChangeTimezone(ctx, "anna", "Georgia", location(t, "Asia/Tbilisi")))
+	_, ok = settings.Timezone("anna")
+	require.False(t, ok)
+}
+
+func TestSettings_ChangeReportTime(t *testing.T) {
+	ctx := context.Background()
+	reportTime := model.ReportTime{Daily: 21 * time.Hour, Monthly: 33 * time.Hour}
+	userRepo := new(mocks.User)
+	userRepo.On("UpdateReportTime", mock.Anything, "dima", reportTime).Return(true, nil)
+	userRepo.On("UpdateReportTime", mock.Anything, "anna", mock.Anything).Return(false, nil)
+	reporter := NewReporter(nil, nil, nil, nil, nil)
+	settings := NewSettings(userRepo, reporter, nil)
+
+	require.NoError(t, settings.ChangeReportTime(ctx, "dima", reportTime))
+	require.Equal(t, reportTime, reporter.timezones.reportTimes["dima"])
+	require.Equal(t, UserNotFoundErr, settings.ChangeReportTime(ctx, "anna", reportTime))
+
+	for _, invalid := range []model.ReportTime{{Daily: 24 * time.Hour}, {Daily: -time.Minute}, {Monthly: 28 * 24 * time.Hour}} {
+		require.Equal(t, InvalidReportTimeErr, settings.ChangeReportTime(ctx, "dima", invalid))
+	}
+	userRepo.AssertNumberOfCalls(t, "UpdateReportTime", 2)
+}
+
+func TestSettings_ChangeMonthStart(t *testing.T) {
+	ctx := context.Background()
+	userRepo := new(mocks.User)
+	userRepo.On("UpdateMonthStart", mock.Anything, "dima", 10).Return(true, nil)
+	reporter := NewReporter(nil, nil, nil, nil, nil)
+	reporter.AddTimezone(location(t, "Europe/Minsk"), "dima")
+	periods := &fakePeriods{periods: make(map[string]map[string]float64)}
+	settings := NewSettings(userRepo, reporter, NewRecorder(periods, periods))
+
+	require.NoError(t, settings.ChangeMonthStart(ctx, "dima", 10))
+	require.Equal(t, 10, settings.MonthStart("dima"))
+	require.Equal(t, InvalidMonthStartErr, settings.ChangeMonthStart(ctx, "dima", 29))
+	require.Equal(t, InvalidMonthStartErr, settings.ChangeMonthStart(ctx, "dima", 0))
+	require.Equal(t, UserNotFoundErr, settings.ChangeMonthStart(ctx, "anna", 10))
+	userRepo.AssertNumberOfCalls(t, "UpdateMonthStart", 1)
+}
+
+func TestSettings_ChangeMonthStartFailed(t *testing.T) {
+	ctx := context.Background()
+	minsk := location(t, "Europe/Minsk")
+	now := time.Now().In(minsk)
+	// expenses of the 3rd and the 12th are in the current calendar month and in two financial months from the 10th
+	month := time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, minsk).Format(monthlyPeriod)
+	previousMonth := time.Date(now.Year(), now.Month()-1, 10, 0, 0, 0, 0, minsk).Format(financialPeriod)
+	nextMonth := time.Date(now.Year(), now.Month(), 10, 0, 0, 0, 0, minsk).Format(financialPeriod)
+
+	testTable := []struct {
+		name       string
+		failPeriod string
+		updateErr  error
+	}{
+		{
+			name:       "Expenses aren't moved",
+			failPeriod: nextMonth,
+		},
+		{
+			name:      "Month start isn't saved",
+			updateErr: errors.New("postgres is unavailable"),
+		},
+	}
+
+	for _, testCase := range testTable {
+		t.Run(testCase.name, func(t *testing.T) {
+			userRepo := new(mocks.User)
+			userRepo.On("UpdateMonthStart", mock.Anything, "dima", 10).Return(testCase.updateErr == nil, testCase.updateErr)
+			reporter := NewReporter(nil, nil, nil, nil, nil)
+			reporter.AddTimezone(minsk, "dima")
+			periods := &fakePeriods{periods: make(map[string]map[string]float64)}
+			recorder := NewRecorder(periods, periods)
+			for _, day := range []int{3, 12} {
+				entry := &model.Entry{Kind: "expenses", User: "dima", Date: time.Date(now.Year(), now.Month(), day, 12, 0, 0, 0, time.UTC),
+					Category: &model.Category{Name: "Кофе", Amount: float64(day)}}
+				require.NoError(t, recorder.Add(ctx, entry, minsk, 0))
+			}
+			periods.failPeriod = testCase.failPeriod
+			settings := NewSettings(userRepo, reporter, recorder)
+
+			require.Error(t, settings.ChangeMonthStart(ctx, "dima", 10))
+			require.Equal(t, 0, settings.MonthStart("dima"))
+			require.Equal(t, 15.0, periods.periods[month]["Кофе"])
+			require.Zero(t, periods.periods[previousMonth]["Кофе"])
+			require.Zero(t, periods.periods[nextMonth]["Кофе"])
+			for _, entry := range periods.entries {
+				require.Equal(t, month, entry.MonthKey)
+			}
+			if testCase.updateErr == nil {
+				userRepo.AssertNotCalled(t, "UpdateMonthStart", mock.Anything, mock.Anything, mock.Anything)
+			}
+		})
+	}
+}
+
+func TestSettings_ChangeLanguage(t *testing.T) {
+	ctx := context.Background()
+	userRepo := new(mocks.User)
+	userRepo.On("UpdateLanguage", mock.Anything, "dima", "pl").Return(true, nil)
+	userRepo.On("UpdateLanguage", mock.Anything, "anna", mock.Anything).Return(false, nil)
+	reporter := NewReporter(nil, nil, nil, nil, nil)
+	settings := NewSettings(userRepo, reporter, nil)
+
+	require.Equal(t, i18n.Language(""), settings.Language("dima"))
+	require.NoError(t, settings.ChangeLanguage(ctx, "dima", i18n.Polish))
+	require.Equal(t, i18n.Polish, settings.Language("dima"))
+	require.Equal(t, UserNotFoundErr, settings.ChangeLanguage(ctx, "anna", i18n.Polish))
+	require.Equal(t, InvalidLanguageErr, settings.ChangeLanguage(ctx, "dima", "de"))
+	userRepo.AssertNumberOfCalls(t, "UpdateLanguage", 2)
+}
+
+func TestSettings_Profile(t *testing.T) {
+	userRepo := new(mocks.User)
+	userRepo.On("Get", mock.Anything, "dima").Return(&model.User{Username: "dima"}, nil)
+	userRepo.On("Get", mock.Anything, "anna").Return(nil, nil)
+	settings := NewSettings(userRepo, nil, nil)
+
+	user, err := settings.Profile(context.Background(), "dima")
+	require.NoError(t, err)
+	require.Equal(t, "dima", user.Username)
+	_, err = settings.Profile(context.Background(), "anna")
+	require.Equal(t, UserNotFoundErr, err)
+}
@@ -0,0 +1,109 @@
+package service
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"github.com/chucky-1/finance/internal/model"
+	"github.com/chucky-1/finance/internal/repository"
+	"time"
+)
+
+const (
+	// telegram allows up to 64 characters in the start parameter, the token takes 32
+	nonceLength     = 12
+	signatureLength = 12
+	tokenTTL        = 24 * time.Hour
+)
+
+var InvalidTokenErr = errors.New("subscription token is invalid, used or expired")
+
+type Subscription struct {
+	repo   repository.Subscription
+	tokens repository.SubscriptionToken
+	secret []byte
+}
+
+func NewSubscription(repo repository.Subscription, tokens repository.SubscriptionToken, secret string) *Subscription {
+	return &Subscription{
+		repo:   repo,
+		tokens: tokens,
+		secret: []byte(secret),
+	}
+}
+
+func (s *Subscription) Subscribe(ctx context.Context, username, period string, chatID int64) error {
+	return s.repo.Set(ctx, &model.Subscription{
+		Username: username,
+		Period:   period,
+		ChatID:   chatID,
+	})
+}
+
+func (s *Subscription) Unsubscribe(ctx context.Context, username, period string) error {
+	return s.repo.Delete(ctx, username, period)
+}
+
+// ChatID returns false if the user isn't subscribed on reports of the period
+func (s *Subscription) ChatID(ctx context.Context, username, period string) (int64, bool, error) {
+	subscription, err := s.repo.Get(ctx, username, period)
+	if err != nil {
+		return 0, false, err
+	}
+	if subscription == nil {
+		return 0, false, nil
+	}
+	return subscription.ChatID, true, nil
+}
+
+// IssueToken returns a signed one-time token for a deep link to the reporter bot of the period
+func (s *Subscription) IssueToken(ctx context.Context, username, period string) (string, error) {
+	nonce := make([]byte, nonceLength)
+	if _, err := rand.Read(nonce); err != nil {
+		return "", fmt.Errorf("couldn't generate nonce: %v", err)
+	}
+	encodedNonce := base64.RawURLEncoding.EncodeToString(nonce)
+	if err := s.tokens.Add(ctx, encodedNonce, username, period, time.Now().UTC().Add(tokenTTL)); err != nil {
+		return "", err
+	}
+	return encodedNonce + s.sign(encodedNonce, period), nil
+}
+
+// Redeem subscribes the chat of the reporter bot to the user the token was issued for and returns the username
+func (s *Subscription) Redeem(ctx context.Context, token, period string, chatID int64) (string, error) {
+	nonce, ok := s.verify(token, period)
+	if !ok {
+		return "", InvalidTokenErr
+	}
+	username, err := s.tokens.Use(ctx, nonce, period, time.Now().UTC())
+	if err != nil {
+		return "", err
+	}
+	if username == "" {
+		return "", InvalidTokenErr
+	}
+	return username, s.Subscribe(ctx, username, period, chatID)
+}
+
+func (s *Subscription) sign(nonce, period string) string {
+	mac := hmac.New(sha256.New, s.secret)
+	mac.Write([]byte(nonce + period))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil)[:signatureLength])
+}
+
+// verify checks the signature of the token and returns its nonce
+func (s *Subscription) verify(token, period string) (string, bool) {
+	nonceSize := base64.RawURLEncoding.EncodedLen(nonceLength)
+	if len(token) != nonceSize+base64.RawURLEncoding.EncodedLen(signatureLength) {
+		return "", false
+	}
+	nonce, signature := token[:nonceSize], token[nonceSize:]
+	if !hmac.Equal([]byte(signature), []byte(s.sign(nonce, period))) {
+		return "", false
+	}
+	return nonce, true
+}
@@ -0,0 +1,62 @@
+package service
+
+import (
+	"github.com/stretchr/testify/require"
+	"testing"
+)
+
+func TestSubscription_SignVerify(t *testing.T) {
+	subscription := NewSubscription(nil, nil, "secret")
+	nonce := "AAECAwQFBgcICQoL"
+	token := nonce + subscription.sign(nonce, DailyReport)
+	require.LessOrEqual(t, len(token), 64)
+
+	testTable := []struct {
+		name   string
+		token  string
+		period string
+		ok     bool
+	}{
+		{
+			name:   "Valid",
+			token:  token,
+			period: DailyReport,
+			ok:     true,
+		},
+		{
+			name:   "Another period",
+			token:  token,
+			period: MonthlyReport,
+			ok:     false,
+		},
+		{
+			name:   "Forged nonce",
+			token:  "BAECAwQFBgcICQoL" + token[len(nonce):],
+			period: DailyReport,
+			ok:     false,
+		},
+		{
+			name:   "Wrong length",
+			token:  token[1:],
+			period: DailyReport,
+			ok:     false,
+		},
+	}
+
+	for _, testCase := range testTable {
+		t.Run(testCase.name, func(t *testing.T) {
+			n, ok := subscription.verify(testCase.token, testCase.period)
+			require.Equal(t, testCase.ok, ok)
+			if ok {
+				require.Equal(t, nonce, n)
+			}
+		})
+	}
+}
+
+func TestSubscription_SignWithAnotherSecret(t *testing.T) {
+	nonce := "AAECAwQFBgcICQoL"
+	token := nonce + NewSubscription(nil, nil, "secret").sign(nonce, DailyReport)
+	_, ok := NewSubscription(nil, nil, "another secret").verify(token, DailyReport)
+	require.False(t, ok)
+}
@@ -0,0 +1,28 @@
+package service
+
+import (
+	"fmt"
+	"sync"
+	"time"
+	// zones are embedded into the binary, so they don't depend on the system
+	_ "time/tzdata"
+)
+
+// locations caches loaded timezones by their names
+var locations sync.Map
+
+// LoadLocation returns the IANA timezone by its name, e.g. Europe/Warsaw
+func LoadLocation(name string) (*time.Location, error) {
+	if location, ok := locations.Load(name); ok {
+		return location.(*time.Location), nil
+	}
+	if name == "" || name == "Local" {
+		return nil, fmt.Errorf("couldn't load timezone %q: the name of a zone is expected", name)
+	}
+	location, err := time.LoadLocation(name)
+	if err != nil {
+		return nil, fmt.Errorf("couldn't load timezone %q: %v", name, err)
+	}
+	locations.Store(name, location)
+	return location, nil
+}
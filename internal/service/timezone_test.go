@@ -0,0 +1,17 @@
+package service
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestLoadLocation(t *testing.T) {
+	warsaw, err := LoadLocation("Europe/Warsaw")
+	require.NoError(t, err)
+	require.Equal(t, "Europe/Warsaw", warsaw.String())
+	_, err = LoadLocation("Europe/Atlantis")
+	require.Error(t, err)
+	_, err = LoadLocation("")
+	require.Error(t, err)
+}
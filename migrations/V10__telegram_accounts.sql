@@ -0,0 +1 @@
+ALTER TABLE finance.users ADD COLUMN tg_user_id bigint UNIQUE;
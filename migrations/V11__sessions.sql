@@ -0,0 +1,9 @@
+CREATE TABLE finance.sessions
+(
+    chat_id      bigint PRIMARY KEY,
+    username     varchar(15) NOT NULL REFERENCES finance.users ON DELETE CASCADE,
+    created_at   timestamptz NOT NULL,
+    last_seen_at timestamptz NOT NULL
+);
+
+CREATE INDEX sessions_username_idx ON finance.sessions (username);
@@ -0,0 +1,15 @@
+-- timezones were fixed offsets, the countries of the bot are mapped to their IANA names,
+-- other whole-hour offsets keep the offset without daylight saving time
+ALTER TABLE finance.users ALTER COLUMN timezone TYPE text USING CASE
+    WHEN country = 'Belarus' THEN 'Europe/Minsk'
+    WHEN country = 'Russia' THEN 'Europe/Moscow'
+    WHEN country = 'Poland' THEN 'Europe/Warsaw'
+    WHEN country = 'Ukraine' THEN 'Europe/Kyiv'
+    WHEN country = 'Georgia' THEN 'Asia/Tbilisi'
+    WHEN country = 'Sri Lanka' THEN 'Asia/Colombo'
+    WHEN country = 'USA' THEN 'America/Los_Angeles'
+    WHEN timezone = interval '0' OR extract(minute FROM timezone) <> 0 THEN 'UTC'
+    -- the sign of Etc/GMT zones is inverted, Etc/GMT-3 is GMT+3
+    WHEN timezone > interval '0' THEN 'Etc/GMT-' || extract(hour FROM timezone)::int
+    ELSE 'Etc/GMT+' || extract(hour FROM -timezone)::int
+END;
@@ -0,0 +1,5 @@
+ALTER TABLE finance.users
+    ADD COLUMN daily_report_time interval NOT NULL DEFAULT '0'
+        CHECK (daily_report_time >= interval '0' AND daily_report_time < interval '24 hours'),
+    ADD COLUMN monthly_report_time interval NOT NULL DEFAULT '0'
+        CHECK (monthly_report_time >= interval '0' AND monthly_report_time < interval '28 days');
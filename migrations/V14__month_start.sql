@@ -0,0 +1,2 @@
+-- 0 is the calendar month like 1, the financial month can't begin on a day which some months don't have
+ALTER TABLE finance.users ADD COLUMN month_start smallint NOT NULL DEFAULT 0 CHECK (month_start BETWEEN 0 AND 28);
@@ -0,0 +1,2 @@
+-- the empty language is Russian, the language of users who registered before languages appeared
+ALTER TABLE finance.users ADD COLUMN language text NOT NULL DEFAULT '' CHECK (language IN ('', 'ru', 'en', 'pl'));
@@ -0,0 +1,29 @@
+-- ledgers are budgets shared by several users, their entries are kept in mongo under the key ledger:<id>
+CREATE TABLE finance.ledgers
+(
+    id         bigserial PRIMARY KEY,
+    name       varchar(32) NOT NULL,
+    owner      varchar(15) NOT NULL REFERENCES finance.users ON DELETE CASCADE,
+    created_at timestamptz NOT NULL
+);
+
+CREATE TABLE finance.ledger_members
+(
+    ledger_id bigint      NOT NULL REFERENCES finance.ledgers ON DELETE CASCADE,
+    username  varchar(15) NOT NULL REFERENCES finance.users ON DELETE CASCADE,
+    role      varchar(6)  NOT NULL CHECK (role IN ('owner', 'editor', 'viewer')),
+    joined_at timestamptz NOT NULL,
+    PRIMARY KEY (ledger_id, username)
+);
+
+CREATE INDEX ledger_members_username_idx ON finance.ledger_members (username);
+
+-- only hashes of invite codes are stored, a code adds one member with the role
+CREATE TABLE finance.ledger_invites
+(
+    hash       char(64)    PRIMARY KEY,
+    ledger_id  bigint      NOT NULL REFERENCES finance.ledgers ON DELETE CASCADE,
+    role       varchar(6)  NOT NULL CHECK (role IN ('editor', 'viewer')),
+    expires_at timestamptz NOT NULL,
+    used_at    timestamptz
+);
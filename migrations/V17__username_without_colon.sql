@@ -0,0 +1,4 @@
+-- entries of ledgers are kept in mongo under the key ledger:<id> instead of a username, so usernames can't have a colon.
+-- New accounts have only latin letters, digits and _, old ones keep their usernames unless they have a colon,
+-- then the migration fails and the user must be renamed first
+ALTER TABLE finance.users ADD CONSTRAINT users_username_without_colon CHECK (position(':' IN username) = 0);
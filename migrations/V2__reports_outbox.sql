@@ -0,0 +1,17 @@
+CREATE TABLE finance.reports_outbox
+(
+    id              bigserial PRIMARY KEY,
+    username        varchar(15) NOT NULL,
+    period          varchar(10) NOT NULL,
+    report          text        NOT NULL,
+    status          varchar(10) NOT NULL DEFAULT 'pending',
+    attempts        int         NOT NULL DEFAULT 0,
+    last_error      text        NOT NULL DEFAULT '',
+    -- reports which weren't tried yet have no last attempt
+    last_attempt_at timestamptz,
+    next_attempt_at timestamptz NOT NULL DEFAULT now(),
+    created_at      timestamptz NOT NULL DEFAULT now(),
+    delivered_at    timestamptz
+);
+
+CREATE INDEX reports_outbox_pending_idx ON finance.reports_outbox (next_attempt_at) WHERE status = 'pending';
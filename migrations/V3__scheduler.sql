@@ -0,0 +1,5 @@
+CREATE TABLE finance.scheduler
+(
+    name      varchar(32) PRIMARY KEY,
+    last_tick timestamptz NOT NULL
+)
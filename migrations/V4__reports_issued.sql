@@ -0,0 +1,10 @@
+CREATE TABLE finance.reports_issued
+(
+    username   varchar(15) NOT NULL,
+    period     varchar(10) NOT NULL,
+    period_key varchar(10) NOT NULL,
+    issued_at  timestamptz NOT NULL DEFAULT now(),
+    PRIMARY KEY (username, period, period_key)
+);
+
+ALTER TABLE finance.reports_outbox ADD COLUMN period_key varchar(10) NOT NULL DEFAULT '';
@@ -0,0 +1,7 @@
+CREATE TABLE finance.report_subscriptions
+(
+    username varchar(15) NOT NULL,
+    period   varchar(10) NOT NULL,
+    chat_id  bigint      NOT NULL,
+    PRIMARY KEY (username, period)
+)
@@ -0,0 +1,8 @@
+CREATE TABLE finance.subscription_tokens
+(
+    nonce      varchar(16) PRIMARY KEY,
+    username   varchar(15) NOT NULL,
+    period     varchar(10) NOT NULL,
+    expires_at timestamptz NOT NULL,
+    used_at    timestamptz
+)
@@ -0,0 +1,10 @@
+CREATE TABLE finance.api_tokens
+(
+    username     varchar(15) NOT NULL REFERENCES finance.users ON DELETE CASCADE,
+    name         varchar(32) NOT NULL,
+    hash         char(64)    NOT NULL UNIQUE,
+    scope        varchar(5)  NOT NULL,
+    created_at   timestamptz NOT NULL,
+    last_used_at timestamptz,
+    PRIMARY KEY (username, name)
+)
@@ -0,0 +1 @@
+ALTER TABLE finance.users ALTER COLUMN password TYPE varchar(255);
@@ -0,0 +1,9 @@
+CREATE TABLE finance.login_attempts
+(
+    key             varchar(64) PRIMARY KEY,
+    failures        int         NOT NULL,
+    last_failure_at timestamptz NOT NULL,
+    locked_until    timestamptz
+);
+
+ALTER TABLE finance.users ADD COLUMN chat_id bigint NOT NULL DEFAULT 0;
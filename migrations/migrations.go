@@ -0,0 +1,8 @@
+// Package migrations keeps the schema of postgres in files named like V1__users_table.sql
+// and data migrations of mongo. The binary embeds them, so they're applied without flyway
+package migrations
+
+import "embed"
+
+//go:embed *.sql
+var Postgres embed.FS
@@ -0,0 +1,26 @@
+package migrations
+
+import (
+	"context"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+
+	"github.com/chucky-1/finance/internal/migration"
+)
+
+// Mongo must only be appended, versions of applied migrations are kept in the database
+var Mongo = []*migration.MongoMigration{
+	{
+		Version:     1,
+		Description: "entries_user_date_index",
+		Up: func(ctx context.Context, cli *mongo.Client) error {
+			_, err := cli.Database("expenses").Collection("entries").Indexes().CreateOne(ctx, mongo.IndexModel{
+				Keys:    bson.D{{Key: "user", Value: 1}, {Key: "date", Value: 1}},
+				Options: options.Index().SetName("user_date"),
+			})
+			return err
+		},
+	},
+}